@@ -7,17 +7,16 @@ import (
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
 	"github.com/rs/zerolog"
-	"gopkg.in/yaml.v2"
 	v1 "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	"example"
+	"example/matchers"
 )
 
-var _ = ginkgo.Describe("Deployment Anti Affinity E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), func() {
+var _ = ginkgo.Describe("Deployment Anti Affinity E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("DeploymentAntiAffinityTest"), func() {
 	var (
 		clientset      *kubernetes.Clientset
 		hpaMaxReplicas int32
@@ -32,37 +31,16 @@ var _ = ginkgo.Describe("Deployment Anti Affinity E2E test", ginkgo.Ordered, gin
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 		logger = example.GetLogger(testTag)
-
-		// Namespace setup
-		logger.Info().Msgf("=== Ensuring test-ns exists ===")
-		_, err = clientset.CoreV1().Namespaces().Get(
-			context.TODO(),
-			"test-ns",
-			metav1.GetOptions{},
-		)
-
-		if apierrors.IsNotFound(err) {
-			logger.Info().Msgf("Creating test-ns namespace\n")
-			ns := &v1.Namespace{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "test-ns",
-				},
-			}
-			_, err = clientset.CoreV1().Namespaces().Create(
-				context.TODO(),
-				ns,
-				metav1.CreateOptions{},
-			)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		} else {
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		}
 	})
 
 	ginkgo.AfterEach(func() {
 		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
 		if ginkgo.CurrentSpecReport().Failed() {
 			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+			// What the pods actually used tells a load problem apart from a scaling problem
+			if usage, err := example.SnapshotUsage(context.TODO(), clientset, example.TestNamespace()); err == nil {
+				example.RecordMetric(testTag, "usage_on_failure", usage)
+			}
 		}
 
 	})
@@ -79,17 +57,9 @@ var _ = ginkgo.Describe("Deployment Anti Affinity E2E test", ginkgo.Ordered, gin
 		hpaYAML, zoneYAML, depYAML, err := example.GetAntiAffinityTestFiles()
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
-		// Parse HPA YAML to extract maxReplicas
-		type hpaSpec struct {
-			Spec struct {
-				MaxReplicas int32 `yaml:"maxReplicas"`
-			} `yaml:"spec"`
-		}
-
-		var hpaConfig hpaSpec
-		err = yaml.Unmarshal([]byte(hpaYAML), &hpaConfig)
+		hpa, err := example.ParseHPA(hpaYAML)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		hpaMaxReplicas = hpaConfig.Spec.MaxReplicas
+		hpaMaxReplicas = hpa.Spec.MaxReplicas
 
 		logger.Info().Msgf("=== Applying Zone Marker manifest ===")
 		err = example.ApplyRawManifest(clientset, zoneYAML)
@@ -103,35 +73,24 @@ var _ = ginkgo.Describe("Deployment Anti Affinity E2E test", ginkgo.Ordered, gin
 		err = example.ApplyRawManifest(clientset, hpaYAML)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
-		logger.Info().Msgf("=== Wait for HPA to trigger scaling ===")
-		deadline := time.Now().Add(5 * time.Minute)
-		pollInterval := 5 * time.Second
-
-		for {
-			// Get current pod count for StatefulSet
-			currentPods, err := clientset.CoreV1().Pods("test-ns").List(
-				context.TODO(),
-				metav1.ListOptions{
-					LabelSelector: "app=dependent-app",
-					FieldSelector: "status.phase=Running",
-				},
-			)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-
-			runningCount := len(currentPods.Items)
-			logger.Info().Msgf("Waiting for HPA, Current running pods: %d/%d\n", runningCount, hpaMaxReplicas)
-
-			if runningCount >= int(hpaMaxReplicas) {
-				logger.Info().Msgf("Waiting for HPA, Reached required pod count of %d\n", hpaMaxReplicas)
-				break
-			}
-
-			if time.Now().After(deadline) {
-				ginkgo.Fail("Failed to wait for the HPA to get to the maximum required pods")
-			}
+		// Without a sample for the first pod the HPA has no utilization to scale on
+		logger.Info().Msgf("=== Wait for metrics-server to report the dependent-app pods ===")
+		_, err = example.WaitForPodMetrics(context.TODO(), clientset, example.TestNamespace(), "app=dependent-app", 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Is metrics-server running?")
 
-			time.Sleep(pollInterval)
-		}
+		logger.Info().Msgf("=== Wait for HPA to trigger scaling ===")
+		_, err = example.WaitForHPAScaled(context.TODO(), clientset, example.TestNamespace(), "test-hpa", hpaMaxReplicas, 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Failed to wait for the HPA to get to the maximum required pods")
+
+		// The HPA counts Pending pods too, the zone checks need them placed. The shared informers report
+		// every pod change, so the wait ends as soon as the last one is ready.
+		var summary example.PodSummary
+		_, err = example.TestNamespaceInformers().WaitForPods(context.TODO(), "app=dependent-app", 3*time.Minute, func(pods []v1.Pod) bool {
+			summary = example.SummarizePods(pods)
+			return len(summary.Ready) >= int(hpaMaxReplicas)
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("Waiting for HPA, Reached required pod count of %d\n", len(summary.Ready))
 	})
 
 	ginkgo.It("should enforce zone separation between zone-marker and dependent-app", func() {
@@ -139,24 +98,22 @@ var _ = ginkgo.Describe("Deployment Anti Affinity E2E test", ginkgo.Ordered, gin
 
 		// Get zone-marker pod information
 		logger.Info().Msgf("=== Getting zone-marker pod details ===")
-		zoneMarkerPods, err := clientset.CoreV1().Pods("test-ns").List(
+		zoneMarkerPods, err := example.ListPods(
 			context.TODO(),
+			clientset,
+			example.TestNamespace(),
 			metav1.ListOptions{LabelSelector: "app=desired-zone-for-anti-affinity"},
 		)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		gomega.Expect(zoneMarkerPods.Items).NotTo(gomega.BeEmpty(), "No zone-marker pods found")
+		gomega.Expect(zoneMarkerPods).NotTo(gomega.BeEmpty(), "No zone-marker pods found")
+
+		zoneMap, err := example.NewZoneMap(context.TODO(), clientset)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 		// Collect all zones from zone-marker pods
 		var forbiddenZones []string
-		for _, zmPod := range zoneMarkerPods.Items {
-			node, err := clientset.CoreV1().Nodes().Get(
-				context.TODO(),
-				zmPod.Spec.NodeName,
-				metav1.GetOptions{},
-			)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-
-			zone := node.Labels["topology.kubernetes.io/zone"]
+		for _, zmPod := range zoneMarkerPods {
+			zone := zoneMap.ZoneOf(zmPod)
 			gomega.Expect(zone).NotTo(gomega.BeEmpty(),
 				"Zone label missing on node %s", zmPod.Spec.NodeName)
 
@@ -168,25 +125,20 @@ var _ = ginkgo.Describe("Deployment Anti Affinity E2E test", ginkgo.Ordered, gin
 
 		// Get dependent-app pods
 		logger.Info().Msgf("=== Getting dependent-app pods details ===")
-		dependentPods, err := clientset.CoreV1().Pods("test-ns").List(
+		dependentPods, err := example.ListPods(
 			context.TODO(),
+			clientset,
+			example.TestNamespace(),
 			metav1.ListOptions{LabelSelector: "app=dependent-app"},
 		)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		gomega.Expect(dependentPods.Items).NotTo(gomega.BeEmpty(), "No dependent-app pods found")
+		gomega.Expect(dependentPods).NotTo(gomega.BeEmpty(), "No dependent-app pods found")
 
 		// Verify zone separation
 		logger.Info().Msgf("=== Validating zone constraints ===")
 		var dependentAppZones []string
-		for _, depPod := range dependentPods.Items {
-			node, err := clientset.CoreV1().Nodes().Get(
-				context.TODO(),
-				depPod.Spec.NodeName,
-				metav1.GetOptions{},
-			)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-
-			podZone := node.Labels["topology.kubernetes.io/zone"]
+		for _, depPod := range dependentPods {
+			podZone := zoneMap.ZoneOf(depPod)
 			gomega.Expect(podZone).NotTo(gomega.BeEmpty(),
 				"Zone label missing on node %s", depPod.Spec.NodeName)
 
@@ -194,10 +146,8 @@ var _ = ginkgo.Describe("Deployment Anti Affinity E2E test", ginkgo.Ordered, gin
 				depPod.Name, depPod.Spec.NodeName, podZone)
 
 			dependentAppZones = append(dependentAppZones, podZone)
-
-			gomega.Expect(forbiddenZones).NotTo(gomega.ContainElement(podZone),
-				"Pod %s in prohibited zone %s", depPod.Name, podZone)
 		}
+		gomega.Expect(dependentPods).To(matchers.NotShareZoneWith(zoneMap, example.TestNamespace(), "app=desired-zone-for-anti-affinity"))
 		logger.Info().Msgf("Zone-Marker Zones (forbiddened for scheduling): %v\nDependent Pod Zones: %v\n", forbiddenZones, dependentAppZones)
 
 	})
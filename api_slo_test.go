@@ -0,0 +1,277 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("API server SLO E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("APIServerSLOTest"), func() {
+	var (
+		clientset   *kubernetes.Clientset
+		sloClient   *kubernetes.Clientset
+		requests    int
+		listObjects int
+		logger      zerolog.Logger
+		testTag     = "APIServerSLOTest"
+	)
+
+	const (
+		// Defaults follow the upstream API call latency SLO: p99 <= 1s for single-object calls and
+		// p99 <= 5s for namespace-scoped LISTs. All are overridable in .env
+		defaultRequests            = 100
+		defaultListObjects         = 50
+		defaultP99ThresholdMs      = 1000
+		defaultListP99ThresholdMs  = 5000
+		defaultMaxErrorRatePercent = 1.0
+		workers                    = 4
+		watchGracePeriod           = 10 * time.Second
+	)
+
+	envInt := func(name string, fallback int) int {
+		value := os.Getenv(name)
+		if value == "" {
+			return fallback
+		}
+		parsed, err := strconv.Atoi(value)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid %s: %s", name, value)
+		return parsed
+	}
+
+	envFloat := func(name string, fallback float64) float64 {
+		value := os.Getenv(name)
+		if value == "" {
+			return fallback
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid %s: %s", name, value)
+		return parsed
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The default client-side rate limit (5 QPS) would dominate the measured latencies
+		config, err := example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		config.QPS = 200
+		config.Burst = 400
+		sloClient, err = kubernetes.NewForConfig(config)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		requests = envInt("API_SLO_REQUESTS", defaultRequests)
+		listObjects = envInt("API_SLO_LIST_OBJECTS", defaultListObjects)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		sloClient.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should create the objects the requests target", func() {
+		logger.Info().Msgf("=== Starting API server SLO E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		configMapYAML, err := example.GetAPISLOTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Creating the target ConfigMap ===")
+		err = example.ApplyRawManifest(clientset, configMapYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The LISTs select app=api-slo, which the generated ConfigMaps carry too
+		seed, err := example.WorkloadSeed()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Generating %d ConfigMaps for LIST from seed %d ===", listObjects, seed)
+		workload := example.GenerateWorkload(example.TestNamespace(), seed, example.WorkloadMix{
+			ConfigMaps: listObjects,
+			Labels:     map[string]string{"app": "api-slo"},
+		})
+		err = workload.Create(context.TODO(), clientset)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should serve the request mix within the latency and error budgets", func() {
+		defer example.E2ePanicHandler()
+
+		configMaps := sloClient.CoreV1().ConfigMaps(example.TestNamespace())
+		listOptions := metav1.ListOptions{LabelSelector: "app=api-slo"}
+
+		// Every PATCH writes a unique seq, the watcher matches the events to the PATCH start times
+		initial, err := configMaps.List(context.TODO(), listOptions)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		watchOptions := listOptions
+		watchOptions.ResourceVersion = initial.ResourceVersion
+		watcher, err := configMaps.Watch(context.TODO(), watchOptions)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer watcher.Stop()
+
+		var mu sync.Mutex
+		latencies := map[string][]float64{}
+		failures := map[string]int{}
+		patchStarted := map[string]time.Time{}
+		watchReceived := map[string]time.Time{}
+
+		watchDone := make(chan struct{})
+		go func() {
+			defer close(watchDone)
+			for event := range watcher.ResultChan() {
+				received := time.Now()
+				configMap, ok := event.Object.(*v1.ConfigMap)
+				if event.Type != watch.Modified || !ok || configMap.Name != "api-slo-target" {
+					continue
+				}
+				mu.Lock()
+				if _, seen := watchReceived[configMap.Data["seq"]]; !seen {
+					watchReceived[configMap.Data["seq"]] = received
+				}
+				mu.Unlock()
+			}
+		}()
+
+		record := func(verb string, start time.Time, err error) {
+			elapsed := float64(time.Since(start).Microseconds()) / 1000
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failures[verb]++
+				logger.Error().Msgf("%s failed: %v", verb, err)
+				return
+			}
+			latencies[verb] = append(latencies[verb], elapsed)
+		}
+
+		// An even mix of GET, LIST and PATCH, interleaved so no verb runs in isolation
+		jobs := make(chan int)
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func(worker int) {
+				defer wg.Done()
+				for i := range jobs {
+					start := time.Now()
+					_, err := configMaps.Get(context.TODO(), "api-slo-target", metav1.GetOptions{})
+					record("GET", start, err)
+
+					start = time.Now()
+					_, err = configMaps.List(context.TODO(), listOptions)
+					record("LIST", start, err)
+
+					seq := fmt.Sprintf("%d-%d", worker, i)
+					patch := fmt.Sprintf(`{"data":{"seq":%q}}`, seq)
+					start = time.Now()
+					mu.Lock()
+					patchStarted[seq] = start
+					mu.Unlock()
+					_, err = configMaps.Patch(context.TODO(), "api-slo-target", types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+					record("PATCH", start, err)
+				}
+			}(w)
+		}
+
+		logger.Info().Msgf("=== Sending %d GET, LIST and PATCH requests each from %d workers ===", requests, workers)
+		started := time.Now()
+		for i := 0; i < requests; i++ {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		elapsed := time.Since(started)
+
+		// Give the watch time to deliver the last events before counting the missing ones
+		deadline := time.Now().Add(watchGracePeriod)
+		for {
+			mu.Lock()
+			pending := len(patchStarted) - failures["PATCH"] - len(watchReceived)
+			mu.Unlock()
+			if pending <= 0 || time.Now().After(deadline) {
+				break
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+		watcher.Stop()
+		<-watchDone
+
+		mu.Lock()
+		defer mu.Unlock()
+		for seq, start := range patchStarted {
+			received, ok := watchReceived[seq]
+			if !ok {
+				failures["WATCH"]++
+				continue
+			}
+			latencies["WATCH"] = append(latencies["WATCH"], float64(received.Sub(start).Microseconds())/1000)
+		}
+		// PATCH requests that failed never produce an event
+		failures["WATCH"] -= failures["PATCH"]
+
+		p99Threshold := envFloat("API_SLO_P99_THRESHOLD_MS", defaultP99ThresholdMs)
+		listP99Threshold := envFloat("API_SLO_LIST_P99_THRESHOLD_MS", defaultListP99ThresholdMs)
+		maxErrorRate := envFloat("API_SLO_MAX_ERROR_RATE_PERCENT", defaultMaxErrorRatePercent)
+
+		logger.Info().Msgf("=== %d requests per verb in %v ===", requests, elapsed.Round(time.Millisecond))
+		var violations []string
+		for _, verb := range []string{"GET", "LIST", "PATCH", "WATCH"} {
+			total := len(latencies[verb]) + failures[verb]
+			errorRate := 100 * float64(failures[verb]) / float64(total)
+			p50 := example.Percentile(latencies[verb], 50)
+			p95 := example.Percentile(latencies[verb], 95)
+			p99 := example.Percentile(latencies[verb], 99)
+			threshold := p99Threshold
+			if verb == "LIST" {
+				threshold = listP99Threshold
+			}
+			logger.Info().Msgf("%-5s total: %d, errors: %.1f%%, p50: %.1fms, p95: %.1fms, p99: %.1fms (budget p99 <= %.0fms)\n",
+				verb, total, errorRate, p50, p95, p99, threshold)
+
+			prefix := "api_" + strings.ToLower(verb)
+			example.RecordMetric(testTag, prefix+"_requests", total)
+			example.RecordMetric(testTag, prefix+"_error_rate_percent", errorRate)
+			example.RecordMetric(testTag, prefix+"_p50_ms", p50)
+			example.RecordMetric(testTag, prefix+"_p95_ms", p95)
+			example.RecordMetric(testTag, prefix+"_p99_ms", p99)
+
+			if p99 > threshold {
+				violations = append(violations, fmt.Sprintf("%s p99 %.1fms exceeds %.0fms", verb, p99, threshold))
+			}
+			if errorRate > maxErrorRate {
+				violations = append(violations, fmt.Sprintf("%s error rate %.1f%% exceeds %.1f%%", verb, errorRate, maxErrorRate))
+			}
+		}
+
+		if len(violations) > 0 {
+			ginkgo.Fail(fmt.Sprintf("The control plane is outside its SLO:\n%s", strings.Join(violations, "\n")))
+		}
+	})
+
+})
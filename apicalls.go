@@ -0,0 +1,256 @@
+package example
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/onsi/ginkgo/v2"
+)
+
+// APICallCounts are API calls by verb and resource, e.g. "list pods" or "patch deployments.apps".
+// Subresources follow their resource, "get pods/log", and requests outside the resource API their
+// method and path, "GET /version".
+type APICallCounts map[string]int
+
+// Total is the number of calls counted
+func (c APICallCounts) Total() int {
+	total := 0
+	for _, count := range c {
+		total += count
+	}
+	return total
+}
+
+// Since returns the calls made after the earlier counts were taken
+func (c APICallCounts) Since(earlier APICallCounts) APICallCounts {
+	since := APICallCounts{}
+	for call, count := range c {
+		if count > earlier[call] {
+			since[call] = count - earlier[call]
+		}
+	}
+	return since
+}
+
+// String lists the total and the most frequent calls, which are what a polling loop gone wrong shows up as
+func (c APICallCounts) String() string {
+	calls := make([]string, 0, len(c))
+	for call := range c {
+		calls = append(calls, call)
+	}
+	sort.Slice(calls, func(i, j int) bool {
+		if c[calls[i]] == c[calls[j]] {
+			return calls[i] < calls[j]
+		}
+		return c[calls[i]] > c[calls[j]]
+	})
+	if len(calls) > 5 {
+		calls = calls[:5]
+	}
+	top := make([]string, len(calls))
+	for i, call := range calls {
+		top[i] = fmt.Sprintf("%s: %d", call, c[call])
+	}
+	return fmt.Sprintf("%d API calls, top: [%s]", c.Total(), strings.Join(top, ", "))
+}
+
+// CheckBudget returns an error when there were more calls than the budget, a budget of 0 or less
+// allows any number
+func (c APICallCounts) CheckBudget(budget int) error {
+	if budget > 0 && c.Total() > budget {
+		return fmt.Errorf("API call budget of %d exceeded: %s", budget, c)
+	}
+	return nil
+}
+
+var (
+	apiCalls   = APICallCounts{}
+	apiCallsMu sync.Mutex
+)
+
+// APICalls returns the calls every client from GetRestConfig made so far
+func APICalls() APICallCounts {
+	apiCallsMu.Lock()
+	defer apiCallsMu.Unlock()
+
+	counts := make(APICallCounts, len(apiCalls))
+	for call, count := range apiCalls {
+		counts[call] = count
+	}
+	return counts
+}
+
+// apiCallCounter is the transport wrapper GetRestConfig installs, it counts each request before
+// passing it on, and the watches until their response is closed for the leak check
+type apiCallCounter struct {
+	delegate http.RoundTripper
+}
+
+func countAPICalls(delegate http.RoundTripper) http.RoundTripper {
+	return &apiCallCounter{delegate: delegate}
+}
+
+func (t *apiCallCounter) RoundTrip(request *http.Request) (*http.Response, error) {
+	call := apiCallOf(request)
+	apiCallsMu.Lock()
+	apiCalls[call]++
+	apiCallsMu.Unlock()
+	response, err := t.delegate.RoundTrip(request)
+	if err == nil && strings.HasPrefix(call, "watch ") {
+		response.Body = trackWatch(call, response.Body)
+	}
+	return response, err
+}
+
+// CloseIdleConnections passes on to the transport, so the suites' AfterEach still closes its connections
+func (t *apiCallCounter) CloseIdleConnections() {
+	if closer, ok := t.delegate.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+func (t *apiCallCounter) WrappedRoundTripper() http.RoundTripper { return t.delegate }
+
+// apiCallOf names the request by its verb and resource, from the path:
+// /api/v1/namespaces/{ns}/{resource}/{name}/{subresource} or /apis/{group}/{version}/...
+func apiCallOf(request *http.Request) string {
+	parts := strings.Split(strings.Trim(request.URL.Path, "/"), "/")
+	var group string
+	switch {
+	case len(parts) >= 3 && parts[0] == "api":
+		parts = parts[2:]
+	case len(parts) >= 4 && parts[0] == "apis":
+		group, parts = parts[1], parts[3:]
+	default:
+		return request.Method + " " + request.URL.Path
+	}
+	if len(parts) >= 3 && parts[0] == "namespaces" {
+		parts = parts[2:]
+	}
+
+	resource := parts[0]
+	if group != "" {
+		resource += "." + group
+	}
+	named := len(parts) >= 2
+	if len(parts) >= 3 {
+		resource += "/" + parts[2]
+	}
+
+	var verb string
+	switch request.Method {
+	case http.MethodGet:
+		switch {
+		case request.URL.Query().Get("watch") == "true" || request.URL.Query().Get("watch") == "1":
+			verb = "watch"
+		case named:
+			verb = "get"
+		default:
+			verb = "list"
+		}
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodPut:
+		verb = "update"
+	case http.MethodPatch:
+		verb = "patch"
+	case http.MethodDelete:
+		verb = "delete"
+		if !named {
+			verb = "deletecollection"
+		}
+	default:
+		verb = strings.ToLower(request.Method)
+	}
+	return verb + " " + resource
+}
+
+// APICallTracker counts the calls made since it was started, the calls of one spec when main_test.go
+// starts it in BeforeEach
+type APICallTracker struct {
+	start APICallCounts
+}
+
+// TrackAPICalls starts counting
+func TrackAPICalls() *APICallTracker {
+	return &APICallTracker{start: APICalls()}
+}
+
+// Calls returns the calls made since the tracker was started
+func (t *APICallTracker) Calls() APICallCounts {
+	return APICalls().Since(t.start)
+}
+
+var (
+	apiCallsBySpec       = make(map[string]map[string]int)
+	apiCallsBySpecByVerb = make(map[string]map[string]APICallCounts)
+	apiCallsBySpecMu     sync.Mutex
+)
+
+// RecordAPICalls records the calls of a spec under the test tag: their total as the api_calls metric and
+// the calls by verb and resource as the api_calls_by_verb metric, both maps by spec text. It returns
+// the calls.
+func RecordAPICalls(testTag, spec string, tracker *APICallTracker) APICallCounts {
+	calls := tracker.Calls()
+
+	apiCallsBySpecMu.Lock()
+	defer apiCallsBySpecMu.Unlock()
+	if apiCallsBySpec[testTag] == nil {
+		apiCallsBySpec[testTag] = make(map[string]int)
+		apiCallsBySpecByVerb[testTag] = make(map[string]APICallCounts)
+	}
+	apiCallsBySpec[testTag][spec] = calls.Total()
+	apiCallsBySpecByVerb[testTag][spec] = calls
+	RecordMetric(testTag, "api_calls", apiCallsBySpec[testTag])
+	RecordMetric(testTag, "api_calls_by_verb", apiCallsBySpecByVerb[testTag])
+	return calls
+}
+
+// defaultAPICallBudgets are the budgets of the suites that poll the most, API_CALL_BUDGETS overrides
+// them. The other suites have none unless it sets one.
+var defaultAPICallBudgets = map[string]int{
+	// The rollout monitoring polls, a change that makes it poll far more often fails the spec
+	"DeploymentPDBTest": 1000,
+	// The placement checks read the informer cache, the budget catches a change that lists the pods in
+	// a loop again
+	"ScalingUnderCordonTest": 2000,
+}
+
+// CheckSpecAPICalls logs the calls the tracker counted during the spec and records them under the
+// spec's SpecTestTag with RecordAPICalls. It returns an error, and logs the tag's TEST_FAILED, when they
+// exceed the tag's budget, see APICallBudget. main_test.go calls it after every spec.
+func CheckSpecAPICalls(report ginkgo.SpecReport, tracker *APICallTracker) error {
+	testTag := SpecTestTag(report)
+	logger := GetLogger(testTag)
+	calls := RecordAPICalls(testTag, report.LeafNodeText, tracker)
+	logger.Info().Interface("api_calls", calls).Msgf("%s", calls)
+	if err := calls.CheckBudget(APICallBudget(testTag, defaultAPICallBudgets[testTag])); err != nil {
+		logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		return fmt.Errorf("%s %q: %w", testTag, report.LeafNodeText, err)
+	}
+	return nil
+}
+
+// APICallBudget returns how many API calls each spec of the suite with the tag may make: its entry in
+// API_CALL_BUDGETS from .env, a comma-separated list like "DeploymentPDBTest=500,DNSTest=200", or the
+// fallback. 0 means no budget.
+func APICallBudget(testTag string, fallback int) int {
+	for _, entry := range strings.Split(os.Getenv("API_CALL_BUDGETS"), ",") {
+		tag, value, found := strings.Cut(entry, "=")
+		if !found || strings.TrimSpace(tag) != testTag {
+			continue
+		}
+		budget, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			Logger.Warn().Msgf("Ignoring invalid API_CALL_BUDGETS entry %q: %v", entry, err)
+			break
+		}
+		return budget
+	}
+	return fallback
+}
@@ -0,0 +1,115 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ApplyConcurrency is how many documents the suites create at a time with ApplyRawManifestConcurrently,
+// ApplyDynamicManifestConcurrently and GeneratedWorkload.CreateConcurrently: APPLY_CONCURRENCY from
+// .env, 8 by default. 1 creates them one after the other.
+func ApplyConcurrency() int {
+	if value := os.Getenv("APPLY_CONCURRENCY"); value != "" {
+		concurrency, err := strconv.Atoi(value)
+		if err == nil && concurrency > 0 {
+			return concurrency
+		}
+		Logger.Warn().Msgf("Ignoring invalid APPLY_CONCURRENCY %q", value)
+	}
+	return 8
+}
+
+// manifestDocument is a decoded document of a manifest, ready to be created
+type manifestDocument struct {
+	// number is the document's position in the manifest, from 1
+	number int
+	// first is set for Namespaces and CustomResourceDefinitions, which the other documents may need
+	first  bool
+	create func(ctx context.Context) error
+}
+
+// manifestError is the failure of one document of a manifest
+type manifestError struct {
+	number  int
+	message string
+}
+
+// applyDocuments creates the documents, up to concurrency of them at a time. With a concurrency of 1
+// or less they are created one after the other in manifest order. Otherwise the Namespaces and
+// CustomResourceDefinitions are created first, and the other documents once all of them are. A
+// document that fails doesn't stop the others, every failure is returned.
+func applyDocuments(documents []manifestDocument, concurrency int) []manifestError {
+	stages := [][]manifestDocument{documents}
+	if concurrency > 1 {
+		var first, rest []manifestDocument
+		for _, document := range documents {
+			if document.first {
+				first = append(first, document)
+			} else {
+				rest = append(rest, document)
+			}
+		}
+		stages = [][]manifestDocument{first, rest}
+	}
+
+	var errs []manifestError
+	for _, stage := range stages {
+		creates := make([]func(ctx context.Context) error, len(stage))
+		for i, document := range stage {
+			creates[i] = document.create
+		}
+		for i, err := range runConcurrently(context.TODO(), creates, concurrency) {
+			if err != nil {
+				number := stage[i].number
+				errs = append(errs, manifestError{number, fmt.Sprintf("Document %d apply failed: %v", number, err)})
+			}
+		}
+	}
+	return errs
+}
+
+// runConcurrently calls the tasks with up to concurrency of them running at a time, in order with a
+// concurrency of 1 or less, and returns once all of them returned. The errors are those of the tasks
+// at the same index, nil for the tasks that succeeded.
+func runConcurrently(ctx context.Context, tasks []func(ctx context.Context) error, concurrency int) []error {
+	errs := make([]error, len(tasks))
+	if concurrency <= 1 {
+		for i, task := range tasks {
+			errs[i] = task(ctx)
+		}
+		return errs
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, concurrency)
+	for i, task := range tasks {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func(i int, task func(ctx context.Context) error) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			errs[i] = task(ctx)
+		}(i, task)
+	}
+	wg.Wait()
+	return errs
+}
+
+// manifestErrorsOf joins the failures of a manifest's documents into one error, by document number,
+// nil when there were none
+func manifestErrorsOf(errs []manifestError) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].number < errs[j].number })
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.message
+	}
+	return fmt.Errorf("manifest application errors:\n%s", strings.Join(messages, "\n"))
+}
@@ -0,0 +1,206 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// AvailabilitySample is the number of ready pods right after a transition, and the pods that were ready
+type AvailabilitySample struct {
+	Time  time.Time `json:"time"`
+	Ready int       `json:"ready"`
+	// Pod is the pod whose change caused the transition, empty for the first sample
+	Pod       string   `json:"pod,omitempty"`
+	ReadyPods []string `json:"ready_pods"`
+}
+
+// AvailabilityViolation is a period in which fewer pods than the monitor's minimum were ready.
+// End is zero while the violation is ongoing.
+type AvailabilityViolation struct {
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	MinReady int       `json:"min_ready"`
+	// Trigger is the pod whose change started the violation, ReadyPods the pods that were still ready
+	// at its lowest point
+	Trigger   string   `json:"trigger"`
+	ReadyPods []string `json:"ready_pods"`
+}
+
+func (v AvailabilityViolation) String() string {
+	end := "ongoing"
+	if !v.End.IsZero() {
+		end = v.End.Format(time.RFC3339Nano) + " (" + v.End.Sub(v.Start).String() + ")"
+	}
+	return fmt.Sprintf("only %d ready pods %v from %s to %s, started by %s", v.MinReady, v.ReadyPods,
+		v.Start.Format(time.RFC3339Nano), end, v.Trigger)
+}
+
+// PodAvailabilityMonitor follows the pods matching a label selector through an informer and records
+// every change of the ready pod count, with the time it was seen and the pods that were ready, so dips
+// that last less than a second are still seen. Terminating pods don't count as ready.
+type PodAvailabilityMonitor struct {
+	minReady int
+	cancel   context.CancelFunc
+
+	mu sync.Mutex
+	// ready maps the UIDs of the ready pods to their names, a StatefulSet's replacement pod has the
+	// name of the one it replaces
+	ready map[types.UID]string
+	// Transitions during the initial list are not recorded, it starts with one sample of all pods
+	synced  bool
+	samples []AvailabilitySample
+}
+
+// StartPodAvailabilityMonitor starts monitoring and returns once the informer has synced, with the
+// current ready count as the first sample. minReady is the count below which a violation is recorded.
+func StartPodAvailabilityMonitor(clientset *kubernetes.Clientset, namespace, selector string, minReady int) (*PodAvailabilityMonitor, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	monitor := &PodAvailabilityMonitor{
+		minReady: minReady,
+		cancel:   cancel,
+		ready:    map[types.UID]string{},
+	}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = selector
+		}))
+	informer := factory.Core().V1().Pods().Informer()
+	registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				monitor.update(pod, pod.DeletionTimestamp == nil && podReady(*pod))
+			}
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			if pod, ok := obj.(*corev1.Pod); ok {
+				monitor.update(pod, pod.DeletionTimestamp == nil && podReady(*pod))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if pod, ok := obj.(*corev1.Pod); ok {
+				monitor.update(pod, false)
+			}
+		},
+	})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("event handler registration failed: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), registration.HasSynced) {
+		cancel()
+		return nil, fmt.Errorf("pod informer for %q in %s did not sync", selector, namespace)
+	}
+
+	monitor.mu.Lock()
+	monitor.synced = true
+	monitor.samples = append(monitor.samples, AvailabilitySample{Time: time.Now(), Ready: len(monitor.ready),
+		ReadyPods: monitor.readyPods()})
+	monitor.mu.Unlock()
+	return monitor, nil
+}
+
+// update is called from the informer for every change, the time is taken before the lock so it is
+// when the change was seen
+func (m *PodAvailabilityMonitor) update(pod *corev1.Pod, ready bool) {
+	seen := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.ready)
+	if ready {
+		m.ready[pod.UID] = pod.Name
+	} else {
+		delete(m.ready, pod.UID)
+	}
+	if m.synced && len(m.ready) != before {
+		m.samples = append(m.samples, AvailabilitySample{Time: seen, Ready: len(m.ready), Pod: pod.Name,
+			ReadyPods: m.readyPods()})
+	}
+}
+
+// readyPods returns the names of the ready pods, sorted. The caller holds the lock.
+func (m *PodAvailabilityMonitor) readyPods() []string {
+	names := make([]string, 0, len(m.ready))
+	for _, name := range m.ready {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Stop ends the monitoring. The recorded samples stay available.
+func (m *PodAvailabilityMonitor) Stop() {
+	m.cancel()
+}
+
+// Samples returns every recorded transition in order
+func (m *PodAvailabilityMonitor) Samples() []AvailabilitySample {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]AvailabilitySample(nil), m.samples...)
+}
+
+// MinObserved returns the lowest ready pod count seen since the monitor started
+func (m *PodAvailabilityMonitor) MinObserved() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	minimum := m.samples[0].Ready
+	for _, sample := range m.samples[1:] {
+		minimum = min(minimum, sample.Ready)
+	}
+	return minimum
+}
+
+// Violations returns the periods in which fewer than minReady pods were ready
+func (m *PodAvailabilityMonitor) Violations() []AvailabilityViolation {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var violations []AvailabilityViolation
+	var current *AvailabilityViolation
+	for _, sample := range m.samples {
+		if sample.Ready < m.minReady {
+			if current == nil {
+				current = &AvailabilityViolation{Start: sample.Time, MinReady: sample.Ready + 1, Trigger: sample.Pod}
+			}
+			if sample.Ready < current.MinReady {
+				current.MinReady = sample.Ready
+				current.ReadyPods = sample.ReadyPods
+			}
+			continue
+		}
+		if current != nil {
+			current.End = sample.Time
+			violations = append(violations, *current)
+			current = nil
+		}
+	}
+	if current != nil {
+		violations = append(violations, *current)
+	}
+	return violations
+}
+
+// RecordMetrics adds the minimum ready count, the number of transitions and the violation timeline to
+// the test tag's section of the final report, with names starting with prefix
+func (m *PodAvailabilityMonitor) RecordMetrics(tag, prefix string) {
+	RecordMetric(tag, prefix+"_min_ready_pods", m.MinObserved())
+	RecordMetric(tag, prefix+"_ready_transitions", len(m.Samples())-1)
+	RecordMetric(tag, prefix+"_violations", m.Violations())
+}
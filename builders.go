@@ -0,0 +1,199 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// FixtureImage returns the image built fixtures run by default: busybox:1.36, overridable with
+// FIXTURE_IMAGE in .env, e.g. for a registry mirror. It must provide sh, sleep and true.
+func FixtureImage() string {
+	if image := os.Getenv("FIXTURE_IMAGE"); image != "" {
+		return image
+	}
+	return "busybox:1.36"
+}
+
+// DeploymentBuilder builds a Deployment, and optionally its PDB, in Go instead of a YAML file per
+// variant. NewDeployment starts from a small sleeping pod and every With method changes one aspect:
+//
+//	deployment, pdb := example.NewDeployment("web").WithReplicas(5).WithZoneSpread(1).WithPDB(3).Build()
+type DeploymentBuilder struct {
+	deployment *appsv1.Deployment
+	pdb        *policyv1.PodDisruptionBudget
+}
+
+// NewDeployment starts a Deployment of one pod in the TestNamespace, labeled app=<name>, running a "main"
+// container of FixtureImage that sleeps, requesting 10m CPU and 16Mi memory
+func NewDeployment(name string) *DeploymentBuilder {
+	labels := map[string]string{"app": name}
+	replicas := int32(1)
+	gracePeriod := int64(5)
+	return &DeploymentBuilder{deployment: &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: TestNamespace(), Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: corev1.PodSpec{
+					TerminationGracePeriodSeconds: &gracePeriod,
+					Containers: []corev1.Container{{
+						Name:    "main",
+						Image:   FixtureImage(),
+						Command: []string{"sh", "-c", "exec sleep 3600"},
+						Resources: corev1.ResourceRequirements{
+							Requests: corev1.ResourceList{
+								corev1.ResourceCPU:    resource.MustParse("10m"),
+								corev1.ResourceMemory: resource.MustParse("16Mi"),
+							},
+						},
+					}},
+				},
+			},
+		},
+	}}
+}
+
+func (b *DeploymentBuilder) container() *corev1.Container {
+	return &b.deployment.Spec.Template.Spec.Containers[0]
+}
+
+// WithNamespace places the Deployment and its PDB in another namespace
+func (b *DeploymentBuilder) WithNamespace(namespace string) *DeploymentBuilder {
+	b.deployment.Namespace = namespace
+	return b
+}
+
+// WithReplicas sets the desired replica count
+func (b *DeploymentBuilder) WithReplicas(replicas int32) *DeploymentBuilder {
+	b.deployment.Spec.Replicas = &replicas
+	return b
+}
+
+// WithImage replaces the container image and command. Without a command the image's entrypoint runs.
+func (b *DeploymentBuilder) WithImage(image string, command ...string) *DeploymentBuilder {
+	b.container().Image = image
+	b.container().Command = command
+	return b
+}
+
+// WithResources sets the container's CPU and memory requests, e.g. "100m" and "64Mi"
+func (b *DeploymentBuilder) WithResources(cpu, memory string) *DeploymentBuilder {
+	b.container().Resources.Requests = corev1.ResourceList{
+		corev1.ResourceCPU:    resource.MustParse(cpu),
+		corev1.ResourceMemory: resource.MustParse(memory),
+	}
+	return b
+}
+
+// WithMemoryLimit sets the container's memory limit
+func (b *DeploymentBuilder) WithMemoryLimit(memory string) *DeploymentBuilder {
+	b.container().Resources.Limits = corev1.ResourceList{corev1.ResourceMemory: resource.MustParse(memory)}
+	return b
+}
+
+// WithTerminationGracePeriod sets how long deleted pods get to shut down
+func (b *DeploymentBuilder) WithTerminationGracePeriod(period time.Duration) *DeploymentBuilder {
+	seconds := int64(period.Seconds())
+	b.deployment.Spec.Template.Spec.TerminationGracePeriodSeconds = &seconds
+	return b
+}
+
+// WithReadinessDelay adds a readiness probe that passes once the delay has passed since the container
+// started, so new pods stay unavailable for a while
+func (b *DeploymentBuilder) WithReadinessDelay(delay time.Duration) *DeploymentBuilder {
+	b.container().ReadinessProbe = &corev1.Probe{
+		ProbeHandler:        corev1.ProbeHandler{Exec: &corev1.ExecAction{Command: []string{"true"}}},
+		InitialDelaySeconds: int32(delay.Seconds()),
+		PeriodSeconds:       1,
+	}
+	return b
+}
+
+// WithRollingUpdate sets the RollingUpdate strategy with maxSurge and maxUnavailable as kubectl takes
+// them, a number or a percentage like "25%"
+func (b *DeploymentBuilder) WithRollingUpdate(maxSurge, maxUnavailable string) *DeploymentBuilder {
+	surge := intstr.Parse(maxSurge)
+	unavailable := intstr.Parse(maxUnavailable)
+	b.deployment.Spec.Strategy = appsv1.DeploymentStrategy{
+		Type:          appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{MaxSurge: &surge, MaxUnavailable: &unavailable},
+	}
+	return b
+}
+
+// WithZoneSpread adds a topology spread constraint over zones that keeps pods unscheduled rather than
+// exceed maxSkew
+func (b *DeploymentBuilder) WithZoneSpread(maxSkew int32) *DeploymentBuilder {
+	return b.withZoneSpread(maxSkew, corev1.DoNotSchedule)
+}
+
+// WithSoftZoneSpread adds a topology spread constraint over zones the scheduler only prefers, like a
+// typical production workload
+func (b *DeploymentBuilder) WithSoftZoneSpread(maxSkew int32) *DeploymentBuilder {
+	return b.withZoneSpread(maxSkew, corev1.ScheduleAnyway)
+}
+
+func (b *DeploymentBuilder) withZoneSpread(maxSkew int32, action corev1.UnsatisfiableConstraintAction) *DeploymentBuilder {
+	spec := &b.deployment.Spec.Template.Spec
+	spec.TopologySpreadConstraints = append(spec.TopologySpreadConstraints, corev1.TopologySpreadConstraint{
+		MaxSkew:           maxSkew,
+		TopologyKey:       corev1.LabelTopologyZone,
+		WhenUnsatisfiable: action,
+		LabelSelector:     &metav1.LabelSelector{MatchLabels: b.deployment.Spec.Selector.MatchLabels},
+	})
+	return b
+}
+
+// WithPDB adds a PodDisruptionBudget named <name>-pdb that keeps minAvailable pods of the Deployment
+func (b *DeploymentBuilder) WithPDB(minAvailable int32) *DeploymentBuilder {
+	value := intstr.FromInt32(minAvailable)
+	b.pdb = &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: b.deployment.Name + "-pdb"},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MinAvailable: &value,
+			Selector:     &metav1.LabelSelector{MatchLabels: b.deployment.Spec.Selector.MatchLabels},
+		},
+	}
+	return b
+}
+
+// Build returns copies of the Deployment and its PDB, nil without WithPDB, so the builder can be
+// reused for further variants
+func (b *DeploymentBuilder) Build() (*appsv1.Deployment, *policyv1.PodDisruptionBudget) {
+	deployment := b.deployment.DeepCopy()
+	if b.pdb == nil {
+		return deployment, nil
+	}
+	pdb := b.pdb.DeepCopy()
+	pdb.Namespace = deployment.Namespace
+	return deployment, pdb
+}
+
+// Create creates the PDB, if any, and then the Deployment, so the budget is in place before the
+// first pod starts
+func (b *DeploymentBuilder) Create(ctx context.Context, clientset *kubernetes.Clientset) error {
+	deployment, pdb := b.Build()
+	if pdb != nil {
+		_, err := clientset.PolicyV1().PodDisruptionBudgets(pdb.Namespace).Create(ctx, pdb, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("PDB %s/%s creation failed: %w", pdb.Namespace, pdb.Name, err)
+		}
+	}
+	_, err := clientset.AppsV1().Deployments(deployment.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("deployment %s/%s creation failed: %w", deployment.Namespace, deployment.Name, err)
+	}
+	return nil
+}
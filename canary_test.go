@@ -0,0 +1,253 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Canary rollout E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("CanaryRolloutTest"), func() {
+	var (
+		clientset     *kubernetes.Clientset
+		config        *rest.Config
+		totalReplicas int32
+		logger        zerolog.Logger
+		testTag       = "CanaryRolloutTest"
+	)
+
+	const (
+		requestCount = 200
+		// With 200 requests the standard deviation of an observed share is at most 3.5 percentage points
+		shareTolerance = 0.15
+		pollInterval   = 2 * time.Second
+	)
+
+	// Canary replicas at each step, the rest of totalReplicas stay on the stable track
+	canarySteps := []int32{1, 2, 3, 4}
+
+	setReplicas := func(name string, replicas int32) {
+		err := example.Scale(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), name, replicas)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	deploymentSettled := func(name string) bool {
+		deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		replicas := *deployment.Spec.Replicas
+		return deployment.Status.ObservedGeneration >= deployment.Generation &&
+			deployment.Status.Replicas == replicas &&
+			deployment.Status.AvailableReplicas == replicas
+	}
+
+	readyEndpoints := func() int {
+		endpoints, err := example.GetServiceEndpoints(context.TODO(), clientset, example.TestNamespace(), "canary-svc")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return len(endpoints.Ready())
+	}
+
+	// shiftWeight scales both tracks and waits until the Service only routes to the new set of pods
+	shiftWeight := func(canary int32) {
+		stable := totalReplicas - canary
+		logger.Info().Msgf("=== Shifting weight to %d canary / %d stable replicas ===", canary, stable)
+		setReplicas("canary-app-canary", canary)
+		setReplicas("canary-app-stable", stable)
+
+		settleTimeout := example.Timeout(example.TimeoutRollout, 3*time.Minute)
+		deadline := time.Now().Add(settleTimeout)
+		for {
+			endpoints := readyEndpoints()
+			if deploymentSettled("canary-app-canary") && deploymentSettled("canary-app-stable") && endpoints == int(totalReplicas) {
+				return
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Tracks did not settle at %d canary / %d stable within %v (ready endpoints: %d)",
+					canary, stable, settleTimeout, endpoints))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	// sendRequests sends requests to the Service from the client pod and counts the responses per track
+	sendRequests := func() map[string]int {
+		samples, err := example.HTTPProbeFromPod(context.TODO(), config, clientset, example.TestNamespaced("http://canary-svc.test-ns.svc.cluster.local"),
+			example.HTTPProbeOptions{Pod: "canary-client", Container: "client", Requests: requestCount})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(samples.StatusCodes()).To(gomega.Equal(map[int]int{200: requestCount}),
+			"Some requests to the Service failed")
+
+		distribution := samples.Bodies()
+		for track := range distribution {
+			gomega.Expect(track).To(gomega.BeElementOf("stable", "canary"), "Unexpected response %q", track)
+		}
+		return distribution
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should serve all traffic from the stable track before the canary", func() {
+		logger.Info().Msgf("=== Starting Canary rollout E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		serviceYAML, stableYAML, canaryYAML, clientYAML, err := example.GetCanaryTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		type deploymentSpec struct {
+			Spec struct {
+				Replicas int32 `yaml:"replicas"`
+			} `yaml:"spec"`
+		}
+
+		var stableConfig deploymentSpec
+		err = yaml.Unmarshal(stableYAML, &stableConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		totalReplicas = stableConfig.Spec.Replicas
+		gomega.Expect(canarySteps[len(canarySteps)-1]).To(gomega.Equal(totalReplicas),
+			"The last step must move every replica to the canary")
+
+		logger.Info().Msgf("=== Applying Service, stable (%d replicas) and canary deployments and client pod ===", totalReplicas)
+		for _, manifest := range [][]byte{serviceYAML, stableYAML, canaryYAML, clientYAML} {
+			err = example.ApplyRawManifest(clientset, manifest)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		readyTimeout := example.Timeout(example.TimeoutRollout, 3*time.Minute)
+		deadline := time.Now().Add(readyTimeout)
+		for {
+			client, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "canary-client", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if client.Status.Phase == v1.PodRunning && deploymentSettled("canary-app-stable") && readyEndpoints() == int(totalReplicas) {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Stable track and client did not become ready within %v", readyTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		distribution := sendRequests()
+		logger.Info().Msgf("Responses per track: %v\n", distribution)
+		gomega.Expect(distribution["canary"]).To(gomega.BeZero())
+	})
+
+	for _, canary := range canarySteps {
+		canary := canary
+		ginkgo.It(fmt.Sprintf("should route traffic by replica ratio with %d canary replicas", canary), func() {
+			defer example.E2ePanicHandler()
+
+			shiftWeight(canary)
+
+			distribution := sendRequests()
+			expected := float64(canary) / float64(totalReplicas)
+			observed := float64(distribution["canary"]) / float64(requestCount)
+			logger.Info().Msgf("Responses per track: %v, canary share %.2f (expected %.2f)\n", distribution, observed, expected)
+			example.RecordMetric(testTag, fmt.Sprintf("canary_share_%d_of_%d", canary, totalReplicas), observed)
+
+			// A track without replicas must get no traffic at all, otherwise the share only has to be close
+			if canary == totalReplicas {
+				gomega.Expect(distribution["stable"]).To(gomega.BeZero(), "Stable track still got traffic after promotion")
+				return
+			}
+			gomega.Expect(math.Abs(observed-expected)).To(gomega.BeNumerically("<=", shareTolerance),
+				"Canary share %.2f is not within %.2f of the replica ratio %.2f", observed, shareTolerance, expected)
+		})
+	}
+
+	ginkgo.It("should roll out changes staged on the paused canary as a single revision", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Pausing the canary rollout ===")
+		err := example.PauseRollout(context.TODO(), clientset, example.TestNamespace(), "canary-app-canary")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		// Resuming a second time is harmless, a failed spec must not leave the Deployment paused
+		defer func() {
+			if err := example.ResumeRollout(context.TODO(), clientset, example.TestNamespace(), "canary-app-canary"); err != nil {
+				logger.Error().Msgf("Failed to resume deployment canary-app-canary: %v", err)
+			}
+		}()
+
+		deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "canary-app-canary", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		revision := deployment.Annotations[example.DeploymentRevisionAnnotation]
+
+		// A release usually changes more than one field, each update would be a rollout of its own
+		logger.Info().Msgf("=== Staging a new release: environment variable and readiness probe period ===")
+		for _, stage := range []func(container *v1.Container){
+			func(container *v1.Container) {
+				container.Env = append(container.Env, v1.EnvVar{Name: "RELEASE", Value: "v2"})
+			},
+			func(container *v1.Container) {
+				container.ReadinessProbe.PeriodSeconds = 1
+			},
+		} {
+			err = example.TriggerRollingUpdate(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), "canary-app-canary",
+				func(template *v1.PodTemplateSpec) {
+					stage(&template.Spec.Containers[0])
+				})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		example.ExpectPollUntil(context.TODO(), example.CheckInterval(pollInterval), example.Timeout(example.TimeoutRollout, time.Minute), func(ctx context.Context) (bool, error) {
+			deployment, err = clientset.AppsV1().Deployments(example.TestNamespace()).Get(ctx, "canary-app-canary", metav1.GetOptions{})
+			if err != nil {
+				return false, err
+			}
+			return deployment.Status.ObservedGeneration >= deployment.Generation, nil
+		}, "The deployment controller did not observe the staged changes")
+		gomega.Expect(deployment.Annotations[example.DeploymentRevisionAnnotation]).To(gomega.Equal(revision),
+			"The paused canary started a rollout")
+
+		logger.Info().Msgf("=== Resuming the canary rollout ===")
+		err = example.ResumeRollout(context.TODO(), clientset, example.TestNamespace(), "canary-app-canary")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.WaitForRollout(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), "canary-app-canary", 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deployment, err = clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "canary-app-canary", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		previous, err := strconv.Atoi(revision)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(deployment.Annotations[example.DeploymentRevisionAnnotation]).To(gomega.Equal(strconv.Itoa(previous+1)),
+			"The staged changes were not rolled out as a single revision")
+
+		distribution := sendRequests()
+		logger.Info().Msgf("Responses per track after the release: %v\n", distribution)
+		gomega.Expect(distribution["stable"]).To(gomega.BeZero(), "Stable track got traffic after the release")
+	})
+
+})
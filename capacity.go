@@ -0,0 +1,120 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// noZone is the zone ClusterCapacity files nodes without a topology.kubernetes.io/zone label under
+const noZone = "<none>"
+
+// ZoneCapacity sums up the nodes of a zone, or of the whole cluster. The allocatable resources only
+// count schedulable nodes, the ones NodeSchedulable accepts.
+type ZoneCapacity struct {
+	Nodes            int   `json:"nodes"`
+	SchedulableNodes int   `json:"schedulable_nodes"`
+	CPUMillicores    int64 `json:"allocatable_cpu_millicores"`
+	MemoryBytes      int64 `json:"allocatable_memory_bytes"`
+	Pods             int64 `json:"allocatable_pods"`
+	// Non-terminated pods already running on the schedulable nodes
+	UsedPods int64 `json:"used_pods"`
+}
+
+// FreePods is how many more pods the schedulable nodes accept, ignoring CPU and memory requests
+func (c ZoneCapacity) FreePods() int64 {
+	return c.Pods - c.UsedPods
+}
+
+func (c *ZoneCapacity) add(other ZoneCapacity) {
+	c.Nodes += other.Nodes
+	c.SchedulableNodes += other.SchedulableNodes
+	c.CPUMillicores += other.CPUMillicores
+	c.MemoryBytes += other.MemoryBytes
+	c.Pods += other.Pods
+	c.UsedPods += other.UsedPods
+}
+
+// CapacitySummary is what ClusterCapacity reports, in the form the final report's cluster_metadata
+// section holds it
+type CapacitySummary struct {
+	Time  time.Time                `json:"time"`
+	Total ZoneCapacity             `json:"total"`
+	Zones map[string]*ZoneCapacity `json:"zones"`
+	// Number of nodes per taint, as key=value:effect
+	Taints map[string]int `json:"taints,omitempty"`
+}
+
+func (s *CapacitySummary) String() string {
+	zones := make([]string, 0, len(s.Zones))
+	for zone, capacity := range s.Zones {
+		zones = append(zones, fmt.Sprintf("%s: %d/%d nodes schedulable", zone, capacity.SchedulableNodes, capacity.Nodes))
+	}
+	sort.Strings(zones)
+	return fmt.Sprintf("%d/%d nodes schedulable, %dm CPU, %dMi memory, %d free pod slots (%s)", s.Total.SchedulableNodes,
+		s.Total.Nodes, s.Total.CPUMillicores, s.Total.MemoryBytes>>20, s.Total.FreePods(), strings.Join(zones, ", "))
+}
+
+// ClusterCapacity counts the nodes per zone and sums up their allocatable CPU, memory and pods, along
+// with how many nodes carry each taint. Suites use it to skip up front when the cluster is too small,
+// instead of timing out, e.g. a 200 replica benchmark on a 3 node kind cluster:
+//
+//	capacity, err := example.ClusterCapacity(context.TODO(), clientset)
+//	if capacity.Total.FreePods() < 200 {
+//		ginkgo.Skip(fmt.Sprintf("The cluster is too small: %v", capacity))
+//	}
+func ClusterCapacity(ctx context.Context, clientset *kubernetes.Clientset) (*CapacitySummary, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("nodes listing failed: %w", err)
+	}
+	// Succeeded and failed pods don't take a slot on their node any more
+	pods, err := listPodPages(ctx, clientset, metav1.NamespaceAll, metav1.ListOptions{
+		FieldSelector: fields.AndSelectors(
+			fields.OneTermNotEqualSelector("status.phase", string(corev1.PodSucceeded)),
+			fields.OneTermNotEqualSelector("status.phase", string(corev1.PodFailed)),
+		).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pods listing failed: %w", err)
+	}
+	podsPerNode := map[string]int64{}
+	for _, pod := range pods {
+		if pod.Spec.NodeName != "" {
+			podsPerNode[pod.Spec.NodeName]++
+		}
+	}
+
+	summary := &CapacitySummary{Time: time.Now(), Zones: map[string]*ZoneCapacity{}, Taints: map[string]int{}}
+	for _, node := range nodes.Items {
+		zone := node.Labels[corev1.LabelTopologyZone]
+		if zone == "" {
+			zone = noZone
+		}
+		nodeCapacity := ZoneCapacity{Nodes: 1}
+		if NodeSchedulable(node) {
+			nodeCapacity.SchedulableNodes = 1
+			nodeCapacity.CPUMillicores = node.Status.Allocatable.Cpu().MilliValue()
+			nodeCapacity.MemoryBytes = node.Status.Allocatable.Memory().Value()
+			nodeCapacity.Pods = node.Status.Allocatable.Pods().Value()
+			nodeCapacity.UsedPods = podsPerNode[node.Name]
+		}
+		if summary.Zones[zone] == nil {
+			summary.Zones[zone] = &ZoneCapacity{}
+		}
+		summary.Zones[zone].add(nodeCapacity)
+		summary.Total.add(nodeCapacity)
+
+		for _, taint := range node.Spec.Taints {
+			summary.Taints[taint.ToString()]++
+		}
+	}
+	return summary, nil
+}
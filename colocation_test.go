@@ -0,0 +1,203 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Pod co-location E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("PodColocationTest"), func() {
+	var (
+		clientset     *kubernetes.Clientset
+		markerYAML    []byte
+		dependentYAML []byte
+		// The node each marker pod runs on
+		markerNodes = map[string]string{}
+		logger      zerolog.Logger
+		testTag     = "PodColocationTest"
+	)
+
+	const (
+		replicas     = 3
+		pollInterval = 2 * time.Second
+		pendingHold  = 15 * time.Second
+	)
+
+	// createDependents creates a Deployment whose pods require a node running the given marker
+	createDependents := func(marker string) {
+		deployment := &appsv1.Deployment{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(dependentYAML), 4096).Decode(deployment)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		deployment.Name = "colocation-dependent-" + marker
+		deployment.Spec.Selector.MatchLabels["marker"] = marker
+		deployment.Spec.Template.Labels["marker"] = marker
+		deployment.Spec.Template.Spec.Affinity.PodAffinity.RequiredDuringSchedulingIgnoredDuringExecution[0].
+			LabelSelector.MatchLabels["marker"] = marker
+
+		logger.Info().Msgf("=== Creating Deployment %s requiring marker %s ===", deployment.Name, marker)
+		_, err = clientset.AppsV1().Deployments(example.TestNamespace()).Create(context.TODO(), deployment, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	dependentPods := func(marker string) []v1.Pod {
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{
+			LabelSelector: "app=colocation-dependent,marker=" + marker,
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return pods
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		markerYAML, dependentYAML, err = example.GetColocationTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should run the marker pods", func() {
+		logger.Info().Msgf("=== Starting Pod co-location E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		for _, marker := range []string{"a", "b"} {
+			pod := &v1.Pod{}
+			err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(markerYAML), 4096).Decode(pod)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			pod.Name = "colocation-marker-" + marker
+			pod.Labels["marker"] = marker
+			_, err = clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), pod, metav1.CreateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		markerTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(markerTimeout)
+		for len(markerNodes) < 2 {
+			for _, marker := range []string{"a", "b"} {
+				pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "colocation-marker-"+marker, metav1.GetOptions{})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				if pod.Status.Phase == v1.PodRunning {
+					markerNodes[marker] = pod.Spec.NodeName
+				}
+			}
+			if len(markerNodes) < 2 && time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Only the markers on %v were running after %v", markerNodes, markerTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== Marker nodes: %v ===", markerNodes)
+	})
+
+	ginkgo.It("should place every dependent pod on the node of its marker", func() {
+		defer example.E2ePanicHandler()
+
+		gomega.Expect(markerNodes).To(gomega.HaveLen(2), "The marker pods are not running")
+		for _, marker := range []string{"a", "b"} {
+			createDependents(marker)
+		}
+
+		start := time.Now()
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := start.Add(runningTimeout)
+		for _, marker := range []string{"a", "b"} {
+			for {
+				pods := dependentPods(marker)
+				running := 0
+				for _, pod := range pods {
+					if pod.Status.Phase == v1.PodRunning {
+						running++
+					}
+				}
+				if running == replicas {
+					break
+				}
+				if time.Now().After(deadline) {
+					ginkgo.Fail(fmt.Sprintf("Only %d/%d pods of marker %s were running after %v", running, replicas, marker, runningTimeout))
+				}
+				time.Sleep(example.CheckInterval(pollInterval))
+			}
+
+			for _, pod := range dependentPods(marker) {
+				gomega.Expect(pod.Spec.NodeName).To(gomega.Equal(markerNodes[marker]),
+					"Pod %s runs on %s, not with marker %s on %s", pod.Name, pod.Spec.NodeName, marker, markerNodes[marker])
+			}
+			logger.Info().Msgf("=== All %d dependents of marker %s run on %s ===", replicas, marker, markerNodes[marker])
+		}
+		example.RecordMetric(testTag, "dependents_running_seconds", time.Since(start).Seconds())
+	})
+
+	ginkgo.It("should keep dependent pods Pending when their marker is absent", func() {
+		defer example.E2ePanicHandler()
+
+		createDependents("absent")
+
+		unschedulableTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(unschedulableTimeout)
+		for {
+			pods := dependentPods("absent")
+			unschedulable := 0
+			var message string
+			for _, pod := range pods {
+				gomega.Expect(pod.Spec.NodeName).To(gomega.BeEmpty(), "Pod %s was placed on %s without a marker", pod.Name, pod.Spec.NodeName)
+				for _, condition := range pod.Status.Conditions {
+					if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse &&
+						condition.Reason == v1.PodReasonUnschedulable {
+						unschedulable++
+						message = condition.Message
+					}
+				}
+			}
+			if unschedulable == replicas {
+				logger.Info().Msgf("=== All %d dependents are unschedulable: %s ===", replicas, message)
+				gomega.Expect(message).To(gomega.ContainSubstring("didn't match pod affinity rules"))
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Only %d/%d pods were marked unschedulable after %v", unschedulable, replicas, unschedulableTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		// A later scheduling attempt must not place them either
+		time.Sleep(pendingHold)
+		var placed []string
+		for _, pod := range dependentPods("absent") {
+			gomega.Expect(pod.Status.Phase).To(gomega.Equal(v1.PodPending))
+			if pod.Spec.NodeName != "" {
+				placed = append(placed, pod.Name+" on "+pod.Spec.NodeName)
+			}
+		}
+		gomega.Expect(placed).To(gomega.BeEmpty(), "Pods were placed without a marker: %s", strings.Join(placed, ", "))
+	})
+
+})
@@ -0,0 +1,32 @@
+package example
+
+import (
+	"os"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+)
+
+// APIContentType returns the content type clients from GetRestConfig exchange with the API server:
+// protobuf, which is smaller and cheaper to decode than JSON for the lists the suites poll, unless
+// API_CONTENT_TYPE in .env is json, e.g. to read the traffic of a debugging proxy
+func APIContentType() string {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("API_CONTENT_TYPE")), "json") {
+		return runtime.ContentTypeJSON
+	}
+	return runtime.ContentTypeProtobuf
+}
+
+// WithContentType returns a copy of the config whose clients send and accept the content type. With
+// protobuf, JSON stays accepted for the APIs that only serve JSON, such as custom resources and most
+// aggregated APIs. Dynamic clients always use JSON, whatever the config says.
+func WithContentType(config *rest.Config, contentType string) *rest.Config {
+	config = rest.CopyConfig(config)
+	config.ContentType = contentType
+	config.AcceptContentTypes = contentType
+	if contentType == runtime.ContentTypeProtobuf {
+		config.AcceptContentTypes = runtime.ContentTypeProtobuf + "," + runtime.ContentTypeJSON
+	}
+	return config
+}
@@ -0,0 +1,271 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+	"example/matchers"
+)
+
+var _ = ginkgo.Describe("Scaling under cordon E2E test", ginkgo.Ordered, ginkgo.Label("disruptive"), example.SuiteConcurrency("ScalingUnderCordonTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		// Ready, schedulable nodes without taints, by name, with their zones and hostnames
+		candidates []string
+		zoneMap    *example.ZoneMap
+		hostnames  []string
+		// Nodes this suite cordoned and must uncordon, even when a spec fails
+		cordonedNodes []string
+		uncordoned    map[string]bool
+		logger        zerolog.Logger
+		testTag       = "ScalingUnderCordonTest"
+	)
+
+	const (
+		// Overridable with CORDON_FRACTION in .env
+		defaultFraction = 0.5
+		// nodeTaintsPolicy in the fixture is beta and enabled by default from 1.26
+		minimumVersion = "1.26"
+		pendingHold    = 15 * time.Second
+	)
+
+	activePods := func(pods []v1.Pod) []v1.Pod {
+		var active []v1.Pod
+		for _, pod := range pods {
+			if pod.DeletionTimestamp == nil {
+				active = append(active, pod)
+			}
+		}
+		return active
+	}
+
+	// The pods are read from the shared informer cache of test-ns, the waits below follow its changes
+	listPods := func() []v1.Pod {
+		pods, err := example.TestNamespaceInformers().Pods("app=cordon-scaling-app")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return activePods(pods)
+	}
+
+	// checkPlacement asserts that the placed pods only use allowed nodes, at most one per node, with a zone
+	// skew of at most 1 over the zones of the allowed nodes. It returns how many pods run and how many the
+	// scheduler reported as unschedulable.
+	checkPlacement := func(pods []v1.Pod, allowed map[string]bool) (int, int) {
+		perZone := map[string]int{}
+		for node := range allowed {
+			perZone[zoneMap.NodeZone(node)] = 0
+		}
+		perNode := map[string]string{}
+		running, unschedulable := 0, 0
+		for _, pod := range pods {
+			if pod.Spec.NodeName == "" {
+				for _, condition := range pod.Status.Conditions {
+					if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse &&
+						condition.Reason == v1.PodReasonUnschedulable {
+						unschedulable++
+					}
+				}
+				continue
+			}
+			gomega.Expect(allowed).To(gomega.HaveKey(pod.Spec.NodeName), "Pod %s was placed on cordoned node %s", pod.Name, pod.Spec.NodeName)
+			other, taken := perNode[pod.Spec.NodeName]
+			gomega.Expect(taken).To(gomega.BeFalse(), "Pods %s and %s share node %s despite the anti-affinity", pod.Name, other, pod.Spec.NodeName)
+			perNode[pod.Spec.NodeName] = pod.Name
+			perZone[zoneMap.ZoneOf(pod)]++
+			if pod.Status.Phase == v1.PodRunning {
+				running++
+			}
+		}
+
+		gomega.Expect(perZone).To(matchers.HaveMaxSkew(1))
+		return running, unschedulable
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		supported, serverVersion, err := example.ServerVersionAtLeast(clientset, minimumVersion)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if !supported {
+			ginkgo.Skip(fmt.Sprintf("Server version %s is older than %s", serverVersion, minimumVersion))
+		}
+
+		fraction := defaultFraction
+		if value := os.Getenv("CORDON_FRACTION"); value != "" {
+			fraction, err = strconv.ParseFloat(value, 64)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid CORDON_FRACTION: %s", value)
+		}
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		zoneMap, err = example.NewZoneMap(context.TODO(), clientset)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, node := range nodes.Items {
+			if !example.NodeSchedulable(node) || len(node.Spec.Taints) > 0 || node.Labels[v1.LabelHostname] == "" {
+				continue
+			}
+			candidates = append(candidates, node.Name)
+			hostnames = append(hostnames, node.Labels[v1.LabelHostname])
+		}
+		if len(candidates) < 3 {
+			ginkgo.Skip(fmt.Sprintf("Scaling under cordon needs 3 ready, schedulable nodes without taints, found %d", len(candidates)))
+		}
+		sort.Strings(candidates)
+
+		// At least one node is cordoned and at least two stay available
+		count := min(max(int(float64(len(candidates))*fraction), 1), len(candidates)-2)
+		uncordoned = map[string]bool{}
+		for i, node := range candidates {
+			if i >= count {
+				uncordoned[node] = true
+			}
+		}
+		logger.Info().Msgf("=== %d candidate nodes, cordoning %v ===", len(candidates), candidates[:count])
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		for _, node := range cordonedNodes {
+			logger.Info().Msgf("=== Restoring node %s ===", node)
+			if err := example.UncordonNode(context.TODO(), clientset, node); err != nil {
+				logger.Error().Msgf("Failed to uncordon node %s: %v", node, err)
+			}
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should honor the constraints on the reduced node set during an HPA scale-up", func() {
+		logger.Info().Msgf("=== Starting Scaling under cordon E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		for _, node := range candidates {
+			if uncordoned[node] {
+				continue
+			}
+			err := example.CordonNode(context.TODO(), clientset, node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			cordonedNodes = append(cordonedNodes, node)
+		}
+
+		deploymentYAML, hpaYAML, err := example.GetCordonScalingTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deployment := &appsv1.Deployment{}
+		err = utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(deploymentYAML), 4096).Decode(deployment)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		deployment.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.
+			NodeSelectorTerms[0].MatchExpressions[0].Values = hostnames
+		_, err = clientset.AppsV1().Deployments(example.TestNamespace()).Create(context.TODO(), deployment, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// One replica per candidate node, so the cordoned share can't be placed
+		maxReplicas := int32(len(candidates))
+		hpa := &autoscalingv2.HorizontalPodAutoscaler{}
+		err = utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(hpaYAML), 4096).Decode(hpa)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		hpa.Spec.MaxReplicas = maxReplicas
+
+		// The scale-up time must not include metrics-server's first scrape of the pods
+		_, err = example.WaitForPodMetrics(context.TODO(), clientset, example.TestNamespace(), "app=cordon-scaling-app", 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Is metrics-server running?")
+		logger.Info().Msgf("=== Creating Deployment and HPA (maxReplicas %d) ===", maxReplicas)
+		start := time.Now()
+		_, err = clientset.AutoscalingV2().HorizontalPodAutoscalers(example.TestNamespace()).Create(context.TODO(), hpa, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Replicas that can't be placed count for the HPA as well
+		_, err = example.WaitForHPAScaled(context.TODO(), clientset, example.TestNamespace(), hpa.Name, maxReplicas, 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Is metrics-server running?")
+		logger.Info().Msgf("=== HPA scaled to %d replicas after %v ===", maxReplicas, time.Since(start).Round(time.Second))
+		example.RecordMetric(testTag, "hpa_scale_up_seconds", time.Since(start).Seconds())
+
+		expectedRunning := len(uncordoned)
+		expectedPending := int(maxReplicas) - expectedRunning
+		var running, unschedulable int
+		_, err = example.TestNamespaceInformers().WaitForPods(context.TODO(), "app=cordon-scaling-app", 3*time.Minute, func(pods []v1.Pod) bool {
+			pods = activePods(pods)
+			running, unschedulable = checkPlacement(pods, uncordoned)
+			return len(pods) == int(maxReplicas) && running == expectedRunning && unschedulable == expectedPending
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "%d running and %d unschedulable, expected %d running and %d Pending",
+			running, unschedulable, expectedRunning, expectedPending)
+		logger.Info().Msgf("=== %d pods running on the uncordoned nodes, %d Pending ===", running, unschedulable)
+
+		// Later scheduling attempts must not break the constraints either
+		time.Sleep(pendingHold)
+		running, unschedulable = checkPlacement(listPods(), uncordoned)
+		gomega.Expect(running).To(gomega.Equal(expectedRunning))
+		gomega.Expect(unschedulable).To(gomega.Equal(expectedPending))
+
+		// The uncordoned nodes are full because of the anti-affinity, which the scheduler must report as
+		// the reason, not only the cordon
+		ctx, cancel := context.WithTimeout(context.TODO(), example.Timeout(example.TimeoutPods, time.Minute))
+		defer cancel()
+		events, err := example.RecordEventsUntil(ctx, clientset, example.TestNamespace(), func(event *v1.Event) bool {
+			return event.Reason == "FailedScheduling" && strings.HasPrefix(event.InvolvedObject.Name, "cordon-scaling-app-")
+		}, func(events []v1.Event) bool {
+			return strings.Contains(events[len(events)-1].Message, "anti-affinity")
+		})
+		for _, event := range events {
+			logger.Info().Msgf("FailedScheduling %s: %s\n", event.InvolvedObject.Name, event.Message)
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "No FailedScheduling event mentions the pod anti-affinity")
+	})
+
+	ginkgo.It("should place the Pending pods once the nodes are uncordoned", func() {
+		defer example.E2ePanicHandler()
+
+		gomega.Expect(cordonedNodes).NotTo(gomega.BeEmpty(), "No node was cordoned")
+		start := time.Now()
+		for _, node := range cordonedNodes {
+			logger.Info().Msgf("=== Uncordoning %s ===", node)
+			err := example.UncordonNode(context.TODO(), clientset, node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+		cordonedNodes = nil
+
+		all := map[string]bool{}
+		for _, node := range candidates {
+			all[node] = true
+		}
+		running := 0
+		_, err := example.TestNamespaceInformers().WaitForPods(context.TODO(), "app=cordon-scaling-app", 3*time.Minute, func(pods []v1.Pod) bool {
+			running, _ = checkPlacement(activePods(pods), all)
+			return running == len(candidates)
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Only %d/%d pods were running after the uncordon", running, len(candidates))
+		logger.Info().Msgf("=== All %d pods running %v after the uncordon ===", len(candidates), time.Since(start).Round(time.Second))
+		example.RecordMetric(testTag, "pending_placed_seconds", time.Since(start).Seconds())
+	})
+
+})
@@ -0,0 +1,262 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("CRD lifecycle E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("CRDLifecycleTest"), func() {
+	var (
+		clientset     *kubernetes.Clientset
+		config        *rest.Config
+		dynamicClient dynamic.Interface
+		crdYAML       []byte
+		widgetYAML    []byte
+		// The CRD outlives test-ns, AfterAll deletes everything recorded here
+		clusterScoped []example.ClusterScopedObject
+		logger        zerolog.Logger
+		testTag       = "CRDLifecycleTest"
+	)
+
+	const (
+		crdName      = "widgets.e2e.example.com"
+		pollInterval = 2 * time.Second
+	)
+
+	crdResource := schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1", Resource: "customresourcedefinitions"}
+	widgetResource := schema.GroupVersionResource{Group: "e2e.example.com", Version: "v1", Resource: "widgets"}
+
+	widgets := func() dynamic.ResourceInterface {
+		return dynamicClient.Resource(widgetResource).Namespace(example.TestNamespace())
+	}
+
+	// newWidget decodes the fixture with a new name and applies mutate to its spec
+	newWidget := func(name string, mutate func(spec map[string]interface{})) *unstructured.Unstructured {
+		widget := &unstructured.Unstructured{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(widgetYAML), 4096).Decode(&widget.Object)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		widget.SetName(name)
+		if mutate != nil {
+			mutate(widget.Object["spec"].(map[string]interface{}))
+		}
+		return widget
+	}
+
+	// installCRD creates the CRD and waits until it is Established and its resource can be listed
+	installCRD := func() {
+		created, err := example.ApplyDynamicManifestTracked(crdYAML)
+		clusterScoped = append(clusterScoped, created...)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		establishTimeout := example.Timeout(example.TimeoutAPI, time.Minute)
+		deadline := time.Now().Add(establishTimeout)
+		for {
+			crd, err := dynamicClient.Resource(crdResource).Get(context.TODO(), crdName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+			established := false
+			for _, c := range conditions {
+				condition, ok := c.(map[string]interface{})
+				if ok && condition["type"] == "Established" && condition["status"] == "True" {
+					established = true
+				}
+			}
+			if established {
+				if _, err := widgets().List(context.TODO(), metav1.ListOptions{}); err == nil {
+					return
+				}
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("CRD %s was not established and served within %v", crdName, establishTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		dynamicClient, err = example.DynamicClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		crdYAML, widgetYAML, err = example.GetCRDLifecycleTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+		example.DeleteClusterScopedObjects(logger, config, clusterScoped)
+	})
+
+	ginkgo.It("should install the CRD and serve its resource", func() {
+		logger.Info().Msgf("=== Starting CRD lifecycle E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Installing CRD %s ===", crdName)
+		start := time.Now()
+		installCRD()
+		logger.Info().Msgf("=== CRD established and served after %v ===", time.Since(start).Round(time.Millisecond))
+		example.RecordMetric(testTag, "crd_established_seconds", time.Since(start).Seconds())
+	})
+
+	ginkgo.It("should create, update and delete a custom resource", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Creating Widget from manifest ===")
+		err := example.ApplyDynamicManifest(widgetYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		widget, err := widgets().Get(context.TODO(), "e2e-widget", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		size, _, _ := unstructured.NestedInt64(widget.Object, "spec", "size")
+		gomega.Expect(size).To(gomega.Equal(int64(3)))
+		generation := widget.GetGeneration()
+
+		logger.Info().Msgf("=== Updating Widget size to 5 ===")
+		err = unstructured.SetNestedField(widget.Object, int64(5), "spec", "size")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		updated, err := widgets().Update(context.TODO(), widget, metav1.UpdateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		size, _, _ = unstructured.NestedInt64(updated.Object, "spec", "size")
+		gomega.Expect(size).To(gomega.Equal(int64(5)))
+		gomega.Expect(updated.GetGeneration()).To(gomega.Equal(generation+1), "A spec change must bump the generation")
+
+		logger.Info().Msgf("=== Deleting Widget ===")
+		err = widgets().Delete(context.TODO(), "e2e-widget", metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_, err = widgets().Get(context.TODO(), "e2e-widget", metav1.GetOptions{})
+		gomega.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue(), "Widget still exists after deletion: %v", err)
+	})
+
+	ginkgo.It("should reject custom resources that violate the structural schema", func() {
+		defer example.E2ePanicHandler()
+
+		invalid := map[string]func(spec map[string]interface{}){
+			"size below minimum": func(spec map[string]interface{}) { spec["size"] = 0 },
+			"size above maximum": func(spec map[string]interface{}) { spec["size"] = 11 },
+			"size of wrong type": func(spec map[string]interface{}) { spec["size"] = "big" },
+			"color not in enum":  func(spec map[string]interface{}) { spec["color"] = "purple" },
+			"missing size":       func(spec map[string]interface{}) { delete(spec, "size") },
+		}
+		for description, mutate := range invalid {
+			_, err := widgets().Create(context.TODO(), newWidget("e2e-widget-invalid", mutate), metav1.CreateOptions{})
+			logger.Info().Msgf("%s: %v\n", description, err)
+			gomega.Expect(apierrors.IsInvalid(err)).To(gomega.BeTrue(), "Widget with %s was not rejected as invalid: %v", description, err)
+		}
+
+		// Structural schemas prune fields they don't declare instead of rejecting them
+		created, err := widgets().Create(context.TODO(), newWidget("e2e-widget-pruned", func(spec map[string]interface{}) {
+			spec["undeclared"] = "value"
+		}), metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_, found, _ := unstructured.NestedFieldNoCopy(created.Object, "spec", "undeclared")
+		gomega.Expect(found).To(gomega.BeFalse(), "Undeclared field was not pruned")
+	})
+
+	ginkgo.It("should only change status through the status subresource", func() {
+		defer example.E2ePanicHandler()
+
+		widget, err := widgets().Create(context.TODO(), newWidget("e2e-widget-status", nil), metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		generation := widget.GetGeneration()
+
+		logger.Info().Msgf("=== Writing status through the main resource ===")
+		err = unstructured.SetNestedField(widget.Object, "Ready", "status", "phase")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		widget, err = widgets().Update(context.TODO(), widget, metav1.UpdateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_, found, _ := unstructured.NestedString(widget.Object, "status", "phase")
+		gomega.Expect(found).To(gomega.BeFalse(), "Status was changed through the main resource")
+
+		logger.Info().Msgf("=== Writing status and spec through the status subresource ===")
+		err = unstructured.SetNestedField(widget.Object, "Ready", "status", "phase")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = unstructured.SetNestedField(widget.Object, int64(9), "spec", "size")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		widget, err = widgets().UpdateStatus(context.TODO(), widget, metav1.UpdateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		phase, _, _ := unstructured.NestedString(widget.Object, "status", "phase")
+		gomega.Expect(phase).To(gomega.Equal("Ready"))
+		size, _, _ := unstructured.NestedInt64(widget.Object, "spec", "size")
+		gomega.Expect(size).To(gomega.Equal(int64(3)), "Spec was changed through the status subresource")
+		gomega.Expect(widget.GetGeneration()).To(gomega.Equal(generation), "A status change must not bump the generation")
+	})
+
+	ginkgo.It("should garbage-collect the custom resources when the CRD is deleted", func() {
+		defer example.E2ePanicHandler()
+
+		for i := 0; i < 3; i++ {
+			_, err := widgets().Create(context.TODO(), newWidget(fmt.Sprintf("e2e-widget-gc-%d", i), nil), metav1.CreateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+		existing, err := widgets().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Deleting CRD %s with %d Widgets ===", crdName, len(existing.Items))
+
+		start := time.Now()
+		err = dynamicClient.Resource(crdResource).Delete(context.TODO(), crdName, metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The customresourcecleanup finalizer keeps the CRD until all of its resources are deleted
+		deletionTimeout := example.Timeout(example.TimeoutAPI, 3*time.Minute)
+		deadline := time.Now().Add(deletionTimeout)
+		for {
+			_, err := dynamicClient.Resource(crdResource).Get(context.TODO(), crdName, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				break
+			}
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("CRD %s was not deleted within %v", crdName, deletionTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== CRD deleted after %v ===", time.Since(start).Round(time.Millisecond))
+		example.RecordMetric(testTag, "crd_deletion_seconds", time.Since(start).Seconds())
+
+		_, err = widgets().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(apierrors.IsNotFound(err)).To(gomega.BeTrue(), "Widgets are still served after CRD deletion: %v", err)
+
+		// Reinstalling the CRD shows whether the old resources were left behind in storage
+		logger.Info().Msgf("=== Reinstalling CRD %s ===", crdName)
+		installCRD()
+		remaining, err := widgets().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(remaining.Items).To(gomega.BeEmpty(), "Widgets survived the deletion of their CRD")
+	})
+
+})
@@ -0,0 +1,267 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+// listCronJobJobs returns the Jobs in test-ns owned by the given CronJob
+func listCronJobJobs(clientset *kubernetes.Clientset, cronJobName string) ([]batchv1.Job, error) {
+	jobs, err := clientset.BatchV1().Jobs(example.TestNamespace()).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var owned []batchv1.Job
+	for _, job := range jobs.Items {
+		for _, ref := range job.OwnerReferences {
+			if ref.Kind == "CronJob" && ref.Name == cronJobName {
+				owned = append(owned, job)
+				break
+			}
+		}
+	}
+	return owned, nil
+}
+
+var _ = ginkgo.Describe("CronJob scheduling E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("CronJobSchedulingTest"), func() {
+	var (
+		clientset      *kubernetes.Clientset
+		historyLimit   int32
+		firstApplyTime time.Time
+		logger         zerolog.Logger
+		testTag        = "CronJobSchedulingTest"
+	)
+
+	const (
+		pollInterval = 5 * time.Second
+		// Jobs are expected to be created within this window after their scheduled minute
+		scheduleTolerance = 30 * time.Second
+		// The upstream scheduled-time annotation, set on Jobs by the CronJob controller since 1.28
+		scheduledTimestampAnnotation = "batch.kubernetes.io/cronjob-scheduled-timestamp"
+	)
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		// Emptying the namespace removes the CronJobs together with every Job and pod they spawned
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should apply CronJob manifests", func() {
+		logger.Info().Msgf("=== Starting CronJob scheduling E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		historyYAML, forbidYAML, replaceYAML, err := example.GetCronJobTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		type cronJobSpec struct {
+			Spec struct {
+				SuccessfulJobsHistoryLimit int32 `yaml:"successfulJobsHistoryLimit"`
+			} `yaml:"spec"`
+		}
+
+		var cronJobConfig cronJobSpec
+		err = yaml.Unmarshal(historyYAML, &cronJobConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		historyLimit = cronJobConfig.Spec.SuccessfulJobsHistoryLimit
+
+		// All CronJobs run side by side so the suite waits for the schedule only once
+		firstApplyTime = time.Now()
+		logger.Info().Msgf("=== Applying history CronJob manifest (successfulJobsHistoryLimit: %d) ===", historyLimit)
+		err = example.ApplyRawManifest(clientset, historyYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying Forbid CronJob manifest ===")
+		err = example.ApplyRawManifest(clientset, forbidYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying Replace CronJob manifest ===")
+		err = example.ApplyRawManifest(clientset, replaceYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should spawn Jobs on schedule", func() {
+		defer example.E2ePanicHandler()
+
+		// The first run happens at the next minute boundary
+		firstJobTimeout := example.Timeout(example.TimeoutJob, 3*time.Minute)
+		deadline := firstApplyTime.Add(firstJobTimeout)
+		var jobs []batchv1.Job
+		for {
+			var err error
+			jobs, err = listCronJobJobs(clientset, "history-cronjob")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			if len(jobs) > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("history-cronjob did not spawn any Job within %v", firstJobTimeout))
+			}
+
+			logger.Info().Msgf("Waiting for history-cronjob to spawn its first Job\n")
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		for _, job := range jobs {
+			created := job.CreationTimestamp.Time
+			scheduled := created.Truncate(time.Minute)
+			if value, ok := job.Annotations[scheduledTimestampAnnotation]; ok {
+				parsed, err := time.Parse(time.RFC3339, value)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				scheduled = parsed
+			}
+
+			delay := created.Sub(scheduled)
+			logger.Info().Msgf("Job %-35s scheduled: %s created: %s delay: %v\n",
+				job.Name, scheduled.Format(time.TimeOnly), created.Format(time.TimeOnly), delay)
+
+			gomega.Expect(delay).To(gomega.BeNumerically("<=", scheduleTolerance),
+				fmt.Sprintf("Job %s was created %v after its scheduled time", job.Name, delay))
+		}
+
+		cronJob, err := clientset.BatchV1().CronJobs(example.TestNamespace()).Get(context.TODO(), "history-cronjob", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(cronJob.Status.LastScheduleTime).NotTo(gomega.BeNil(), "CronJob status has no lastScheduleTime")
+	})
+
+	ginkgo.It("should prune successful Jobs beyond successfulJobsHistoryLimit", func() {
+		defer example.E2ePanicHandler()
+
+		// Pruning can only be observed once more Jobs have succeeded than the limit retains
+		logger.Info().Msgf("=== Waiting for more than %d successful runs ===", historyLimit)
+		seenSucceeded := map[string]bool{}
+		deadline := time.Now().Add(example.Timeout(example.TimeoutJob, time.Duration(historyLimit+3)*time.Minute))
+		for {
+			jobs, err := listCronJobJobs(clientset, "history-cronjob")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			var retained int32
+			for _, job := range jobs {
+				if job.Status.Succeeded > 0 {
+					seenSucceeded[job.Name] = true
+					retained++
+				}
+			}
+
+			logger.Info().Msgf("Successful Jobs seen: %d, currently retained: %d (limit %d)\n",
+				len(seenSucceeded), retained, historyLimit)
+
+			if int32(len(seenSucceeded)) > historyLimit && retained <= historyLimit {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Successful Jobs were not pruned to %d (seen %d, retained %d)",
+					historyLimit, len(seenSucceeded), retained))
+			}
+
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		logger.Info().Msgf("=== Successful Job history pruned to %d ===", historyLimit)
+	})
+
+	ginkgo.It("should never run overlapping Jobs with concurrencyPolicy Forbid", func() {
+		defer example.E2ePanicHandler()
+
+		// Each run outlives the schedule interval, so at least one schedule must have been skipped by now
+		jobs, err := listCronJobJobs(clientset, "forbid-cronjob")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(jobs).NotTo(gomega.BeEmpty(), "forbid-cronjob did not spawn any Job")
+
+		cronJob, err := clientset.BatchV1().CronJobs(example.TestNamespace()).Get(context.TODO(), "forbid-cronjob", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(len(cronJob.Status.Active)).To(gomega.BeNumerically("<=", 1),
+			"Forbid CronJob has more than one active Job")
+
+		// Compare the run windows of every pair of Jobs
+		now := time.Now()
+		for i := range jobs {
+			for j := i + 1; j < len(jobs); j++ {
+				a, b := jobs[i], jobs[j]
+				if a.Status.StartTime == nil || b.Status.StartTime == nil {
+					continue
+				}
+
+				aEnd, bEnd := now, now
+				if a.Status.CompletionTime != nil {
+					aEnd = a.Status.CompletionTime.Time
+				}
+				if b.Status.CompletionTime != nil {
+					bEnd = b.Status.CompletionTime.Time
+				}
+
+				overlap := a.Status.StartTime.Time.Before(bEnd) && b.Status.StartTime.Time.Before(aEnd)
+				gomega.Expect(overlap).To(gomega.BeFalse(),
+					fmt.Sprintf("Jobs %s and %s ran concurrently under Forbid policy", a.Name, b.Name))
+			}
+		}
+
+		logger.Info().Msgf("=== %d Forbid Jobs ran without overlapping ===", len(jobs))
+	})
+
+	ginkgo.It("should replace the running Job with concurrencyPolicy Replace", func() {
+		defer example.E2ePanicHandler()
+
+		seenJobs := map[string]bool{}
+		deadline := time.Now().Add(example.Timeout(example.TimeoutJob, 4*time.Minute))
+		for {
+			jobs, err := listCronJobJobs(clientset, "replace-cronjob")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// Replaced Jobs may linger while their deletion is in progress, they don't count as running
+			var running []string
+			for _, job := range jobs {
+				seenJobs[job.Name] = true
+				if _, finished := example.JobFinished(&job); job.DeletionTimestamp == nil && !finished {
+					running = append(running, job.Name)
+				}
+			}
+
+			logger.Info().Msgf("Replace CronJob, Jobs seen: %d, running: %v\n", len(seenJobs), running)
+			gomega.Expect(len(running)).To(gomega.BeNumerically("<=", 1),
+				fmt.Sprintf("Replace CronJob has %d Jobs running at once: %v", len(running), running))
+
+			if len(seenJobs) >= 2 && len(running) == 1 {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("replace-cronjob did not replace its running Job (seen %d Jobs)", len(seenJobs)))
+			}
+
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		logger.Info().Msgf("=== Running Job was replaced by the next scheduled run ===")
+	})
+
+})
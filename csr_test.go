@@ -0,0 +1,221 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	certificatesv1 "k8s.io/api/certificates/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("CertificateSigningRequest API E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("CertificateSigningRequestTest"), func() {
+	var (
+		config    *rest.Config
+		clientset *kubernetes.Clientset
+		key       *ecdsa.PrivateKey
+		csrName   string
+		// The issued certificate, PEM encoded
+		certificatePEM []byte
+		logger         zerolog.Logger
+		testTag        = "CertificateSigningRequestTest"
+	)
+
+	const (
+		// The identity the issued certificate authenticates as. It has no RBAC bindings.
+		username     = "e2e-csr-user"
+		pollInterval = time.Second
+	)
+
+	getCSR := func() *certificatesv1.CertificateSigningRequest {
+		csr, err := clientset.CertificatesV1().CertificateSigningRequests().Get(context.TODO(), csrName, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return csr
+	}
+
+	// canI asks the API server whether the test's own identity may perform the action
+	canI := func(attributes authorizationv1.ResourceAttributes) bool {
+		review, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(context.TODO(), &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+		}, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return review.Status.Allowed
+	}
+
+	deleteCSR := func() {
+		err := clientset.CertificatesV1().CertificateSigningRequests().Delete(context.TODO(), csrName, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Error().Msgf("Failed to delete CSR %s: %v", csrName, err)
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		// CSRs are cluster-scoped, so clearing the namespace doesn't remove it
+		if csrName != "" {
+			deleteCSR()
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should accept a CSR for a client certificate", func() {
+		logger.Info().Msgf("=== Starting CertificateSigningRequest API E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		csrYAML, err := example.GetCSRTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		csr := &certificatesv1.CertificateSigningRequest{}
+		err = utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(csrYAML), 4096).Decode(csr)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		csrName = csr.Name
+
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		request, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: username},
+		}, key)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		csr.Spec.Request = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request})
+
+		// A CSR left behind by an interrupted run would make the create fail
+		deleteCSR()
+		logger.Info().Msgf("=== Submitting CSR %s for %s to %s ===", csrName, username, csr.Spec.SignerName)
+		_, err = clientset.CertificatesV1().CertificateSigningRequests().Create(context.TODO(), csr, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		created := getCSR()
+		gomega.Expect(created.Status.Conditions).To(gomega.BeEmpty(), "CSR was decided without an approval")
+		gomega.Expect(created.Spec.Username).NotTo(gomega.BeEmpty(), "The API server did not record the requester")
+		logger.Info().Msgf("=== CSR pending, requested by %s ===", created.Spec.Username)
+	})
+
+	ginkgo.It("should issue the certificate once the CSR is approved", func() {
+		defer example.E2ePanicHandler()
+
+		csr := getCSR()
+		// Approving client certificates mints identities, so e2e-test-role doesn't grant it by default
+		if !canI(authorizationv1.ResourceAttributes{Group: "certificates.k8s.io", Resource: "signers", Verb: "approve", Name: csr.Spec.SignerName}) ||
+			!canI(authorizationv1.ResourceAttributes{Group: "certificates.k8s.io", Resource: "certificatesigningrequests", Subresource: "approval", Verb: "update"}) {
+			ginkgo.Skip(fmt.Sprintf("Not permitted to approve CSRs for %s", csr.Spec.SignerName))
+		}
+
+		logger.Info().Msgf("=== Approving CSR %s ===", csrName)
+		csr.Status.Conditions = append(csr.Status.Conditions, certificatesv1.CertificateSigningRequestCondition{
+			Type:    certificatesv1.CertificateApproved,
+			Status:  v1.ConditionTrue,
+			Reason:  "E2ETest",
+			Message: "Approved by the CertificateSigningRequest API E2E test",
+		})
+		start := time.Now()
+		_, err := clientset.CertificatesV1().CertificateSigningRequests().UpdateApproval(context.TODO(), csrName, csr, metav1.UpdateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		issuanceTimeout := example.Timeout(example.TimeoutAPI, 2*time.Minute)
+		deadline := start.Add(issuanceTimeout)
+		for {
+			current := getCSR()
+			for _, condition := range current.Status.Conditions {
+				if condition.Type == certificatesv1.CertificateFailed {
+					ginkgo.Fail(fmt.Sprintf("Signing failed: %s: %s", condition.Reason, condition.Message))
+				}
+			}
+			if len(current.Status.Certificate) > 0 {
+				certificatePEM = current.Status.Certificate
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("No certificate was issued for %s within %v", current.Spec.SignerName, issuanceTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== Certificate issued after %v ===", time.Since(start).Round(time.Millisecond))
+		example.RecordMetric(testTag, "issuance_seconds", time.Since(start).Seconds())
+
+		block, _ := pem.Decode(certificatePEM)
+		gomega.Expect(block).NotTo(gomega.BeNil(), "Issued certificate is not PEM encoded")
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Subject %s, issuer %s, valid until %s ===",
+			certificate.Subject, certificate.Issuer, certificate.NotAfter.Format(time.RFC3339))
+
+		gomega.Expect(certificate.Subject.CommonName).To(gomega.Equal(username))
+		gomega.Expect(certificate.ExtKeyUsage).To(gomega.ContainElement(x509.ExtKeyUsageClientAuth))
+		gomega.Expect(certificate.PublicKey).To(gomega.Equal(key.Public()), "Certificate was issued for another key")
+		// expirationSeconds is 600, signers may only shorten it
+		gomega.Expect(certificate.NotAfter).To(gomega.BeTemporally("<=", start.Add(15*time.Minute)),
+			"The signer ignored expirationSeconds")
+	})
+
+	ginkgo.It("should authenticate with the issued certificate", func() {
+		defer example.E2ePanicHandler()
+
+		if certificatePEM == nil {
+			ginkgo.Skip("No certificate was issued")
+		}
+
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		// Only the endpoint and the server trust are taken over, never the test's own credentials
+		certConfig := &rest.Config{
+			Host: config.Host,
+			TLSClientConfig: rest.TLSClientConfig{
+				Insecure:   config.Insecure,
+				ServerName: config.ServerName,
+				CAFile:     config.CAFile,
+				CAData:     config.CAData,
+				CertData:   certificatePEM,
+				KeyData:    pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+			},
+		}
+		certClientset, err := kubernetes.NewForConfig(certConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The user has no permissions, so Forbidden for that user proves the authentication; an
+		// unaccepted certificate would be Unauthorized instead
+		_, err = certClientset.CoreV1().Pods(example.TestNamespace()).List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).To(gomega.HaveOccurred(), "User %s without bindings was allowed to list pods", username)
+		logger.Info().Msgf("=== Request with the certificate: %v ===", err)
+		gomega.Expect(apierrors.IsUnauthorized(err)).To(gomega.BeFalse(), "The API server did not accept the issued certificate")
+		gomega.Expect(apierrors.IsForbidden(err)).To(gomega.BeTrue(), "Unexpected error type: %v", err)
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring(fmt.Sprintf("User %q", username)))
+	})
+
+})
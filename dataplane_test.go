@@ -0,0 +1,190 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Service dataplane consistency E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("ServiceDataplaneConsistencyTest"), func() {
+	var (
+		config    *rest.Config
+		clientset *kubernetes.Clientset
+		logger    zerolog.Logger
+		testTag   = "ServiceDataplaneConsistencyTest"
+	)
+
+	const (
+		minReplicas = 2
+		maxReplicas = 6
+		// Overridable with DATAPLANE_SCALE_CYCLES in .env
+		defaultCycles = 5
+		// Overridable with DATAPLANE_MAX_ERROR_RATE in .env, as a fraction of all requests
+		defaultMaxErrorRate = 0.01
+		baselineWindow      = 10 * time.Second
+		pollInterval        = time.Second
+	)
+
+	// counts returns the client's running totals of successful and failed requests
+	counts := func() (int, int) {
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "dataplane-client", "client",
+			[]string{"cat", "/tmp/counts"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "stderr: %s", stderr)
+		fields := strings.Fields(stdout)
+		gomega.Expect(fields).To(gomega.HaveLen(2), "Unexpected counts: %q", stdout)
+		ok, err := strconv.Atoi(fields[0])
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		failed, err := strconv.Atoi(fields[1])
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return ok, failed
+	}
+
+	setReplicas := func(replicas int32) {
+		err := example.Scale(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), "dataplane-backend", replicas)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	// waitForReplicas waits until exactly replicas backend pods exist, terminating ones included, and all are ready
+	waitForReplicas := func(replicas int, timeout time.Duration) {
+		timeout = example.Timeout(example.TimeoutPods, timeout)
+		deadline := time.Now().Add(timeout)
+		for {
+			pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=dataplane-backend"})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			ready := 0
+			for _, pod := range pods {
+				for _, condition := range pod.Status.Conditions {
+					if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue && pod.DeletionTimestamp == nil {
+						ready++
+					}
+				}
+			}
+			if len(pods) == replicas && ready == replicas {
+				return
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Backend has %d pods, %d ready, after %v, expected %d", len(pods), ready, timeout, replicas))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should serve every request while the backends are stable", func() {
+		logger.Info().Msgf("=== Starting Service dataplane consistency E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		backendYAML, clientYAML, err := example.GetDataplaneTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying backend Deployment, Service and client pod manifests ===")
+		err = example.ApplyRawManifest(clientset, backendYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		waitForReplicas(minReplicas, 3*time.Minute)
+		err = example.ApplyRawManifest(clientset, clientYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The counts file appears with the first finished request
+		firstRequestTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(firstRequestTimeout)
+		for {
+			_, _, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "dataplane-client", "client",
+				[]string{"test", "-e", "/tmp/counts"})
+			if err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Client did not report any request within %v: %v", firstRequestTimeout, err))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		// Failures now can't be blamed on endpoint churn, so the rest of the test would be meaningless
+		okBefore, failedBefore := counts()
+		time.Sleep(baselineWindow)
+		okAfter, failedAfter := counts()
+		logger.Info().Msgf("=== Baseline: %d requests, %d failed in %v ===",
+			okAfter-okBefore+failedAfter-failedBefore, failedAfter-failedBefore, baselineWindow)
+		gomega.Expect(okAfter-okBefore).To(gomega.BeNumerically(">", 0), "No request succeeded with stable backends")
+		gomega.Expect(failedAfter-failedBefore).To(gomega.BeZero(), "Requests failed with stable backends")
+	})
+
+	ginkgo.It("should keep the error rate below the threshold while the backends scale up and down", func() {
+		defer example.E2ePanicHandler()
+
+		cycles := defaultCycles
+		if value := os.Getenv("DATAPLANE_SCALE_CYCLES"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid DATAPLANE_SCALE_CYCLES: %s", value)
+			cycles = parsed
+		}
+		maxErrorRate := defaultMaxErrorRate
+		if value := os.Getenv("DATAPLANE_MAX_ERROR_RATE"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid DATAPLANE_MAX_ERROR_RATE: %s", value)
+			maxErrorRate = parsed
+		}
+
+		okBefore, failedBefore := counts()
+		start := time.Now()
+		for cycle := 1; cycle <= cycles; cycle++ {
+			logger.Info().Msgf("=== Cycle %d/%d: scaling %d -> %d -> %d ===", cycle, cycles, minReplicas, maxReplicas, minReplicas)
+			setReplicas(maxReplicas)
+			waitForReplicas(maxReplicas, 3*time.Minute)
+			setReplicas(minReplicas)
+			waitForReplicas(minReplicas, 3*time.Minute)
+		}
+		okAfter, failedAfter := counts()
+
+		total := okAfter - okBefore + failedAfter - failedBefore
+		failed := failedAfter - failedBefore
+		gomega.Expect(total).To(gomega.BeNumerically(">", 0), "The client sent no requests during the scaling")
+		errorRate := float64(failed) / float64(total)
+		logger.Info().Msgf("=== %d cycles in %v: %d requests, %d failed, error rate %.4f (threshold %.4f) ===",
+			cycles, time.Since(start).Round(time.Second), total, failed, errorRate, maxErrorRate)
+
+		example.RecordMetric(testTag, "requests", total)
+		example.RecordMetric(testTag, "failed_requests", failed)
+		example.RecordMetric(testTag, "error_rate", errorRate)
+		gomega.Expect(errorRate).To(gomega.BeNumerically("<=", maxErrorRate),
+			"%d of %d requests failed while the endpoints changed", failed, total)
+	})
+
+})
@@ -0,0 +1,174 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Ephemeral debug container E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("EphemeralDebugContainerTest"), func() {
+	var (
+		clientset    *kubernetes.Clientset
+		config       *rest.Config
+		targetYAML   []byte
+		debuggerYAML []byte
+		debugger     *v1.EphemeralContainer
+		initialState v1.ContainerStatus
+		podUID       string
+		logger       zerolog.Logger
+		testTag      = "EphemeralDebugContainerTest"
+	)
+
+	const pollInterval = time.Second
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		targetYAML, debuggerYAML, err = example.GetDebugContainerTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should run the target pod", func() {
+		logger.Info().Msgf("=== Starting Ephemeral debug container E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying target pod manifest ===")
+		err := example.ApplyRawManifest(clientset, targetYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "debug-target", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if pod.Status.Phase == v1.PodRunning && len(pod.Status.ContainerStatuses) > 0 {
+				initialState = pod.Status.ContainerStatuses[0]
+				podUID = string(pod.UID)
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("debug-target did not reach Running within %v", runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== debug-target is running (container: %s, restartCount: %d) ===",
+			initialState.ContainerID, initialState.RestartCount)
+	})
+
+	ginkgo.It("should attach an ephemeral container through the ephemeralcontainers subresource", func() {
+		defer example.E2ePanicHandler()
+
+		debugger = &v1.EphemeralContainer{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(debuggerYAML), 4096).Decode(debugger)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "debug-target", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, *debugger)
+
+		logger.Info().Msgf("=== Adding ephemeral container %s (image: %s, target: %s) ===",
+			debugger.Name, debugger.Image, debugger.TargetContainerName)
+		addedAt := time.Now()
+		_, err = clientset.CoreV1().Pods(example.TestNamespace()).UpdateEphemeralContainers(context.TODO(), "debug-target", pod, metav1.UpdateOptions{})
+		if apierrors.IsNotFound(err) || apierrors.IsMethodNotSupported(err) {
+			ginkgo.Skip(fmt.Sprintf("The API server does not serve the ephemeralcontainers subresource: %v", err))
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "The cluster rejected the ephemeral container")
+
+		startTimeout := example.Timeout(example.TimeoutPods, 2*time.Minute)
+		deadline := addedAt.Add(startTimeout)
+		for {
+			pod, err = clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "debug-target", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			var status *v1.ContainerStatus
+			for i := range pod.Status.EphemeralContainerStatuses {
+				if pod.Status.EphemeralContainerStatuses[i].Name == debugger.Name {
+					status = &pod.Status.EphemeralContainerStatuses[i]
+				}
+			}
+			if status != nil && status.State.Running != nil {
+				logger.Info().Msgf("=== Ephemeral container running after %v ===", time.Since(addedAt).Round(time.Millisecond))
+				example.RecordMetric(testTag, "ephemeral_container_start_seconds", time.Since(addedAt).Seconds())
+				break
+			}
+			if status != nil && status.State.Terminated != nil {
+				ginkgo.Fail(fmt.Sprintf("Ephemeral container terminated: %s (exit code %d)",
+					status.State.Terminated.Reason, status.State.Terminated.ExitCode))
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Ephemeral container did not start within %v (status: %+v)", startTimeout, status))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	})
+
+	ginkgo.It("should run diagnostic commands in the ephemeral container", func() {
+		defer example.E2ePanicHandler()
+
+		output, err := example.GetPodLogs(context.TODO(), clientset, example.TestNamespace(), "debug-target", example.PodLogOptions{
+			Container: debugger.Name,
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(output).To(gomega.ContainSubstring("debug session started"))
+
+		// Sharing the target's process namespace is what makes kubectl debug --target useful
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "debug-target", debugger.Name,
+			[]string{"ps", "-o", "pid,args"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Running ps in the ephemeral container failed: %s", stderr)
+		logger.Info().Msgf("Processes visible to the debugger:\n%s", stdout)
+		gomega.Expect(strings.Contains(stdout, "sleep 3600")).To(gomega.BeTrue(),
+			"The debugger cannot see the target container's processes")
+	})
+
+	ginkgo.It("should leave the target container running without a restart", func() {
+		defer example.E2ePanicHandler()
+
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "debug-target", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		status := pod.Status.ContainerStatuses[0]
+		logger.Info().Msgf("=== debug-target container: %s, restartCount: %d ===", status.ContainerID, status.RestartCount)
+
+		gomega.Expect(string(pod.UID)).To(gomega.Equal(podUID), "The pod was recreated")
+		gomega.Expect(pod.Status.Phase).To(gomega.Equal(v1.PodRunning))
+		gomega.Expect(status.RestartCount).To(gomega.Equal(initialState.RestartCount))
+		gomega.Expect(status.ContainerID).To(gomega.Equal(initialState.ContainerID))
+		gomega.Expect(status.State.Running).NotTo(gomega.BeNil())
+	})
+
+})
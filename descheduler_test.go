@@ -0,0 +1,240 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Descheduler interaction E2E test", ginkgo.Ordered, ginkgo.Label("disruptive"), example.SuiteConcurrency("DeschedulerInteractionTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		cycle     time.Duration
+		// The two nodes the pods are restricted to. The second one is cordoned during the scale-up.
+		nodeNames []string
+		hostnames []string
+		// Nodes this suite cordoned and must uncordon, even when a spec fails
+		cordonedNodes []string
+		logger        zerolog.Logger
+		testTag       = "DeschedulerInteractionTest"
+	)
+
+	const (
+		replicas = 4
+		// The descheduler's default interval. Overridable with DESCHEDULER_CYCLE_SECONDS in .env
+		defaultCycleSeconds = 300
+		// nodeTaintsPolicy in the fixture is beta and enabled by default from 1.26
+		minimumVersion = "1.26"
+		pollInterval   = time.Second
+	)
+
+	// podsPerNode returns the non-terminating descheduler-app pods per node, how many are ready and the
+	// names of all of them
+	podsPerNode := func() (map[string]int, int, []string) {
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=descheduler-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		perNode := map[string]int{}
+		ready := 0
+		var names []string
+		for _, pod := range pods {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			names = append(names, pod.Name)
+			if pod.Spec.NodeName != "" {
+				perNode[pod.Spec.NodeName]++
+			}
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+					ready++
+				}
+			}
+		}
+		return perNode, ready, names
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		supported, serverVersion, err := example.ServerVersionAtLeast(clientset, minimumVersion)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if !supported {
+			ginkgo.Skip(fmt.Sprintf("Server version %s is older than %s", serverVersion, minimumVersion))
+		}
+
+		// The descheduler runs either as a Deployment or as a CronJob, both under the same name
+		deschedulerNamespace := os.Getenv("DESCHEDULER_NAMESPACE")
+		if deschedulerNamespace == "" {
+			deschedulerNamespace = "kube-system"
+		}
+		deschedulerName := os.Getenv("DESCHEDULER_NAME")
+		if deschedulerName == "" {
+			deschedulerName = "descheduler"
+		}
+		_, err = clientset.AppsV1().Deployments(deschedulerNamespace).Get(context.TODO(), deschedulerName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			_, err = clientset.BatchV1().CronJobs(deschedulerNamespace).Get(context.TODO(), deschedulerName, metav1.GetOptions{})
+		}
+		if apierrors.IsNotFound(err) {
+			ginkgo.Skip(fmt.Sprintf("No descheduler Deployment or CronJob %s/%s", deschedulerNamespace, deschedulerName))
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		cycle = defaultCycleSeconds * time.Second
+		if value := os.Getenv("DESCHEDULER_CYCLE_SECONDS"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid DESCHEDULER_CYCLE_SECONDS: %s", value)
+			cycle = time.Duration(seconds) * time.Second
+		}
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, node := range nodes.Items {
+			if node.Spec.Unschedulable || len(node.Spec.Taints) > 0 || node.Labels[v1.LabelHostname] == "" || len(nodeNames) == 2 {
+				continue
+			}
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+					nodeNames = append(nodeNames, node.Name)
+					hostnames = append(hostnames, node.Labels[v1.LabelHostname])
+				}
+			}
+		}
+		if len(nodeNames) < 2 {
+			ginkgo.Skip(fmt.Sprintf("Skewing the placement needs 2 ready, schedulable nodes without taints, found %v", nodeNames))
+		}
+		logger.Info().Msgf("=== Descheduler %s/%s found, cycle %v, nodes %v ===", deschedulerNamespace, deschedulerName, cycle, nodeNames)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		for _, node := range cordonedNodes {
+			logger.Info().Msgf("=== Restoring node %s ===", node)
+			if err := example.UncordonNode(context.TODO(), clientset, node); err != nil {
+				logger.Error().Msgf("Failed to uncordon node %s: %v", node, err)
+			}
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should place every replica on one node while the other is cordoned", func() {
+		logger.Info().Msgf("=== Starting Descheduler interaction E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		pdbYAML, deploymentYAML, err := example.GetDeschedulerTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Cordoning %s during the scale-up ===", nodeNames[1])
+		err = example.CordonNode(context.TODO(), clientset, nodeNames[1])
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		cordonedNodes = append(cordonedNodes, nodeNames[1])
+
+		err = example.ApplyRawManifest(clientset, pdbYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deployment := &appsv1.Deployment{}
+		err = utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(deploymentYAML), 4096).Decode(deployment)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		count := int32(replicas)
+		deployment.Spec.Replicas = &count
+		deployment.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.
+			NodeSelectorTerms[0].MatchExpressions[0].Values = hostnames
+		logger.Info().Msgf("=== Creating Deployment with %d replicas on %v ===", replicas, hostnames)
+		_, err = clientset.AppsV1().Deployments(example.TestNamespace()).Create(context.TODO(), deployment, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		readyTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(readyTimeout)
+		for {
+			_, ready, _ := podsPerNode()
+			if ready == replicas {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("descheduler-app has %d/%d ready pods after %v", ready, replicas, readyTimeout))
+			}
+			time.Sleep(example.CheckInterval(2 * time.Second))
+		}
+		perNode, _, _ := podsPerNode()
+		logger.Info().Msgf("=== Pods per node: %v ===", perNode)
+		gomega.Expect(perNode[nodeNames[0]]).To(gomega.Equal(replicas), "Pods were not all placed on %s", nodeNames[0])
+
+		logger.Info().Msgf("=== Uncordoning %s ===", nodeNames[1])
+		err = example.UncordonNode(context.TODO(), clientset, nodeNames[1])
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		cordonedNodes = nil
+	})
+
+	ginkgo.It("should rebalance the pods within two descheduler cycles without violating the PDB", func() {
+		defer example.E2ePanicHandler()
+
+		// The descheduler may have just finished a cycle, so up to two are allowed
+		timeout := 2 * cycle
+		logger.Info().Msgf("=== Waiting up to %v for the descheduler to rebalance ===", timeout)
+
+		start := time.Now()
+		deadline := start.Add(timeout)
+		minReady := replicas
+		seen := map[string]bool{}
+		for {
+			perNode, ready, names := podsPerNode()
+			for _, name := range names {
+				seen[name] = true
+			}
+			if ready < minReady {
+				minReady = ready
+			}
+			// maxUnavailable 1 in the PDB: the descheduler evicts, so it may never take two pods at once
+			gomega.Expect(ready).To(gomega.BeNumerically(">=", replicas-1),
+				"Ready pods dropped to %d, the PDB allows only 1 unavailable", ready)
+
+			skew := perNode[nodeNames[0]] - perNode[nodeNames[1]]
+			if skew < 0 {
+				skew = -skew
+			}
+			if skew <= 1 && ready == replicas && len(names) == replicas {
+				logger.Info().Msgf("=== Rebalanced after %v, pods per node: %v ===", time.Since(start).Round(time.Second), perNode)
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pods were not rebalanced within %v: pods per node %v, %d/%d ready",
+					timeout, perNode, ready, replicas))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		example.RecordMetric(testTag, "rebalance_seconds", time.Since(start).Seconds())
+		example.RecordMetric(testTag, "evicted_pods", len(seen)-replicas)
+		example.RecordMetric(testTag, "min_ready_during_rebalance", minReady)
+	})
+
+})
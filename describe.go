@@ -0,0 +1,209 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+)
+
+// describeEventLimit is how many of the object's most recent events DescribeObject shows
+const describeEventLimit = 10
+
+// DescribeObject returns a human-readable dump of any object, like kubectl describe: its metadata,
+// spec, status, conditions and most recent events. The namespace is ignored for cluster-scoped kinds.
+// It is meant for logs when an assertion fails:
+//
+//	if ginkgo.CurrentSpecReport().Failed() {
+//		description, _ := example.DescribeObject(context.TODO(), config, appsv1.SchemeGroupVersion.WithKind("Deployment"), "test-ns", "app")
+//		logger.Error().Msgf("%s", description)
+//	}
+func DescribeObject(ctx context.Context, config *rest.Config, gvk schema.GroupVersionKind, namespace, name string) (string, error) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return "", fmt.Errorf("dynamic client creation error: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return "", fmt.Errorf("discovery client creation error: %w", err)
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return "", fmt.Errorf("client creation error: %w", err)
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return "", fmt.Errorf("no resource for %s: %w", gvk, err)
+	}
+	var resource dynamic.ResourceInterface
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		resource = dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+	} else {
+		resource = dynamicClient.Resource(mapping.Resource)
+		// Events about cluster-scoped objects are recorded in the default namespace
+		namespace = metav1.NamespaceDefault
+	}
+	object, err := resource.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("%s %s lookup failed: %w", gvk.Kind, name, err)
+	}
+
+	var builder strings.Builder
+	writeObjectMeta(&builder, object)
+	writeSection(&builder, "Spec", object.Object["spec"])
+	status, _, _ := unstructured.NestedMap(object.Object, "status")
+	conditions, _, _ := unstructured.NestedSlice(object.Object, "status", "conditions")
+	if status != nil {
+		delete(status, "conditions")
+		writeSection(&builder, "Status", status)
+	}
+	writeConditions(&builder, conditions)
+
+	events, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("involvedObject.uid", string(object.GetUID())).String(),
+	})
+	if err != nil {
+		fmt.Fprintf(&builder, "Events: <listing failed: %v>\n", err)
+	} else {
+		writeEvents(&builder, events.Items)
+	}
+	return builder.String(), nil
+}
+
+func writeObjectMeta(builder *strings.Builder, object *unstructured.Unstructured) {
+	writer := tabwriter.NewWriter(builder, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer, "Name:\t%s\n", object.GetName())
+	if object.GetNamespace() != "" {
+		fmt.Fprintf(writer, "Namespace:\t%s\n", object.GetNamespace())
+	}
+	fmt.Fprintf(writer, "Kind:\t%s (%s)\n", object.GetKind(), object.GetAPIVersion())
+	fmt.Fprintf(writer, "Labels:\t%s\n", formatMap(object.GetLabels()))
+	fmt.Fprintf(writer, "Annotations:\t%s\n", formatMap(object.GetAnnotations()))
+	fmt.Fprintf(writer, "Created:\t%s\n", object.GetCreationTimestamp().Format(time.RFC3339))
+	if deletion := object.GetDeletionTimestamp(); deletion != nil {
+		fmt.Fprintf(writer, "Deleting since:\t%s, finalizers %v\n", deletion.Format(time.RFC3339), object.GetFinalizers())
+	}
+	var owners []string
+	for _, owner := range object.GetOwnerReferences() {
+		owners = append(owners, owner.Kind+"/"+owner.Name)
+	}
+	if len(owners) > 0 {
+		fmt.Fprintf(writer, "Owners:\t%s\n", strings.Join(owners, ", "))
+	}
+	writer.Flush()
+}
+
+func formatMap(values map[string]string) string {
+	if len(values) == 0 {
+		return "<none>"
+	}
+	pairs := make([]string, 0, len(values))
+	for key, value := range values {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ", ")
+}
+
+// writeSection writes the value as indented YAML under the title, nothing when it is empty
+func writeSection(builder *strings.Builder, title string, value interface{}) {
+	if value == nil {
+		return
+	}
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		fmt.Fprintf(builder, "%s: <%v>\n", title, err)
+		return
+	}
+	if trimmed := strings.TrimSpace(string(content)); trimmed == "" || trimmed == "{}" {
+		return
+	}
+	fmt.Fprintf(builder, "%s:\n", title)
+	for _, line := range strings.Split(strings.TrimRight(string(content), "\n"), "\n") {
+		fmt.Fprintf(builder, "  %s\n", line)
+	}
+}
+
+func writeConditions(builder *strings.Builder, conditions []interface{}) {
+	if len(conditions) == 0 {
+		return
+	}
+	fmt.Fprintf(builder, "Conditions:\n")
+	writer := tabwriter.NewWriter(builder, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer, "  Type\tStatus\tReason\tLast transition\tMessage\n")
+	for _, condition := range conditions {
+		entry, ok := condition.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(writer, "  %v\t%v\t%v\t%v\t%v\n", entry["type"], entry["status"], valueOrNone(entry["reason"]),
+			valueOrNone(entry["lastTransitionTime"]), valueOrNone(entry["message"]))
+	}
+	writer.Flush()
+}
+
+func valueOrNone(value interface{}) interface{} {
+	if value == nil || value == "" {
+		return "-"
+	}
+	return value
+}
+
+// writeEvents writes the most recent events, oldest first, like kubectl describe
+func writeEvents(builder *strings.Builder, events []corev1.Event) {
+	if len(events) == 0 {
+		fmt.Fprintf(builder, "Events: <none>\n")
+		return
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return eventTime(events[i]).Before(eventTime(events[j]))
+	})
+	if len(events) > describeEventLimit {
+		events = events[len(events)-describeEventLimit:]
+	}
+	fmt.Fprintf(builder, "Events:\n")
+	writer := tabwriter.NewWriter(builder, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(writer, "  Type\tReason\tAge\tFrom\tMessage\n")
+	for _, event := range events {
+		age := time.Since(eventTime(event)).Round(time.Second).String()
+		if event.Count > 1 {
+			age += fmt.Sprintf(" (x%d)", event.Count)
+		}
+		from := event.Source.Component
+		if from == "" {
+			from = event.ReportingController
+		}
+		fmt.Fprintf(writer, "  %s\t%s\t%s\t%s\t%s\n", event.Type, event.Reason, age, from, strings.TrimSpace(event.Message))
+	}
+	writer.Flush()
+}
+
+// eventTime is when the event last happened. Events created through the events.k8s.io API only set
+// EventTime.
+func eventTime(event corev1.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
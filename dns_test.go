@@ -0,0 +1,244 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var digQueryTimePattern = regexp.MustCompile(`Query time: (\d+) msec`)
+
+var _ = ginkgo.Describe("Cluster DNS E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("ClusterDNSTest"), func() {
+	var (
+		clientset       *kubernetes.Clientset
+		config          *rest.Config
+		localServiceIP  string
+		remoteServiceIP string
+		logger          zerolog.Logger
+		testTag         = "ClusterDNSTest"
+		remoteNamespace = example.TestNamespaced("test-ns-dns")
+	)
+
+	const (
+		clusterDomain = "cluster.local"
+		// Query load used for the latency measurement: loadWorkers concurrent loops of loadQueries lookups each
+		loadWorkers = 4
+		loadQueries = 50
+		// Default p95 budget, overridable with DNS_P95_THRESHOLD_MS in .env
+		defaultP95ThresholdMs = 200
+	)
+
+	// dig resolves the name from inside the given client pod, honoring the pod's search list
+	dig := func(podName, name string) string {
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), podName, "client",
+			[]string{"dig", "+short", "+search", name})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "dig failed: %s", stderr)
+		return strings.TrimSpace(stdout)
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespaceByName(logger, clientset, remoteNamespace)
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should apply Services and DNS client pods", func() {
+		logger.Info().Msgf("=== Starting Cluster DNS E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		servicesYAML, clientsYAML, err := example.GetDNSTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying Services manifest ===")
+		err = example.ApplyDynamicManifest(servicesYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying DNS client pods manifest ===")
+		err = example.ApplyDynamicManifest(clientsYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		localService, err := clientset.CoreV1().Services(example.TestNamespace()).Get(context.TODO(), "local-svc", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		localServiceIP = localService.Spec.ClusterIP
+
+		remoteService, err := clientset.CoreV1().Services(remoteNamespace).Get(context.TODO(), "remote-svc", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		remoteServiceIP = remoteService.Spec.ClusterIP
+		logger.Info().Msgf("=== local-svc ClusterIP: %s, remote-svc ClusterIP: %s ===", localServiceIP, remoteServiceIP)
+
+		logger.Info().Msgf("=== Waiting for DNS client pods to run ===")
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			pods, err := example.ListPods(
+				context.TODO(),
+				clientset,
+				example.TestNamespace(),
+				metav1.ListOptions{
+					LabelSelector: "app=dns-client",
+					FieldSelector: "status.phase=Running",
+				},
+			)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			logger.Info().Msgf("Running DNS client pods: %d/2\n", len(pods))
+			if len(pods) == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("DNS client pods did not reach Running within %v", runningTimeout))
+			}
+
+			time.Sleep(example.CheckInterval(3 * time.Second))
+		}
+	})
+
+	ginkgo.It("should resolve Service names in the pod's namespace", func() {
+		defer example.E2ePanicHandler()
+
+		for _, name := range []string{
+			"local-svc",
+			example.TestNamespaced("local-svc.test-ns"),
+			example.TestNamespaced("local-svc.test-ns.svc"),
+			example.TestNamespaced("local-svc.test-ns.svc.") + clusterDomain,
+		} {
+			resolved := dig("dns-client", name)
+			logger.Info().Msgf("%-45s -> %s\n", name, resolved)
+			gomega.Expect(resolved).To(gomega.Equal(localServiceIP), "Unexpected answer for %s", name)
+		}
+	})
+
+	ginkgo.It("should resolve cross-namespace FQDNs", func() {
+		defer example.E2ePanicHandler()
+
+		for _, name := range []string{
+			"remote-svc." + remoteNamespace,
+			"remote-svc." + remoteNamespace + ".svc." + clusterDomain,
+		} {
+			resolved := dig("dns-client", name)
+			logger.Info().Msgf("%-45s -> %s\n", name, resolved)
+			gomega.Expect(resolved).To(gomega.Equal(remoteServiceIP), "Unexpected answer for %s", name)
+		}
+
+		// The short name must not leak across namespaces through the default search list
+		resolved := dig("dns-client", "remote-svc")
+		logger.Info().Msgf("%-45s -> %q\n", "remote-svc", resolved)
+		gomega.Expect(resolved).To(gomega.BeEmpty(), "Short name of a Service in another namespace resolved")
+	})
+
+	ginkgo.It("should apply pod dnsConfig search domains and ndots", func() {
+		defer example.E2ePanicHandler()
+
+		defaultResolv, _, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "dns-client", "client",
+			[]string{"cat", "/etc/resolv.conf"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("dns-client resolv.conf:\n%s", defaultResolv)
+		gomega.Expect(defaultResolv).To(gomega.ContainSubstring("ndots:5"))
+
+		customResolv, _, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "dns-client-custom", "client",
+			[]string{"cat", "/etc/resolv.conf"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("dns-client-custom resolv.conf:\n%s", customResolv)
+		gomega.Expect(customResolv).To(gomega.ContainSubstring("ndots:1"))
+		gomega.Expect(customResolv).To(gomega.ContainSubstring(remoteNamespace + ".svc." + clusterDomain))
+
+		// The extra search domain makes the remote Service resolvable by its short name
+		resolved := dig("dns-client-custom", "remote-svc")
+		logger.Info().Msgf("dns-client-custom: %-27s -> %s\n", "remote-svc", resolved)
+		gomega.Expect(resolved).To(gomega.Equal(remoteServiceIP))
+
+		// With ndots:1 a dotted name is tried as absolute first but the search list still applies
+		resolved = dig("dns-client-custom", example.TestNamespaced("local-svc.test-ns"))
+		logger.Info().Msgf("dns-client-custom: %-27s -> %s\n", example.TestNamespaced("local-svc.test-ns"), resolved)
+		gomega.Expect(resolved).To(gomega.Equal(localServiceIP))
+	})
+
+	ginkgo.It("should keep lookup latency within budget under query load", func() {
+		defer example.E2ePanicHandler()
+
+		threshold := float64(defaultP95ThresholdMs)
+		if value := os.Getenv("DNS_P95_THRESHOLD_MS"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid DNS_P95_THRESHOLD_MS")
+			threshold = parsed
+		}
+
+		fqdn := example.TestNamespaced("local-svc.test-ns.svc.") + clusterDomain
+		script := fmt.Sprintf(
+			"for w in $(seq 1 %d); do (for i in $(seq 1 %d); do dig +tries=1 +time=2 %s | grep -E 'status:|Query time:'; done) & done; wait",
+			loadWorkers, loadQueries, fqdn)
+
+		logger.Info().Msgf("=== Running %d concurrent loops of %d lookups ===", loadWorkers, loadQueries)
+		start := time.Now()
+		output, _, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "dns-client", "client",
+			[]string{"bash", "-c", script})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		elapsed := time.Since(start)
+
+		var latencies []float64
+		successful := 0
+		for _, line := range strings.Split(output, "\n") {
+			if strings.Contains(line, "status: NOERROR") {
+				successful++
+			}
+			if match := digQueryTimePattern.FindStringSubmatch(line); match != nil {
+				ms, err := strconv.ParseFloat(match[1], 64)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				latencies = append(latencies, ms)
+			}
+		}
+
+		total := loadWorkers * loadQueries
+		failed := total - successful
+		p50 := example.Percentile(latencies, 50)
+		p95 := example.Percentile(latencies, 95)
+		p99 := example.Percentile(latencies, 99)
+
+		logger.Info().Msgf("=== %d lookups in %v, failed: %d, p50: %.0fms, p95: %.0fms, p99: %.0fms (budget p95 <= %.0fms) ===",
+			total, elapsed.Round(time.Millisecond), failed, p50, p95, p99, threshold)
+
+		example.RecordMetric(testTag, "dns_lookups_total", total)
+		example.RecordMetric(testTag, "dns_lookups_failed", failed)
+		example.RecordMetric(testTag, "dns_lookup_p50_ms", p50)
+		example.RecordMetric(testTag, "dns_lookup_p95_ms", p95)
+		example.RecordMetric(testTag, "dns_lookup_p99_ms", p99)
+
+		gomega.Expect(failed).To(gomega.BeZero(), "%d of %d lookups did not return NOERROR", failed, total)
+		gomega.Expect(p95).To(gomega.BeNumerically("<=", threshold),
+			fmt.Sprintf("p95 lookup latency %.0fms exceeds budget of %.0fms", p95, threshold))
+	})
+
+})
@@ -0,0 +1,110 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ServiceEndpoint is one address of a Service as its EndpointSlices list it
+type ServiceEndpoint struct {
+	Address string
+	// Pod is the name of the pod behind the address, empty for endpoints that aren't pods
+	Pod         string
+	Ready       bool
+	Serving     bool
+	Terminating bool
+}
+
+// ServiceEndpoints are the endpoints of a Service, from all of its EndpointSlices
+type ServiceEndpoints []ServiceEndpoint
+
+// Ready returns the endpoints kube-proxy sends new traffic to
+func (e ServiceEndpoints) Ready() ServiceEndpoints {
+	var ready ServiceEndpoints
+	for _, endpoint := range e {
+		if endpoint.Ready {
+			ready = append(ready, endpoint)
+		}
+	}
+	return ready
+}
+
+// Find returns the endpoint with the address, e.g. a pod IP, and whether the Service lists it at all
+func (e ServiceEndpoints) Find(address string) (ServiceEndpoint, bool) {
+	for _, endpoint := range e {
+		if endpoint.Address == address {
+			return endpoint, true
+		}
+	}
+	return ServiceEndpoint{}, false
+}
+
+// GetServiceEndpoints lists the endpoints of the Service's EndpointSlices. An address that several
+// slices list, e.g. while the controller moves it between slices, is returned once. Conditions the
+// controller left unset are read the way the API documents: ready and serving, not terminating.
+func GetServiceEndpoints(ctx context.Context, clientset *kubernetes.Clientset, namespace, service string) (ServiceEndpoints, error) {
+	slices, err := clientset.DiscoveryV1().EndpointSlices(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: discoveryv1.LabelServiceName + "=" + service,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("EndpointSlices of service %s/%s listing failed: %w", namespace, service, err)
+	}
+	seen := map[string]bool{}
+	var endpoints ServiceEndpoints
+	for _, slice := range slices.Items {
+		for _, endpoint := range slice.Endpoints {
+			ready := endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready
+			serving := ready
+			if endpoint.Conditions.Serving != nil {
+				serving = *endpoint.Conditions.Serving
+			}
+			terminating := endpoint.Conditions.Terminating != nil && *endpoint.Conditions.Terminating
+			pod := ""
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+				pod = endpoint.TargetRef.Name
+			}
+			for _, address := range endpoint.Addresses {
+				if seen[address] {
+					continue
+				}
+				seen[address] = true
+				endpoints = append(endpoints, ServiceEndpoint{
+					Address:     address,
+					Pod:         pod,
+					Ready:       ready,
+					Serving:     serving,
+					Terminating: terminating,
+				})
+			}
+		}
+	}
+	return endpoints, nil
+}
+
+// WaitForEndpoints polls the Service's EndpointSlices until at least minReady endpoints are ready, the
+// point from which traffic to the Service actually reaches that many pods. Pods being ready doesn't
+// mean that yet, the EndpointSlice controller lists them with a delay. It returns the endpoints, and
+// on timeout the error carries the last counts.
+func WaitForEndpoints(ctx context.Context, clientset *kubernetes.Clientset, namespace, service string, minReady int,
+	timeout time.Duration) (ServiceEndpoints, error) {
+	timeout = Timeout(TimeoutEndpoints, timeout)
+	var endpoints ServiceEndpoints
+	err := PollUntil(ctx, time.Second, timeout, func(ctx context.Context) (bool, error) {
+		var err error
+		endpoints, err = GetServiceEndpoints(ctx, clientset, namespace, service)
+		if err != nil {
+			return false, err
+		}
+		return len(endpoints.Ready()) >= minReady, nil
+	})
+	if err != nil {
+		return endpoints, fmt.Errorf("service %s/%s has %d/%d ready endpoints (%d listed): %w", namespace, service,
+			len(endpoints.Ready()), minReady, len(endpoints), err)
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,100 @@
+package example
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// EventFilter selects the events WatchEvents passes on, nil passes all of them
+type EventFilter func(event *corev1.Event) bool
+
+// WatchEvents sends the namespace's events that pass the filter to the returned channel until ctx is
+// cancelled, then closes it. The events that already exist are sent first. Events the API server
+// aggregates are sent again on every update, with the count increased.
+func WatchEvents(ctx context.Context, clientset *kubernetes.Clientset, namespace string, filter EventFilter) (<-chan corev1.Event, error) {
+	existing, err := clientset.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("events listing in %s failed: %w", namespace, err)
+	}
+	// Resumes from the list, reconnecting when the watch is closed, until ctx is cancelled
+	watcher, err := watchtools.NewRetryWatcher(existing.ResourceVersion, &cache.ListWatch{
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			return clientset.CoreV1().Events(namespace).Watch(ctx, options)
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("events watch in %s failed: %w", namespace, err)
+	}
+
+	events := make(chan corev1.Event)
+	send := func(event *corev1.Event) bool {
+		if filter != nil && !filter(event) {
+			return true
+		}
+		select {
+		case events <- *event:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	go func() {
+		defer close(events)
+		defer watcher.Stop()
+		for i := range existing.Items {
+			if !send(&existing.Items[i]) {
+				return
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case change, ok := <-watcher.ResultChan():
+				if !ok {
+					return
+				}
+				event, isEvent := change.Object.(*corev1.Event)
+				if !isEvent || change.Type == watch.Deleted {
+					continue
+				}
+				if !send(event) {
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// RecordEventsUntil collects the namespace's events that pass the filter, starting with the ones that
+// already exist, until the collected events satisfy until. When ctx ends first the events collected so
+// far are returned with the context's error, so assertions can still show them.
+func RecordEventsUntil(ctx context.Context, clientset *kubernetes.Clientset, namespace string, filter EventFilter,
+	until func(events []corev1.Event) bool) ([]corev1.Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := WatchEvents(ctx, clientset, namespace, filter)
+	if err != nil {
+		return nil, err
+	}
+	var collected []corev1.Event
+	for event := range stream {
+		collected = append(collected, event)
+		if until(collected) {
+			return collected, nil
+		}
+	}
+	if ctx.Err() != nil {
+		return collected, fmt.Errorf("events in %s: %w", namespace, ctx.Err())
+	}
+	return collected, fmt.Errorf("event watch in %s ended", namespace)
+}
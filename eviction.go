@@ -0,0 +1,117 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// EvictionBlockedError is returned by EvictPod when the API server refuses the eviction with 429
+// TooManyRequests because it would violate a PodDisruptionBudget
+type EvictionBlockedError struct {
+	Namespace string
+	Name      string
+	// Reasons holds the API server's explanations, e.g. "The disruption budget app-pdb needs 2 healthy
+	// pods and has 2 currently"
+	Reasons []string
+	// RetryAfter is the delay the API server suggests before trying again, zero if it suggests none
+	RetryAfter time.Duration
+	err        error
+}
+
+func (e *EvictionBlockedError) Error() string {
+	return fmt.Sprintf("eviction of pod %s/%s blocked: %s", e.Namespace, e.Name, strings.Join(e.Reasons, "; "))
+}
+
+func (e *EvictionBlockedError) Unwrap() error { return e.err }
+
+// IsEvictionBlocked reports whether err is, or wraps, an EvictionBlockedError
+func IsEvictionBlocked(err error) bool {
+	var blocked *EvictionBlockedError
+	return errors.As(err, &blocked)
+}
+
+// EvictPod requests the eviction of a pod through the policy/v1 eviction subresource, like kubectl
+// drain does for each pod. A refusal because of a PodDisruptionBudget is returned at once as an
+// EvictionBlockedError, retrying it is up to the caller. Other transient errors, including 429s from
+// API priority and fairness, are retried with DefaultRetryPolicy. A pod that is already gone yields
+// an error apierrors.IsNotFound recognizes.
+func EvictPod(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) error {
+	eviction := &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+	}
+	return Retry(ctx, DefaultRetryPolicy, func(ctx context.Context) error {
+		err := clientset.PolicyV1().Evictions(namespace).Evict(ctx, eviction)
+		if blocked := evictionBlocked(namespace, name, err); blocked != nil {
+			return Terminal(blocked)
+		}
+		return err
+	})
+}
+
+// evictionBlocked turns a 429 caused by a disruption budget into an EvictionBlockedError, nil for any
+// other error. API servers before 1.26 don't set the DisruptionBudget cause, only the message says it.
+func evictionBlocked(namespace, name string, err error) *EvictionBlockedError {
+	if !apierrors.IsTooManyRequests(err) {
+		return nil
+	}
+	var reasons []string
+	var status apierrors.APIStatus
+	if errors.As(err, &status) && status.Status().Details != nil {
+		for _, cause := range status.Status().Details.Causes {
+			if cause.Type == policyv1.DisruptionBudgetCause {
+				reasons = append(reasons, cause.Message)
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		if !strings.Contains(err.Error(), "disruption budget") {
+			return nil
+		}
+		reasons = append(reasons, err.Error())
+	}
+	blocked := &EvictionBlockedError{Namespace: namespace, Name: name, Reasons: reasons, err: err}
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok {
+		blocked.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return blocked
+}
+
+// EvictPods evicts every named pod, trying again every 2 seconds for those a PodDisruptionBudget
+// refused, until all are evicted or gone, the way kubectl drain retries. It returns the number of
+// refused evictions. On timeout the error names the pods that are still blocked and why.
+func EvictPods(ctx context.Context, clientset *kubernetes.Clientset, namespace string, names []string,
+	timeout time.Duration) (int, error) {
+	timeout = Timeout(TimeoutPDB, timeout)
+	remaining := append([]string(nil), names...)
+	refused := 0
+	var lastBlocked error
+	err := PollUntil(ctx, CheckInterval(2*time.Second), timeout, func(ctx context.Context) (bool, error) {
+		var blocked []string
+		for _, name := range remaining {
+			err := EvictPod(ctx, clientset, namespace, name)
+			switch {
+			case err == nil, apierrors.IsNotFound(err):
+			case IsEvictionBlocked(err):
+				refused++
+				lastBlocked = err
+				blocked = append(blocked, name)
+			default:
+				return false, fmt.Errorf("eviction of pod %s/%s failed: %w", namespace, name, err)
+			}
+		}
+		remaining = blocked
+		return len(remaining) == 0, nil
+	})
+	if err != nil && len(remaining) > 0 {
+		return refused, fmt.Errorf("pods %v in %s not evicted, last refusal %v: %w", remaining, namespace, lastBlocked, err)
+	}
+	return refused, err
+}
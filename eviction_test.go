@@ -0,0 +1,200 @@
+package example_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Eviction API E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("EvictionAPITest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		config    *rest.Config
+		// When the first eviction used up the budget
+		budgetUsed time.Time
+		logger     zerolog.Logger
+		testTag    = "EvictionAPITest"
+	)
+
+	disruptionsAllowed := func() int32 {
+		status, err := example.GetPDBStatus(context.TODO(), clientset, example.TestNamespace(), "eviction-app-pdb")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if !status.Observed {
+			return -1
+		}
+		return status.DisruptionsAllowed
+	}
+
+	// waitForBudget waits until the PDB allows exactly the given number of disruptions
+	waitForBudget := func(allowed int32, timeout time.Duration) {
+		status, err := example.WaitForPDBStatus(context.TODO(), clientset, example.TestNamespace(), "eviction-app-pdb", timeout,
+			func(status example.PDBStatus) bool {
+				return status.DisruptionsAllowed == allowed
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "PDB does not allow %d disruptions", allowed)
+		logger.Info().Msgf("PDB %s\n", status)
+	}
+
+	// readyPod returns a ready, non-terminating eviction-app pod
+	readyPod := func() string {
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=eviction-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, pod := range pods {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+					return pod.Name
+				}
+			}
+		}
+		ginkgo.Fail("No ready eviction-app pod")
+		return ""
+	}
+
+	// expectTerminating checks that the pod is gone or being deleted
+	expectTerminating := func(name string) {
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pod.DeletionTimestamp).NotTo(gomega.BeNil(), "Pod %s is not being deleted", name)
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+			// The budget's status and events usually explain a refused or unexpected eviction
+			for _, object := range []struct {
+				gvk  schema.GroupVersionKind
+				name string
+			}{
+				{policyv1.SchemeGroupVersion.WithKind("PodDisruptionBudget"), "eviction-app-pdb"},
+				{appsv1.SchemeGroupVersion.WithKind("Deployment"), "eviction-app"},
+			} {
+				if description, err := example.DescribeObject(context.TODO(), config, object.gvk, example.TestNamespace(), object.name); err == nil {
+					logger.Error().Msgf("%s", description)
+				}
+			}
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should allow one disruption once all replicas are ready", func() {
+		logger.Info().Msgf("=== Starting Eviction API E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		pdbYAML, deploymentYAML, err := example.GetEvictionTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying Deployment (3 replicas) and PDB (maxUnavailable 1) manifests ===")
+		err = example.ApplyRawManifest(clientset, deploymentYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.ApplyRawManifest(clientset, pdbYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		waitForBudget(1, 3*time.Minute)
+	})
+
+	ginkgo.It("should evict a pod while the budget allows a disruption", func() {
+		defer example.E2ePanicHandler()
+
+		name := readyPod()
+		logger.Info().Msgf("=== Evicting pod %s ===", name)
+		err := example.EvictPod(context.TODO(), clientset, example.TestNamespace(), name)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		budgetUsed = time.Now()
+		expectTerminating(name)
+
+		// The replacement stays unready for 20 seconds, so the budget is used up until then
+		waitForBudget(0, 10*time.Second)
+	})
+
+	ginkgo.It("should refuse evictions with 429 TooManyRequests while no disruption is allowed", func() {
+		defer example.E2ePanicHandler()
+
+		gomega.Expect(disruptionsAllowed()).To(gomega.BeZero(), "The replacement pod became ready before the refused eviction")
+
+		name := readyPod()
+		logger.Info().Msgf("=== Evicting pod %s with no disruption allowed ===", name)
+		err := example.EvictPod(context.TODO(), clientset, example.TestNamespace(), name)
+		gomega.Expect(err).To(gomega.HaveOccurred(), "Eviction of %s was allowed with no disruption left", name)
+		logger.Info().Msgf("=== Eviction refused: %v ===", err)
+		gomega.Expect(apierrors.IsTooManyRequests(err)).To(gomega.BeTrue(), "Unexpected error type: %v", err)
+		var blocked *example.EvictionBlockedError
+		gomega.Expect(errors.As(err, &blocked)).To(gomega.BeTrue(), "The refusal does not name a disruption budget: %v", err)
+		logger.Info().Msgf("=== Blocked by: %v, retry suggested after %v ===", blocked.Reasons, blocked.RetryAfter)
+		gomega.Expect(blocked.Reasons).To(gomega.ContainElement(gomega.ContainSubstring("disruption budget")))
+
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pod.DeletionTimestamp).To(gomega.BeNil(), "Pod %s is terminating although its eviction was refused", name)
+	})
+
+	ginkgo.It("should not protect pods from direct deletion", func() {
+		defer example.E2ePanicHandler()
+
+		gomega.Expect(disruptionsAllowed()).To(gomega.BeZero(), "The replacement pod became ready before the direct deletion")
+
+		// This is why the PDB suites' direct deletes don't show what the budget guarantees
+		name := readyPod()
+		logger.Info().Msgf("=== Deleting pod %s directly with no disruption allowed ===", name)
+		err := clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "The PDB blocked a direct deletion")
+		expectTerminating(name)
+	})
+
+	ginkgo.It("should allow evictions again once the replacements are ready", func() {
+		defer example.E2ePanicHandler()
+
+		status, err := example.WaitForPDBStatus(context.TODO(), clientset, example.TestNamespace(), "eviction-app-pdb", 3*time.Minute,
+			func(status example.PDBStatus) bool {
+				return status.DisruptionsAllowed > 0
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "The budget did not allow disruptions again")
+		recovery := time.Since(budgetUsed)
+		logger.Info().Msgf("PDB %s\n", status)
+		logger.Info().Msgf("=== Budget recovered %v after the first eviction ===", recovery.Round(time.Second))
+		example.RecordMetric(testTag, "budget_recovery_seconds", recovery.Seconds())
+
+		name := readyPod()
+		err = example.EvictPod(context.TODO(), clientset, example.TestNamespace(), name)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		expectTerminating(name)
+	})
+
+})
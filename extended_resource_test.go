@@ -0,0 +1,183 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Extended resource scheduling E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("ExtendedResourceSchedulingTest"), func() {
+	var (
+		clientset    *kubernetes.Clientset
+		podYAML      []byte
+		resourceName v1.ResourceName
+		// Allocatable amount of the resource per advertising node
+		advertising map[string]int64
+		maxPerNode  int64
+		logger      zerolog.Logger
+		testTag     = "ExtendedResourceSchedulingTest"
+	)
+
+	const (
+		// Overridable with EXTENDED_RESOURCE_NAME in .env, e.g. for a fake device plugin
+		defaultResourceName = "nvidia.com/gpu"
+		pollInterval        = 2 * time.Second
+		pendingHold         = 15 * time.Second
+	)
+
+	// createPod creates a pod with a limit of count units of the resource. Extended resources can't be
+	// overcommitted, so the request defaults to the limit.
+	createPod := func(name string, count int64) {
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(podYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		pod.Name = name
+		pod.Spec.Containers[0].Resources.Limits = v1.ResourceList{
+			resourceName: *resource.NewQuantity(count, resource.DecimalSI),
+		}
+		// Nodes with special hardware are usually tainted with the resource name
+		pod.Spec.Tolerations = append(pod.Spec.Tolerations, v1.Toleration{
+			Key:      string(resourceName),
+			Operator: v1.TolerationOpExists,
+		})
+
+		logger.Info().Msgf("=== Creating pod %s requesting %d %s ===", name, count, resourceName)
+		_, err = clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		resourceName = defaultResourceName
+		if value := os.Getenv("EXTENDED_RESOURCE_NAME"); value != "" {
+			resourceName = v1.ResourceName(value)
+		}
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		advertising = map[string]int64{}
+		for _, node := range nodes.Items {
+			quantity, ok := node.Status.Allocatable[resourceName]
+			if !ok || quantity.IsZero() {
+				continue
+			}
+			advertising[node.Name] = quantity.Value()
+			if quantity.Value() > maxPerNode {
+				maxPerNode = quantity.Value()
+			}
+		}
+		if len(advertising) == 0 {
+			ginkgo.Skip(fmt.Sprintf("No node advertises %s", resourceName))
+		}
+		names := make([]string, 0, len(advertising))
+		for name := range advertising {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		logger.Info().Msgf("=== %d of %d nodes advertise %s (%v), at most %d per node ===",
+			len(advertising), len(nodes.Items), resourceName, names, maxPerNode)
+
+		podYAML, err = example.GetExtendedResourceTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should schedule a pod requesting the resource only on an advertising node", func() {
+		logger.Info().Msgf("=== Starting Extended resource scheduling E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		start := time.Now()
+		createPod("extended-resource-one", 1)
+
+		// All units may be in use by other workloads, which is not a scheduling failure of the cluster
+		runningTimeout := example.Timeout(example.TimeoutPods, 5*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "extended-resource-one", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if pod.Status.Phase == v1.PodRunning {
+				logger.Info().Msgf("=== Pod running on %s after %v ===", pod.Spec.NodeName, time.Since(start).Round(time.Second))
+				gomega.Expect(advertising).To(gomega.HaveKey(pod.Spec.NodeName),
+					"Pod was placed on %s, which doesn't advertise %s", pod.Spec.NodeName, resourceName)
+				example.RecordMetric(testTag, "extended_resource_pod_start_seconds", time.Since(start).Seconds())
+				return
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod requesting 1 %s was not running after %v (phase %s)", resourceName, runningTimeout, pod.Status.Phase))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	})
+
+	ginkgo.It("should keep a pod requesting more than any node offers Pending with a FailedScheduling event", func() {
+		defer example.E2ePanicHandler()
+
+		createPod("extended-resource-too-many", maxPerNode+1)
+
+		expected := "Insufficient " + string(resourceName)
+		var message string
+		eventTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(eventTimeout)
+		for message == "" {
+			events, err := clientset.CoreV1().Events(example.TestNamespace()).List(context.TODO(), metav1.ListOptions{
+				FieldSelector: fields.Set{
+					"involvedObject.name": "extended-resource-too-many",
+					"reason":              "FailedScheduling",
+				}.AsSelector().String(),
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, event := range events.Items {
+				message = event.Message
+			}
+			if message == "" && time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("No FailedScheduling event within %v", eventTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== FailedScheduling: %s ===", message)
+		gomega.Expect(message).To(gomega.ContainSubstring(expected))
+
+		// The pod must stay Pending, not just be waiting for a retry of the scheduler
+		time.Sleep(pendingHold)
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "extended-resource-too-many", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pod.Status.Phase).To(gomega.Equal(v1.PodPending))
+		gomega.Expect(pod.Spec.NodeName).To(gomega.BeEmpty(), "Pod requesting %d %s was placed on %s",
+			maxPerNode+1, resourceName, pod.Spec.NodeName)
+	})
+
+})
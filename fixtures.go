@@ -0,0 +1,95 @@
+package example
+
+import (
+	"bytes"
+	"fmt"
+
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	policyv1 "k8s.io/api/policy/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// decodeFixture decodes every document of a manifest into its API type, the way ApplyRawManifest does
+func decodeFixture(manifest []byte) ([]runtime.Object, error) {
+	var objects []runtime.Object
+	for i, doc := range bytes.Split(manifest, []byte("\n---\n")) {
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+		obj, _, err := yamlSerializer.Decode(doc, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("document %d decode failed: %w", i+1, err)
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// ParseHPA decodes the autoscaling/v2 HorizontalPodAutoscaler of a fixture, the first one when the
+// manifest holds several documents, so suites can read e.g. its maxReplicas
+func ParseHPA(manifest []byte) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	objects, err := decodeFixture(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("HPA fixture: %w", err)
+	}
+	for _, obj := range objects {
+		if hpa, ok := obj.(*autoscalingv2.HorizontalPodAutoscaler); ok {
+			return hpa, nil
+		}
+	}
+	return nil, fmt.Errorf("no autoscaling/v2 HorizontalPodAutoscaler in the fixture")
+}
+
+// HPAUtilizationTarget returns the averageUtilization target of the first Resource metric of the HPA
+// that has one, e.g. 70 for a CPU target of 70%
+func HPAUtilizationTarget(hpa *autoscalingv2.HorizontalPodAutoscaler) (int32, error) {
+	for _, metric := range hpa.Spec.Metrics {
+		if metric.Type == autoscalingv2.ResourceMetricSourceType && metric.Resource != nil &&
+			metric.Resource.Target.AverageUtilization != nil {
+			return *metric.Resource.Target.AverageUtilization, nil
+		}
+	}
+	return 0, fmt.Errorf("HPA %s has no Resource metric with an averageUtilization target", hpa.Name)
+}
+
+// ParsePDB decodes the policy/v1 PodDisruptionBudget of a fixture, the first one when the manifest
+// holds several documents. Its minAvailable or maxUnavailable may be a percentage, PDBMinAvailable
+// resolves either to a pod count.
+func ParsePDB(manifest []byte) (*policyv1.PodDisruptionBudget, error) {
+	objects, err := decodeFixture(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("PDB fixture: %w", err)
+	}
+	for _, obj := range objects {
+		if pdb, ok := obj.(*policyv1.PodDisruptionBudget); ok {
+			return pdb, nil
+		}
+	}
+	return nil, fmt.Errorf("no policy/v1 PodDisruptionBudget in the fixture")
+}
+
+// PDBMinAvailable returns how many of expectedPods the PodDisruptionBudget keeps available, which is
+// what the disruption controller reports as desiredHealthy. Percentages are rounded up like the
+// controller does, for minAvailable as well as for maxUnavailable. A PDB without either doesn't
+// protect any pod.
+func PDBMinAvailable(pdb *policyv1.PodDisruptionBudget, expectedPods int32) (int32, error) {
+	switch {
+	case pdb.Spec.MinAvailable != nil:
+		minAvailable, err := intstr.GetScaledValueFromIntOrPercent(pdb.Spec.MinAvailable, int(expectedPods), true)
+		if err != nil {
+			return 0, fmt.Errorf("PDB %s minAvailable %s: %w", pdb.Name, pdb.Spec.MinAvailable, err)
+		}
+		return int32(minAvailable), nil
+	case pdb.Spec.MaxUnavailable != nil:
+		maxUnavailable, err := intstr.GetScaledValueFromIntOrPercent(pdb.Spec.MaxUnavailable, int(expectedPods), true)
+		if err != nil {
+			return 0, fmt.Errorf("PDB %s maxUnavailable %s: %w", pdb.Name, pdb.Spec.MaxUnavailable, err)
+		}
+		if int32(maxUnavailable) > expectedPods {
+			return 0, nil
+		}
+		return expectedPods - int32(maxUnavailable), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,221 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+// containerLogLine is a line of a followed container log with the time the kubelet wrote it and
+// the time the test received it
+type containerLogLine struct {
+	Logged   time.Time
+	Received time.Time
+}
+
+var _ = ginkgo.Describe("Graceful termination E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("GracefulTerminationTest"), func() {
+	var (
+		clientset   *kubernetes.Clientset
+		gracePeriod time.Duration
+		logger      zerolog.Logger
+		testTag     = "GracefulTerminationTest"
+	)
+
+	const (
+		// Matches the sleep in the fixture's preStop hook
+		preStopSleep = 5 * time.Second
+		pollInterval = 200 * time.Millisecond
+	)
+
+	// endpointState returns whether the pod IP is listed in the Service's EndpointSlices and whether it is ready
+	endpointState := func(podIP string) (listed, ready bool) {
+		endpoints, err := example.GetServiceEndpoints(context.TODO(), clientset, example.TestNamespace(), "graceful-svc")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		endpoint, listed := endpoints.Find(podIP)
+		return listed, endpoint.Ready
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should run the pod behind a Service as a ready endpoint", func() {
+		logger.Info().Msgf("=== Starting Graceful termination E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		serviceYAML, podYAML, err := example.GetGracefulTerminationTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		type podSpec struct {
+			Spec struct {
+				TerminationGracePeriodSeconds int64 `yaml:"terminationGracePeriodSeconds"`
+			} `yaml:"spec"`
+		}
+
+		var podConfig podSpec
+		err = yaml.Unmarshal(podYAML, &podConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gracePeriod = time.Duration(podConfig.Spec.TerminationGracePeriodSeconds) * time.Second
+
+		logger.Info().Msgf("=== Applying Service and pod manifests (grace period: %v) ===", gracePeriod)
+		err = example.ApplyRawManifest(clientset, serviceYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.ApplyRawManifest(clientset, podYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		readyTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(readyTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "graceful-pod", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if pod.Status.Phase == v1.PodRunning && pod.Status.PodIP != "" {
+				if _, ready := endpointState(pod.Status.PodIP); ready {
+					break
+				}
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("graceful-pod did not become a ready endpoint within %v", readyTimeout))
+			}
+			time.Sleep(example.CheckInterval(time.Second))
+		}
+	})
+
+	ginkgo.It("should withdraw the endpoint before SIGTERM and shut down within the grace period", func() {
+		defer example.E2ePanicHandler()
+
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "graceful-pod", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		podIP := pod.Status.PodIP
+
+		// Follow the container log for the whole shutdown, the log is gone once the pod is removed
+		ctx, cancel := context.WithCancel(context.TODO())
+		defer cancel()
+		var logMu sync.Mutex
+		logLines := map[string]containerLogLine{}
+		_, err = example.StreamPodLogs(ctx, clientset, example.TestNamespace(), "graceful-pod", example.PodLogOptions{
+			Container:  "main",
+			Follow:     true,
+			Timestamps: true,
+		}, func(line string) {
+			received := time.Now()
+			timestamp, message, found := strings.Cut(line, " ")
+			if !found {
+				return
+			}
+			logged, err := time.Parse(time.RFC3339Nano, timestamp)
+			if err != nil {
+				return
+			}
+			logMu.Lock()
+			logLines[message] = containerLogLine{Logged: logged, Received: received}
+			logMu.Unlock()
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		seenLine := func(message string) (containerLogLine, bool) {
+			logMu.Lock()
+			defer logMu.Unlock()
+			line, ok := logLines[message]
+			return line, ok
+		}
+
+		// Give the follow request a moment to attach before the pod starts terminating
+		deadline := time.Now().Add(example.Timeout(example.TimeoutPods, 30*time.Second))
+		for {
+			if _, ok := seenLine("started"); ok {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail("Container log does not show the startup line")
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		logger.Info().Msgf("=== Deleting graceful-pod ===")
+		deletedAt := time.Now()
+		err = clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), "graceful-pod", metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		var withdrawnAt, removedAt time.Time
+		deadline = deletedAt.Add(gracePeriod + time.Minute)
+		for removedAt.IsZero() {
+			if withdrawnAt.IsZero() {
+				if _, ready := endpointState(podIP); !ready {
+					withdrawnAt = time.Now()
+					logger.Info().Msgf("=== Endpoint withdrawn %v after delete ===", withdrawnAt.Sub(deletedAt).Round(time.Millisecond))
+				}
+			}
+
+			_, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "graceful-pod", metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				removedAt = time.Now()
+				break
+			}
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("graceful-pod was not removed within %v", gracePeriod+time.Minute))
+			}
+			time.Sleep(pollInterval)
+		}
+		logger.Info().Msgf("=== Pod removed %v after delete ===", removedAt.Sub(deletedAt).Round(time.Millisecond))
+
+		preStop, ok := seenLine("preStop started")
+		gomega.Expect(ok).To(gomega.BeTrue(), "preStop hook did not run")
+		sigterm, ok := seenLine("SIGTERM received")
+		gomega.Expect(ok).To(gomega.BeTrue(), "Container never logged the SIGTERM")
+		exiting, ok := seenLine("exiting")
+		gomega.Expect(ok).To(gomega.BeTrue(), "Container did not finish its shutdown, it was probably killed")
+
+		sigtermAfterDelete := sigterm.Received.Sub(deletedAt)
+		shutdown := exiting.Logged.Sub(sigterm.Logged)
+		removalAfterSigterm := removedAt.Sub(sigterm.Received)
+		logger.Info().Msgf("=== SIGTERM %v after delete, shutdown took %v, pod removed %v after SIGTERM ===",
+			sigtermAfterDelete.Round(time.Millisecond), shutdown.Round(time.Millisecond), removalAfterSigterm.Round(time.Millisecond))
+		example.RecordMetric(testTag, "endpoint_withdrawal_seconds", withdrawnAt.Sub(deletedAt).Seconds())
+		example.RecordMetric(testTag, "sigterm_after_delete_seconds", sigtermAfterDelete.Seconds())
+		example.RecordMetric(testTag, "removal_after_sigterm_seconds", removalAfterSigterm.Seconds())
+
+		// The kubelet timestamps come from the node clock, so only compare them with each other
+		gomega.Expect(sigterm.Logged.Sub(preStop.Logged)).To(gomega.BeNumerically(">=", preStopSleep-time.Second),
+			"SIGTERM arrived before the preStop hook finished")
+		gomega.Expect(withdrawnAt.IsZero()).To(gomega.BeFalse(), "Endpoint was never withdrawn")
+		gomega.Expect(withdrawnAt.Before(sigterm.Received)).To(gomega.BeTrue(),
+			"Endpoint was still ready when the container received SIGTERM")
+		gomega.Expect(removedAt.Sub(deletedAt)).To(gomega.BeNumerically("<", gracePeriod),
+			"Pod was only removed after the grace period, the container was killed")
+	})
+
+})
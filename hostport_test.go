@@ -0,0 +1,236 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("hostPort and hostNetwork E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("HostPortHostNetworkTest"), func() {
+	var (
+		config          *rest.Config
+		clientset       *kubernetes.Clientset
+		hostPortYAML    []byte
+		hostNetworkYAML []byte
+		clientYAML      []byte
+		hostPort        int32
+		hostNetworkPort int32
+		// The node both hostPort pods are pinned to
+		nodeName string
+		hostname string
+		logger   zerolog.Logger
+		testTag  = "HostPortHostNetworkTest"
+	)
+
+	const (
+		// Overridable with HOST_PORT and HOST_NETWORK_PORT in .env, when the ports are in use on the nodes
+		defaultHostPort        = 18080
+		defaultHostNetworkPort = 18081
+		pollInterval           = 2 * time.Second
+		pendingHold            = 15 * time.Second
+	)
+
+	portFromEnv := func(key string, fallback int32) int32 {
+		value := os.Getenv(key)
+		if value == "" {
+			return fallback
+		}
+		port, err := strconv.Atoi(value)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid %s: %s", key, value)
+		return int32(port)
+	}
+
+	decodePod := func(podYAML []byte) *v1.Pod {
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(podYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return pod
+	}
+
+	waitForRunning := func(name string, timeout time.Duration) *v1.Pod {
+		timeout = example.Timeout(example.TimeoutPods, timeout)
+		deadline := time.Now().Add(timeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if pod.Status.Phase == v1.PodRunning {
+				return pod
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s did not reach Running within %v (phase %s)", name, timeout, pod.Status.Phase))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	createHostPortPod := func(name string) {
+		pod := decodePod(hostPortYAML)
+		pod.Name = name
+		pod.Spec.Containers[0].Ports[0].HostPort = hostPort
+		pod.Spec.NodeSelector = map[string]string{v1.LabelHostname: hostname}
+		logger.Info().Msgf("=== Creating pod %s with hostPort %d on %s ===", name, hostPort, nodeName)
+		_, err := clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		hostPort = portFromEnv("HOST_PORT", defaultHostPort)
+		hostNetworkPort = portFromEnv("HOST_NETWORK_PORT", defaultHostNetworkPort)
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, node := range nodes.Items {
+			if node.Spec.Unschedulable || len(node.Spec.Taints) > 0 || node.Labels[v1.LabelHostname] == "" || nodeName != "" {
+				continue
+			}
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+					nodeName = node.Name
+					hostname = node.Labels[v1.LabelHostname]
+				}
+			}
+		}
+		if nodeName == "" {
+			ginkgo.Skip("No ready, schedulable node without taints")
+		}
+
+		hostPortYAML, hostNetworkYAML, clientYAML, err = example.GetHostPortTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should run the first pod requesting the hostPort", func() {
+		logger.Info().Msgf("=== Starting hostPort and hostNetwork E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		createHostPortPod("hostport-first")
+		pod := waitForRunning("hostport-first", 3*time.Minute)
+		gomega.Expect(pod.Spec.NodeName).To(gomega.Equal(nodeName))
+	})
+
+	ginkgo.It("should keep a second pod requesting the same hostPort on the node Pending", func() {
+		defer example.E2ePanicHandler()
+
+		createHostPortPod("hostport-second")
+
+		var message string
+		eventTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(eventTimeout)
+		for message == "" {
+			events, err := clientset.CoreV1().Events(example.TestNamespace()).List(context.TODO(), metav1.ListOptions{
+				FieldSelector: fields.Set{
+					"involvedObject.name": "hostport-second",
+					"reason":              "FailedScheduling",
+				}.AsSelector().String(),
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, event := range events.Items {
+				message = event.Message
+			}
+			if message == "" && time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("No FailedScheduling event within %v", eventTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== FailedScheduling: %s ===", message)
+		// Reported by the NodePorts scheduler plugin
+		gomega.Expect(message).To(gomega.ContainSubstring("didn't have free ports for the requested pod ports"))
+
+		time.Sleep(pendingHold)
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "hostport-second", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pod.Status.Phase).To(gomega.Equal(v1.PodPending))
+		gomega.Expect(pod.Spec.NodeName).To(gomega.BeEmpty(), "Second pod with hostPort %d was placed on %s", hostPort, pod.Spec.NodeName)
+	})
+
+	ginkgo.It("should reach a hostNetwork pod on its node IP", func() {
+		defer example.E2ePanicHandler()
+
+		server := decodePod(hostNetworkYAML)
+		server.Spec.Containers[0].Env[0].Value = strconv.Itoa(int(hostNetworkPort))
+		logger.Info().Msgf("=== Creating hostNetwork pod serving on port %d ===", hostNetworkPort)
+		_, err := clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), server, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		_, err = clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), decodePod(clientYAML), metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		running := waitForRunning(server.Name, 3*time.Minute)
+		waitForRunning("hostnetwork-client", 3*time.Minute)
+
+		node, err := clientset.CoreV1().Nodes().Get(context.TODO(), running.Spec.NodeName, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		var nodeIP string
+		for _, address := range node.Status.Addresses {
+			if address.Type == v1.NodeInternalIP {
+				nodeIP = address.Address
+				break
+			}
+		}
+		gomega.Expect(nodeIP).NotTo(gomega.BeEmpty(), "Node %s has no InternalIP", node.Name)
+		gomega.Expect(running.Status.PodIP).To(gomega.Equal(nodeIP), "hostNetwork pod did not get the node IP")
+
+		expected, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), server.Name, "main",
+			[]string{"hostname"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "stderr: %s", stderr)
+
+		// httpd may need a moment after the container started
+		url := fmt.Sprintf("http://%s:%d/", nodeIP, hostNetworkPort)
+		logger.Info().Msgf("=== Fetching %s from the client pod ===", url)
+		start := time.Now()
+		reachTimeout := example.Timeout(example.TimeoutNetwork, time.Minute)
+		deadline := start.Add(reachTimeout)
+		for {
+			stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "hostnetwork-client", "client",
+				[]string{"wget", "-q", "-O-", "-T", "5", url})
+			if err == nil {
+				gomega.Expect(strings.TrimSpace(stdout)).To(gomega.Equal(strings.TrimSpace(expected)),
+					"Response did not come from the hostNetwork pod")
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("%s was not reachable within %v: %v, stderr: %s", url, reachTimeout, err, stderr))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		example.RecordMetric(testTag, "host_network_reachable_seconds", time.Since(start).Seconds())
+	})
+
+})
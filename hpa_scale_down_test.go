@@ -0,0 +1,208 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("HPA scale-down behavior E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("HPAScaleDownTest"), func() {
+	var (
+		clientset     *kubernetes.Clientset
+		hpaConfig     hpaBehaviorSpec
+		loadGenerator *example.LoadGenerator
+		logger        zerolog.Logger
+		testTag       = "HPAScaleDownTest"
+	)
+
+	const (
+		pollInterval = 2 * time.Second
+		// Matches the CPU request in the Deployment fixture
+		requestMillicores = 100
+	)
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+			// What the pods actually used tells a load problem apart from a scaling problem
+			if usage, err := example.SnapshotUsage(context.TODO(), clientset, example.TestNamespace()); err == nil {
+				example.RecordMetric(testTag, "usage_on_failure", usage)
+			}
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		if loadGenerator != nil {
+			loadGenerator.Stop()
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should scale up to maxReplicas under load", func() {
+		logger.Info().Msgf("=== Starting HPA scale-down behavior E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		hpaYAML, depYAML, err := example.GetHPAScaleDownTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		err = yaml.Unmarshal(hpaYAML, &hpaConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, policy := range hpaConfig.Spec.Behavior.ScaleDown.Policies {
+			gomega.Expect(policy.Type).To(gomega.Equal("Pods"), "Only Pods scale-down policies are supported by this test")
+		}
+		logger.Info().Msgf("=== HPA replicas %d-%d, scale-down stabilization window: %ds, policies: %+v ===",
+			hpaConfig.Spec.MinReplicas, hpaConfig.Spec.MaxReplicas,
+			hpaConfig.Spec.Behavior.ScaleDown.StabilizationWindowSeconds, hpaConfig.Spec.Behavior.ScaleDown.Policies)
+
+		logger.Info().Msgf("=== Applying Deployment manifest ===")
+		err = example.ApplyRawManifest(clientset, depYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying HPA manifest ===")
+		err = example.ApplyRawManifest(clientset, hpaYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Enough load for one replica more than maxReplicas at the target utilization, so the HPA settles
+		// at maxReplicas however fast the nodes are
+		hpa, err := example.ParseHPA(hpaYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		utilization, err := example.HPAUtilizationTarget(hpa)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "The load is generated for a utilization target")
+		load := int(hpaConfig.Spec.MaxReplicas+1) * requestMillicores * int(utilization) / 100
+		logger.Info().Msgf("=== Generating %dm of CPU load ===", load)
+		loadGenerator = example.StartLoadGenerator(logger, clientset, example.TestNamespace(), "app=scale-down-app", load)
+
+		logger.Info().Msgf("=== Wait for metrics-server to report the scale-down-app pods ===")
+		_, err = example.WaitForPodMetrics(context.TODO(), clientset, example.TestNamespace(), "app=scale-down-app", 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Is metrics-server running?")
+
+		logger.Info().Msgf("=== Wait for HPA to scale up to %d ===", hpaConfig.Spec.MaxReplicas)
+		_, err = example.WaitForHPAScaled(context.TODO(), clientset, example.TestNamespace(), "scale-down-hpa", hpaConfig.Spec.MaxReplicas, 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Failed to wait for the HPA to get to the maximum required pods")
+		err = example.WaitForDeploymentReady(context.TODO(), clientset, example.TestNamespace(), "scale-down-app", 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The HPA acts on metrics-server data, so the generated load must show up there
+		usage, err := example.SnapshotUsage(context.TODO(), clientset, example.TestNamespace())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		example.RecordMetric(testTag, "scaled_up_usage", usage)
+		logger.Info().Msgf("=== Pods use %dm of CPU under %dm of generated load ===", usage.PodCPUMillicores(), load)
+		gomega.Expect(usage.PodCPUMillicores()).To(gomega.BeNumerically(">=", load/2),
+			"Pods use far less CPU than generated, the HPA scaled on something else")
+	})
+
+	ginkgo.It("should scale down according to the stabilization window and scale-down policies", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Removing load from all pods ===")
+		loadGenerator.Stop()
+		loadGenerator = nil
+		loadRemovedAt := time.Now()
+
+		scaleDown := hpaConfig.Spec.Behavior.ScaleDown
+		window := time.Duration(scaleDown.StabilizationWindowSeconds) * time.Second
+		var maxPodsPerPeriod int32
+		var period time.Duration
+		for _, policy := range scaleDown.Policies {
+			if policy.Value > maxPodsPerPeriod {
+				maxPodsPerPeriod = policy.Value
+				period = time.Duration(policy.PeriodSeconds) * time.Second
+			}
+		}
+
+		// Metrics lag behind the load, so give the HPA a few minutes on top of what the policies need
+		steps := (hpaConfig.Spec.MaxReplicas - hpaConfig.Spec.MinReplicas + maxPodsPerPeriod - 1) / maxPodsPerPeriod
+		timeout := window + time.Duration(steps)*period + example.Timeout(example.TimeoutHPA, 5*time.Minute)
+		logger.Info().Msgf("=== Waiting up to %v for scale-down to %d replicas ===", timeout, hpaConfig.Spec.MinReplicas)
+
+		type scaleStep struct {
+			Replicas int32   `json:"replicas"`
+			Seconds  float64 `json:"seconds_after_load_removed"`
+		}
+		var timeline []scaleStep
+		lastReplicas := hpaConfig.Spec.MaxReplicas
+		deadline := loadRemovedAt.Add(timeout)
+		for lastReplicas > hpaConfig.Spec.MinReplicas {
+			scale, err := clientset.AppsV1().Deployments(example.TestNamespace()).GetScale(context.TODO(), "scale-down-app", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			if scale.Spec.Replicas < lastReplicas {
+				elapsed := time.Since(loadRemovedAt)
+				logger.Info().Msgf("=== Scaled down %d -> %d after %v ===", lastReplicas, scale.Spec.Replicas, elapsed.Round(time.Second))
+				timeline = append(timeline, scaleStep{Replicas: scale.Spec.Replicas, Seconds: elapsed.Seconds()})
+				lastReplicas = scale.Spec.Replicas
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Deployment did not scale down to %d within %v (currently %d)",
+					hpaConfig.Spec.MinReplicas, timeout, lastReplicas))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		example.RecordMetric(testTag, "scale_down_timeline", timeline)
+		example.RecordMetric(testTag, "first_scale_down_seconds", timeline[0].Seconds)
+		example.RecordMetric(testTag, "scale_down_to_min_seconds", timeline[len(timeline)-1].Seconds)
+
+		logger.Info().Msgf("=== Validating scale-down timing ===")
+		gomega.Expect(timeline[0].Seconds).To(gomega.BeNumerically(">=", window.Seconds()),
+			"Scaled down %.0fs after the load was removed, inside the %v stabilization window", timeline[0].Seconds, window)
+
+		// No period long window may remove more pods than the policy allows. Observed times are off by up
+		// to one poll interval, so the window is shrunk by that much.
+		replicasBefore := func(i int) int32 {
+			if i == 0 {
+				return hpaConfig.Spec.MaxReplicas
+			}
+			return timeline[i-1].Replicas
+		}
+		for i, step := range timeline {
+			var removed int32
+			for j := i; j >= 0 && step.Seconds-timeline[j].Seconds < (period-pollInterval).Seconds(); j-- {
+				removed += replicasBefore(j) - timeline[j].Replicas
+			}
+			gomega.Expect(removed).To(gomega.BeNumerically("<=", maxPodsPerPeriod),
+				"%d pods removed within %v up to the step to %d replicas, the policy allows %d",
+				removed, period, step.Replicas, maxPodsPerPeriod)
+		}
+	})
+
+})
+
+// hpaBehaviorSpec holds the parts of the HPA fixture the scale-down assertions are derived from
+type hpaBehaviorSpec struct {
+	Spec struct {
+		MinReplicas int32 `yaml:"minReplicas"`
+		MaxReplicas int32 `yaml:"maxReplicas"`
+		Behavior    struct {
+			ScaleDown struct {
+				StabilizationWindowSeconds int32 `yaml:"stabilizationWindowSeconds"`
+				Policies                   []struct {
+					Type          string `yaml:"type"`
+					Value         int32  `yaml:"value"`
+					PeriodSeconds int32  `yaml:"periodSeconds"`
+				} `yaml:"policies"`
+			} `yaml:"scaleDown"`
+		} `yaml:"behavior"`
+	} `yaml:"spec"`
+}
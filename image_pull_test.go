@@ -0,0 +1,181 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Image pull secret E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("ImagePullSecretTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		podYAML   []byte
+		image     string
+		// Node that pulled the private image with credentials, it has the image cached
+		pulledOnNode string
+		logger       zerolog.Logger
+		testTag      = "ImagePullSecretTest"
+	)
+
+	const (
+		// Copied into test-ns from PRIVATE_REGISTRY_SECRET ("namespace/name") in .env
+		defaultSourceSecret = "e2e-admin-ns/registry-credentials"
+		pullSecretName      = "e2e-pull-secret"
+		pollInterval        = 2 * time.Second
+	)
+
+	// createPod creates a pod of the private image, with the pull secret and pull policy given
+	createPod := func(name string, withSecret bool, pullPolicy v1.PullPolicy, nodeName string) {
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(podYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pod.Name = name
+		pod.Spec.Containers[0].Image = image
+		pod.Spec.Containers[0].ImagePullPolicy = pullPolicy
+		pod.Spec.NodeName = nodeName
+		if withSecret {
+			pod.Spec.ImagePullSecrets = []v1.LocalObjectReference{{Name: pullSecretName}}
+		}
+
+		logger.Info().Msgf("=== Creating pod %s (pull secret: %t, pull policy: %s) ===", name, withSecret, pullPolicy)
+		_, err = clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	// waitForPull waits until the pod's image was pulled and started, or its pull failed. It returns
+	// whether the image was pulled, and the waiting reason and message otherwise.
+	waitForPull := func(name string) (bool, string, string, *v1.Pod) {
+		pullTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(pullTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.State.Running != nil || status.State.Terminated != nil {
+					return true, "", "", pod
+				}
+				if waiting := status.State.Waiting; waiting != nil &&
+					(waiting.Reason == "ErrImagePull" || waiting.Reason == "ImagePullBackOff") {
+					return false, waiting.Reason, waiting.Message, pod
+				}
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s neither pulled its image nor failed to within %v", name, pullTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		image = os.Getenv("PRIVATE_REGISTRY_IMAGE")
+		if image == "" {
+			ginkgo.Skip("PRIVATE_REGISTRY_IMAGE is not set in .env")
+		}
+
+		podYAML, err = example.GetImagePullTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Pods can only reference pull secrets in their own namespace
+		sourceSecret := os.Getenv("PRIVATE_REGISTRY_SECRET")
+		if sourceSecret == "" {
+			sourceSecret = defaultSourceSecret
+		}
+		namespace, name, found := strings.Cut(sourceSecret, "/")
+		gomega.Expect(found).To(gomega.BeTrue(), "PRIVATE_REGISTRY_SECRET must be namespace/name, got %s", sourceSecret)
+		source, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(source.Type).To(gomega.BeElementOf(v1.SecretTypeDockerConfigJson, v1.SecretTypeDockercfg),
+			"Secret %s is not an image pull secret", sourceSecret)
+
+		logger.Info().Msgf("=== Copying pull secret %s to test-ns/%s ===", sourceSecret, pullSecretName)
+		_, err = clientset.CoreV1().Secrets(example.TestNamespace()).Create(context.TODO(), &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: pullSecretName},
+			Type:       source.Type,
+			Data:       source.Data,
+		}, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	// imagePullPolicy Always makes every pod pull, so an image cached on the node can't hide a missing secret
+
+	ginkgo.It("should fail to pull the private image without a pull secret", func() {
+		logger.Info().Msgf("=== Starting Image pull secret E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		createPod("image-pull-without-secret", false, v1.PullAlways, "")
+		pulled, reason, message, _ := waitForPull("image-pull-without-secret")
+		gomega.Expect(pulled).To(gomega.BeFalse(), "Private image %s was pulled without credentials", image)
+		logger.Info().Msgf("=== Pull failed as expected: %s: %s ===", reason, message)
+	})
+
+	ginkgo.It("should pull the private image with the pull secret", func() {
+		defer example.E2ePanicHandler()
+
+		start := time.Now()
+		createPod("image-pull-with-secret", true, v1.PullAlways, "")
+		pulled, reason, message, pod := waitForPull("image-pull-with-secret")
+		gomega.Expect(pulled).To(gomega.BeTrue(), "Private image %s was not pulled with the pull secret: %s: %s", image, reason, message)
+
+		pulledOnNode = pod.Spec.NodeName
+		logger.Info().Msgf("=== Image pulled and started on %s after %v ===", pulledOnNode, time.Since(start).Round(time.Second))
+		example.RecordMetric(testTag, "private_image_start_seconds", time.Since(start).Seconds())
+	})
+
+	ginkgo.It("should not start the cached private image without credentials when pulls are enforced", func() {
+		defer example.E2ePanicHandler()
+
+		if pulledOnNode == "" {
+			ginkgo.Skip("The private image was not pulled on any node")
+		}
+
+		// With IfNotPresent the kubelet reuses the image cached by the previous spec. Only the
+		// AlwaysPullImages admission plugin makes pods without credentials fail here.
+		createPod("image-pull-cached", false, v1.PullIfNotPresent, pulledOnNode)
+		pulled, reason, _, pod := waitForPull("image-pull-cached")
+		logger.Info().Msgf("=== Pull policy after admission: %s, cached image started: %t %s ===",
+			pod.Spec.Containers[0].ImagePullPolicy, pulled, reason)
+		example.RecordMetric(testTag, "cached_private_image_reusable", pulled)
+
+		if os.Getenv("IMAGE_PULL_ENFORCE_ALWAYS_PULL") != "true" {
+			return
+		}
+		gomega.Expect(pulled).To(gomega.BeFalse(),
+			"A pod without credentials started the private image cached on %s", pulledOnNode)
+	})
+
+})
@@ -0,0 +1,236 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// InformerSet caches the pods, Deployments and events of a namespace through shared informers, so
+// suites read them from the cache and wait for changes instead of listing them every few seconds. The
+// caches are only as fresh as the watches behind them, a read right after a write may not see it yet.
+type InformerSet struct {
+	Namespace string
+	cancel    context.CancelFunc
+	factory   informers.SharedInformerFactory
+
+	pods        cache.SharedIndexInformer
+	deployments cache.SharedIndexInformer
+	events      cache.SharedIndexInformer
+}
+
+// StartInformerSet starts the informers of the namespace and returns once their caches have synced.
+// The namespace doesn't have to exist, its objects appear in the caches once it does.
+func StartInformerSet(clientset *kubernetes.Clientset, namespace string) (*InformerSet, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	factory := informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithNamespace(namespace))
+	set := &InformerSet{
+		Namespace:   namespace,
+		cancel:      cancel,
+		factory:     factory,
+		pods:        factory.Core().V1().Pods().Informer(),
+		deployments: factory.Apps().V1().Deployments().Informer(),
+		events:      factory.Core().V1().Events().Informer(),
+	}
+
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), set.pods.HasSynced, set.deployments.HasSynced, set.events.HasSynced) {
+		cancel()
+		return nil, fmt.Errorf("informers in %s did not sync", namespace)
+	}
+	return set, nil
+}
+
+// Stop ends the informers' watches
+func (s *InformerSet) Stop() {
+	s.cancel()
+	s.factory.Shutdown()
+}
+
+// Pods returns copies of the cached pods matching the label selector, by name. Terminating pods are
+// included.
+func (s *InformerSet) Pods(selector string) ([]corev1.Pod, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+	}
+	cached, err := s.factory.Core().V1().Pods().Lister().Pods(s.Namespace).List(parsed)
+	if err != nil {
+		return nil, fmt.Errorf("cached pods %q in %s: %w", selector, s.Namespace, err)
+	}
+	pods := make([]corev1.Pod, 0, len(cached))
+	for _, pod := range cached {
+		pods = append(pods, *pod.DeepCopy())
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].Name < pods[j].Name })
+	return pods, nil
+}
+
+// Deployment returns a copy of the cached Deployment, with a NotFound error like the API's when it
+// isn't cached
+func (s *InformerSet) Deployment(name string) (*appsv1.Deployment, error) {
+	deployment, err := s.factory.Apps().V1().Deployments().Lister().Deployments(s.Namespace).Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return deployment.DeepCopy(), nil
+}
+
+// Events returns copies of the cached events that pass the filter, by last timestamp
+func (s *InformerSet) Events(filter EventFilter) []corev1.Event {
+	var events []corev1.Event
+	for _, obj := range s.events.GetStore().List() {
+		if event, ok := obj.(*corev1.Event); ok && (filter == nil || filter(event)) {
+			events = append(events, *event.DeepCopy())
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].LastTimestamp.Before(&events[j].LastTimestamp) })
+	return events
+}
+
+// Subscribe calls handler on every change of the namespace's pods, Deployments or events, from the
+// informers' goroutines, until the returned function is called. The handler must not block.
+func (s *InformerSet) Subscribe(handler func()) (func(), error) {
+	handlers := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { handler() },
+		UpdateFunc: func(interface{}, interface{}) { handler() },
+		DeleteFunc: func(interface{}) { handler() },
+	}
+	var registrations []func()
+	unsubscribe := func() {
+		for _, remove := range registrations {
+			remove()
+		}
+	}
+	for _, informer := range []cache.SharedIndexInformer{s.pods, s.deployments, s.events} {
+		registration, err := informer.AddEventHandler(handlers)
+		if err != nil {
+			unsubscribe()
+			return nil, fmt.Errorf("event handler registration in %s failed: %w", s.Namespace, err)
+		}
+		registrations = append(registrations, func() { _ = informer.RemoveEventHandler(registration) })
+	}
+	return unsubscribe, nil
+}
+
+// waitForChange evaluates condition right away and again after every change of the cached objects,
+// until it returns true or an error, or the timeout expires. The timeout error wraps
+// context.DeadlineExceeded, like PollUntil's.
+func (s *InformerSet) waitForChange(ctx context.Context, timeout time.Duration, condition func() (bool, error)) error {
+	changed := make(chan struct{}, 1)
+	unsubscribe, err := s.Subscribe(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	if err != nil {
+		return err
+	}
+	defer unsubscribe()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		done, err := condition()
+		if err != nil || done {
+			return err
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("condition not met within %v: %w", timeout, ctx.Err())
+		}
+	}
+}
+
+// WaitForPods waits until the condition holds for the cached pods matching the label selector,
+// re-evaluating it on every change instead of polling, and returns those pods
+func (s *InformerSet) WaitForPods(ctx context.Context, selector string, timeout time.Duration,
+	condition func(pods []corev1.Pod) bool) ([]corev1.Pod, error) {
+	timeout = Timeout(TimeoutPods, timeout)
+	var pods []corev1.Pod
+	err := s.waitForChange(ctx, timeout, func() (bool, error) {
+		var err error
+		pods, err = s.Pods(selector)
+		if err != nil {
+			return false, err
+		}
+		return condition(pods), nil
+	})
+	if err != nil {
+		return pods, fmt.Errorf("pods %q in %s (%s): %w", selector, s.Namespace, SummarizePods(pods), err)
+	}
+	return pods, nil
+}
+
+// WaitForDeployment waits until the condition holds for the cached Deployment, re-evaluating it on
+// every change, and returns it. A Deployment that doesn't exist yet is waited for.
+func (s *InformerSet) WaitForDeployment(ctx context.Context, name string, timeout time.Duration,
+	condition func(deployment *appsv1.Deployment) bool) (*appsv1.Deployment, error) {
+	timeout = Timeout(TimeoutRollout, timeout)
+	var deployment *appsv1.Deployment
+	err := s.waitForChange(ctx, timeout, func() (bool, error) {
+		var err error
+		deployment, err = s.Deployment(name)
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return condition(deployment), nil
+	})
+	if err != nil {
+		return deployment, fmt.Errorf("deployment %s/%s: %w", s.Namespace, name, err)
+	}
+	return deployment, nil
+}
+
+var (
+	testNamespaceInformers   *InformerSet
+	testNamespaceInformersMu sync.Mutex
+)
+
+// StartTestNamespaceInformers starts the InformerSet of the TestNamespace the suites share.
+// SetUpTestNamespace calls it once per process, before any spec runs.
+func StartTestNamespaceInformers(clientset *kubernetes.Clientset) error {
+	testNamespaceInformersMu.Lock()
+	defer testNamespaceInformersMu.Unlock()
+	if testNamespaceInformers != nil {
+		return nil
+	}
+	set, err := StartInformerSet(clientset, TestNamespace())
+	if err != nil {
+		return err
+	}
+	testNamespaceInformers = set
+	return nil
+}
+
+// StopTestNamespaceInformers stops the shared InformerSet of the TestNamespace, from TearDownTestNamespace
+func StopTestNamespaceInformers() {
+	testNamespaceInformersMu.Lock()
+	defer testNamespaceInformersMu.Unlock()
+	if testNamespaceInformers != nil {
+		testNamespaceInformers.Stop()
+		testNamespaceInformers = nil
+	}
+}
+
+// TestNamespaceInformers returns the shared InformerSet of the TestNamespace, nil when it wasn't started
+func TestNamespaceInformers() *InformerSet {
+	testNamespaceInformersMu.Lock()
+	defer testNamespaceInformersMu.Unlock()
+	return testNamespaceInformers
+}
@@ -0,0 +1,188 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Init container ordering E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("InitContainerOrderingTest"), func() {
+	var (
+		clientset         *kubernetes.Clientset
+		config            *rest.Config
+		orderedYAML       []byte
+		failingAlwaysYAML []byte
+		failingNeverYAML  []byte
+		logger            zerolog.Logger
+		testTag           = "InitContainerOrderingTest"
+	)
+
+	const pollInterval = time.Second
+
+	podCondition := func(pod *v1.Pod, conditionType v1.PodConditionType) v1.ConditionStatus {
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == conditionType {
+				return condition.Status
+			}
+		}
+		return v1.ConditionUnknown
+	}
+
+	// waitForPod polls the pod until done returns true and returns the last observed state
+	waitForPod := func(name, description string, timeout time.Duration, done func(*v1.Pod) bool) *v1.Pod {
+		timeout = example.Timeout(example.TimeoutPods, timeout)
+		deadline := time.Now().Add(timeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if done(pod) {
+				return pod
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s did not %s within %v (phase: %s)", name, description, timeout, pod.Status.Phase))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	// expectAppContainerNotStarted checks that the app container of a pod never ran
+	expectAppContainerNotStarted := func(pod *v1.Pod) {
+		gomega.Expect(pod.Status.ContainerStatuses).To(gomega.HaveLen(1))
+		status := pod.Status.ContainerStatuses[0]
+		logger.Info().Msgf("%s state: %+v\n", status.Name, status.State)
+		gomega.Expect(status.State.Running).To(gomega.BeNil(), "App container started although an init container failed")
+		if status.State.Terminated != nil {
+			gomega.Expect(status.State.Terminated.StartedAt.IsZero()).To(gomega.BeTrue(),
+				"App container ran although an init container failed")
+		}
+		gomega.Expect(podCondition(pod, v1.PodInitialized)).To(gomega.Equal(v1.ConditionFalse))
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		orderedYAML, failingAlwaysYAML, failingNeverYAML, err = example.GetInitContainersTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should run init containers sequentially to completion before the app container", func() {
+		logger.Info().Msgf("=== Starting Init container ordering E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying ordered init containers pod manifest ===")
+		err := example.ApplyRawManifest(clientset, orderedYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pod := waitForPod("init-ordered", "reach Running", 3*time.Minute, func(pod *v1.Pod) bool {
+			return pod.Status.Phase == v1.PodRunning
+		})
+		gomega.Expect(podCondition(pod, v1.PodInitialized)).To(gomega.Equal(v1.ConditionTrue))
+
+		// Container timestamps have second precision, so consecutive containers may share a second
+		var previousFinish time.Time
+		for _, status := range pod.Status.InitContainerStatuses {
+			terminated := status.State.Terminated
+			gomega.Expect(terminated).NotTo(gomega.BeNil(), "Init container %s has not terminated", status.Name)
+			logger.Info().Msgf("%s: started %s, finished %s, exit code %d\n", status.Name,
+				terminated.StartedAt.UTC().Format(time.RFC3339), terminated.FinishedAt.UTC().Format(time.RFC3339), terminated.ExitCode)
+
+			gomega.Expect(terminated.ExitCode).To(gomega.BeZero(), "Init container %s failed", status.Name)
+			gomega.Expect(status.RestartCount).To(gomega.BeZero(), "Init container %s was restarted", status.Name)
+			gomega.Expect(terminated.StartedAt.Time.Before(previousFinish)).To(gomega.BeFalse(),
+				"Init container %s started before the previous one finished", status.Name)
+			previousFinish = terminated.FinishedAt.Time
+		}
+
+		appStatus := pod.Status.ContainerStatuses[0]
+		gomega.Expect(appStatus.State.Running).NotTo(gomega.BeNil())
+		gomega.Expect(appStatus.State.Running.StartedAt.Time.Before(previousFinish)).To(gomega.BeFalse(),
+			"App container started before the last init container finished")
+
+		firstStart := pod.Status.InitContainerStatuses[0].State.Terminated.StartedAt.Time
+		logger.Info().Msgf("=== Init phase took %v ===", previousFinish.Sub(firstStart))
+		example.RecordMetric(testTag, "init_phase_seconds", previousFinish.Sub(firstStart).Seconds())
+
+		// The shared file shows the order the containers actually ran in
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "init-ordered", "main",
+			[]string{"cat", "/work/order"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Reading the order file failed: %s", stderr)
+		gomega.Expect(strings.Fields(stdout)).To(gomega.Equal([]string{"init-1", "init-2", "init-3", "main"}))
+	})
+
+	ginkgo.It("should keep retrying a failing init container and block the pod with restartPolicy Always", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying failing init container pod manifest (restartPolicy Always) ===")
+		err := example.ApplyRawManifest(clientset, failingAlwaysYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The back-off between retries doubles from 10 seconds, two retries fit comfortably in 3 minutes
+		pod := waitForPod("init-failing-always", "retry its init container twice", 3*time.Minute, func(pod *v1.Pod) bool {
+			return len(pod.Status.InitContainerStatuses) > 0 && pod.Status.InitContainerStatuses[0].RestartCount >= 2
+		})
+
+		initStatus := pod.Status.InitContainerStatuses[0]
+		logger.Info().Msgf("%s: restartCount %d, state %+v\n", initStatus.Name, initStatus.RestartCount, initStatus.State)
+		gomega.Expect(pod.Status.Phase).To(gomega.Equal(v1.PodPending))
+		gomega.Expect(initStatus.LastTerminationState.Terminated).NotTo(gomega.BeNil())
+		gomega.Expect(initStatus.LastTerminationState.Terminated.ExitCode).To(gomega.Equal(int32(1)))
+
+		expectAppContainerNotStarted(pod)
+		waiting := pod.Status.ContainerStatuses[0].State.Waiting
+		gomega.Expect(waiting).NotTo(gomega.BeNil())
+		gomega.Expect(waiting.Reason).To(gomega.Equal("PodInitializing"))
+	})
+
+	ginkgo.It("should fail the pod without retrying a failing init container with restartPolicy Never", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying failing init container pod manifest (restartPolicy Never) ===")
+		err := example.ApplyRawManifest(clientset, failingNeverYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pod := waitForPod("init-failing-never", "reach Failed", 3*time.Minute, func(pod *v1.Pod) bool {
+			return pod.Status.Phase == v1.PodFailed
+		})
+
+		initStatus := pod.Status.InitContainerStatuses[0]
+		logger.Info().Msgf("%s: restartCount %d, state %+v\n", initStatus.Name, initStatus.RestartCount, initStatus.State)
+		gomega.Expect(initStatus.RestartCount).To(gomega.BeZero(), "Init container was retried with restartPolicy Never")
+		gomega.Expect(initStatus.State.Terminated).NotTo(gomega.BeNil())
+		gomega.Expect(initStatus.State.Terminated.ExitCode).To(gomega.Equal(int32(3)))
+
+		expectAppContainerNotStarted(pod)
+	})
+
+})
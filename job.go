@@ -0,0 +1,187 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ErrJobFailed is wrapped by the WaitForJobComplete error of a Job whose Failed condition is true, e.g.
+// after its backoffLimit or activeDeadlineSeconds. The JobResult is returned along with it.
+var ErrJobFailed = errors.New("job failed")
+
+// JobPodResult is how one pod of a Job ended, or how far it got if it still runs
+type JobPodResult struct {
+	Name  string
+	Node  string
+	Phase corev1.PodPhase
+	// ExitCode and Reason are those of the pod's first container once it terminated, e.g. 137 and
+	// OOMKilled. Reason falls back to the pod's, e.g. DeadlineExceeded.
+	ExitCode int32
+	Reason   string
+	// StartTime is zero for a pod that never started, FinishTime for one whose container didn't terminate
+	StartTime  time.Time
+	FinishTime time.Time
+}
+
+// JobResult is the outcome of a finished Job
+type JobResult struct {
+	Name string
+	// Complete is true for a Job that succeeded, false for one that failed
+	Complete bool
+	// Reason and Message are those of the Complete or Failed condition, e.g. BackoffLimitExceeded
+	Reason     string
+	Message    string
+	StartTime  time.Time
+	FinishTime time.Time
+	Succeeded  int32
+	Failed     int32
+	// Active is the number of pods still running when the Job finished, they are being terminated
+	Active int32
+	// Pods are the Job's pods that still exist, by start time
+	Pods []JobPodResult
+}
+
+// MaxConcurrentPods is the highest number of the Job's pods that ran at the same time, from the pods'
+// start and finish times. It is what parallelism bounds, without sampling the Job while it runs. The
+// times have a resolution of one second, a pod that finishes in the second another one starts is not
+// counted as running with it.
+func (r *JobResult) MaxConcurrentPods() int {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+	var events []event
+	for _, pod := range r.Pods {
+		if pod.StartTime.IsZero() {
+			continue
+		}
+		events = append(events, event{pod.StartTime, 1})
+		if !pod.FinishTime.IsZero() {
+			events = append(events, event{pod.FinishTime, -1})
+		}
+	}
+	// Finishes sort before starts at the same time
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].at.Equal(events[j].at) {
+			return events[i].delta < events[j].delta
+		}
+		return events[i].at.Before(events[j].at)
+	})
+	running, peak := 0, 0
+	for _, e := range events {
+		running += e.delta
+		if running > peak {
+			peak = running
+		}
+	}
+	return peak
+}
+
+// JobFinished returns the Job's Complete or Failed condition once one of them is true
+func JobFinished(job *batchv1.Job) (*batchv1.JobCondition, bool) {
+	for i, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) &&
+			condition.Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i], true
+		}
+	}
+	return nil, false
+}
+
+// WaitForJobComplete polls the Job until it finishes and returns its result, including how each of
+// its pods ended. A Job that failed returns its result along with an error wrapping ErrJobFailed, so
+// suites expecting a failure assert on that:
+//
+//	result, err := example.WaitForJobComplete(ctx, clientset, "test-ns", "failing-job", 5*time.Minute)
+//	gomega.Expect(err).To(gomega.MatchError(example.ErrJobFailed))
+//	gomega.Expect(result.Reason).To(gomega.Equal("BackoffLimitExceeded"))
+//
+// On timeout the error carries the Job's last pod counts.
+func WaitForJobComplete(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string,
+	timeout time.Duration) (*JobResult, error) {
+	timeout = Timeout(TimeoutJob, timeout)
+	var job *batchv1.Job
+	var condition *batchv1.JobCondition
+	err := PollUntil(ctx, 2*time.Second, timeout, func(ctx context.Context) (bool, error) {
+		var err error
+		job, err = clientset.BatchV1().Jobs(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		var finished bool
+		condition, finished = JobFinished(job)
+		return finished, nil
+	})
+	if err != nil {
+		if job == nil {
+			return nil, fmt.Errorf("job %s/%s: %w", namespace, name, err)
+		}
+		return nil, fmt.Errorf("job %s/%s not finished (active: %d, succeeded: %d, failed: %d): %w", namespace, name,
+			job.Status.Active, job.Status.Succeeded, job.Status.Failed, err)
+	}
+
+	result := &JobResult{
+		Name:       name,
+		Complete:   condition.Type == batchv1.JobComplete,
+		Reason:     condition.Reason,
+		Message:    condition.Message,
+		FinishTime: condition.LastTransitionTime.Time,
+		Succeeded:  job.Status.Succeeded,
+		Failed:     job.Status.Failed,
+		Active:     job.Status.Active,
+	}
+	if job.Status.StartTime != nil {
+		result.StartTime = job.Status.StartTime.Time
+	}
+	result.Pods, err = jobPodResults(ctx, clientset, job)
+	if err != nil {
+		return result, err
+	}
+	if !result.Complete {
+		return result, fmt.Errorf("job %s/%s: %s: %s: %w", namespace, name, result.Reason, result.Message, ErrJobFailed)
+	}
+	return result, nil
+}
+
+// jobPodResults lists the pods the Job's selector matches
+func jobPodResults(ctx context.Context, clientset *kubernetes.Clientset, job *batchv1.Job) ([]JobPodResult, error) {
+	selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("job %s/%s selector: %w", job.Namespace, job.Name, err)
+	}
+	pods, err := ListPods(ctx, clientset, job.Namespace, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("pods of job %s/%s listing failed: %w", job.Namespace, job.Name, err)
+	}
+
+	var results []JobPodResult
+	for _, pod := range pods {
+		result := JobPodResult{
+			Name:   pod.Name,
+			Node:   pod.Spec.NodeName,
+			Phase:  pod.Status.Phase,
+			Reason: pod.Status.Reason,
+		}
+		if pod.Status.StartTime != nil {
+			result.StartTime = pod.Status.StartTime.Time
+		}
+		if len(pod.Status.ContainerStatuses) > 0 {
+			if terminated := pod.Status.ContainerStatuses[0].State.Terminated; terminated != nil {
+				result.ExitCode = terminated.ExitCode
+				result.Reason = terminated.Reason
+				result.FinishTime = terminated.FinishedAt.Time
+			}
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].StartTime.Before(results[j].StartTime) })
+	return results, nil
+}
@@ -0,0 +1,147 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Job execution E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("JobExecutionTest"), func() {
+	var (
+		clientset   *kubernetes.Clientset
+		parallelJob []byte
+		failingJob  []byte
+		deadlineJob []byte
+		logger      zerolog.Logger
+		testTag     = "JobExecutionTest"
+	)
+
+	// Only the fields the assertions depend on are parsed from the fixtures
+	type jobSpec struct {
+		Spec struct {
+			Completions           int32 `yaml:"completions"`
+			Parallelism           int32 `yaml:"parallelism"`
+			BackoffLimit          int32 `yaml:"backoffLimit"`
+			ActiveDeadlineSeconds int64 `yaml:"activeDeadlineSeconds"`
+		} `yaml:"spec"`
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		parallelJob, failingJob, deadlineJob, err = example.GetJobTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should honor completions and parallelism", func() {
+		logger.Info().Msgf("=== Starting Job execution E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		var jobConfig jobSpec
+		err := yaml.Unmarshal(parallelJob, &jobConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		completions := jobConfig.Spec.Completions
+		parallelism := jobConfig.Spec.Parallelism
+
+		logger.Info().Msgf("=== Applying parallel Job manifest (completions: %d, parallelism: %d) ===", completions, parallelism)
+		err = example.ApplyRawManifest(clientset, parallelJob)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		result, err := example.WaitForJobComplete(context.TODO(), clientset, example.TestNamespace(), "parallel-job", 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The most pods that ran at once, from the run windows of all pods of the Job
+		maxConcurrent := result.MaxConcurrentPods()
+		logger.Info().Msgf("=== Job finished: succeeded %d, max concurrent pods %d ===", result.Succeeded, maxConcurrent)
+		gomega.Expect(result.Succeeded).To(gomega.Equal(completions),
+			"Succeeded pod count does not match completions")
+		gomega.Expect(maxConcurrent).To(gomega.BeNumerically("<=", parallelism),
+			fmt.Sprintf("Observed %d concurrent pods, parallelism is %d", maxConcurrent, parallelism))
+
+		succeededPods := int32(0)
+		for _, pod := range result.Pods {
+			if pod.Phase == v1.PodSucceeded {
+				succeededPods++
+			}
+		}
+		gomega.Expect(succeededPods).To(gomega.Equal(completions),
+			"Succeeded pods in namespace do not match completions")
+	})
+
+	ginkgo.It("should stop retrying after backoffLimit is exceeded", func() {
+		defer example.E2ePanicHandler()
+
+		var jobConfig jobSpec
+		err := yaml.Unmarshal(failingJob, &jobConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		backoffLimit := jobConfig.Spec.BackoffLimit
+
+		logger.Info().Msgf("=== Applying failing Job manifest (backoffLimit: %d) ===", backoffLimit)
+		err = example.ApplyRawManifest(clientset, failingJob)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Retries back off exponentially (10s, 20s, 40s...) so allow enough time for all attempts
+		result, err := example.WaitForJobComplete(context.TODO(), clientset, example.TestNamespace(), "failing-job", 5*time.Minute)
+		gomega.Expect(err).To(gomega.MatchError(example.ErrJobFailed))
+		logger.Info().Msgf("=== Job failed with reason %s after %d failed pods ===", result.Reason, result.Failed)
+
+		gomega.Expect(result.Reason).To(gomega.Equal("BackoffLimitExceeded"))
+		gomega.Expect(result.Failed).To(gomega.Equal(backoffLimit+1),
+			"Failed pod count should be backoffLimit + 1")
+		gomega.Expect(result.Succeeded).To(gomega.BeZero())
+	})
+
+	ginkgo.It("should terminate the Job once activeDeadlineSeconds elapses", func() {
+		defer example.E2ePanicHandler()
+
+		var jobConfig jobSpec
+		err := yaml.Unmarshal(deadlineJob, &jobConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		activeDeadline := time.Duration(jobConfig.Spec.ActiveDeadlineSeconds) * time.Second
+
+		logger.Info().Msgf("=== Applying deadline Job manifest (activeDeadlineSeconds: %v) ===", activeDeadline)
+		err = example.ApplyRawManifest(clientset, deadlineJob)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		result, err := example.WaitForJobComplete(context.TODO(), clientset, example.TestNamespace(), "deadline-job", activeDeadline+2*time.Minute)
+		gomega.Expect(err).To(gomega.MatchError(example.ErrJobFailed))
+		gomega.Expect(result.Reason).To(gomega.Equal("DeadlineExceeded"))
+		gomega.Expect(result.StartTime.IsZero()).To(gomega.BeFalse())
+
+		runtime := result.FinishTime.Sub(result.StartTime)
+		logger.Info().Msgf("=== Job terminated after %v (deadline %v) ===", runtime, activeDeadline)
+		gomega.Expect(runtime).To(gomega.BeNumerically(">=", activeDeadline),
+			"Job was terminated before its activeDeadlineSeconds")
+
+		gomega.Expect(result.Active).To(gomega.BeZero(), "Job still has active pods after deadline")
+	})
+
+})
@@ -0,0 +1,216 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("KEDA scale-to-zero E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("KEDAScaleToZeroTest"), func() {
+	var (
+		clientset     *kubernetes.Clientset
+		config        *rest.Config
+		dynamicClient dynamic.Interface
+		timeout       time.Duration
+		logger        zerolog.Logger
+		testTag       = "KEDAScaleToZeroTest"
+	)
+
+	const (
+		// Replicas the source asks for, one per unit of the metric
+		activeValue = 2
+		// Match pollingInterval and cooldownPeriod in the ScaledObject fixture
+		kedaPollingInterval = 5 * time.Second
+		cooldownPeriod      = 30 * time.Second
+		// Overridable with KEDA_TIMEOUT_SECONDS in .env
+		defaultTimeoutSeconds = 180
+		pollInterval          = 2 * time.Second
+	)
+
+	scaledObjectResource := schema.GroupVersionResource{Group: "keda.sh", Version: "v1alpha1", Resource: "scaledobjects"}
+
+	// setValue changes the metric the event source serves
+	setValue := func(value int) {
+		logger.Info().Msgf("=== Setting the event source value to %d ===", value)
+		_, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "keda-source", "source",
+			[]string{"sh", "-c", fmt.Sprintf(`echo '{"value": %d}' > /www/metric.json`, value)})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Setting the value failed: %s", stderr)
+	}
+
+	// condition returns the status of a ScaledObject condition, or "" while it is not reported
+	condition := func(conditionType string) string {
+		scaledObject, err := dynamicClient.Resource(scaledObjectResource).Namespace(example.TestNamespace()).Get(context.TODO(), "keda-app-scaler", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		conditions, _, err := unstructured.NestedSlice(scaledObject.Object, "status", "conditions")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, item := range conditions {
+			cond, ok := item.(map[string]interface{})
+			if ok && cond["type"] == conditionType {
+				status, _ := cond["status"].(string)
+				return status
+			}
+		}
+		return ""
+	}
+
+	// waitForReplicas waits until the Deployment wants and has the given number of ready replicas, with no
+	// other pods left, and returns how long that took
+	waitForReplicas := func(replicas int32, timeout time.Duration) time.Duration {
+		start := time.Now()
+		deadline := start.Add(timeout)
+		for {
+			deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "keda-app", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=keda-app"})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if *deployment.Spec.Replicas == replicas && deployment.Status.ReadyReplicas == replicas && len(pods) == int(replicas) {
+				return time.Since(start)
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("keda-app has %d/%d ready replicas and %d pods after %v, expected %d",
+					deployment.Status.ReadyReplicas, *deployment.Spec.Replicas, len(pods), timeout, replicas))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		dynamicClient, err = example.DynamicClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		// KEDA is an add-on, clusters without its CRDs are skipped rather than failed
+		_, err = clientset.Discovery().ServerResourcesForGroupVersion(scaledObjectResource.GroupVersion().String())
+		if apierrors.IsNotFound(err) {
+			ginkgo.Skip("KEDA CRDs (keda.sh/v1alpha1) are not installed")
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		timeout = example.Timeout(example.TimeoutHPA, defaultTimeoutSeconds*time.Second)
+		if value := os.Getenv("KEDA_TIMEOUT_SECONDS"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid KEDA_TIMEOUT_SECONDS: %s", value)
+			timeout = time.Duration(seconds) * time.Second
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should keep an idle workload at zero replicas", func() {
+		logger.Info().Msgf("=== Starting KEDA scale-to-zero E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		sourceYAML, workloadYAML, scaledObjectYAML, err := example.GetKEDATestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying event source and workload manifests ===")
+		err = example.ApplyRawManifest(clientset, sourceYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.ApplyRawManifest(clientset, workloadYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		readyTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(readyTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "keda-source", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			ready := false
+			for _, cond := range pod.Status.Conditions {
+				if cond.Type == v1.PodReady && cond.Status == v1.ConditionTrue {
+					ready = true
+				}
+			}
+			if ready {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("keda-source was not ready within %v", readyTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		logger.Info().Msgf("=== Applying ScaledObject manifest ===")
+		err = example.ApplyDynamicManifest(scaledObjectYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deadline = time.Now().Add(timeout)
+		for condition("Ready") != "True" {
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("ScaledObject was not Ready after %v, is the KEDA operator running?", timeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		// Several polling intervals with the value at 0
+		time.Sleep(cooldownPeriod)
+		gomega.Expect(condition("Active")).NotTo(gomega.Equal("True"), "ScaledObject is active with the value at 0")
+		waitForReplicas(0, 0)
+	})
+
+	ginkgo.It("should scale from zero once the event source is active", func() {
+		defer example.E2ePanicHandler()
+
+		setValue(activeValue)
+		scaleUp := waitForReplicas(activeValue, timeout)
+		logger.Info().Msgf("=== Scaled from 0 to %d ready replicas after %v ===", activeValue, scaleUp.Round(time.Second))
+		example.RecordMetric(testTag, "scale_from_zero_seconds", scaleUp.Seconds())
+		gomega.Expect(condition("Active")).To(gomega.Equal("True"))
+
+		// KEDA hands scaling above one replica to an HPA it owns
+		hpas, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(example.TestNamespace()).List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(hpas.Items).To(gomega.ContainElement(gomega.HaveField("Spec.ScaleTargetRef.Name", "keda-app")),
+			"KEDA created no HPA for keda-app")
+	})
+
+	ginkgo.It("should scale back to zero after the cooldown once the event source is idle", func() {
+		defer example.E2ePanicHandler()
+
+		setValue(0)
+		scaleDown := waitForReplicas(0, cooldownPeriod+timeout)
+		logger.Info().Msgf("=== Scaled back to 0 replicas after %v ===", scaleDown.Round(time.Second))
+		example.RecordMetric(testTag, "scale_to_zero_seconds", scaleDown.Seconds())
+		// KEDA must not scale to zero before the source has been idle for the cooldown. Its last active poll
+		// may have been up to one polling interval before the value changed.
+		gomega.Expect(scaleDown).To(gomega.BeNumerically(">=", cooldownPeriod-kedaPollingInterval),
+			"Scaled to zero before the cooldown period")
+		gomega.Expect(condition("Active")).NotTo(gomega.Equal("True"))
+	})
+
+})
@@ -0,0 +1,344 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Leak check modes LEAK_CHECK in .env selects from. Off by default, the check then costs nothing.
+const (
+	LeakCheckOff    = "off"
+	LeakCheckReport = "report"
+	LeakCheckFail   = "fail"
+)
+
+// LeakCheckMode returns the leak check mode from LEAK_CHECK, off when it isn't set or invalid
+func LeakCheckMode() string {
+	switch mode := strings.ToLower(os.Getenv("LEAK_CHECK")); mode {
+	case "", LeakCheckOff:
+		return LeakCheckOff
+	case LeakCheckReport, LeakCheckFail:
+		return mode
+	default:
+		Logger.Warn().Msgf("Ignoring invalid LEAK_CHECK %q, expected off, report or fail", mode)
+		return LeakCheckOff
+	}
+}
+
+var (
+	// openWatches counts the watch responses whose body wasn't closed yet, by API call
+	openWatches   = map[string]int{}
+	openWatchesMu sync.Mutex
+	// openPortForwards counts the port-forwards whose ForwardPorts didn't return yet
+	openPortForwards atomic.Int64
+	// openConnections counts the connections of the clients from GetRestConfig that weren't closed yet,
+	// only while the leak check is on
+	openConnections atomic.Int64
+)
+
+// trackWatch counts the watch as open until its response body is closed
+func trackWatch(call string, body io.ReadCloser) io.ReadCloser {
+	openWatchesMu.Lock()
+	openWatches[call]++
+	openWatchesMu.Unlock()
+	return &watchBody{ReadCloser: body, call: call}
+}
+
+type watchBody struct {
+	io.ReadCloser
+	call   string
+	closed sync.Once
+}
+
+func (b *watchBody) Close() error {
+	b.closed.Do(func() {
+		openWatchesMu.Lock()
+		openWatches[b.call]--
+		openWatchesMu.Unlock()
+	})
+	return b.ReadCloser.Close()
+}
+
+// watchesOpen returns the open watches by API call
+func watchesOpen() map[string]int {
+	openWatchesMu.Lock()
+	defer openWatchesMu.Unlock()
+	open := map[string]int{}
+	for call, count := range openWatches {
+		if count > 0 {
+			open[call] = count
+		}
+	}
+	return open
+}
+
+// countConnections makes the dial function count the connections it opens until they are closed.
+// client-go doesn't share transports between configs with a dial function, so with the leak check on
+// every client has connections of its own. The check closes their idle connections first, a client
+// whose connections are still in use shows up as connection growth.
+func countConnections(dial func(ctx context.Context, network, address string) (net.Conn, error)) func(ctx context.Context, network, address string) (net.Conn, error) {
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	}
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		conn, err := dial(ctx, network, address)
+		if err != nil {
+			return nil, err
+		}
+		openConnections.Add(1)
+		return &countedConn{Conn: conn}, nil
+	}
+}
+
+var (
+	// idleClosers are the transports of the clients from GetRestConfig, while the leak check is on
+	idleClosers   []interface{ CloseIdleConnections() }
+	idleClosersMu sync.Mutex
+)
+
+// trackTransport keeps the transport of a client, for the leak check to close its idle connections
+func trackTransport(delegate http.RoundTripper) http.RoundTripper {
+	if closer, ok := delegate.(interface{ CloseIdleConnections() }); ok {
+		idleClosersMu.Lock()
+		idleClosers = append(idleClosers, closer)
+		idleClosersMu.Unlock()
+	}
+	return delegate
+}
+
+// closeIdleConnections closes the idle connections of every client from GetRestConfig
+func closeIdleConnections() {
+	idleClosersMu.Lock()
+	defer idleClosersMu.Unlock()
+	for _, closer := range idleClosers {
+		closer.CloseIdleConnections()
+	}
+}
+
+type countedConn struct {
+	net.Conn
+	closed sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closed.Do(func() { openConnections.Add(-1) })
+	return c.Conn.Close()
+}
+
+// goroutine is one entry of a goroutine dump
+type goroutine struct {
+	id    int
+	state string
+	// top is the function the goroutine is in, creator the one that started it
+	top     string
+	creator string
+	stack   string
+}
+
+func (g goroutine) String() string {
+	return fmt.Sprintf("goroutine %d [%s] in %s, created by %s", g.id, g.state, g.top, g.creator)
+}
+
+// goroutines parses the dump of every goroutine of the process
+func goroutines() []goroutine {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	var result []goroutine
+	for _, entry := range strings.Split(string(buf), "\n\n") {
+		lines := strings.Split(strings.TrimSpace(entry), "\n")
+		header, found := strings.CutPrefix(lines[0], "goroutine ")
+		if !found || len(lines) < 2 {
+			continue
+		}
+		idText, state, _ := strings.Cut(header, " ")
+		id, err := strconv.Atoi(idText)
+		if err != nil {
+			continue
+		}
+		g := goroutine{
+			id:    id,
+			state: strings.TrimSuffix(strings.TrimPrefix(state, "["), "]:"),
+			stack: entry,
+		}
+		for _, line := range lines[1:] {
+			if creator, found := strings.CutPrefix(line, "created by "); found {
+				creator, _, _ = strings.Cut(creator, " in goroutine")
+				g.creator = creator
+			} else if g.top == "" && !strings.HasPrefix(line, "\t") && !waitFunction(line) {
+				g.top = functionOf(line)
+			}
+		}
+		result = append(result, g)
+	}
+	return result
+}
+
+// functionOf drops the arguments of a stack frame's function line
+func functionOf(line string) string {
+	if i := strings.LastIndex(line, "("); i > 0 && strings.HasSuffix(line, ")") {
+		return line[:i]
+	}
+	return line
+}
+
+// waitFunction reports whether the frame is one of the runtime, sync or time functions a goroutine
+// blocks in, which don't tell what it is waiting for
+func waitFunction(line string) bool {
+	for _, prefix := range []string{"runtime.", "internal/", "sync.", "time.Sleep"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// backgroundGoroutines run for the whole process whenever they are started, they are no leaks
+var backgroundGoroutines = []string{
+	"github.com/onsi/ginkgo/v2",
+	"github.com/onsi/gomega",
+	"testing.",
+	"os/signal.",
+	"k8s.io/klog/v2.(*flushDaemon)",
+	"k8s.io/client-go/transport.(*dynamicClientCert).run",
+	"k8s.io/client-go/util/connrotation",
+}
+
+// connectionGoroutines serve a connection of a client, they are counted as connections
+var connectionGoroutines = []string{
+	"net/http.(*persistConn)",
+	"net/http.(*http2ClientConn).readLoop",
+	"golang.org/x/net/http2.(*ClientConn).readLoop",
+}
+
+func stackContains(g goroutine, functions []string) bool {
+	for _, function := range functions {
+		if strings.Contains(g.stack, "\n"+function) || strings.HasPrefix(g.top, function) {
+			return true
+		}
+	}
+	return false
+}
+
+// LeakReport is what the process left running after its suites: the watches whose response wasn't
+// closed, the port-forwards that weren't stopped, the goroutines started since the baseline that
+// are still running, and the growth of the open connections
+type LeakReport struct {
+	Watches      map[string]int `json:"watches,omitempty"`
+	PortForwards int            `json:"port_forwards,omitempty"`
+	Goroutines   []string       `json:"goroutines,omitempty"`
+	// ConnectionGrowth is the number of connections open beyond those open at the baseline
+	ConnectionGrowth int64 `json:"connection_growth,omitempty"`
+}
+
+// Leaked reports whether anything was left running
+func (r LeakReport) Leaked() bool {
+	return len(r.Watches) > 0 || r.PortForwards > 0 || len(r.Goroutines) > 0 || r.ConnectionGrowth > 0
+}
+
+func (r LeakReport) String() string {
+	if !r.Leaked() {
+		return "no leaks"
+	}
+	watches := make([]string, 0, len(r.Watches))
+	for call, count := range r.Watches {
+		watches = append(watches, fmt.Sprintf("%s: %d", call, count))
+	}
+	sort.Strings(watches)
+	return fmt.Sprintf("%d goroutines, open watches [%s], %d port-forwards, %d more connections",
+		len(r.Goroutines), strings.Join(watches, ", "), r.PortForwards, r.ConnectionGrowth)
+}
+
+// LeakCheck compares what the process has running after its suites with a baseline taken before them
+type LeakCheck struct {
+	mode        string
+	goroutines  map[int]bool
+	connections int64
+}
+
+// StartLeakCheck takes the baseline of the leak check, once per process before the suites and after
+// GetClient, which installs the connection counting. It returns nil when LEAK_CHECK is off.
+func StartLeakCheck() *LeakCheck {
+	mode := LeakCheckMode()
+	if mode == LeakCheckOff {
+		return nil
+	}
+	check := &LeakCheck{mode: mode, goroutines: map[int]bool{}, connections: openConnections.Load()}
+	for _, g := range goroutines() {
+		check.goroutines[g.id] = true
+	}
+	return check
+}
+
+// Check waits up to grace for what the suites started to wind down, then logs what is still running
+// and records it as the LeakCheck metrics of the report. In fail mode a leak is returned as an error.
+// A nil check does nothing.
+func (c *LeakCheck) Check(grace time.Duration) (LeakReport, error) {
+	if c == nil {
+		return LeakReport{}, nil
+	}
+	// Idle connections are closed after the keep-alive timeout, which outlasts the grace, only those
+	// still in use count
+	closeIdleConnections()
+
+	var report LeakReport
+	deadline := time.Now().Add(grace)
+	for {
+		report = c.leaks()
+		if !report.Leaked() || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	logger := GetLogger("Setup")
+	RecordMetric("LeakCheck", "leaked_goroutines", len(report.Goroutines))
+	RecordMetric("LeakCheck", "open_watches", report.Watches)
+	RecordMetric("LeakCheck", "open_port_forwards", report.PortForwards)
+	RecordMetric("LeakCheck", "connection_growth", report.ConnectionGrowth)
+	if !report.Leaked() {
+		logger.Info().Msgf("Leak check: %s", report)
+		return report, nil
+	}
+	logger.Warn().Interface("leaks", report).Msgf("Leak check: %s", report)
+	if c.mode == LeakCheckFail {
+		return report, fmt.Errorf("leaks after the suites: %s", report)
+	}
+	return report, nil
+}
+
+func (c *LeakCheck) leaks() LeakReport {
+	report := LeakReport{
+		Watches:          watchesOpen(),
+		PortForwards:     int(openPortForwards.Load()),
+		ConnectionGrowth: openConnections.Load() - c.connections,
+	}
+	if report.ConnectionGrowth < 0 {
+		report.ConnectionGrowth = 0
+	}
+	for _, g := range goroutines() {
+		if c.goroutines[g.id] || stackContains(g, backgroundGoroutines) || stackContains(g, connectionGoroutines) {
+			continue
+		}
+		report.Goroutines = append(report.Goroutines, g.String())
+	}
+	return report
+}
@@ -0,0 +1,258 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"example"
+)
+
+// leaseCandidate is a leader election participant running in the test process, like the
+// controllers that depend on lease-based leader election
+type leaseCandidate struct {
+	identity string
+	cancel   context.CancelFunc
+	// Closed when the candidate becomes the leader
+	leading chan struct{}
+	// Closed when the candidate has stopped participating
+	stopped chan struct{}
+}
+
+var _ = ginkgo.Describe("Lease coordination E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("LeaseCoordinationTest"), func() {
+	var (
+		clientset  *kubernetes.Clientset
+		candidates []*leaseCandidate
+		holderA    *leaseCandidate
+		holderB    *leaseCandidate
+		logger     zerolog.Logger
+		testTag    = "LeaseCoordinationTest"
+	)
+
+	const (
+		leaseName = "e2e-leader-election"
+		// The defaults of kube-controller-manager, which most controllers copy
+		leaseDuration = 15 * time.Second
+		renewDeadline = 10 * time.Second
+		retryPeriod   = 2 * time.Second
+		// Allowance for API latency and the jitter client-go adds to the retry period
+		slack = 5 * time.Second
+	)
+
+	// startCandidate starts a candidate that keeps trying to acquire and renew the lease until it is
+	// stopped. With releaseOnCancel it gives up the lease on stop, otherwise it vanishes like a crashed
+	// process and the lease has to expire.
+	startCandidate := func(identity string, releaseOnCancel bool) *leaseCandidate {
+		ctx, cancel := context.WithCancel(context.Background())
+		candidate := &leaseCandidate{
+			identity: identity,
+			cancel:   cancel,
+			leading:  make(chan struct{}),
+			stopped:  make(chan struct{}),
+		}
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock: &resourcelock.LeaseLock{
+				LeaseMeta:  metav1.ObjectMeta{Name: leaseName, Namespace: example.TestNamespace()},
+				Client:     clientset.CoordinationV1(),
+				LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
+			},
+			LeaseDuration:   leaseDuration,
+			RenewDeadline:   renewDeadline,
+			RetryPeriod:     retryPeriod,
+			ReleaseOnCancel: releaseOnCancel,
+			Name:            identity,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(context.Context) {
+					logger.Info().Msgf("%s started leading\n", identity)
+					close(candidate.leading)
+				},
+				OnStoppedLeading: func() {
+					logger.Info().Msgf("%s stopped leading\n", identity)
+				},
+			},
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		go func() {
+			defer close(candidate.stopped)
+			elector.Run(ctx)
+		}()
+		candidates = append(candidates, candidate)
+		return candidate
+	}
+
+	stopCandidate := func(candidate *leaseCandidate) {
+		candidate.cancel()
+		select {
+		case <-candidate.stopped:
+		case <-time.After(renewDeadline + slack):
+			ginkgo.Fail(fmt.Sprintf("Candidate %s did not stop", candidate.identity))
+		}
+	}
+
+	isLeading := func(candidate *leaseCandidate) bool {
+		select {
+		case <-candidate.leading:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// waitForLeading waits until the candidate leads and returns how long that took
+	waitForLeading := func(candidate *leaseCandidate, timeout time.Duration) time.Duration {
+		start := time.Now()
+		select {
+		case <-candidate.leading:
+			return time.Since(start)
+		case <-time.After(timeout):
+			ginkgo.Fail(fmt.Sprintf("Candidate %s did not acquire the lease within %v", candidate.identity, timeout))
+			return 0
+		}
+	}
+
+	getLease := func() *coordinationv1.Lease {
+		lease, err := clientset.CoordinationV1().Leases(example.TestNamespace()).Get(context.TODO(), leaseName, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return lease
+	}
+
+	holder := func(lease *coordinationv1.Lease) string {
+		if lease.Spec.HolderIdentity == nil {
+			return ""
+		}
+		return *lease.Spec.HolderIdentity
+	}
+
+	transitions := func(lease *coordinationv1.Lease) int32 {
+		if lease.Spec.LeaseTransitions == nil {
+			return 0
+		}
+		return *lease.Spec.LeaseTransitions
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		for _, candidate := range candidates {
+			candidate.cancel()
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should let the first candidate acquire the lease", func() {
+		logger.Info().Msgf("=== Starting Lease coordination E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Starting candidate e2e-holder-a ===")
+		holderA = startCandidate("e2e-holder-a", false)
+		acquired := waitForLeading(holderA, retryPeriod+slack)
+		example.RecordMetric(testTag, "acquire_seconds", acquired.Seconds())
+
+		lease := getLease()
+		logger.Info().Msgf("=== Lease acquired after %v, holder %s ===", acquired.Round(time.Millisecond), holder(lease))
+		gomega.Expect(holder(lease)).To(gomega.Equal("e2e-holder-a"))
+		gomega.Expect(lease.Spec.LeaseDurationSeconds).NotTo(gomega.BeNil())
+		gomega.Expect(*lease.Spec.LeaseDurationSeconds).To(gomega.Equal(int32(leaseDuration.Seconds())))
+	})
+
+	ginkgo.It("should keep renewing the lease while holding it", func() {
+		defer example.E2ePanicHandler()
+
+		gomega.Expect(holderA).NotTo(gomega.BeNil(), "e2e-holder-a was not started")
+		first := getLease()
+		gomega.Expect(first.Spec.RenewTime).NotTo(gomega.BeNil())
+
+		// Several retry periods, each of which renews, but well within the lease duration
+		time.Sleep(3 * retryPeriod)
+		second := getLease()
+		gomega.Expect(second.Spec.RenewTime).NotTo(gomega.BeNil())
+		renewedBy := second.Spec.RenewTime.Sub(first.Spec.RenewTime.Time)
+		logger.Info().Msgf("=== renewTime advanced by %v ===", renewedBy.Round(time.Millisecond))
+
+		gomega.Expect(holder(second)).To(gomega.Equal("e2e-holder-a"))
+		gomega.Expect(renewedBy).To(gomega.BeNumerically(">", 0), "The holder did not renew the lease")
+		gomega.Expect(transitions(second)).To(gomega.Equal(transitions(first)), "The lease changed hands while being renewed")
+	})
+
+	ginkgo.It("should keep a second candidate waiting while the lease is renewed", func() {
+		defer example.E2ePanicHandler()
+
+		gomega.Expect(holderA).NotTo(gomega.BeNil(), "e2e-holder-a was not started")
+		logger.Info().Msgf("=== Starting candidate e2e-holder-b ===")
+		holderB = startCandidate("e2e-holder-b", true)
+
+		// Longer than the lease duration, so only the renewals keep e2e-holder-b out
+		time.Sleep(leaseDuration + slack)
+		gomega.Expect(isLeading(holderB)).To(gomega.BeFalse(), "e2e-holder-b acquired a lease that was being renewed")
+		gomega.Expect(holder(getLease())).To(gomega.Equal("e2e-holder-a"))
+	})
+
+	ginkgo.It("should hand the lease to the waiting candidate once the holder's lease expires", func() {
+		defer example.E2ePanicHandler()
+
+		gomega.Expect(holderB).NotTo(gomega.BeNil(), "e2e-holder-b was not started")
+		before := getLease()
+
+		// Stopped without releasing, like a crashed process
+		logger.Info().Msgf("=== Stopping e2e-holder-a without releasing the lease ===")
+		start := time.Now()
+		stopCandidate(holderA)
+
+		waitForLeading(holderB, leaseDuration+retryPeriod+slack)
+		takeover := time.Since(start)
+		logger.Info().Msgf("=== e2e-holder-b took over after %v ===", takeover.Round(time.Millisecond))
+		example.RecordMetric(testTag, "takeover_seconds", takeover.Seconds())
+
+		after := getLease()
+		gomega.Expect(holder(after)).To(gomega.Equal("e2e-holder-b"))
+		gomega.Expect(transitions(after)).To(gomega.Equal(transitions(before)+1), "leaseTransitions was not incremented")
+	})
+
+	ginkgo.It("should hand the lease over immediately when the holder releases it", func() {
+		defer example.E2ePanicHandler()
+
+		gomega.Expect(holderB).NotTo(gomega.BeNil(), "e2e-holder-b was not started")
+		gomega.Expect(isLeading(holderB)).To(gomega.BeTrue(), "e2e-holder-b does not hold the lease")
+
+		logger.Info().Msgf("=== Starting candidate e2e-holder-c and releasing the lease of e2e-holder-b ===")
+		holderC := startCandidate("e2e-holder-c", true)
+		start := time.Now()
+		stopCandidate(holderB)
+		gomega.Expect(holder(getLease())).NotTo(gomega.Equal("e2e-holder-b"), "e2e-holder-b did not release the lease")
+
+		// No need to wait for an expiry, so well under the lease duration
+		waitForLeading(holderC, retryPeriod+slack)
+		handover := time.Since(start)
+		logger.Info().Msgf("=== e2e-holder-c took over after %v ===", handover.Round(time.Millisecond))
+		example.RecordMetric(testTag, "release_handover_seconds", handover.Seconds())
+		gomega.Expect(holder(getLease())).To(gomega.Equal("e2e-holder-c"))
+	})
+
+})
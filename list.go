@@ -0,0 +1,90 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ListPageSize is the Limit of each page the list helpers request, so a namespace with thousands of
+// pods is listed in several small responses instead of one the API server has to build at once
+const ListPageSize = 500
+
+// ErrUnscopedList is returned by ListPods for options without a label selector. Listing every pod of a
+// namespace gets slow where thousands of them run, a suite lists the pods of its own workload.
+var ErrUnscopedList = errors.New("pod list without label selector")
+
+// ListPods lists the namespace's pods matching the options' label selector, and field selector if it
+// has one, page by page. Limit and Continue of the options are ignored.
+//
+//	pods, err := example.ListPods(ctx, clientset, "test-ns", metav1.ListOptions{
+//		LabelSelector: "app=app",
+//		FieldSelector: "status.phase=Running",
+//	})
+func ListPods(ctx context.Context, clientset *kubernetes.Clientset, namespace string, options metav1.ListOptions) ([]corev1.Pod, error) {
+	if options.LabelSelector == "" {
+		return nil, fmt.Errorf("pods in %s: %w", namespace, ErrUnscopedList)
+	}
+	pods, err := listPodPages(ctx, clientset, namespace, options)
+	if err != nil {
+		return nil, fmt.Errorf("pods %q in %s listing failed: %w", options.LabelSelector, namespace, err)
+	}
+	return pods, nil
+}
+
+// ListPodsOnNode lists the pods bound to the node page by page, in every namespace when namespace is
+// empty. The node's field selector scopes the list instead of a label selector.
+func ListPodsOnNode(ctx context.Context, clientset *kubernetes.Clientset, namespace, nodeName string) ([]corev1.Pod, error) {
+	pods, err := listPodPages(ctx, clientset, namespace, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pods on node %s listing failed: %w", nodeName, err)
+	}
+	return pods, nil
+}
+
+// listPodPages lists the pods matching the options page by page, whatever selectors they have
+func listPodPages(ctx context.Context, clientset *kubernetes.Clientset, namespace string, options metav1.ListOptions) ([]corev1.Pod, error) {
+	var pods []corev1.Pod
+	err := paginate(options, func() { pods = nil }, func(options metav1.ListOptions) (string, error) {
+		list, err := clientset.CoreV1().Pods(namespace).List(ctx, options)
+		if err != nil {
+			return "", err
+		}
+		pods = append(pods, list.Items...)
+		return list.Continue, nil
+	})
+	return pods, err
+}
+
+// paginate calls page with the options of each page, ListPageSize objects at a time, until it returns
+// an empty continue token. A token expires when the list takes longer than the API server keeps its
+// snapshot (5 minutes by default), the list then starts over once, after reset.
+func paginate(options metav1.ListOptions, reset func(), page func(options metav1.ListOptions) (string, error)) error {
+	options.Limit = ListPageSize
+	options.Continue = ""
+	restarted := false
+	for {
+		next, err := page(options)
+		if apierrors.IsResourceExpired(err) && !restarted {
+			restarted = true
+			reset()
+			options.Continue = ""
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if next == "" {
+			return nil
+		}
+		options.Continue = next
+	}
+}
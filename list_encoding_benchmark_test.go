@@ -0,0 +1,148 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("List encoding benchmark E2E test", ginkgo.Ordered, ginkgo.Label("benchmark"), example.SuiteConcurrency("ListEncodingBenchmarkTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		config    *rest.Config
+		pods      int
+		rounds    int
+		logger    zerolog.Logger
+		testTag   = "ListEncodingBenchmarkTest"
+	)
+
+	const (
+		// Overridable with LIST_BENCH_PODS and LIST_BENCH_ROUNDS in .env
+		defaultPods   = 500
+		defaultRounds = 20
+		selector      = "app=list-bench"
+	)
+
+	envInt := func(name string, fallback int) int {
+		value := os.Getenv(name)
+		if value == "" {
+			return fallback
+		}
+		parsed, err := strconv.Atoi(value)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid %s: %s", name, value)
+		gomega.Expect(parsed).To(gomega.BeNumerically(">", 0), "Invalid %s: %s", name, value)
+		return parsed
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+		pods = envInt("LIST_BENCH_PODS", defaultPods)
+		rounds = envInt("LIST_BENCH_ROUNDS", defaultRounds)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should create the pods to list", func() {
+		logger.Info().Msgf("=== Starting List encoding benchmark E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		// The pods stay Pending on a node selector no node has, so they take no node resources. The
+		// environment makes them about as large as typical application pods.
+		deployment, _ := example.NewDeployment("list-bench").WithReplicas(int32(pods)).Build()
+		template := &deployment.Spec.Template.Spec
+		template.NodeSelector = map[string]string{"e2e.example.com/list-bench": "unschedulable"}
+		for i := 0; i < 20; i++ {
+			template.Containers[0].Env = append(template.Containers[0].Env, v1.EnvVar{
+				Name:  fmt.Sprintf("LIST_BENCH_%d", i),
+				Value: fmt.Sprintf("value-%d-of-a-typical-configuration-setting", i),
+			})
+		}
+		logger.Info().Msgf("=== Creating %d Pending pods ===", pods)
+		_, err := clientset.AppsV1().Deployments(example.TestNamespace()).Create(context.TODO(), deployment, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		_, err = example.TestNamespaceInformers().WaitForPods(context.TODO(), selector, 5*time.Minute, func(current []v1.Pod) bool {
+			return len(current) == pods
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should list the pods with less data over protobuf than over JSON", func() {
+		defer example.E2ePanicHandler()
+
+		sizes := map[string]int{}
+		medians := map[string]float64{}
+		for _, encoding := range []struct {
+			name        string
+			contentType string
+		}{{"json", runtime.ContentTypeJSON}, {"protobuf", runtime.ContentTypeProtobuf}} {
+			// The client-side rate limit would dominate the measured latencies
+			encodingConfig := example.WithContentType(config, encoding.contentType)
+			encodingConfig.QPS = 100
+			encodingConfig.Burst = 200
+			client, err := kubernetes.NewForConfig(encodingConfig)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			body, err := client.CoreV1().RESTClient().Get().Namespace(example.TestNamespace()).Resource("pods").
+				Param("labelSelector", selector).DoRaw(context.TODO())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			sizes[encoding.name] = len(body)
+
+			// Each round includes decoding into the typed list, where protobuf saves most
+			var latencies []float64
+			for round := 0; round < rounds; round++ {
+				start := time.Now()
+				list, err := client.CoreV1().Pods(example.TestNamespace()).List(context.TODO(), metav1.ListOptions{LabelSelector: selector})
+				latencies = append(latencies, float64(time.Since(start).Milliseconds()))
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				gomega.Expect(list.Items).To(gomega.HaveLen(pods))
+			}
+			medians[encoding.name] = example.Percentile(latencies, 50)
+
+			logger.Info().Msgf("%s: %d bytes, list p50: %.0fms, p99: %.0fms\n", encoding.name, len(body),
+				example.Percentile(latencies, 50), example.Percentile(latencies, 99))
+			example.RecordMetric(testTag, fmt.Sprintf("list_%d_%s_bytes", pods, encoding.name), len(body))
+			example.RecordMetric(testTag, fmt.Sprintf("list_%d_%s_p50_ms", pods, encoding.name), example.Percentile(latencies, 50))
+			example.RecordMetric(testTag, fmt.Sprintf("list_%d_%s_p99_ms", pods, encoding.name), example.Percentile(latencies, 99))
+		}
+
+		logger.Info().Msgf("=== Protobuf lists are %.0f%% of the JSON size, p50 %.0fms vs %.0fms ===",
+			100*float64(sizes["protobuf"])/float64(sizes["json"]), medians["protobuf"], medians["json"])
+		gomega.Expect(sizes["protobuf"]).To(gomega.BeNumerically("<", sizes["json"]),
+			"The protobuf list is not smaller, did the API server answer with JSON?")
+		// Latencies depend on the network and the API server's load, they are recorded but not asserted
+	})
+
+})
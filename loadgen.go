@@ -0,0 +1,139 @@
+package example
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResourceConsumerImage is the upstream e2e image LoadGenerator drives. Pods of the load target run it
+// as their container and expose its port 8080, see hpa_scale_down_test_yamls/deployment.yaml.
+const ResourceConsumerImage = "registry.k8s.io/e2e-test-images/resource-consumer:1.13"
+
+// Each round asks every pod to burn its share for the round's duration, so the load follows scaling
+// with at most one round of delay and ends at most one round after Stop
+const loadRound = 10 * time.Second
+
+// LoadGenerator keeps a fixed total CPU load spread evenly over the ready pods of a workload. With a
+// total of T millicores and an HPA targeting U% of a request of R millicores, the HPA settles at
+// ceil(T / (R * U / 100)) replicas whatever the node's speed, unlike workloads that burn CPU as fast
+// as they can.
+type LoadGenerator struct {
+	logger    zerolog.Logger
+	clientset *kubernetes.Clientset
+	namespace string
+	selector  string
+	cancel    context.CancelFunc
+	done      chan struct{}
+
+	mu         sync.Mutex
+	millicores int
+	roundEnd   time.Time
+}
+
+// StartLoadGenerator starts spreading totalMillicores over the ready pods matching the selector, which
+// must run ResourceConsumerImage. Failed requests are logged and retried in the next round.
+func StartLoadGenerator(logger zerolog.Logger, clientset *kubernetes.Clientset, namespace, selector string, totalMillicores int) *LoadGenerator {
+	ctx, cancel := context.WithCancel(context.Background())
+	generator := &LoadGenerator{
+		logger:     logger,
+		clientset:  clientset,
+		namespace:  namespace,
+		selector:   selector,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		millicores: totalMillicores,
+	}
+	go generator.run(ctx)
+	return generator
+}
+
+// SetMillicores changes the total load from the next round on
+func (g *LoadGenerator) SetMillicores(totalMillicores int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.millicores = totalMillicores
+}
+
+// Stop ends the load and returns once the last round's consumption is over, so the pods are idle
+func (g *LoadGenerator) Stop() {
+	g.cancel()
+	<-g.done
+	g.mu.Lock()
+	remaining := time.Until(g.roundEnd)
+	g.mu.Unlock()
+	if remaining > 0 {
+		time.Sleep(remaining)
+	}
+}
+
+func (g *LoadGenerator) run(ctx context.Context) {
+	defer close(g.done)
+	ticker := time.NewTicker(loadRound)
+	defer ticker.Stop()
+	for {
+		g.round(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (g *LoadGenerator) round(ctx context.Context) {
+	pods, err := ListPods(ctx, g.clientset, g.namespace, metav1.ListOptions{LabelSelector: g.selector})
+	if err != nil {
+		if ctx.Err() == nil {
+			g.logger.Error().Msgf("Load generator failed to list pods %q: %v", g.selector, err)
+		}
+		return
+	}
+	var ready []string
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && podReady(pod) {
+			ready = append(ready, pod.Name)
+		}
+	}
+	if len(ready) == 0 {
+		return
+	}
+
+	g.mu.Lock()
+	total := g.millicores
+	g.mu.Unlock()
+	duration := strconv.Itoa(int(loadRound.Seconds()))
+	for i, name := range ready {
+		share := total / len(ready)
+		if i < total%len(ready) {
+			share++
+		}
+		if share == 0 {
+			continue
+		}
+		err := g.clientset.CoreV1().RESTClient().Post().
+			Namespace(g.namespace).
+			Resource("pods").
+			Name(name+":8080").
+			SubResource("proxy").
+			Suffix("ConsumeCPU").
+			Param("millicores", strconv.Itoa(share)).
+			Param("durationSec", duration).
+			Do(ctx).
+			Error()
+		if err != nil {
+			if ctx.Err() == nil {
+				g.logger.Error().Msgf("Load generator failed to start %dm on %s: %v", share, name, err)
+			}
+			continue
+		}
+		g.mu.Lock()
+		g.roundEnd = time.Now().Add(loadRound)
+		g.mu.Unlock()
+	}
+}
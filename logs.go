@@ -0,0 +1,84 @@
+package example
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PodLogOptions selects which container output to read. The zero value reads the whole log of the
+// pod's only container.
+type PodLogOptions struct {
+	// Required when the pod has more than one container
+	Container string
+	// Only output logged within this duration, zero for all of it
+	Since time.Duration
+	// The output of the previous instance of the container, e.g. the one that was OOMKilled
+	Previous bool
+	// Prefix every line with the RFC3339Nano time the runtime logged it at
+	Timestamps bool
+	// Keep streaming new output until the container stops or the context is cancelled. GetPodLogs
+	// ignores it.
+	Follow bool
+}
+
+func (o PodLogOptions) toAPI() *corev1.PodLogOptions {
+	options := &corev1.PodLogOptions{
+		Container:  o.Container,
+		Previous:   o.Previous,
+		Timestamps: o.Timestamps,
+		Follow:     o.Follow,
+	}
+	if o.Since > 0 {
+		seconds := int64(o.Since.Round(time.Second).Seconds())
+		options.SinceSeconds = &seconds
+	}
+	return options
+}
+
+// GetPodLogs returns the container output selected by options
+func GetPodLogs(ctx context.Context, clientset *kubernetes.Clientset, namespace, pod string, options PodLogOptions) (string, error) {
+	options.Follow = false
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, options.toAPI()).Stream(ctx)
+	if err != nil {
+		return "", fmt.Errorf("log request for %s/%s failed: %w", namespace, pod, err)
+	}
+	defer stream.Close()
+	output, err := io.ReadAll(stream)
+	if err != nil {
+		return string(output), fmt.Errorf("log read for %s/%s failed: %w", namespace, pod, err)
+	}
+	return string(output), nil
+}
+
+// StreamPodLogs opens the container output selected by options and calls onLine for every line,
+// without the line break, from a goroutine. It returns once the stream is open, so nothing logged after
+// that is missed. The returned channel receives the outcome when the output ends; with Follow that is
+// once the container stops or ctx is cancelled.
+func StreamPodLogs(ctx context.Context, clientset *kubernetes.Clientset, namespace, pod string, options PodLogOptions,
+	onLine func(line string)) (<-chan error, error) {
+	stream, err := clientset.CoreV1().Pods(namespace).GetLogs(pod, options.toAPI()).Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("log request for %s/%s failed: %w", namespace, pod, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		defer stream.Close()
+		scanner := bufio.NewScanner(stream)
+		for scanner.Scan() {
+			onLine(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			done <- fmt.Errorf("log stream for %s/%s failed: %w", namespace, pod, err)
+			return
+		}
+		done <- nil
+	}()
+	return done, nil
+}
@@ -1,13 +1,67 @@
 package example_test
 
 import (
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
+
+	"example"
 )
 
 func TestMain(t *testing.T) {
 	gomega.RegisterFailHandler(ginkgo.Fail)
 	ginkgo.RunSpecs(t, "All Tests Suite")
 }
+
+// The cluster is checked once per run on process 1. Every process then builds its clientset and
+// creates its test namespace with the informers the suites share, instead of each Describe doing so
+// in BeforeAll.
+var _ = ginkgo.SynchronizedBeforeSuite(func(ctx context.Context) []byte {
+	clientset, err := example.GetClient()
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	gomega.Expect(example.Preflight(ctx, clientset)).To(gomega.Succeed())
+	return nil
+}, func(ctx context.Context, _ []byte) {
+	clientset, err := example.GetClient()
+	gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	leakCheck = example.StartLeakCheck()
+	gomega.Expect(example.SetUpTestNamespace(ctx, clientset)).To(gomega.Succeed())
+})
+
+// specAPICalls counts the API calls of the running spec. Every spec's calls are logged and recorded under
+// its suite's tag, and a spec making more than the tag's budget from API_CALL_BUDGETS fails.
+var specAPICalls *example.APICallTracker
+
+var _ = ginkgo.BeforeEach(func() {
+	specAPICalls = example.TrackAPICalls()
+})
+
+var _ = ginkgo.ReportAfterEach(func(report ginkgo.SpecReport) {
+	// Skipped and pending specs never ran the BeforeEach
+	if specAPICalls == nil {
+		return
+	}
+	tracker := specAPICalls
+	specAPICalls = nil
+	gomega.Expect(example.CheckSpecAPICalls(report, tracker)).To(gomega.Succeed())
+})
+
+// leakCheck is the process's baseline for the leak check, nil unless LEAK_CHECK is set in .env
+var leakCheck *example.LeakCheck
+
+// Under ginkgo -p every process but the first leaves its logs, metrics and API calls for the final report.
+// The leak check runs once the shared informers are stopped, with LEAK_CHECK=fail a leak fails the run.
+var _ = ginkgo.SynchronizedAfterSuite(func(ctx context.Context) {
+	if clientset, err := example.GetClient(); err == nil {
+		example.TearDownTestNamespace(ctx, clientset)
+	}
+	_, leakErr := leakCheck.Check(10 * time.Second)
+	if err := example.WriteProcessReport(); err != nil {
+		fmt.Fprintf(ginkgo.GinkgoWriter, "Process report not written: %v\n", err)
+	}
+	gomega.Expect(leakErr).NotTo(gomega.HaveOccurred())
+}, func() {})
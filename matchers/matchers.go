@@ -0,0 +1,261 @@
+// Package matchers holds gomega matchers for cluster state. Their failure messages name the pods,
+// nodes and zones involved, so specs don't have to build that detail themselves.
+package matchers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+	corev1 "k8s.io/api/core/v1"
+
+	"example"
+)
+
+// clusterMatcher adapts a match function that explains itself to types.GomegaMatcher. The explanation
+// describes the actual state and is used for both failure messages.
+type clusterMatcher struct {
+	expectation string
+	match       func(actual interface{}) (bool, string, error)
+	explanation string
+}
+
+func (m *clusterMatcher) Match(actual interface{}) (bool, error) {
+	matched, explanation, err := m.match(actual)
+	m.explanation = explanation
+	return matched, err
+}
+
+func (m *clusterMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected %s, but %s", m.expectation, m.explanation)
+}
+
+func (m *clusterMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected not %s, but %s", m.expectation, m.explanation)
+}
+
+// toPods accepts a pod, a pod pointer, a slice of pods or a pod list
+func toPods(actual interface{}) ([]corev1.Pod, error) {
+	switch pods := actual.(type) {
+	case corev1.Pod:
+		return []corev1.Pod{pods}, nil
+	case *corev1.Pod:
+		return []corev1.Pod{*pods}, nil
+	case []corev1.Pod:
+		return pods, nil
+	case *corev1.PodList:
+		return pods.Items, nil
+	}
+	return nil, fmt.Errorf("expected pods, got:\n%s", format.Object(actual, 1))
+}
+
+// toSummary accepts an example.PodSummary, or pods in any form toPods accepts
+func toSummary(actual interface{}) (example.PodSummary, error) {
+	if summary, ok := actual.(example.PodSummary); ok {
+		return summary, nil
+	}
+	pods, err := toPods(actual)
+	if err != nil {
+		return example.PodSummary{}, err
+	}
+	return example.SummarizePods(pods), nil
+}
+
+// notReadyReason returns why a pod isn't ready, empty if it is. The Ready condition decides, the
+// containers and the phase only explain a pod that isn't, so the reason is never empty for one.
+func notReadyReason(pod corev1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "terminating"
+	}
+	var message string
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			if condition.Status == corev1.ConditionTrue {
+				return ""
+			}
+			message = condition.Message
+		}
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil {
+			if status.State.Waiting.Reason != "" {
+				return status.State.Waiting.Reason
+			}
+			return "waiting"
+		}
+	}
+	if message != "" {
+		return message
+	}
+	if pod.Status.Phase != "" {
+		return string(pod.Status.Phase)
+	}
+	return "not ready"
+}
+
+// BeReady succeeds when every pod is Ready and not terminating. It accepts a pod, a pod pointer, a
+// slice of pods or a pod list.
+func BeReady() types.GomegaMatcher {
+	return &clusterMatcher{
+		expectation: "all pods to be ready",
+		match: func(actual interface{}) (bool, string, error) {
+			pods, err := toPods(actual)
+			if err != nil {
+				return false, "", err
+			}
+			var notReady []string
+			for _, pod := range pods {
+				if reason := notReadyReason(pod); reason != "" {
+					notReady = append(notReady, fmt.Sprintf("%s on %q (%s)", pod.Name, pod.Spec.NodeName, reason))
+				}
+			}
+			if len(notReady) == 0 {
+				return true, fmt.Sprintf("all %d are", len(pods)), nil
+			}
+			return false, "not ready: " + strings.Join(notReady, ", "), nil
+		},
+	}
+}
+
+// SatisfyPDB succeeds when at least minAvailable of the pods are ready, the way a PodDisruptionBudget
+// counts healthy pods. Terminating pods don't count.
+func SatisfyPDB(minAvailable int32) types.GomegaMatcher {
+	return &clusterMatcher{
+		expectation: fmt.Sprintf("at least %d ready pods", minAvailable),
+		match: func(actual interface{}) (bool, string, error) {
+			pods, err := toPods(actual)
+			if err != nil {
+				return false, "", err
+			}
+			var ready []string
+			var notReady []string
+			for _, pod := range pods {
+				if reason := notReadyReason(pod); reason != "" {
+					notReady = append(notReady, fmt.Sprintf("%s (%s)", pod.Name, reason))
+				} else {
+					ready = append(ready, pod.Name)
+				}
+			}
+			explanation := fmt.Sprintf("%d are ready %v, not ready: %v", len(ready), ready, notReady)
+			return int32(len(ready)) >= minAvailable, explanation, nil
+		},
+	}
+}
+
+// HaveReadyPods succeeds when exactly count pods are ready and not terminating, whatever state the
+// other pods are in. It accepts an example.PodSummary as well as pods.
+func HaveReadyPods(count int) types.GomegaMatcher {
+	return &clusterMatcher{
+		expectation: fmt.Sprintf("%d ready pods", count),
+		match: func(actual interface{}) (bool, string, error) {
+			summary, err := toSummary(actual)
+			if err != nil {
+				return false, "", err
+			}
+			return len(summary.Ready) == count, fmt.Sprintf("the pods are %s", summary), nil
+		},
+	}
+}
+
+// HaveNoPendingPods succeeds when no pod is waiting to be scheduled or for its containers to start,
+// e.g. after a rollout that must have found room for every pod. It accepts an example.PodSummary as
+// well as pods.
+func HaveNoPendingPods() types.GomegaMatcher {
+	return &clusterMatcher{
+		expectation: "no pending pods",
+		match: func(actual interface{}) (bool, string, error) {
+			summary, err := toSummary(actual)
+			if err != nil {
+				return false, "", err
+			}
+			return len(summary.Pending) == 0, fmt.Sprintf("the pods are %s", summary), nil
+		},
+	}
+}
+
+// BeScheduledInZone succeeds when every pod runs on a node in one of the zones. Unscheduled pods fail
+// it.
+func BeScheduledInZone(zoneMap *example.ZoneMap, zones ...string) types.GomegaMatcher {
+	return &clusterMatcher{
+		expectation: fmt.Sprintf("all pods to be scheduled in zones %v", zones),
+		match: func(actual interface{}) (bool, string, error) {
+			pods, err := toPods(actual)
+			if err != nil {
+				return false, "", err
+			}
+			allowed := map[string]bool{}
+			for _, zone := range zones {
+				allowed[zone] = true
+			}
+			var outside []string
+			for _, pod := range pods {
+				if pod.Spec.NodeName == "" {
+					outside = append(outside, pod.Name+" is unscheduled")
+				} else if zone := zoneMap.ZoneOf(pod); !allowed[zone] {
+					outside = append(outside, fmt.Sprintf("%s runs on %s in zone %q", pod.Name, pod.Spec.NodeName, zone))
+				}
+			}
+			if len(outside) == 0 {
+				return true, fmt.Sprintf("all %d are", len(pods)), nil
+			}
+			return false, strings.Join(outside, ", "), nil
+		},
+	}
+}
+
+// NotShareZoneWith succeeds when no pod runs in a zone that also runs a scheduled, non-terminating pod
+// matching the label selector in the namespace, which is what a zone-wide pod anti-affinity to those
+// pods requires. The other pods are listed when the matcher runs.
+func NotShareZoneWith(zoneMap *example.ZoneMap, namespace, selector string) types.GomegaMatcher {
+	return &clusterMatcher{
+		expectation: fmt.Sprintf("no pod to share a zone with pods %q", selector),
+		match: func(actual interface{}) (bool, string, error) {
+			pods, err := toPods(actual)
+			if err != nil {
+				return false, "", err
+			}
+			others, err := zoneMap.PodZones(context.TODO(), namespace, selector)
+			if err != nil {
+				return false, "", err
+			}
+			othersByZone := map[string][]string{}
+			for name, zone := range others {
+				othersByZone[zone] = append(othersByZone[zone], name)
+			}
+			var shared []string
+			for _, pod := range pods {
+				if pod.Spec.NodeName == "" {
+					continue
+				}
+				zone := zoneMap.ZoneOf(pod)
+				if names, found := othersByZone[zone]; found {
+					sort.Strings(names)
+					shared = append(shared, fmt.Sprintf("%s runs on %s in zone %q with %v", pod.Name, pod.Spec.NodeName, zone, names))
+				}
+			}
+			if len(shared) == 0 {
+				return true, fmt.Sprintf("none of %d does", len(pods)), nil
+			}
+			return false, strings.Join(shared, ", "), nil
+		},
+	}
+}
+
+// HaveMaxSkew succeeds when the counts of a per-zone distribution, as returned by
+// ZoneMap.Distribution, differ by at most maxSkew
+func HaveMaxSkew(maxSkew int) types.GomegaMatcher {
+	return &clusterMatcher{
+		expectation: fmt.Sprintf("a zone skew of at most %d", maxSkew),
+		match: func(actual interface{}) (bool, string, error) {
+			perZone, ok := actual.(map[string]int)
+			if !ok {
+				return false, "", fmt.Errorf("expected a map[string]int of pods per zone, got:\n%s", format.Object(actual, 1))
+			}
+			skew := example.ZoneSkew(perZone)
+			return skew <= maxSkew, fmt.Sprintf("the skew is %d: %v", skew, perZone), nil
+		},
+	}
+}
@@ -0,0 +1,164 @@
+package example
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/joho/godotenv"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	runID     string
+	runIDOnce sync.Once
+	// runIDSet is whether runID is E2E_RUN_ID's rather than random
+	runIDSet bool
+
+	fixtureNames   = map[string]string{}
+	fixtureNamesMu sync.Mutex
+
+	usedNames   = map[string]int{}
+	usedNamesMu sync.Mutex
+)
+
+// maxRunIDLength caps the run ID, so a long E2E_RUN_ID leaves the names room for their prefix
+const maxRunIDLength = 16
+
+// RunID identifies this test run in generated names: E2E_RUN_ID from .env, e.g. a CI job number, or
+// 5 random lowercase alphanumerics. An E2E_RUN_ID longer than 16 characters is shortened, see runIDOf.
+func RunID() string {
+	runIDOnce.Do(func() {
+		// Suites may name things before GetRestConfig loads .env, its errors are reported there
+		godotenv.Load(".env")
+		runID = runIDOf(os.Getenv("E2E_RUN_ID"))
+		runIDSet = runID != ""
+		if !runIDSet {
+			runID = utilrand.String(5)
+		}
+	})
+	return runID
+}
+
+// runIDOf sanitizes a run ID like sanitizeName. One longer than maxRunIDLength keeps its first
+// characters, to stay recognizable, followed by a hash of the whole ID, to tell apart IDs that only
+// differ at the end.
+func runIDOf(value string) string {
+	id := sanitizeName(value)
+	if len(id) <= maxRunIDLength {
+		return id
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return fmt.Sprintf("%s-%08x", strings.TrimRight(id[:maxRunIDLength-9], "-"), hash.Sum32())
+}
+
+// UniqueName returns a DNS-1123 label made of the prefix and the run ID, so concurrent runs and the
+// leftovers of a crashed one never collide. Within a run, further calls with the same prefix get a
+// counter appended. The prefix is lowercased, stripped of invalid characters and shortened as needed
+// to stay within 63 characters.
+func UniqueName(prefix string) string {
+	return uniqueName(prefix, RunID())
+}
+
+func uniqueName(prefix, id string) string {
+	usedNamesMu.Lock()
+	defer usedNamesMu.Unlock()
+
+	suffix := "-" + id
+	usedNames[prefix]++
+	if count := usedNames[prefix]; count > 1 {
+		suffix += fmt.Sprintf("-%d", count)
+	}
+	base := sanitizeName(prefix)
+	if len(base)+len(suffix) > validation.DNS1123LabelMaxLength {
+		base = strings.TrimRight(base[:max(0, validation.DNS1123LabelMaxLength-len(suffix))], "-")
+	}
+	if base == "" {
+		return strings.TrimPrefix(suffix, "-")
+	}
+	return base + suffix
+}
+
+// FixtureName returns the name the fixtures' object with the given name gets in this run when
+// readFixture renames it, see renamedKinds: UniqueName of the name, the same on every call
+func FixtureName(name string) string {
+	fixtureNamesMu.Lock()
+	defer fixtureNamesMu.Unlock()
+	if unique, found := fixtureNames[name]; found {
+		return unique
+	}
+	fixtureNames[name] = UniqueName(name)
+	return fixtureNames[name]
+}
+
+// renamedKinds are the kinds of the fixtures' cluster-scoped objects, which readFixture renames with
+// FixtureName as no namespace keeps them apart from those of a concurrent run. The names of namespaced
+// objects stay as they are, TestNamespace is what keeps runs apart. CustomResourceDefinitions keep
+// theirs too, it has to be their plural and group.
+var renamedKinds = map[string]bool{
+	"CertificateSigningRequest": true,
+	"PriorityClass":             true,
+}
+
+var (
+	kindLine         = regexp.MustCompile(`(?m)^kind:\s*(\S+)\s*$`)
+	metadataNameLine = regexp.MustCompile(`(?m)^  name:\s*(\S+)\s*$`)
+	// priorityClassNameLine is how the fixtures' pods refer to a renamed PriorityClass
+	priorityClassNameLine = regexp.MustCompile(`(?m)^\s*priorityClassName:\s*(\S+)\s*$`)
+)
+
+// fixtureNamed renames the objects of renamedKinds in a manifest with FixtureName, and the
+// priorityClassName fields that refer to them. The cluster's own system- PriorityClasses are left alone.
+func fixtureNamed(manifest string) string {
+	docs := strings.Split(manifest, "\n---\n")
+	for i, doc := range docs {
+		if kind := kindLine.FindStringSubmatch(doc); kind != nil && renamedKinds[kind[1]] {
+			doc = replaceFirstGroup(doc, metadataNameLine.FindStringSubmatchIndex(doc))
+		}
+		for _, match := range reversed(priorityClassNameLine.FindAllStringSubmatchIndex(doc, -1)) {
+			if !strings.HasPrefix(doc[match[2]:match[3]], "system-") {
+				doc = replaceFirstGroup(doc, match)
+			}
+		}
+		docs[i] = doc
+	}
+	return strings.Join(docs, "\n---\n")
+}
+
+// replaceFirstGroup replaces the first group of a match with its FixtureName, a nil match changes nothing
+func replaceFirstGroup(text string, match []int) string {
+	if match == nil {
+		return text
+	}
+	return text[:match[2]] + FixtureName(text[match[2]:match[3]]) + text[match[3]:]
+}
+
+// reversed returns the matches last first, so replacing one doesn't move those still to be replaced
+func reversed(matches [][]int) [][]int {
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
+
+// sanitizeName lowercases the name and replaces every run of characters a DNS-1123 label can't hold
+// with a single dash, trimming dashes at the ends
+func sanitizeName(name string) string {
+	var builder strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+			dash = false
+		} else if !dash {
+			builder.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.Trim(builder.String(), "-")
+}
@@ -0,0 +1,132 @@
+package example
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+func TestRunIDOf(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "unset", value: "", want: ""},
+		{name: "short", value: "1234", want: "1234"},
+		{name: "invalid characters", value: "CI Job #42", want: "ci-job-42"},
+		{name: "at the limit", value: "ci-job-123456789", want: "ci-job-123456789"},
+		{name: "long", value: "ci-jo-" + strings.Repeat("9", 20), want: "ci-jo-9-8c6ae892"},
+		{name: "long with a dash at the cut", value: "github-actions-run-8812345678-attempt-2", want: "github-25c53f84"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := runIDOf(test.value); got != test.want {
+				t.Errorf("runIDOf(%q) = %q, want %q", test.value, got, test.want)
+			}
+		})
+	}
+
+	if first, second := runIDOf("github-actions-run-1-attempt-1"), runIDOf("github-actions-run-1-attempt-2"); first == second {
+		t.Errorf("long run IDs that only differ at the end both got %q", first)
+	}
+}
+
+func TestUniqueName(t *testing.T) {
+	longRunID := runIDOf("github-actions-run-8812345678-attempt-2")
+	tests := []struct {
+		name   string
+		prefix string
+		runID  string
+		// calls is how often the prefix is passed, want the names returned
+		calls int
+		want  []string
+	}{
+		{name: "short prefix", prefix: "app", runID: "abc12", calls: 1, want: []string{"app-abc12"}},
+		{name: "invalid characters", prefix: "Zone_Spread.Example", runID: "abc12", calls: 1, want: []string{"zone-spread-example-abc12"}},
+		{name: "empty prefix", prefix: "", runID: "abc12", calls: 1, want: []string{"abc12"}},
+		{
+			name: "repeated prefix", prefix: "zone-spread-example", runID: "abc12", calls: 3,
+			want: []string{"zone-spread-example-abc12", "zone-spread-example-abc12-2", "zone-spread-example-abc12-3"},
+		},
+		{
+			name: "long prefix", prefix: strings.Repeat("a", 80), runID: "abc12", calls: 2,
+			want: []string{strings.Repeat("a", 57) + "-abc12", strings.Repeat("a", 55) + "-abc12-2"},
+		},
+		{
+			name: "long prefix with a dash at the cut", prefix: strings.Repeat("a", 56) + "-" + strings.Repeat("b", 10), runID: "abc12", calls: 1,
+			want: []string{strings.Repeat("a", 56) + "-abc12"},
+		},
+		{
+			name: "long run ID", prefix: "rollout-s25pct-u25pct", runID: longRunID, calls: 2,
+			want: []string{"rollout-s25pct-u25pct-github-25c53f84", "rollout-s25pct-u25pct-github-25c53f84-2"},
+		},
+		{
+			name: "long prefix and long run ID", prefix: strings.Repeat("a", 80), runID: longRunID, calls: 1,
+			want: []string{strings.Repeat("a", 47) + "-github-25c53f84"},
+		},
+		{
+			name: "run ID longer than a label", prefix: "app", runID: strings.Repeat("x", 70), calls: 1,
+			want: []string{strings.Repeat("x", 70)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			usedNamesMu.Lock()
+			usedNames = map[string]int{}
+			usedNamesMu.Unlock()
+
+			for i := 0; i < test.calls; i++ {
+				got := uniqueName(test.prefix, test.runID)
+				if got != test.want[i] {
+					t.Errorf("call %d: uniqueName(%q, %q) = %q, want %q", i+1, test.prefix, test.runID, got, test.want[i])
+				}
+				if errs := validation.IsDNS1123Label(got); len(errs) > 0 && len(test.runID) <= maxRunIDLength {
+					t.Errorf("call %d: uniqueName(%q, %q) = %q is no DNS-1123 label: %v", i+1, test.prefix, test.runID, got, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestFixtureNamed(t *testing.T) {
+	low, high := FixtureName("e2e-low-priority"), FixtureName("e2e-high-priority")
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{
+			name:     "cluster-scoped objects",
+			manifest: "apiVersion: scheduling.k8s.io/v1\nkind: PriorityClass\nmetadata:\n  name: e2e-low-priority\nvalue: -10\n---\napiVersion: scheduling.k8s.io/v1\nkind: PriorityClass\nmetadata:\n  name: e2e-high-priority\nvalue: 1000\n",
+			want:     "apiVersion: scheduling.k8s.io/v1\nkind: PriorityClass\nmetadata:\n  name: " + low + "\nvalue: -10\n---\napiVersion: scheduling.k8s.io/v1\nkind: PriorityClass\nmetadata:\n  name: " + high + "\nvalue: 1000\n",
+		},
+		{
+			name:     "references to them",
+			manifest: "kind: Deployment\nmetadata:\n  name: low-priority-app\nspec:\n  template:\n    spec:\n      priorityClassName: e2e-low-priority\n",
+			want:     "kind: Deployment\nmetadata:\n  name: low-priority-app\nspec:\n  template:\n    spec:\n      priorityClassName: " + low + "\n",
+		},
+		{
+			name:     "system PriorityClasses",
+			manifest: "kind: Pod\nmetadata:\n  name: critical\nspec:\n  priorityClassName: system-node-critical\n",
+			want:     "kind: Pod\nmetadata:\n  name: critical\nspec:\n  priorityClassName: system-node-critical\n",
+		},
+		{
+			name:     "namespaced objects",
+			manifest: "kind: Service\nmetadata:\n  name: canary-svc\n  namespace: test-ns\n",
+			want:     "kind: Service\nmetadata:\n  name: canary-svc\n  namespace: test-ns\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := fixtureNamed(test.manifest); got != test.want {
+				t.Errorf("fixtureNamed() = %q, want %q", got, test.want)
+			}
+		})
+	}
+
+	if FixtureName("e2e-low-priority") != low {
+		t.Errorf("FixtureName changed from %q to %q between calls", low, FixtureName("e2e-low-priority"))
+	}
+}
@@ -0,0 +1,258 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NamespaceManager creates the namespace a suite runs in and deletes it again, forcing the deletion
+// when it hangs
+type NamespaceManager struct {
+	logger    zerolog.Logger
+	clientset *kubernetes.Clientset
+	name      string
+	labels    map[string]string
+}
+
+// NewNamespaceManager manages the namespace with the given name. The labels, which may be nil, are set
+// when Ensure creates the namespace and added when it already exists.
+func NewNamespaceManager(logger zerolog.Logger, clientset *kubernetes.Clientset, name string, labels map[string]string) *NamespaceManager {
+	return &NamespaceManager{
+		logger:    logger,
+		clientset: clientset,
+		name:      name,
+		labels:    labels,
+	}
+}
+
+// NewRunNamespaceManager manages a namespace named by UniqueName, so a run never meets leftovers of an
+// earlier one that is still terminating. Fixtures that hardcode their namespace can't be applied in it.
+func NewRunNamespaceManager(logger zerolog.Logger, clientset *kubernetes.Clientset, prefix string, labels map[string]string) *NamespaceManager {
+	return NewNamespaceManager(logger, clientset, UniqueName(prefix), labels)
+}
+
+// Name returns the managed namespace's name
+func (m *NamespaceManager) Name() string {
+	return m.name
+}
+
+// Ensure creates the namespace, or adds the labels to the existing one, and waits until it is Active.
+// A namespace still terminating from an earlier run is waited out and created again.
+func (m *NamespaceManager) Ensure(ctx context.Context, timeout time.Duration) error {
+	timeout = Timeout(TimeoutNamespace, timeout)
+	m.logger.Info().Msgf("=== Ensuring %s exists ===", m.name)
+	namespaces := m.clientset.CoreV1().Namespaces()
+	var phase corev1.NamespacePhase
+	err := PollUntil(ctx, 2*time.Second, timeout, func(ctx context.Context) (bool, error) {
+		ns, err := namespaces.Get(ctx, m.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			m.logger.Info().Msgf("Creating %s namespace", m.name)
+			_, err = namespaces.Create(ctx, &corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{Name: m.name, Labels: m.labels},
+			}, metav1.CreateOptions{})
+			if err != nil && !apierrors.IsAlreadyExists(err) {
+				return false, fmt.Errorf("namespace %s creation failed: %w", m.name, err)
+			}
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("namespace %s lookup failed: %w", m.name, err)
+		}
+		phase = ns.Status.Phase
+		if phase != corev1.NamespaceActive {
+			m.logger.Info().Msgf("Waiting for %s namespace, currently %s", m.name, phase)
+			return false, nil
+		}
+
+		missing := false
+		for key, value := range m.labels {
+			if ns.Labels[key] != value {
+				missing = true
+			}
+		}
+		if !missing {
+			return true, nil
+		}
+		if ns.Labels == nil {
+			ns.Labels = map[string]string{}
+		}
+		for key, value := range m.labels {
+			ns.Labels[key] = value
+		}
+		// A conflict is retried with the next Get
+		_, err = namespaces.Update(ctx, ns, metav1.UpdateOptions{})
+		if err != nil && !apierrors.IsConflict(err) {
+			return false, fmt.Errorf("namespace %s labeling failed: %w", m.name, err)
+		}
+		return err == nil, nil
+	})
+	if err != nil {
+		return fmt.Errorf("namespace %s not active (phase %q): %w", m.name, phase, err)
+	}
+	return nil
+}
+
+// Cleanup deletes the namespace and waits up to Timeout(TimeoutNamespace, 3*time.Minute) for it to go.
+// When it doesn't, the reasons are logged and the deletion is forced with a zero grace period, waiting
+// as long again. Failures are only logged, so cleanup never fails the suite. It stops waiting when ctx
+// ends.
+func (m *NamespaceManager) Cleanup(ctx context.Context) {
+	m.logger.Info().Msgf("=== Final namespace cleanup ===")
+	err := Retry(ctx, DefaultRetryPolicy, func(ctx context.Context) error {
+		return m.clientset.CoreV1().Namespaces().Delete(ctx, m.name, metav1.DeleteOptions{})
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		m.logger.Error().Msgf("Initial cleanup failed: %v", err)
+	}
+
+	// Wait for initial deletion (3 minutes by default)
+	deleteTimeout := Timeout(TimeoutNamespace, 3*time.Minute)
+	initialDeleteTimeout := time.Now().Add(deleteTimeout)
+	for {
+		_, err := m.clientset.CoreV1().Namespaces().Get(ctx, m.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			m.logger.Info().Msgf("Namespace '%s' successfully deleted", m.name)
+			return
+		}
+		if time.Now().After(initialDeleteTimeout) {
+			m.logger.Info().Msgf("Initial deletion timed out after %v. Attempting force deletion...", deleteTimeout)
+			if blockers, err := NamespaceDeletionBlockers(ctx, m.clientset, m.name); err == nil {
+				for _, blocker := range blockers {
+					m.logger.Info().Msgf("Deletion blocked by %s", blocker)
+				}
+			}
+			break
+		}
+		m.logger.Info().Msgf("Waiting for initial deletion to complete...")
+		if err := SleepContext(ctx, 5*time.Second); err != nil {
+			m.logger.Error().Msgf("Gave up waiting for namespace '%s' deletion: %v", m.name, context.Cause(ctx))
+			return
+		}
+	}
+
+	// Force deletion
+	deletePolicy := metav1.DeletePropagationBackground
+	deleteOptions := metav1.DeleteOptions{
+		GracePeriodSeconds: new(int64),
+		PropagationPolicy:  &deletePolicy,
+	}
+	*deleteOptions.GracePeriodSeconds = 0 // This the forcing part
+
+	err = Retry(ctx, DefaultRetryPolicy, func(ctx context.Context) error {
+		return m.clientset.CoreV1().Namespaces().Delete(ctx, m.name, deleteOptions)
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		m.logger.Error().Msgf("Force deletion failed: %v", err)
+	}
+
+	// Wait for force deletion
+	forceDeleteTimeout := time.Now().Add(deleteTimeout)
+	for {
+		_, err := m.clientset.CoreV1().Namespaces().Get(ctx, m.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			m.logger.Info().Msgf("Namespace '%s' successfully force deleted", m.name)
+			return
+		}
+		if time.Now().After(forceDeleteTimeout) {
+			m.logger.Error().Msgf("Force deletion timed out after %v", deleteTimeout)
+			return
+		}
+		m.logger.Info().Msgf("Waiting for force deletion to complete...")
+		if err := SleepContext(ctx, 5*time.Second); err != nil {
+			m.logger.Error().Msgf("Gave up waiting for namespace '%s' force deletion: %v", m.name, context.Cause(ctx))
+			return
+		}
+	}
+}
+
+// keptInNamespace are the objects Kubernetes creates in every namespace, which Empty leaves in place, by
+// resource. Pods can't be created without the default ServiceAccount until its controller recreates it.
+var keptInNamespace = map[string]string{
+	"serviceaccounts": "default",
+	"configmaps":      "kube-root-ca.crt",
+}
+
+// Empty deletes the objects of every namespaced resource the runner may delete and waits up to the
+// timeout until they are gone, keeping the namespace, its labels, the default ServiceAccount and the
+// kube-root-ca.crt ConfigMap. It takes seconds where deleting and recreating the namespace takes
+// minutes. Resources the runner's RBAC doesn't allow deleting are skipped. On timeout the error names
+// the resources that still have objects, e.g. because of a finalizer nothing removes.
+func (m *NamespaceManager) Empty(ctx context.Context, timeout time.Duration) error {
+	timeout = Timeout(TimeoutNamespace, timeout)
+	m.logger.Info().Msgf("=== Emptying %s ===", m.name)
+	dynamicClient, err := DynamicClient()
+	if err != nil {
+		return err
+	}
+	// The resources of an aggregated API that is down are missing, the others are still returned
+	lists, err := m.clientset.Discovery().ServerPreferredNamespacedResources()
+	if err != nil && !discovery.IsGroupDiscoveryFailedError(err) {
+		return fmt.Errorf("namespaced resource discovery failed: %w", err)
+	}
+
+	background := metav1.DeletePropagationBackground
+	var deleted []schema.GroupVersionResource
+	for _, list := range lists {
+		groupVersion, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		for _, resource := range list.APIResources {
+			if !sets.NewString(resource.Verbs...).HasAll("deletecollection", "list") {
+				continue
+			}
+			gvr := groupVersion.WithResource(resource.Name)
+			err := dynamicClient.Resource(gvr).Namespace(m.name).DeleteCollection(ctx,
+				metav1.DeleteOptions{PropagationPolicy: &background}, m.listOptions(resource.Name))
+			switch {
+			case err == nil && resource.Name != "events":
+				// Terminating pods still report events, they are deleted but not waited for
+				deleted = append(deleted, gvr)
+			case err == nil:
+			case apierrors.IsForbidden(err), apierrors.IsNotFound(err), apierrors.IsMethodNotSupported(err):
+			default:
+				return fmt.Errorf("%s deletion in %s failed: %w", gvr.GroupResource(), m.name, err)
+			}
+		}
+	}
+
+	var remaining []string
+	err = PollUntil(ctx, 2*time.Second, timeout, func(ctx context.Context) (bool, error) {
+		remaining = nil
+		for _, gvr := range deleted {
+			options := m.listOptions(gvr.Resource)
+			options.Limit = 1
+			list, err := dynamicClient.Resource(gvr).Namespace(m.name).List(ctx, options)
+			if err != nil {
+				return false, fmt.Errorf("%s listing in %s failed: %w", gvr.GroupResource(), m.name, err)
+			}
+			if len(list.Items) > 0 {
+				remaining = append(remaining, gvr.GroupResource().String())
+			}
+		}
+		return len(remaining) == 0, nil
+	})
+	if err != nil {
+		return fmt.Errorf("namespace %s not empty, objects left: %v: %w", m.name, remaining, err)
+	}
+	m.logger.Info().Msgf("Namespace '%s' emptied", m.name)
+	return nil
+}
+
+// listOptions selects the objects of the resource that Empty deletes
+func (m *NamespaceManager) listOptions(resource string) metav1.ListOptions {
+	if kept, ok := keptInNamespace[resource]; ok {
+		return metav1.ListOptions{FieldSelector: "metadata.name!=" + kept}
+	}
+	return metav1.ListOptions{}
+}
@@ -0,0 +1,289 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Namespace deletion latency E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("NamespaceDeletionLatencyTest"), func() {
+	var (
+		clientset   *kubernetes.Clientset
+		config      *rest.Config
+		objectsYAML []byte
+		heldYAML    []byte
+		// The object mix as it ran before the namespace was deleted
+		snapshot *example.NamespaceSnapshot
+		// Pods of the object mix, the fixture's 4 and those of the generated Deployments
+		expectedPods = 4
+		logger       zerolog.Logger
+		testTag      = "NamespaceDeletionLatencyTest"
+		// Overridable with SPEC_TIMEOUTS in .env
+		specTimeout = example.SpecTimeout(testTag, 10*time.Minute)
+		namespace   = example.TestNamespaced("test-ns-deletion")
+	)
+
+	const (
+		// Matches the initial deletion wait of ClearNamespace. Overridable with
+		// NAMESPACE_DELETION_TIMEOUT_SECONDS in .env
+		defaultTimeoutSeconds = 180
+		pollInterval          = time.Second
+	)
+
+	createNamespace := func(ctx context.Context) {
+		_, err := clientset.CoreV1().Namespaces().Create(ctx, &v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{Name: namespace},
+		}, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	// waitForRunning waits until the pods of the object mix run, which also means the PVC is bound and
+	// in use
+	waitForRunning := func(ctx context.Context) {
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			running := 0
+			for _, pod := range pods.Items {
+				if pod.Status.Phase == v1.PodRunning {
+					running++
+				}
+			}
+			if running == expectedPods {
+				return
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Only %d/%d pods were running after %v", running, expectedPods, runningTimeout))
+			}
+			gomega.Expect(example.SleepContext(ctx, example.CheckInterval(2*time.Second))).To(gomega.Succeed())
+		}
+	}
+
+	// finalizersIn extracts the finalizer names from a NamespaceFinalizersRemaining blocker, whose message
+	// reads "Some content in the namespace has finalizers remaining: <finalizer> in <n> resource instances, ..."
+	finalizersIn := func(blockers []string) []string {
+		var finalizers []string
+		for _, blocker := range blockers {
+			if !strings.HasPrefix(blocker, string(v1.NamespaceFinalizersRemaining)) {
+				continue
+			}
+			_, list, found := strings.Cut(blocker, "remaining: ")
+			if !found {
+				continue
+			}
+			for _, entry := range strings.Split(list, ", ") {
+				finalizer, _, _ := strings.Cut(entry, " in ")
+				finalizers = append(finalizers, finalizer)
+			}
+		}
+		return finalizers
+	}
+
+	// waitForDeletion polls the terminating namespace until it is gone, calling onBlockers with every
+	// poll's blockers. It logs the blockers whenever they change and returns how long each finalizer
+	// held the namespace.
+	waitForDeletion := func(ctx context.Context, timeout time.Duration, onBlockers func([]string)) map[string]float64 {
+		blockedSeconds := map[string]float64{}
+		var previous string
+		deadline := time.Now().Add(timeout)
+		last := time.Now()
+		for {
+			blockers, err := example.NamespaceDeletionBlockers(ctx, clientset, namespace)
+			if apierrors.IsNotFound(err) {
+				return blockedSeconds
+			}
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			now := time.Now()
+			for _, finalizer := range finalizersIn(blockers) {
+				blockedSeconds[finalizer] += now.Sub(last).Seconds()
+			}
+			last = now
+			if current := strings.Join(blockers, "\n"); current != previous {
+				for _, blocker := range blockers {
+					logger.Info().Msgf("Blocked by %s\n", blocker)
+				}
+				previous = current
+			}
+			if onBlockers != nil {
+				onBlockers(blockers)
+			}
+
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Namespace %s was not deleted within %v, blocked by:\n%s",
+					namespace, timeout, strings.Join(blockers, "\n")))
+			}
+			gomega.Expect(example.SleepContext(ctx, example.CheckInterval(pollInterval))).To(gomega.Succeed())
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		objectsYAML, heldYAML, err = example.GetNamespaceDeletionTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+			// What ran in the namespace, for reproducing the failure with kubectl apply
+			if snapshot != nil {
+				manifest, err := snapshot.Manifest()
+				if err == nil {
+					logger.Error().Msgf("Snapshot of %s taken at %s:\n%s", namespace, snapshot.TakenAt.Format(time.RFC3339), manifest)
+				}
+			}
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		// A failed spec can leave the held ConfigMap behind, which would block the cleanup for good
+		patch := []byte(`{"metadata":{"finalizers":null}}`)
+		_, err := clientset.CoreV1().ConfigMaps(namespace).Patch(context.TODO(), "deletion-held", types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Error().Msgf("Failed to release ConfigMap deletion-held: %v", err)
+		}
+		example.ClearNamespaceByName(logger, clientset, namespace)
+	})
+
+	ginkgo.It("should create a namespace with a representative object mix", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		logger.Info().Msgf("=== Starting Namespace deletion latency E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+
+		logger.Info().Msgf("=== Creating namespace %s with a Deployment, Service, ConfigMap, Secret and a pod with a PVC ===", namespace)
+		createNamespace(ctx)
+		err := example.ApplyRawManifestConcurrently(clientset, objectsYAML, example.ApplyConcurrency())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Realistic object counts, reproducible with WORKLOAD_SEED
+		seed, err := example.WorkloadSeed()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		workload := example.GenerateWorkload(namespace, seed, example.WorkloadMix{
+			Deployments: 10, Services: 10, ConfigMaps: 50, MaxReplicas: 1,
+		})
+		logger.Info().Msgf("=== Generating %d objects with %d pods from seed %d ===", workload.Objects(), workload.Replicas(), seed)
+		err = workload.CreateConcurrently(ctx, clientset, example.ApplyConcurrency())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		expectedPods = 4 + workload.Replicas()
+
+		// Deletion is only representative once the pods run and the PVC is bound and in use
+		waitForRunning(ctx)
+
+		snapshot, err = example.SnapshotNamespace(ctx, config, namespace)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Snapshot of %d objects taken ===", len(snapshot.Objects))
+	})
+
+	ginkgo.It("should delete the namespace within the timeout and report what blocked it", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+
+		timeout := example.Timeout(example.TimeoutNamespace, defaultTimeoutSeconds*time.Second)
+		if value := os.Getenv("NAMESPACE_DELETION_TIMEOUT_SECONDS"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid NAMESPACE_DELETION_TIMEOUT_SECONDS: %s", value)
+			timeout = time.Duration(seconds) * time.Second
+		}
+
+		logger.Info().Msgf("=== Deleting namespace %s ===", namespace)
+		start := time.Now()
+		err := clientset.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		blockedSeconds := waitForDeletion(ctx, timeout, nil)
+		deletion := time.Since(start)
+
+		logger.Info().Msgf("=== Namespace deleted after %v, finalizers blocking it (seconds): %v ===",
+			deletion.Round(time.Millisecond), blockedSeconds)
+		example.RecordMetric(testTag, "namespace_deletion_seconds", deletion.Seconds())
+		example.RecordMetric(testTag, "finalizer_blocked_seconds", blockedSeconds)
+	})
+
+	ginkgo.It("should restore the snapshot into the recreated namespace", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+		gomega.Expect(snapshot).NotTo(gomega.BeNil(), "No snapshot was taken before the deletion")
+
+		logger.Info().Msgf("=== Recreating namespace %s from the snapshot ===", namespace)
+		start := time.Now()
+		createNamespace(ctx)
+		err := example.RestoreNamespace(ctx, config, snapshot)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		waitForRunning(ctx)
+		restore := time.Since(start)
+		logger.Info().Msgf("=== Object mix running again after %v ===", restore.Round(time.Millisecond))
+		example.RecordMetric(testTag, "namespace_restore_seconds", restore.Seconds())
+
+		// The next spec needs the namespace gone again
+		err = clientset.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		waitForDeletion(ctx, example.Timeout(example.TimeoutNamespace, 3*time.Minute), nil)
+	})
+
+	ginkgo.It("should report a finalizer that holds the namespace in Terminating", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+
+		createNamespace(ctx)
+		err := example.ApplyRawManifest(clientset, heldYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Deleting namespace %s with a ConfigMap held by e2e.example.com/hold ===", namespace)
+		start := time.Now()
+		err = clientset.CoreV1().Namespaces().Delete(ctx, namespace, metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The finalizer is released as soon as the namespace names it, which proves a stuck deletion
+		// can be traced back to the responsible finalizer
+		var reported time.Duration
+		waitForDeletion(ctx, example.Timeout(example.TimeoutNamespace, time.Minute), func(blockers []string) {
+			if reported != 0 {
+				return
+			}
+			for _, finalizer := range finalizersIn(blockers) {
+				if finalizer != "e2e.example.com/hold" {
+					continue
+				}
+				reported = time.Since(start)
+				logger.Info().Msgf("=== Finalizer reported after %v, releasing it ===", reported.Round(time.Millisecond))
+				patch := []byte(`{"metadata":{"finalizers":null}}`)
+				_, err := clientset.CoreV1().ConfigMaps(namespace).Patch(ctx, "deletion-held", types.MergePatchType, patch, metav1.PatchOptions{})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+		})
+
+		gomega.Expect(reported).NotTo(gomega.BeZero(), "The namespace was deleted without reporting the held finalizer")
+		example.RecordMetric(testTag, "finalizer_report_seconds", reported.Seconds())
+	})
+
+})
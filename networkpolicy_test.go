@@ -0,0 +1,215 @@
+package example_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	utilexec "k8s.io/client-go/util/exec"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("NetworkPolicy isolation E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("NetworkPolicyIsolationTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		config    *rest.Config
+		logger    zerolog.Logger
+		testTag   = "NetworkPolicyIsolationTest"
+
+		clientNamespace = example.TestNamespaced("test-ns-client")
+		serverAddress   = example.TestNamespaced("netpol-server.test-ns.svc.cluster.local")
+	)
+
+	const (
+		// NetworkPolicies are programmed asynchronously by the CNI
+		policyPropagationTimeout = 60 * time.Second
+		pollInterval             = 3 * time.Second
+	)
+
+	type netpolClient struct {
+		namespace string
+		name      string
+	}
+	var (
+		allowedClient = netpolClient{namespace: clientNamespace, name: "allowed-client"}
+		deniedClient  = netpolClient{namespace: clientNamespace, name: "denied-client"}
+		sameNsClient  = netpolClient{namespace: example.TestNamespace(), name: "same-ns-client"}
+		allClients    = []netpolClient{allowedClient, deniedClient, sameNsClient}
+	)
+
+	// canConnect opens a TCP connection to the server Service from inside the client pod.
+	// A non-zero exit of nc means the connection was refused or timed out.
+	canConnect := func(client netpolClient) (bool, error) {
+		_, _, err := example.ExecInPod(context.TODO(), config, clientset, client.namespace, client.name, "client",
+			[]string{"nc", "-z", "-w", "2", serverAddress, "80"})
+		if err == nil {
+			return true, nil
+		}
+		var exitErr utilexec.ExitError
+		if errors.As(err, &exitErr) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	// expectConnectivity waits until every client's reachability matches the expectation
+	expectConnectivity := func(expected map[netpolClient]bool) {
+		propagationTimeout := example.Timeout(example.TimeoutNetwork, policyPropagationTimeout)
+		deadline := time.Now().Add(propagationTimeout)
+		for {
+			mismatches := []string{}
+			for client, want := range expected {
+				got, err := canConnect(client)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				logger.Info().Msgf("Client %s/%-15s reachable: %-5t expected: %t\n", client.namespace, client.name, got, want)
+				if got != want {
+					mismatches = append(mismatches, fmt.Sprintf("%s/%s (reachable: %t, expected: %t)",
+						client.namespace, client.name, got, want))
+				}
+			}
+
+			if len(mismatches) == 0 {
+				return
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Connectivity did not match NetworkPolicies within %v: %v",
+					propagationTimeout, mismatches))
+			}
+
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespaceByName(logger, clientset, clientNamespace)
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should deploy server and client pods across namespaces", func() {
+		logger.Info().Msgf("=== Starting NetworkPolicy isolation E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		workloadsYAML, clientsYAML, _, _, err := example.GetNetworkPolicyTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying client namespace and server manifests ===")
+		err = example.ApplyDynamicManifestConcurrently(workloadsYAML, example.ApplyConcurrency())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying client pod manifests ===")
+		err = example.ApplyDynamicManifestConcurrently(clientsYAML, example.ApplyConcurrency())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Waiting for server and client pods to run ===")
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			serverPods, err := example.ListPods(
+				context.TODO(),
+				clientset,
+				example.TestNamespace(),
+				metav1.ListOptions{
+					LabelSelector: "app=netpol-server",
+					FieldSelector: "status.phase=Running",
+				},
+			)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			runningClients := 0
+			for _, client := range allClients {
+				pod, err := clientset.CoreV1().Pods(client.namespace).Get(context.TODO(), client.name, metav1.GetOptions{})
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				if pod.Status.Phase == v1.PodRunning {
+					runningClients++
+				}
+			}
+
+			logger.Info().Msgf("Running server pods: %d, running clients: %d/%d\n",
+				len(serverPods), runningClients, len(allClients))
+			if len(serverPods) > 0 && runningClients == len(allClients) {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Server and client pods did not reach Running within %v", runningTimeout))
+			}
+
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	})
+
+	ginkgo.It("should allow all clients without NetworkPolicies", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Verifying baseline connectivity ===")
+		expectConnectivity(map[netpolClient]bool{
+			allowedClient: true,
+			deniedClient:  true,
+			sameNsClient:  true,
+		})
+	})
+
+	ginkgo.It("should deny all ingress with a default deny policy", func() {
+		defer example.E2ePanicHandler()
+
+		_, _, denyAllYAML, _, err := example.GetNetworkPolicyTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying deny-all NetworkPolicy ===")
+		err = example.ApplyDynamicManifest(denyAllYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		expectConnectivity(map[netpolClient]bool{
+			allowedClient: false,
+			deniedClient:  false,
+			sameNsClient:  false,
+		})
+	})
+
+	ginkgo.It("should only allow the selected client with a selective allow policy", func() {
+		defer example.E2ePanicHandler()
+
+		_, _, _, allowYAML, err := example.GetNetworkPolicyTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying selective allow NetworkPolicy ===")
+		err = example.ApplyDynamicManifest(allowYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		expectConnectivity(map[netpolClient]bool{
+			allowedClient: true,
+			deniedClient:  false,
+			sameNsClient:  false,
+		})
+	})
+
+})
@@ -0,0 +1,218 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// DrainResult lists the pods a drain evicted and the ones whose eviction was refused
+type DrainResult struct {
+	Evicted []string
+	Blocked []string
+}
+
+func setNodeUnschedulable(ctx context.Context, clientset *kubernetes.Clientset, nodeName string, unschedulable bool) error {
+	patch := fmt.Sprintf(`{"spec":{"unschedulable":%t}}`, unschedulable)
+	_, err := clientset.CoreV1().Nodes().Patch(ctx, nodeName, types.StrategicMergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to set unschedulable=%t on node %s: %w", unschedulable, nodeName, err)
+	}
+	return nil
+}
+
+func CordonNode(ctx context.Context, clientset *kubernetes.Clientset, nodeName string) error {
+	return setNodeUnschedulable(ctx, clientset, nodeName, true)
+}
+
+func UncordonNode(ctx context.Context, clientset *kubernetes.Clientset, nodeName string) error {
+	return setNodeUnschedulable(ctx, clientset, nodeName, false)
+}
+
+// NodeReady reports whether the node's Ready condition is True
+func NodeReady(node corev1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == corev1.NodeReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// NodeSchedulable reports whether the scheduler places new pods on the node: it is Ready, not
+// cordoned and has no NoSchedule or NoExecute taint
+func NodeSchedulable(node corev1.Node) bool {
+	return nodeNotSchedulableReason(node) == ""
+}
+
+// nodeNotSchedulableReason returns why NodeSchedulable is false, empty when it is true
+func nodeNotSchedulableReason(node corev1.Node) string {
+	if !NodeReady(node) {
+		return "not ready"
+	}
+	if node.Spec.Unschedulable {
+		return "cordoned"
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == corev1.TaintEffectNoSchedule || taint.Effect == corev1.TaintEffectNoExecute {
+			return "tainted " + taint.ToString()
+		}
+	}
+	return ""
+}
+
+// WaitForNodesReady waits until at least minReady nodes are Ready and returns the Ready ones. A
+// minReady of 0 waits for every node, for preflight checks of tests whose results depend on the
+// cluster's full capacity. On timeout the error names the nodes that aren't Ready.
+func WaitForNodesReady(ctx context.Context, clientset *kubernetes.Clientset, minReady int, timeout time.Duration) ([]corev1.Node, error) {
+	timeout = Timeout(TimeoutNodes, timeout)
+	var ready []corev1.Node
+	var notReady []string
+	err := PollUntil(ctx, 5*time.Second, timeout, func(ctx context.Context) (bool, error) {
+		nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return false, fmt.Errorf("node listing failed: %w", err)
+		}
+		ready, notReady = nil, nil
+		for _, node := range nodes.Items {
+			if NodeReady(node) {
+				ready = append(ready, node)
+			} else {
+				notReady = append(notReady, node.Name)
+			}
+		}
+		if minReady <= 0 {
+			return len(ready) > 0 && len(notReady) == 0, nil
+		}
+		return len(ready) >= minReady, nil
+	})
+	if err != nil {
+		return ready, fmt.Errorf("%d nodes ready, waiting for %d, not ready: %s: %w", len(ready), minReady,
+			strings.Join(notReady, ", "), err)
+	}
+	return ready, nil
+}
+
+// WaitForNodeSchedulable waits until NodeSchedulable holds for the node, e.g. after UncordonNode,
+// RemoveNodeTaint or a node restart. On timeout the error says what still keeps pods off it.
+func WaitForNodeSchedulable(ctx context.Context, clientset *kubernetes.Clientset, nodeName string, timeout time.Duration) error {
+	timeout = Timeout(TimeoutNodes, timeout)
+	reason := "unknown"
+	err := PollUntil(ctx, 2*time.Second, timeout, func(ctx context.Context) (bool, error) {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return false, fmt.Errorf("node %s lookup failed: %w", nodeName, err)
+		}
+		reason = nodeNotSchedulableReason(*node)
+		return reason == "", nil
+	})
+	if err != nil {
+		return fmt.Errorf("node %s not schedulable (%s): %w", nodeName, reason, err)
+	}
+	return nil
+}
+
+// AddNodeTaint adds the taint to the node, replacing an existing taint with the same key and effect.
+// Taints are a list, so the node is read and updated with a retry on conflict instead of patched.
+func AddNodeTaint(ctx context.Context, clientset *kubernetes.Clientset, nodeName string, taint corev1.Taint) error {
+	return updateNodeTaints(ctx, clientset, nodeName, func(taints []corev1.Taint) []corev1.Taint {
+		if taint.Effect == corev1.TaintEffectNoExecute && taint.TimeAdded == nil {
+			now := metav1.Now()
+			taint.TimeAdded = &now
+		}
+		return append(withoutTaint(taints, taint.Key, taint.Effect), taint)
+	})
+}
+
+// RemoveNodeTaint removes the taint with the given key and effect. Removing a taint that isn't
+// there is not an error, so it is safe to call from cleanup code.
+func RemoveNodeTaint(ctx context.Context, clientset *kubernetes.Clientset, nodeName, key string, effect corev1.TaintEffect) error {
+	return updateNodeTaints(ctx, clientset, nodeName, func(taints []corev1.Taint) []corev1.Taint {
+		return withoutTaint(taints, key, effect)
+	})
+}
+
+func updateNodeTaints(ctx context.Context, clientset *kubernetes.Clientset, nodeName string, mutate func([]corev1.Taint) []corev1.Taint) error {
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := clientset.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		node.Spec.Taints = mutate(node.Spec.Taints)
+		_, err = clientset.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update taints on node %s: %w", nodeName, err)
+	}
+	return nil
+}
+
+func withoutTaint(taints []corev1.Taint, key string, effect corev1.TaintEffect) []corev1.Taint {
+	var result []corev1.Taint
+	for _, taint := range taints {
+		if taint.Key == key && taint.Effect == effect {
+			continue
+		}
+		result = append(result, taint)
+	}
+	return result
+}
+
+// DrainNode cordons the node and requests one eviction for every pod on it with EvictPod, the way
+// kubectl drain does, but without retrying evictions a PodDisruptionBudget refused. DaemonSet and mirror pods are skipped. When namespace
+// is not empty only pods in that namespace are evicted, so tests can drain their own workloads
+// without touching the rest of the node.
+func DrainNode(ctx context.Context, clientset *kubernetes.Clientset, nodeName, namespace string) (*DrainResult, error) {
+	if err := CordonNode(ctx, clientset, nodeName); err != nil {
+		return nil, err
+	}
+
+	pods, err := ListPodsOnNode(ctx, clientset, namespace, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &DrainResult{}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || isDaemonSetPod(pod) || isMirrorPod(pod) {
+			continue
+		}
+
+		err := EvictPod(ctx, clientset, pod.Namespace, pod.Name)
+		switch {
+		case err == nil:
+			result.Evicted = append(result.Evicted, pod.Name)
+		case IsEvictionBlocked(err):
+			result.Blocked = append(result.Blocked, pod.Name)
+		case apierrors.IsNotFound(err):
+			continue
+		default:
+			return result, fmt.Errorf("failed to evict pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+	}
+
+	return result, nil
+}
+
+func isDaemonSetPod(pod corev1.Pod) bool {
+	for _, ref := range pod.OwnerReferences {
+		if ref.Kind == "DaemonSet" {
+			return true
+		}
+	}
+	return false
+}
+
+func isMirrorPod(pod corev1.Pod) bool {
+	_, ok := pod.Annotations[corev1.MirrorPodAnnotationKey]
+	return ok
+}
@@ -0,0 +1,224 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Node affinity E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("NodeAffinityTest"), func() {
+	var (
+		clientset                  *kubernetes.Clientset
+		targetNode                 string
+		targetHostname             string
+		schedulableNodes           int
+		requiredNodeYAML           []byte
+		requiredUnsatisfiableYAML  []byte
+		preferredNodeYAML          []byte
+		preferredUnsatisfiableYAML []byte
+		logger                     zerolog.Logger
+		testTag                    = "NodeAffinityTest"
+	)
+
+	const (
+		placeholderHostname = "target-node-placeholder"
+		pollInterval        = 3 * time.Second
+		// How long unsatisfiable pods must stay Pending
+		pendingWindow = 30 * time.Second
+	)
+
+	// createTargetedDeployment creates the fixture Deployment with the placeholder hostname in its
+	// node affinity replaced by the target node's kubernetes.io/hostname label
+	createTargetedDeployment := func(depYAML []byte) {
+		deployment := &appsv1.Deployment{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(depYAML), 4096).Decode(deployment)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		nodeAffinity := deployment.Spec.Template.Spec.Affinity.NodeAffinity
+		var expressions []*v1.NodeSelectorRequirement
+		if nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution != nil {
+			for i := range nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+				term := &nodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms[i]
+				for j := range term.MatchExpressions {
+					expressions = append(expressions, &term.MatchExpressions[j])
+				}
+			}
+		}
+		for i := range nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution {
+			term := &nodeAffinity.PreferredDuringSchedulingIgnoredDuringExecution[i].Preference
+			for j := range term.MatchExpressions {
+				expressions = append(expressions, &term.MatchExpressions[j])
+			}
+		}
+		for _, expression := range expressions {
+			for k, value := range expression.Values {
+				if value == placeholderHostname {
+					expression.Values[k] = targetHostname
+				}
+			}
+		}
+
+		logger.Info().Msgf("=== Creating Deployment %s targeting node %s ===", deployment.Name, targetNode)
+		_, err = clientset.AppsV1().Deployments(example.TestNamespace()).Create(context.TODO(), deployment, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	waitForDeploymentReady := func(name string) []v1.Pod {
+		err := example.WaitForDeploymentReady(context.TODO(), clientset, example.TestNamespace(), name, 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=" + name})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return pods
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		requiredNodeYAML, requiredUnsatisfiableYAML, preferredNodeYAML, preferredUnsatisfiableYAML, err = example.GetNodeAffinityTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Target an untainted schedulable node so that node affinity is the only placement constraint
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, node := range nodes.Items {
+			if node.Spec.Unschedulable || len(node.Spec.Taints) > 0 {
+				continue
+			}
+			schedulableNodes++
+			if targetNode == "" && node.Labels["kubernetes.io/hostname"] != "" {
+				targetNode = node.Name
+				targetHostname = node.Labels["kubernetes.io/hostname"]
+			}
+		}
+		if targetNode == "" {
+			ginkgo.Skip("No untainted schedulable node with a kubernetes.io/hostname label")
+		}
+		logger.Info().Msgf("=== Target node: %s (%d untainted schedulable nodes) ===", targetNode, schedulableNodes)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should place every pod on the node matched by a required node affinity", func() {
+		logger.Info().Msgf("=== Starting Node affinity E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		createTargetedDeployment(requiredNodeYAML)
+		for _, pod := range waitForDeploymentReady("required-node") {
+			gomega.Expect(pod.Spec.NodeName).To(gomega.Equal(targetNode), "Pod %s ignored the required node affinity", pod.Name)
+		}
+		logger.Info().Msgf("=== All required-node pods run on %s ===", targetNode)
+	})
+
+	ginkgo.It("should keep pods Pending when a required node affinity can't be satisfied", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying unsatisfiable required node affinity Deployment ===")
+		err := example.ApplyRawManifest(clientset, requiredUnsatisfiableYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "required-unsatisfiable", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		replicas := int(*deployment.Spec.Replicas)
+
+		// Wait until the scheduler has tried and rejected every pod, then make sure none gets placed
+		unschedulableSince := time.Time{}
+		unschedulableTimeout := example.Timeout(example.TimeoutPods, 2*time.Minute)
+		deadline := time.Now().Add(unschedulableTimeout)
+		for {
+			pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=required-unsatisfiable"})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			unschedulable := 0
+			for _, pod := range pods {
+				gomega.Expect(pod.Spec.NodeName).To(gomega.BeEmpty(), "Pod %s was scheduled despite an unsatisfiable required node affinity", pod.Name)
+				gomega.Expect(pod.Status.Phase).To(gomega.Equal(v1.PodPending))
+				for _, cond := range pod.Status.Conditions {
+					if cond.Type == v1.PodScheduled && cond.Status == v1.ConditionFalse && cond.Reason == v1.PodReasonUnschedulable {
+						unschedulable++
+					}
+				}
+			}
+			logger.Info().Msgf("Unschedulable pods: %d/%d\n", unschedulable, replicas)
+
+			if unschedulable == replicas {
+				if unschedulableSince.IsZero() {
+					unschedulableSince = time.Now()
+				} else if time.Since(unschedulableSince) >= pendingWindow {
+					break
+				}
+			} else if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Only %d/%d pods were reported Unschedulable within %v", unschedulable, replicas, unschedulableTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== required-unsatisfiable pods stayed Pending for %v ===", pendingWindow)
+	})
+
+	ginkgo.It("should still schedule pods when a preferred node affinity can't be satisfied", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying unsatisfiable preferred node affinity Deployment ===")
+		err := example.ApplyRawManifest(clientset, preferredUnsatisfiableYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pods := waitForDeploymentReady("preferred-unsatisfiable")
+		for _, pod := range pods {
+			gomega.Expect(pod.Spec.NodeName).NotTo(gomega.BeEmpty())
+		}
+		logger.Info().Msgf("=== All %d preferred-unsatisfiable pods were scheduled ===", len(pods))
+	})
+
+	ginkgo.It("should bias placement towards the node matched by a preferred node affinity", func() {
+		defer example.E2ePanicHandler()
+
+		createTargetedDeployment(preferredNodeYAML)
+		pods := waitForDeploymentReady("preferred-node")
+
+		onTarget := 0
+		for _, pod := range pods {
+			logger.Info().Msgf("Pod %s runs on node %s\n", pod.Name, pod.Spec.NodeName)
+			if pod.Spec.NodeName == targetNode {
+				onTarget++
+			}
+		}
+		logger.Info().Msgf("=== %d/%d preferred-node pods run on %s ===", onTarget, len(pods), targetNode)
+		example.RecordMetric(testTag, "preferred_node_ratio", float64(onTarget)/float64(len(pods)))
+
+		// Other scoring plugins may still spread a few replicas, the preference only has to dominate
+		if schedulableNodes > 1 {
+			gomega.Expect(onTarget*2).To(gomega.BeNumerically(">", len(pods)),
+				"Most pods should run on the preferred node (%d/%d on %s)", onTarget, len(pods), targetNode)
+		}
+	})
+
+})
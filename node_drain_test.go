@@ -0,0 +1,192 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+	"example/matchers"
+)
+
+var _ = ginkgo.Describe("Node drain PDB E2E test", ginkgo.Ordered, ginkgo.Label("disruptive"), example.SuiteConcurrency("NodeDrainPDBTest"), func() {
+	var (
+		clientset      *kubernetes.Clientset
+		drainedNode    string
+		initialAllowed int32
+		minAvailable   int32
+		evictedPodName string
+		logger         zerolog.Logger
+		testTag        = "NodeDrainPDBTest"
+	)
+
+	const pollInterval = 3 * time.Second
+
+	// waitForPDB waits until the PDB controller has caught up with the current pods and reports
+	// the expected number of allowed disruptions
+	waitForPDB := func(disruptionsAllowed int32, timeout time.Duration) example.PDBStatus {
+		status, err := example.WaitForPDBStatus(context.TODO(), clientset, example.TestNamespace(), "drain-app-pdb", timeout,
+			func(status example.PDBStatus) bool {
+				return status.DisruptionsAllowed == disruptionsAllowed
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "PDB did not report %d allowed disruptions", disruptionsAllowed)
+		logger.Info().Msgf("PDB %s\n", status)
+		return status
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		// Never leave a node cordoned, even when a spec failed halfway through the drain
+		if drainedNode != "" {
+			logger.Info().Msgf("=== Restoring node %s ===", drainedNode)
+			if err := example.UncordonNode(context.TODO(), clientset, drainedNode); err != nil {
+				logger.Error().Msgf("Failed to uncordon node %s: %v", drainedNode, err)
+			}
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should place PDB-protected pods on a single node", func() {
+		logger.Info().Msgf("=== Starting Node drain PDB E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if len(nodes.Items) < 2 {
+			ginkgo.Skip("Draining a node needs at least 2 nodes")
+		}
+
+		pdbYAML, depYAML, err := example.GetNodeDrainTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pdb, err := example.ParsePDB(pdbYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying Deployment manifest ===")
+		err = example.ApplyRawManifest(clientset, depYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying PDB manifest ===")
+		err = example.ApplyRawManifest(clientset, pdbYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "drain-app", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		replicas := *deployment.Spec.Replicas
+		minAvailable, err = example.PDBMinAvailable(pdb, replicas)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Waiting for %d ready replicas ===", replicas)
+		readyTimeout := example.Timeout(example.TimeoutRollout, 3*time.Minute)
+		deadline := time.Now().Add(readyTimeout)
+		for {
+			deployment, err = clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "drain-app", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if deployment.Status.ReadyReplicas == replicas {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("drain-app did not become ready within %v", readyTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=drain-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		drainedNode = pods[0].Spec.NodeName
+		for _, pod := range pods {
+			gomega.Expect(pod.Spec.NodeName).To(gomega.Equal(drainedNode), "Pod %s is not co-located", pod.Name)
+		}
+		logger.Info().Msgf("=== All replicas run on node %s ===", drainedNode)
+
+		initialAllowed = waitForPDB(replicas-minAvailable, time.Minute).DisruptionsAllowed
+	})
+
+	ginkgo.It("should evict only as many pods as the PDB allows when draining", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Draining node %s (test-ns pods only) ===", drainedNode)
+		result, err := example.DrainNode(context.TODO(), clientset, drainedNode, example.TestNamespace())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Evicted: %v, blocked by PDB: %v ===", result.Evicted, result.Blocked)
+
+		gomega.Expect(int32(len(result.Evicted))).To(gomega.Equal(initialAllowed),
+			"Evictions should be allowed exactly disruptionsAllowed times")
+		gomega.Expect(result.Blocked).NotTo(gomega.BeEmpty(), "No eviction was refused by the PDB")
+		evictedPodName = result.Evicted[0]
+
+		// The replacement can't join its siblings on the cordoned node, so the budget stays exhausted
+		waitForPDB(0, time.Minute)
+
+		node, err := clientset.CoreV1().Nodes().Get(context.TODO(), drainedNode, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(node.Spec.Unschedulable).To(gomega.BeTrue(), "Drained node is not cordoned")
+
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=drain-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		pending := 0
+		for _, pod := range pods {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			gomega.Expect(pod.Name).NotTo(gomega.Equal(evictedPodName), "Evicted pod is not terminating")
+			if pod.Status.Phase == v1.PodPending {
+				pending++
+			}
+		}
+		logger.Info().Msgf("=== Pending replacement pods: %d ===", pending)
+		gomega.Expect(pending).To(gomega.Equal(len(result.Evicted)))
+		gomega.Expect(pods).To(matchers.SatisfyPDB(minAvailable))
+
+		logger.Info().Msgf("=== Retrying the blocked evictions ===")
+		retry, err := example.DrainNode(context.TODO(), clientset, drainedNode, example.TestNamespace())
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(retry.Evicted).To(gomega.BeEmpty(), "Eviction was allowed with zero disruptionsAllowed")
+	})
+
+	ginkgo.It("should recover the disruption budget after the node is uncordoned", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Uncordoning node %s ===", drainedNode)
+		err := example.UncordonNode(context.TODO(), clientset, drainedNode)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.WaitForNodeSchedulable(context.TODO(), clientset, drainedNode, time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		waitForPDB(initialAllowed, 3*time.Minute)
+
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=drain-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pods).To(matchers.BeReady())
+		for _, pod := range pods {
+			gomega.Expect(pod.Spec.NodeName).To(gomega.Equal(drainedNode))
+		}
+		logger.Info().Msgf("=== Node %s restored, PDB back to %d allowed disruptions ===", drainedNode, initialAllowed)
+	})
+
+})
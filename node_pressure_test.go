@@ -0,0 +1,316 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Node-pressure eviction E2E test", ginkgo.Ordered, ginkgo.Label("disruptive"), example.SuiteConcurrency("NodePressureEvictionTest"), func() {
+	var (
+		config         *rest.Config
+		clientset      *kubernetes.Clientset
+		writerYAML     []byte
+		bestEffortYAML []byte
+		guaranteedYAML []byte
+		pdbYAML        []byte
+		nodeName       string
+		hostname       string
+		// The BestEffort and Guaranteed pods running before the fill, replacements are not tracked
+		bestEffortPods []string
+		guaranteedPods []string
+		// Whether the writer has removed its fill from the node
+		released bool
+		logger   zerolog.Logger
+		testTag  = "NodePressureEvictionTest"
+	)
+
+	const (
+		writerName = "node-pressure-writer"
+		// Below the kubelet's default hard threshold nodefs.available<10%. Overridable with
+		// NODE_PRESSURE_AVAILABLE_PERCENT in .env for kubelets with other thresholds.
+		defaultAvailablePercent = 5
+		// Overridable with NODE_PRESSURE_TIMEOUT_SECONDS in .env, for large node disks
+		defaultFillTimeoutSeconds = 600
+		// The kubelet keeps the condition for its eviction-pressure-transition-period, 5 minutes by default
+		clearTimeout = 10 * time.Minute
+		pollInterval = 2 * time.Second
+	)
+
+	intFromEnv := func(key string, fallback int) int {
+		value := os.Getenv(key)
+		if value == "" {
+			return fallback
+		}
+		parsed, err := strconv.Atoi(value)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid %s: %s", key, value)
+		return parsed
+	}
+
+	createPinnedDeployment := func(deploymentYAML []byte) {
+		deployment := &appsv1.Deployment{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(deploymentYAML), 4096).Decode(deployment)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		deployment.Spec.Template.Spec.NodeSelector = map[string]string{v1.LabelHostname: hostname}
+		_, err = clientset.AppsV1().Deployments(example.TestNamespace()).Create(context.TODO(), deployment, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	podsByName := func(app string) map[string]v1.Pod {
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=" + app})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		byName := map[string]v1.Pod{}
+		for _, pod := range pods {
+			byName[pod.Name] = pod
+		}
+		return byName
+	}
+
+	// isEvicted reports whether the kubelet evicted the pod. Evicted pods stay around as Failed.
+	isEvicted := func(pod v1.Pod) bool {
+		return pod.Status.Phase == v1.PodFailed && pod.Status.Reason == "Evicted"
+	}
+
+	diskPressure := func() bool {
+		node, err := clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == v1.NodeDiskPressure {
+				return condition.Status == v1.ConditionTrue
+			}
+		}
+		return false
+	}
+
+	// releaseFill makes the writer stop and remove its files, and waits until it has done so
+	releaseFill := func() error {
+		_, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), writerName, "writer",
+			[]string{"touch", "/tmp/stop"})
+		if err != nil {
+			return fmt.Errorf("stopping the writer: %w (stderr: %s)", err, stderr)
+		}
+		releaseTimeout := example.Timeout(example.TimeoutPods, 2*time.Minute)
+		deadline := time.Now().Add(releaseTimeout)
+		for {
+			_, _, err = example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), writerName, "writer",
+				[]string{"test", "-e", "/tmp/released"})
+			if err == nil {
+				released = true
+				return nil
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("the writer did not remove its fill within %v: %w", releaseTimeout, err)
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		// The kubelet evicts every pod on the node that it ranks before ours, not just the test's
+		if os.Getenv("NODE_PRESSURE_EVICTION") != "true" {
+			ginkgo.Skip("Filling a node's filesystem is opt-in, set NODE_PRESSURE_EVICTION=true")
+		}
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, node := range nodes.Items {
+			if node.Spec.Unschedulable || len(node.Spec.Taints) > 0 || node.Labels[v1.LabelHostname] == "" || nodeName != "" {
+				continue
+			}
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+					nodeName = node.Name
+					hostname = node.Labels[v1.LabelHostname]
+				}
+			}
+		}
+		if nodeName == "" {
+			ginkgo.Skip("No ready, schedulable node without taints")
+		}
+		logger.Info().Msgf("=== Target node: %s ===", nodeName)
+
+		writerYAML, bestEffortYAML, guaranteedYAML, pdbYAML, err = example.GetNodePressureTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		// Deleting the writer also removes the fill, but only if it gets to handle SIGTERM
+		if !released {
+			_, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), writerName, metav1.GetOptions{})
+			if err == nil {
+				logger.Info().Msgf("=== Releasing the fill on %s ===", nodeName)
+				if err := releaseFill(); err != nil {
+					logger.Error().Msgf("Failed to release the fill, remove /var/lib/e2e-node-pressure on %s: %v", nodeName, err)
+				}
+			}
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should run BestEffort and Guaranteed pods on the target node", func() {
+		logger.Info().Msgf("=== Starting Node-pressure eviction E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Creating 3 BestEffort and 2 Guaranteed pods with a PDB on %s ===", nodeName)
+		err := example.ApplyRawManifest(clientset, pdbYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		createPinnedDeployment(bestEffortYAML)
+		createPinnedDeployment(guaranteedYAML)
+
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			bestEffortPods, guaranteedPods = nil, nil
+			for app, qos := range map[string]v1.PodQOSClass{
+				"node-pressure-besteffort": v1.PodQOSBestEffort,
+				"node-pressure-guaranteed": v1.PodQOSGuaranteed,
+			} {
+				for name, pod := range podsByName(app) {
+					if pod.Status.Phase != v1.PodRunning {
+						continue
+					}
+					gomega.Expect(pod.Status.QOSClass).To(gomega.Equal(qos), "Pod %s has the wrong QoS class", name)
+					if qos == v1.PodQOSBestEffort {
+						bestEffortPods = append(bestEffortPods, name)
+					} else {
+						guaranteedPods = append(guaranteedPods, name)
+					}
+				}
+			}
+			if len(bestEffortPods) == 3 && len(guaranteedPods) == 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("%d/3 BestEffort and %d/2 Guaranteed pods were running after %v",
+					len(bestEffortPods), len(guaranteedPods), runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	})
+
+	ginkgo.It("should report DiskPressure once the writer fills the node filesystem", func() {
+		defer example.E2ePanicHandler()
+
+		availablePercent := intFromEnv("NODE_PRESSURE_AVAILABLE_PERCENT", defaultAvailablePercent)
+		// An explicit NODE_PRESSURE_TIMEOUT_SECONDS is taken as is, the default follows the timeout profile
+		timeout := example.Timeout(example.TimeoutNodes, defaultFillTimeoutSeconds*time.Second)
+		if os.Getenv("NODE_PRESSURE_TIMEOUT_SECONDS") != "" {
+			timeout = time.Duration(intFromEnv("NODE_PRESSURE_TIMEOUT_SECONDS", defaultFillTimeoutSeconds)) * time.Second
+		}
+
+		writer := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(writerYAML), 4096).Decode(writer)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		writer.Spec.NodeSelector = map[string]string{v1.LabelHostname: hostname}
+		writer.Spec.Containers[0].Env[0].Value = strconv.Itoa(availablePercent)
+
+		logger.Info().Msgf("=== Filling %s until %d%% is available ===", nodeName, availablePercent)
+		start := time.Now()
+		_, err = clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), writer, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deadline := start.Add(timeout)
+		for !diskPressure() {
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Node %s did not report DiskPressure within %v", nodeName, timeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== DiskPressure after %v ===", time.Since(start).Round(time.Second))
+		example.RecordMetric(testTag, "disk_pressure_seconds", time.Since(start).Seconds())
+	})
+
+	ginkgo.It("should evict the BestEffort pods before any Guaranteed pod", func() {
+		defer example.E2ePanicHandler()
+
+		start := time.Now()
+		evictionTimeout := example.Timeout(example.TimeoutPods, 5*time.Minute)
+		deadline := start.Add(evictionTimeout)
+		for {
+			bestEffort := podsByName("node-pressure-besteffort")
+			guaranteed := podsByName("node-pressure-guaranteed")
+			evicted := 0
+			for _, name := range bestEffortPods {
+				if pod, found := bestEffort[name]; !found || isEvicted(pod) {
+					evicted++
+				}
+			}
+			// The kubelet ignores PDBs, so the ranking is the only thing protecting these pods
+			for _, name := range guaranteedPods {
+				pod, found := guaranteed[name]
+				gomega.Expect(found && !isEvicted(pod)).To(gomega.BeTrue(),
+					"Guaranteed pod %s was evicted with %d/%d BestEffort pods evicted", name, evicted, len(bestEffortPods))
+			}
+			if evicted == len(bestEffortPods) {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Only %d/%d BestEffort pods were evicted within %v", evicted, len(bestEffortPods), evictionTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== All BestEffort pods evicted after %v, Guaranteed pods still running ===", time.Since(start).Round(time.Second))
+		example.RecordMetric(testTag, "besteffort_eviction_seconds", time.Since(start).Seconds())
+	})
+
+	ginkgo.It("should clear DiskPressure once the fill is removed", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Removing the fill from %s ===", nodeName)
+		start := time.Now()
+		err := releaseFill()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		timeout := example.Timeout(example.TimeoutNodes, clearTimeout)
+		deadline := start.Add(timeout)
+		for diskPressure() {
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Node %s still reports DiskPressure %v after the fill was removed", nodeName, timeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== DiskPressure cleared after %v ===", time.Since(start).Round(time.Second))
+		example.RecordMetric(testTag, "disk_pressure_clear_seconds", time.Since(start).Seconds())
+
+		guaranteed := podsByName("node-pressure-guaranteed")
+		for _, name := range guaranteedPods {
+			pod, found := guaranteed[name]
+			gomega.Expect(found && pod.Status.Phase == v1.PodRunning).To(gomega.BeTrue(), "Guaranteed pod %s did not survive", name)
+		}
+	})
+
+})
@@ -0,0 +1,176 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("OOM and resource limit E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("OOMResourceLimitTest"), func() {
+	var (
+		config        *rest.Config
+		clientset     *kubernetes.Clientset
+		oomYAML       []byte
+		throttledYAML []byte
+		logger        zerolog.Logger
+		testTag       = "OOMResourceLimitTest"
+	)
+
+	const (
+		// The kubelet's exit code for a container killed by SIGKILL
+		killedExitCode = 137
+		// How long the throttled container has to keep running without a restart
+		throttleWindow = time.Minute
+		pollInterval   = 2 * time.Second
+	)
+
+	containerStatus := func(name string) v1.ContainerStatus {
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if len(pod.Status.ContainerStatuses) == 0 {
+			return v1.ContainerStatus{}
+		}
+		return pod.Status.ContainerStatuses[0]
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		oomYAML, throttledYAML, err = example.GetOOMTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should report OOMKilled for a container exceeding its memory limit", func() {
+		logger.Info().Msgf("=== Starting OOM and resource limit E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying pod exceeding its 32Mi memory limit ===")
+		start := time.Now()
+		err := example.ApplyRawManifest(clientset, oomYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		oomTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := start.Add(oomTimeout)
+		for {
+			status := containerStatus("oom")
+			if terminated := status.LastTerminationState.Terminated; terminated != nil {
+				logger.Info().Msgf("=== Container terminated after %v: %s, exit code %d ===",
+					time.Since(start).Round(time.Second), terminated.Reason, terminated.ExitCode)
+				gomega.Expect(terminated.Reason).To(gomega.Equal("OOMKilled"))
+				gomega.Expect(terminated.ExitCode).To(gomega.Equal(int32(killedExitCode)))
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Container was not terminated within %v", oomTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		example.RecordMetric(testTag, "first_oom_seconds", time.Since(start).Seconds())
+	})
+
+	ginkgo.It("should back off restarting the OOMKilled container", func() {
+		defer example.E2ePanicHandler()
+
+		// The backoff starts at 10 seconds and doubles, so the second restart already waits in CrashLoopBackOff
+		backOffTimeout := example.Timeout(example.TimeoutPods, 5*time.Minute)
+		deadline := time.Now().Add(backOffTimeout)
+		for {
+			status := containerStatus("oom")
+			waiting := status.State.Waiting
+			if waiting != nil && waiting.Reason == "CrashLoopBackOff" && status.RestartCount >= 2 {
+				logger.Info().Msgf("=== %s after %d restarts: %s ===", waiting.Reason, status.RestartCount, waiting.Message)
+				gomega.Expect(status.LastTerminationState.Terminated).NotTo(gomega.BeNil())
+				gomega.Expect(status.LastTerminationState.Terminated.Reason).To(gomega.Equal("OOMKilled"))
+				example.RecordMetric(testTag, "restarts_before_backoff", status.RestartCount)
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Container was not in CrashLoopBackOff within %v, %d restarts", backOffTimeout, status.RestartCount))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		// The runtime keeps the killed instance's output, which is what explains a crash loop
+		output, err := example.GetPodLogs(context.TODO(), clientset, example.TestNamespace(), "oom", example.PodLogOptions{Previous: true})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(output).To(gomega.ContainSubstring("allocating until OOMKilled"),
+			"The log of the OOMKilled instance is not available")
+	})
+
+	ginkgo.It("should keep a CPU-throttled container running", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying pod spinning under a 50m CPU limit ===")
+		err := example.ApplyRawManifest(clientset, throttledYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for containerStatus("cpu-throttled").State.Running == nil {
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("CPU-throttled container was not running within %v", runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		// Exceeding the CPU limit only throttles, unlike the memory limit
+		logger.Info().Msgf("=== Watching the container for %v ===", throttleWindow)
+		end := time.Now().Add(throttleWindow)
+		for time.Now().Before(end) {
+			status := containerStatus("cpu-throttled")
+			gomega.Expect(status.State.Running).NotTo(gomega.BeNil(), "CPU-throttled container stopped running")
+			gomega.Expect(status.RestartCount).To(gomega.BeZero(), "CPU-throttled container was restarted")
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		// cgroup v2 first, then v1
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "cpu-throttled", "main",
+			[]string{"sh", "-c", "cat /sys/fs/cgroup/cpu.stat 2>/dev/null || cat /sys/fs/cgroup/cpu/cpu.stat"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "stderr: %s", stderr)
+		throttled := -1
+		for _, line := range strings.Split(stdout, "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 2 && fields[0] == "nr_throttled" {
+				throttled, err = strconv.Atoi(fields[1])
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+		}
+		logger.Info().Msgf("=== Throttled periods: %d ===", throttled)
+		gomega.Expect(throttled).To(gomega.BeNumerically(">", 0), "The CPU limit was not enforced, cpu.stat:\n%s", stdout)
+		example.RecordMetric(testTag, "throttled_periods", throttled)
+	})
+
+})
@@ -0,0 +1,173 @@
+package example
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+)
+
+// TestNamespace is the namespace the suites run in: test-ns, or test-ns-p<N> for parallel process N
+// of ginkgo -p, so processes don't delete each other's objects. Process 1 keeps test-ns. With
+// E2E_RUN_ID set in .env the run ID is added, e.g. test-ns-ci-42-p2, so runs sharing a cluster don't
+// either.
+func TestNamespace() string {
+	namespace := "test-ns"
+	if id := RunID(); runIDSet {
+		namespace += "-" + id
+	}
+	if process := ginkgo.GinkgoParallelProcess(); process > 1 {
+		namespace += fmt.Sprintf("-p%d", process)
+	}
+	return namespace
+}
+
+// TestNamespaced replaces test-ns in a manifest, an address like "svc.test-ns.svc.cluster.local" or
+// the name of a suite's additional namespace like "test-ns-dns" with the process's TestNamespace
+func TestNamespaced(text string) string {
+	if namespace := TestNamespace(); namespace != "test-ns" {
+		return strings.ReplaceAll(text, "test-ns", namespace)
+	}
+	return text
+}
+
+// parallelSafeSuites may run concurrently with other suites under ginkgo -p: they only create
+// namespaced objects in their own namespaces and put no notable load on the nodes. Suites that cordon,
+// taint or label nodes, create cluster-scoped objects, measure latencies or scale on CPU run serially.
+var parallelSafeSuites = map[string]bool{
+	"CanaryRolloutTest":               true,
+	"ClusterDNSTest":                  true,
+	"ConfigPropagationTest":           true,
+	"CronJobSchedulingTest":           true,
+	"DeploymentPDBTest":               true,
+	"EphemeralDebugContainerTest":     true,
+	"EvictionAPITest":                 true,
+	"GracefulTerminationTest":         true,
+	"ImagePullSecretTest":             true,
+	"InitContainerOrderingTest":       true,
+	"JobExecutionTest":                true,
+	"LeaseCoordinationTest":           true,
+	"NetworkPolicyIsolationTest":      true,
+	"OOMResourceLimitTest":            true,
+	"PodColocationTest":               true,
+	"PodSecurityAdmissionTest":        true,
+	"ProbeBehaviorTest":               true,
+	"ProjectedTokenTest":              true,
+	"RBACVerificationTest":            true,
+	"RollingUpdateMatrixTest":         true,
+	"SecurityContextEnforcementTest":  true,
+	"ServiceDataplaneConsistencyTest": true,
+	"StatefulSetHeadlessDNSTest":      true,
+	"StatefulSetOrderedScalingTest":   true,
+	"StatefulSetPDBTest":              true,
+	"StatefulSetPVCRetentionTest":     true,
+	"TTLAfterFinishedTest":            true,
+	"VolumeExpansionTest":             true,
+}
+
+// suiteTags are the tags SuiteConcurrency labeled suites with, written while the spec tree is built
+var suiteTags = map[string]bool{}
+
+// SuiteConcurrency is the decorator of the suite with the tag that declares whether it may run
+// concurrently with other suites: the label parallel-safe, or ginkgo.Serial, which ginkgo -p runs on
+// process 1 once the parallel specs are done. Without -p it changes nothing. The defaults can be
+// changed in .env with comma-separated tags in PARALLEL_SUITES and SERIAL_SUITES. The suite is also
+// labeled with its tag, which SpecTestTag reads back and --label-filter can select.
+func SuiteConcurrency(testTag string) interface{} {
+	suiteTags[testTag] = true
+	tag := ginkgo.Label(testTag)
+	if contains(splitTags(os.Getenv("SERIAL_SUITES")), testTag) {
+		return []interface{}{ginkgo.Serial, tag}
+	}
+	if parallelSafeSuites[testTag] || contains(splitTags(os.Getenv("PARALLEL_SUITES")), testTag) {
+		return []interface{}{ginkgo.Label("parallel-safe"), tag}
+	}
+	return []interface{}{ginkgo.Serial, tag}
+}
+
+// SpecTestTag returns the tag of the suite the spec belongs to, from the label SuiteConcurrency gave
+// it, or its outermost container's text for a suite without one
+func SpecTestTag(report ginkgo.SpecReport) string {
+	for _, label := range report.Labels() {
+		if suiteTags[label] {
+			return label
+		}
+	}
+	if len(report.ContainerHierarchyTexts) > 0 {
+		return report.ContainerHierarchyTexts[0]
+	}
+	return report.LeafNodeText
+}
+
+func splitTags(tags string) []string {
+	var result []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+// processReport is what a parallel process other than the first leaves for the final report, which
+// only process 1 writes
+type processReport struct {
+	// LogFile is the process's run log, Logs its entries when they were kept in memory instead
+	LogFile  string                            `json:"log_file,omitempty"`
+	Logs     []byte                            `json:"logs,omitempty"`
+	Metrics  map[string]map[string]interface{} `json:"metrics"`
+	APICalls APICallCounts                     `json:"api_calls"`
+}
+
+func processReportPath(dir string, process int) string {
+	return filepath.Join(dir, fmt.Sprintf("process_report_%d.json", process))
+}
+
+// WriteProcessReport saves the run log's path, the metrics and the API calls of a parallel process
+// other than the first into ./temp, for the final report to merge. The SynchronizedAfterSuite calls it
+// on every process, it does nothing on process 1 and in serial runs.
+func WriteProcessReport() error {
+	process := ginkgo.GinkgoParallelProcess()
+	if process == 1 {
+		return nil
+	}
+	report := processReport{LogFile: RunLogFile(), Logs: processLog.inMemory(), APICalls: APICalls()}
+	metricsByTagsMu.Lock()
+	report.Metrics = metricsByTags
+	data, err := json.Marshal(report)
+	metricsByTagsMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("process %d report serialization failed: %w", process, err)
+	}
+	if err := os.WriteFile(processReportPath("./temp", process), data, 0644); err != nil {
+		return fmt.Errorf("process %d report write failed: %w", process, err)
+	}
+	return nil
+}
+
+// readProcessReports reads and removes the reports the other parallel processes left, for processes 2
+// to total. A missing report doesn't keep the others from being read.
+func readProcessReports(dir string, total int) ([]processReport, error) {
+	var reports []processReport
+	var errs []error
+	for process := 2; process <= total; process++ {
+		path := processReportPath(dir, process)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("process %d report missing: %w", process, err))
+			continue
+		}
+		var report processReport
+		if err := json.Unmarshal(data, &report); err != nil {
+			errs = append(errs, fmt.Errorf("process %d report decoding error: %w", process, err))
+			continue
+		}
+		reports = append(reports, report)
+		os.Remove(path)
+	}
+	return reports, errors.Join(errs...)
+}
@@ -0,0 +1,73 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PDBStatus is the disruption controller's own accounting for a PodDisruptionBudget, which is what the
+// eviction API enforces. Suites assert on it rather than recomputing it from pod lists, which can't see
+// pods the controller has not counted yet.
+type PDBStatus struct {
+	CurrentHealthy     int32 `json:"current_healthy"`
+	DesiredHealthy     int32 `json:"desired_healthy"`
+	DisruptionsAllowed int32 `json:"disruptions_allowed"`
+	ExpectedPods       int32 `json:"expected_pods"`
+	// Observed is false while the controller has not caught up with the current spec, the figures are
+	// then those of the previous one
+	Observed bool `json:"observed"`
+}
+
+func (s PDBStatus) String() string {
+	status := fmt.Sprintf("currentHealthy %d, desiredHealthy %d, disruptionsAllowed %d, expectedPods %d",
+		s.CurrentHealthy, s.DesiredHealthy, s.DisruptionsAllowed, s.ExpectedPods)
+	if !s.Observed {
+		status += " (spec not observed yet)"
+	}
+	return status
+}
+
+// GetPDBStatus reads the status of the PodDisruptionBudget
+func GetPDBStatus(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) (PDBStatus, error) {
+	pdb, err := clientset.PolicyV1().PodDisruptionBudgets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return PDBStatus{}, fmt.Errorf("PDB %s/%s lookup failed: %w", namespace, name, err)
+	}
+	return PDBStatus{
+		CurrentHealthy:     pdb.Status.CurrentHealthy,
+		DesiredHealthy:     pdb.Status.DesiredHealthy,
+		DisruptionsAllowed: pdb.Status.DisruptionsAllowed,
+		ExpectedPods:       pdb.Status.ExpectedPods,
+		Observed:           pdb.Status.ObservedGeneration >= pdb.Generation,
+	}, nil
+}
+
+// WaitForPDBStatus polls the PodDisruptionBudget until the controller has observed its current spec and
+// the condition holds for its status, and returns that status. On timeout the error carries the last
+// status seen.
+//
+//	// Wait until an eviction can go through
+//	example.WaitForPDBStatus(ctx, clientset, "test-ns", "app-pdb", time.Minute, func(status example.PDBStatus) bool {
+//		return status.DisruptionsAllowed > 0
+//	})
+func WaitForPDBStatus(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, timeout time.Duration,
+	condition func(status PDBStatus) bool) (PDBStatus, error) {
+	timeout = Timeout(TimeoutPDB, timeout)
+	var last PDBStatus
+	err := PollUntil(ctx, CheckInterval(2*time.Second), timeout, func(ctx context.Context) (bool, error) {
+		status, err := GetPDBStatus(ctx, clientset, namespace, name)
+		if err != nil {
+			return false, err
+		}
+		last = status
+		return status.Observed && condition(status), nil
+	})
+	if err != nil {
+		return last, fmt.Errorf("PDB %s/%s: %s: %w", namespace, name, last, err)
+	}
+	return last, nil
+}
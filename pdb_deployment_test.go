@@ -3,25 +3,27 @@ package example_test
 import (
 	"context"
 	"fmt"
+	"strconv"
 	"time"
 
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
 	"github.com/rs/zerolog"
-	"gopkg.in/yaml.v2"
+	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 
 	"example"
+	"example/matchers"
 )
 
-var _ = ginkgo.Describe("Deployment PDB E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), func() {
+var _ = ginkgo.Describe("Deployment PDB E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("DeploymentPDBTest"), func() {
 	var (
 		clientset         *kubernetes.Clientset
+		config            *rest.Config
 		minBDPAllowedPods int32
 		logger            zerolog.Logger
 		testTag           = "DeploymentPDBTest"
@@ -29,43 +31,31 @@ var _ = ginkgo.Describe("Deployment PDB E2E test", ginkgo.Ordered, ginkgo.Label(
 	ginkgo.BeforeAll(func() {
 
 		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
 		clientset, err = example.GetClient()
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 		logger = example.GetLogger(testTag)
-
-		// Namespace setup
-		logger.Info().Msgf("=== Ensuring test-ns exists ===")
-		_, err = clientset.CoreV1().Namespaces().Get(
-			context.TODO(),
-			"test-ns",
-			metav1.GetOptions{},
-		)
-
-		if apierrors.IsNotFound(err) {
-			logger.Info().Msgf("Creating test-ns namespace\n")
-			ns := &v1.Namespace{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "test-ns",
-				},
-			}
-			_, err = clientset.CoreV1().Namespaces().Create(
-				context.TODO(),
-				ns,
-				metav1.CreateOptions{},
-			)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		} else {
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		}
 	})
 
 	ginkgo.AfterEach(func() {
 		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
 		if ginkgo.CurrentSpecReport().Failed() {
 			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+			// The Deployment's conditions and events show where a rollout got stuck
+			description, err := example.DescribeObject(context.TODO(), config, appsv1.SchemeGroupVersion.WithKind("Deployment"), example.TestNamespace(), "app")
+			if err == nil {
+				logger.Error().Msgf("%s", description)
+			}
+			// The breakdown of the pods goes into the final report with the failure
+			pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=app"})
+			if err == nil {
+				summary := example.SummarizePods(pods)
+				logger.Error().Interface("pod_summary", summary).Msgf("Pods of deployment app: %s", summary)
+			}
 		}
-
 	})
 
 	ginkgo.AfterAll(func() {
@@ -80,17 +70,8 @@ var _ = ginkgo.Describe("Deployment PDB E2E test", ginkgo.Ordered, ginkgo.Label(
 		pdbYAML, depYAML, err := example.GetPDBDeploymentTestFiles()
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
-		type pdbSpec struct {
-			Spec struct {
-				MinAvailable int32 `yaml:"minAvailable"`
-			} `yaml:"spec"`
-		}
-
-		var pdbConfig pdbSpec
-		err = yaml.Unmarshal([]byte(pdbYAML), &pdbConfig)
+		pdb, err := example.ParsePDB(pdbYAML)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		minBDPAllowedPods = pdbConfig.Spec.MinAvailable
-		logger.Info().Msgf("=== Minimum allowed pods from PDB: %d ===", minBDPAllowedPods)
 
 		// Apply all the manifests
 		logger.Info().Msgf("=== Applying Deployment manifest ===")
@@ -101,171 +82,144 @@ var _ = ginkgo.Describe("Deployment PDB E2E test", ginkgo.Ordered, ginkgo.Label(
 		err = example.ApplyRawManifest(clientset, pdbYAML)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
+		// The PDB only reports its pods as healthy once they are scheduled and ready
 		logger.Info().Msgf("=== Wait for Pods to schedule ===")
-		time.Sleep(30 * time.Second)
+		status, err := example.WaitForPDBStatus(context.TODO(), clientset, example.TestNamespace(), pdb.Name, 3*time.Minute,
+			func(status example.PDBStatus) bool {
+				return status.ExpectedPods > 0 && status.CurrentHealthy == status.ExpectedPods
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Pods covered by the PDB did not become healthy")
+		logger.Info().Msgf("PDB %s %s\n", pdb.Name, status)
+
+		// A percentage only turns into a pod count against the pods the PDB covers
+		minBDPAllowedPods, err = example.PDBMinAvailable(pdb, status.ExpectedPods)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(minBDPAllowedPods).To(gomega.Equal(status.DesiredHealthy),
+			"The PDB controller resolved the budget differently")
+		logger.Info().Msgf("=== Minimum allowed pods from PDB: %d ===", minBDPAllowedPods)
 	})
 
 	ginkgo.It("should maintain minimum pods during rolling update", func() {
 		defer example.E2ePanicHandler()
 
-		// Get existing deployment
-		currentDeployment, err := clientset.AppsV1().Deployments("test-ns").Get(
-			context.TODO(),
-			"app",
-			metav1.GetOptions{},
-		)
+		// The monitor evaluates the ready pod count on every pod update, so dips shorter than a second are seen
+		monitor, err := example.StartPodAvailabilityMonitor(clientset, example.TestNamespace(), "app=app", int(minBDPAllowedPods))
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
-
-		// Create modified deployment with new CPU request
-		newDeployment := currentDeployment.DeepCopy()
-		newDeployment.Spec.Template.Spec.Containers[0].Resources.Requests[v1.ResourceCPU] = resource.MustParse("100m")
+		defer monitor.Stop()
 
 		logger.Info().Msgf("=== Triggering rolling update with new CPU requests ===")
-		_, err = clientset.AppsV1().Deployments("test-ns").Update(
-			context.TODO(),
-			newDeployment,
-			metav1.UpdateOptions{
-				FieldManager: "e2e-test",
-			},
-		)
+		err = example.TriggerRollingUpdate(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), "app",
+			func(template *v1.PodTemplateSpec) {
+				template.Spec.Containers[0].Resources.Requests[v1.ResourceCPU] = resource.MustParse("100m")
+			})
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
-		// Monitoring parameters
-		const (
-			checkInterval = 15 * time.Second
-			maxAttempts   = 20
-		)
-		minObservedPods := int32(1 << 30) // Initialize with very high number
-		checkCounter := 1
-		rolloutComplete := false
-
-		logger.Info().Msgf("=== Starting rolling update monitoring ===")
-		for attempt := 1; attempt <= maxAttempts; attempt++ {
-			// Get current deployment status
-			deployment, err := clientset.AppsV1().Deployments("test-ns").Get(
-				context.TODO(),
-				"app",
-				metav1.GetOptions{},
-			)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Waiting for the rollout ===")
+		err = example.WaitForRollout(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), "app", 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
-			// Check rollout completion
-			if deployment.Status.UpdatedReplicas == *deployment.Spec.Replicas &&
-				deployment.Status.Replicas == *deployment.Spec.Replicas &&
-				deployment.Status.AvailableReplicas == *deployment.Spec.Replicas {
-				rolloutComplete = true
-				logger.Info().Msgf("=== Rollout completed successfully ===")
-				break
-			}
+		// Final validation
+		deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "app", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pods).To(matchers.HaveReadyPods(int(*deployment.Spec.Replicas)))
+		gomega.Expect(pods).To(matchers.HaveNoPendingPods())
+		monitor.RecordMetrics(testTag, "rolling_update")
+		for _, violation := range monitor.Violations() {
+			logger.Error().Interface("pdb_violation", violation).Msgf("PDB violated: %s", violation)
+		}
+		gomega.Expect(monitor.Violations()).To(gomega.BeEmpty(),
+			fmt.Sprintf("Ready pod count dropped to %d, below the PDB minimum %d", monitor.MinObserved(), minBDPAllowedPods))
 
-			// Get current pods
-			checkStart := time.Now()
-			runningPods, err := clientset.CoreV1().Pods("test-ns").List(
-				context.TODO(),
-				metav1.ListOptions{
-					FieldSelector: "status.phase=Running",
-					LabelSelector: "app=app",
-				},
-			)
-			checkDuration := time.Since(checkStart)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Rolling update completed with minimum %d ready pods (PDB requires >=%d) ===",
+			monitor.MinObserved(), minBDPAllowedPods)
+	})
 
-			// Calculate pod statuses
-			var ready, runningNotReady, pending, terminating int
-			currentRunningPods := int32(len(runningPods.Items))
-			var podNames []string
-
-			for _, pod := range runningPods.Items {
-				podNames = append(podNames, pod.Name)
-				if pod.DeletionTimestamp != nil {
-					terminating++
-					continue
-				}
-
-				switch pod.Status.Phase {
-				case v1.PodPending:
-					pending++
-				case v1.PodRunning:
-					isReady := false
-					for _, cond := range pod.Status.Conditions {
-						if cond.Type == v1.PodReady && cond.Status == v1.ConditionTrue {
-							isReady = true
-							break
-						}
-					}
-					if isReady {
-						ready++
-					} else {
-						runningNotReady++
-					}
-				}
-			}
+	ginkgo.It("should maintain minimum pods when a paused rollout with staged changes is resumed", func() {
+		defer example.E2ePanicHandler()
 
-			// Update minimum observed runningPods
-			if currentRunningPods < minObservedPods {
-				minObservedPods = currentRunningPods
+		logger.Info().Msgf("=== Pausing the rollout of deployment app ===")
+		err := example.PauseRollout(context.TODO(), clientset, example.TestNamespace(), "app")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		// Resuming a second time is harmless, a failed spec must not leave the Deployment paused
+		defer func() {
+			if err := example.ResumeRollout(context.TODO(), clientset, example.TestNamespace(), "app"); err != nil {
+				logger.Error().Msgf("Failed to resume deployment app: %v", err)
 			}
+		}()
 
-			// Get rolling update strategy parameters
-			rollingUpdate := deployment.Spec.Strategy.RollingUpdate
-			maxSurge := "0"
-			maxUnavailable := "0"
-			if rollingUpdate != nil {
-				maxSurge = rollingUpdate.MaxSurge.String()
-				maxUnavailable = rollingUpdate.MaxUnavailable.String()
+		deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "app", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		revision := deployment.Annotations[example.DeploymentRevisionAnnotation]
+
+		// Two separate updates, each of which would start a rollout of its own on an unpaused Deployment
+		stagedChanges := []struct {
+			description string
+			apply       func(container *v1.Container)
+		}{
+			{"lower CPU request", func(container *v1.Container) {
+				container.Resources.Requests[v1.ResourceCPU] = resource.MustParse("50m")
+			}},
+			{"new environment variable", func(container *v1.Container) {
+				container.Env = append(container.Env, v1.EnvVar{Name: "STAGED_CHANGE", Value: "true"})
+			}},
+		}
+		for _, change := range stagedChanges {
+			logger.Info().Msgf("=== Staging %s ===", change.description)
+			err = example.TriggerRollingUpdate(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), "app",
+				func(template *v1.PodTemplateSpec) {
+					change.apply(&template.Spec.Containers[0])
+				})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		// Once the controller has observed the staged changes, a rollout would have started already
+		example.ExpectPollUntil(context.TODO(), example.CheckInterval(2*time.Second), example.Timeout(example.TimeoutRollout, time.Minute), func(ctx context.Context) (bool, error) {
+			deployment, err = clientset.AppsV1().Deployments(example.TestNamespace()).Get(ctx, "app", metav1.GetOptions{})
+			if err != nil {
+				return false, err
 			}
+			return deployment.Status.ObservedGeneration >= deployment.Generation, nil
+		}, "The deployment controller did not observe the staged changes")
+		gomega.Expect(deployment.Annotations[example.DeploymentRevisionAnnotation]).To(gomega.Equal(revision),
+			"The paused Deployment started a rollout")
 
-			// Print detailed status
-			logger.Info().Msgf("=== Check %d ===", checkCounter)
-			logger.Info().Msgf("Rollout Status:\n"+
-				"  Total Pods: %d\n"+
-				"  Surge Usage: %d/%s\n"+
-				"  Unavailable: %d/%s\n"+
-				"  Ready: %d | RunningNotReady: %d | Pending: %d | Terminating: %d\n"+
-				"  Pod Names: %v\n"+
-				"  Check Duration: %vms\n",
-				len(runningPods.Items),
-				len(runningPods.Items)-int(*deployment.Spec.Replicas), maxSurge,
-				int(*deployment.Spec.Replicas)-int(deployment.Status.AvailableReplicas), maxUnavailable,
-				ready, runningNotReady, pending, terminating,
-				podNames,
-				checkDuration.Milliseconds())
-
-			// Immediate validation
-			gomega.Expect(currentRunningPods).To(
-				gomega.BeNumerically(">=", minBDPAllowedPods),
-				fmt.Sprintf("Check %d: Running Pod count %d < PDB minimum %d",
-					checkCounter,
-					currentRunningPods,
-					minBDPAllowedPods),
-			)
-
-			checkCounter++
-			time.Sleep(checkInterval)
-		}
+		monitor, err := example.StartPodAvailabilityMonitor(clientset, example.TestNamespace(), "app=app", int(minBDPAllowedPods))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer monitor.Stop()
 
-		// Final validation
-		gomega.Expect(rolloutComplete).To(gomega.BeTrue(), "Rollout did not complete within timeout")
-		gomega.Expect(minObservedPods).To(
-			gomega.BeNumerically(">=", minBDPAllowedPods),
-			fmt.Sprintf("Minimum observed running pods (%d) violated PDB requirement (%d)",
-				minObservedPods,
-				minBDPAllowedPods),
-		)
+		logger.Info().Msgf("=== Resuming the rollout ===")
+		err = example.ResumeRollout(context.TODO(), clientset, example.TestNamespace(), "app")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.WaitForRollout(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), "app", 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deployment, err = clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "app", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		previous, err := strconv.Atoi(revision)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(deployment.Annotations[example.DeploymentRevisionAnnotation]).To(gomega.Equal(strconv.Itoa(previous+1)),
+			"The staged changes were not rolled out in a single revision")
 
-		logger.Info().Msgf("=== Rolling update completed with minimum %d running pods (PDB requires >=%d) ===",
-			minObservedPods,
-			minBDPAllowedPods)
+		monitor.RecordMetrics(testTag, "resumed_rollout")
+		for _, violation := range monitor.Violations() {
+			logger.Error().Interface("pdb_violation", violation).Msgf("PDB violated: %s", violation)
+		}
+		gomega.Expect(monitor.Violations()).To(gomega.BeEmpty(),
+			fmt.Sprintf("Ready pod count dropped to %d, below the PDB minimum %d", monitor.MinObserved(), minBDPAllowedPods))
 	})
 
-	ginkgo.It("should maintain minimum pod count during deletions", func() {
+	ginkgo.It("should maintain minimum pod count while every pod is evicted", func() {
 		defer example.E2ePanicHandler()
 
 		// Get current pod count with proper selectors
 		labelSelector := "app=app,component=my-unique-deployment"
 
-		pods, err := clientset.CoreV1().Pods("test-ns").List(
+		pods, err := example.ListPods(
 			context.TODO(),
+			clientset,
+			example.TestNamespace(),
 			metav1.ListOptions{
 				LabelSelector: labelSelector,
 				FieldSelector: "status.phase=Running",
@@ -275,7 +229,7 @@ var _ = ginkgo.Describe("Deployment PDB E2E test", ginkgo.Ordered, ginkgo.Label(
 
 		// Filter out terminating pods in code
 		var activePods []v1.Pod
-		for _, pod := range pods.Items {
+		for _, pod := range pods {
 			if pod.DeletionTimestamp == nil {
 				activePods = append(activePods, pod)
 			}
@@ -289,57 +243,33 @@ var _ = ginkgo.Describe("Deployment PDB E2E test", ginkgo.Ordered, ginkgo.Label(
 			fmt.Sprintf("Initial pods (%d) below PDB minimum (%d)", initialPods, minBDPAllowedPods),
 		)
 
-		// Delete all active pods
-		logger.Info().Msgf("=== Deleting all %d pods ===", initialPods)
+		monitor, err := example.StartPodAvailabilityMonitor(clientset, example.TestNamespace(), labelSelector, int(minBDPAllowedPods))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer monitor.Stop()
+
+		// A direct delete bypasses the PDB, evictions are what it guards against. The ones it refuses are
+		// retried until replacements are ready and the budget allows them.
+		names := make([]string, 0, len(activePods))
 		for _, pod := range activePods {
-			err := clientset.CoreV1().Pods("test-ns").Delete(
-				context.TODO(),
-				pod.Name,
-				metav1.DeleteOptions{},
-			)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			names = append(names, pod.Name)
 		}
+		logger.Info().Msgf("=== Evicting all %d pods ===", initialPods)
+		refused, err := example.EvictPods(context.TODO(), clientset, example.TestNamespace(), names, 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== All pods evicted, %d evictions refused by the PDB ===", refused)
 
-		// Post-deletion checks with proper filtering
-		logger.Info().Msgf("=== Performing post-deletion validation ===")
-		const numAttempts = 10
-		for attempt := 1; attempt <= numAttempts; attempt++ {
-			startPostCheck := time.Now()
-
-			postDeletePods, err := clientset.CoreV1().Pods("test-ns").List(
-				context.TODO(),
-				metav1.ListOptions{
-					LabelSelector: labelSelector,
-					FieldSelector: "status.phase=Running",
-				},
-			)
-			postCheckDuration := time.Since(startPostCheck)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		// The replacements of the last evictions must become ready without a dip either
+		_, err = example.WaitForPodsReady(context.TODO(), clientset, example.TestNamespace(), labelSelector, initialPods, example.PodCountAtLeast, 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
-			// Filter terminating pods
-			var currentActivePods []v1.Pod
-			for _, p := range postDeletePods.Items {
-				if p.DeletionTimestamp == nil {
-					currentActivePods = append(currentActivePods, p)
-				}
-			}
-			finalCount := len(currentActivePods)
-
-			logger.Info().Msgf("Attempt %d: Active Pods=%d, Sampling Duration=%v\n",
-				attempt,
-				finalCount,
-				postCheckDuration.Round(time.Millisecond))
-
-			gomega.Expect(int32(finalCount)).To(
-				gomega.BeNumerically(">=", minBDPAllowedPods),
-				fmt.Sprintf("Attempt %d: Pod count %d < PDB minimum %d",
-					attempt,
-					finalCount,
-					minBDPAllowedPods),
-			)
+		monitor.RecordMetrics(testTag, "evictions")
+		for _, violation := range monitor.Violations() {
+			logger.Error().Interface("pdb_violation", violation).Msgf("PDB violated: %s", violation)
 		}
-
-		logger.Info().Msgf("=== All post-deletion checks passed ===")
+		gomega.Expect(monitor.Violations()).To(gomega.BeEmpty(),
+			fmt.Sprintf("Ready pod count dropped to %d, below the PDB minimum %d", monitor.MinObserved(), minBDPAllowedPods))
+		logger.Info().Msgf("=== All pods replaced with minimum %d ready pods (PDB requires >=%d) ===",
+			monitor.MinObserved(), minBDPAllowedPods)
 	})
 
 })
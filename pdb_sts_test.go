@@ -8,9 +8,6 @@ import (
 	"github.com/onsi/ginkgo/v2"
 	"github.com/onsi/gomega"
 	"github.com/rs/zerolog"
-	"gopkg.in/yaml.v2"
-	v1 "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -18,12 +15,14 @@ import (
 	"example"
 )
 
-var _ = ginkgo.Describe("StatefulSet PDB E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), func() {
+var _ = ginkgo.Describe("StatefulSet PDB E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("StatefulSetPDBTest"), func() {
 	var (
 		clientset         *kubernetes.Clientset
 		minBDPAllowedPods int32
-		logger            zerolog.Logger
-		testTag           = "StatefulSetPDBTest"
+		// podSelector selects the pods the PDB covers
+		podSelector string
+		logger      zerolog.Logger
+		testTag     = "StatefulSetPDBTest"
 	)
 
 	ginkgo.BeforeAll(func() {
@@ -33,31 +32,6 @@ var _ = ginkgo.Describe("StatefulSet PDB E2E test", ginkgo.Ordered, ginkgo.Label
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
 		logger = example.GetLogger(testTag)
-
-		// Namespace setup
-		logger.Info().Msgf("=== Ensuring test-ns exists ===")
-		_, err = clientset.CoreV1().Namespaces().Get(
-			context.TODO(),
-			"test-ns",
-			metav1.GetOptions{},
-		)
-
-		if apierrors.IsNotFound(err) {
-			logger.Info().Msgf("Creating test-ns namespace\n")
-			ns := &v1.Namespace{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "test-ns",
-				},
-			}
-			_, err = clientset.CoreV1().Namespaces().Create(
-				context.TODO(),
-				ns,
-				metav1.CreateOptions{},
-			)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		} else {
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		}
 	})
 
 	ginkgo.AfterEach(func() {
@@ -80,17 +54,8 @@ var _ = ginkgo.Describe("StatefulSet PDB E2E test", ginkgo.Ordered, ginkgo.Label
 		pdbYAML, ssYAML, err := example.GetPDBStSTestFiles()
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
-		type pdbSpec struct {
-			Spec struct {
-				MinAvailable int32 `yaml:"minAvailable"`
-			} `yaml:"spec"`
-		}
-
-		var pdbConfig pdbSpec
-		err = yaml.Unmarshal([]byte(pdbYAML), &pdbConfig)
+		pdb, err := example.ParsePDB(pdbYAML)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		minBDPAllowedPods = pdbConfig.Spec.MinAvailable
-		logger.Info().Msgf("=== Minimum allowed pods from PDB: %d ===", minBDPAllowedPods)
 
 		// Apply all the manifests
 		logger.Info().Msgf("=== Applying StatefulSet and Service manifest ===")
@@ -101,22 +66,34 @@ var _ = ginkgo.Describe("StatefulSet PDB E2E test", ginkgo.Ordered, ginkgo.Label
 		err = example.ApplyRawManifest(clientset, pdbYAML)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
+		// The PDB only reports its pods as healthy once they are scheduled and ready
 		logger.Info().Msgf("=== Wait for Pods to schedule ===")
-		time.Sleep(30 * time.Second)
+		status, err := example.WaitForPDBStatus(context.TODO(), clientset, example.TestNamespace(), pdb.Name, 3*time.Minute,
+			func(status example.PDBStatus) bool {
+				return status.ExpectedPods > 0 && status.CurrentHealthy == status.ExpectedPods
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Pods covered by the PDB did not become healthy")
+		logger.Info().Msgf("PDB %s %s\n", pdb.Name, status)
+
+		// A percentage only turns into a pod count against the pods the PDB covers
+		minBDPAllowedPods, err = example.PDBMinAvailable(pdb, status.ExpectedPods)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(minBDPAllowedPods).To(gomega.Equal(status.DesiredHealthy),
+			"The PDB controller resolved the budget differently")
+		logger.Info().Msgf("=== Minimum allowed pods from PDB: %d ===", minBDPAllowedPods)
+
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		podSelector = selector.String()
 	})
 
-	ginkgo.It("should maintain minimum pod count during deletions", func() {
+	ginkgo.It("should maintain minimum pod count while every pod is evicted", func() {
 		defer example.E2ePanicHandler()
 
-		//Get current pod count
-		pods, err := clientset.CoreV1().Pods("test-ns").List(
-			context.TODO(),
-			metav1.ListOptions{FieldSelector: "status.phase=Running"},
-		)
+		pods, err := example.WaitForPodsReady(context.TODO(), clientset, example.TestNamespace(), podSelector, 1, example.PodCountAtLeast, time.Minute)
 		gomega.Expect(err).NotTo(gomega.HaveOccurred())
-
-		initialPods := len(pods.Items)
-		logger.Info().Msgf("=== Initial running pods: %d ===", initialPods)
+		initialPods := len(pods)
+		logger.Info().Msgf("=== Initial ready pods: %d ===", initialPods)
 
 		// Verify minimum pod count
 		gomega.Expect(int32(initialPods)).To(
@@ -124,45 +101,34 @@ var _ = ginkgo.Describe("StatefulSet PDB E2E test", ginkgo.Ordered, ginkgo.Label
 			fmt.Sprintf("Initial pods (%d) below PDB minimum (%d)", initialPods, minBDPAllowedPods),
 		)
 
-		// Delete all pods
-		logger.Info().Msgf("=== Deleting all %d pods ===", initialPods)
-		for _, pod := range pods.Items {
-			err := clientset.CoreV1().Pods("test-ns").Delete(
-				context.TODO(),
-				pod.Name,
-				metav1.DeleteOptions{},
-			)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-		}
+		// The monitor evaluates the ready pod count on every pod update, so dips shorter than a second are seen
+		monitor, err := example.StartPodAvailabilityMonitor(clientset, example.TestNamespace(), podSelector, int(minBDPAllowedPods))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer monitor.Stop()
 
-		// Immediate post-deletion checks with 5 attempts
-		logger.Info().Msgf("=== Performing post-deletion validation (several attempts) ===")
-		numAttempts := 10
-		for attempt := 1; attempt <= numAttempts; attempt++ {
-			startPostCheck := time.Now()
-			postDeletePods, err := clientset.CoreV1().Pods("test-ns").List(
-				context.TODO(),
-				metav1.ListOptions{FieldSelector: "status.phase=Running"},
-			)
-			postCheckDuration := time.Since(startPostCheck)
-			gomega.Expect(err).NotTo(gomega.HaveOccurred())
-			finalPods := len(postDeletePods.Items)
-
-			logger.Info().Msgf("Attempt %d: Running Pods=%d, Sampling Duration=%v\n",
-				attempt,
-				finalPods,
-				postCheckDuration.Round(time.Millisecond))
-
-			gomega.Expect(int32(finalPods)).To(
-				gomega.BeNumerically(">=", minBDPAllowedPods),
-				fmt.Sprintf("Attempt %d: Running Pod count (%d) violated PDB minimum (%d)",
-					attempt,
-					finalPods,
-					minBDPAllowedPods),
-			)
+		// A direct delete bypasses the PDB, evictions are what it guards against. The ones it refuses are
+		// retried until the recreated pods are ready and the budget allows them.
+		names := make([]string, 0, len(pods))
+		for _, pod := range pods {
+			names = append(names, pod.Name)
 		}
+		logger.Info().Msgf("=== Evicting all %d pods ===", initialPods)
+		refused, err := example.EvictPods(context.TODO(), clientset, example.TestNamespace(), names, 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== All pods evicted, %d evictions refused by the PDB ===", refused)
+
+		// The StatefulSet recreates each pod under its name, the last ones must become ready without a dip either
+		_, err = example.WaitForPodsReady(context.TODO(), clientset, example.TestNamespace(), podSelector, initialPods, example.PodCountAtLeast, 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
 
-		logger.Info().Msgf("=== All post-deletion checks passed ===")
+		monitor.RecordMetrics(testTag, "evictions")
+		for _, violation := range monitor.Violations() {
+			logger.Error().Interface("pdb_violation", violation).Msgf("PDB violated: %s", violation)
+		}
+		gomega.Expect(monitor.Violations()).To(gomega.BeEmpty(),
+			fmt.Sprintf("Ready pod count dropped to %d, below the PDB minimum %d", monitor.MinObserved(), minBDPAllowedPods))
+		logger.Info().Msgf("=== All pods replaced with minimum %d ready pods (PDB requires >=%d) ===",
+			monitor.MinObserved(), minBDPAllowedPods)
 	})
 
 })
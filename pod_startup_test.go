@@ -0,0 +1,214 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Pod startup latency E2E test", ginkgo.Ordered, ginkgo.Label("benchmark"), example.SuiteConcurrency("PodStartupLatencyTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		podYAML   []byte
+		// Hostname of the node the image is prepulled on, every sample is pinned to it
+		hostname string
+		logger   zerolog.Logger
+		testTag  = "PodStartupLatencyTest"
+	)
+
+	const (
+		// Overridable with POD_STARTUP_SAMPLES in .env
+		defaultSamples = 20
+		// Upstream pod startup SLO for stateless pods with prepulled images. Overridable with
+		// POD_STARTUP_P99_THRESHOLD_MS in .env
+		defaultP99ThresholdMs = 5000
+		sampleTimeout         = 2 * time.Minute
+	)
+
+	// podPhases are the moments a pod reached each startup phase, as observed on a watch. Pod condition
+	// timestamps have second resolution, too coarse for latencies of a few hundred milliseconds.
+	type podPhases struct {
+		created   time.Time
+		scheduled time.Time
+		running   time.Time
+		ready     time.Time
+	}
+
+	// startPod creates a pod and follows it on a watch until it is Ready
+	startPod := func(name string) podPhases {
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(podYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		pod.Name = name
+		pod.Spec.NodeSelector[v1.LabelHostname] = hostname
+
+		// The watch is opened first, so no transition can happen before it
+		watcher, err := clientset.CoreV1().Pods(example.TestNamespace()).Watch(context.TODO(), metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("metadata.name", name).String(),
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer watcher.Stop()
+
+		var phases podPhases
+		phases.created = time.Now()
+		_, err = clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		timeout := time.After(sampleTimeout)
+		for phases.ready.IsZero() {
+			select {
+			case event, ok := <-watcher.ResultChan():
+				if !ok {
+					ginkgo.Fail(fmt.Sprintf("Watch of pod %s closed before it was ready", name))
+				}
+				observed := time.Now()
+				current, ok := event.Object.(*v1.Pod)
+				if !ok {
+					continue
+				}
+				for _, condition := range current.Status.Conditions {
+					if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionTrue && phases.scheduled.IsZero() {
+						phases.scheduled = observed
+					}
+					if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+						phases.ready = observed
+					}
+				}
+				for _, status := range current.Status.ContainerStatuses {
+					if status.State.Running != nil && phases.running.IsZero() {
+						phases.running = observed
+					}
+				}
+			case <-timeout:
+				ginkgo.Fail(fmt.Sprintf("Pod %s was not ready within %v", name, sampleTimeout))
+			}
+		}
+
+		// A status update can carry several transitions at once
+		if phases.running.IsZero() {
+			phases.running = phases.ready
+		}
+		if phases.scheduled.IsZero() {
+			phases.scheduled = phases.running
+		}
+		return phases
+	}
+
+	deletePod := func(name string) {
+		gracePeriod := int64(0)
+		err := clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), name, metav1.DeleteOptions{
+			GracePeriodSeconds: &gracePeriod,
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Error().Msgf("Failed to delete pod %s: %v", name, err)
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		podYAML, err = example.GetPodStartupTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should prepull the image on a schedulable node", func() {
+		logger.Info().Msgf("=== Starting Pod startup latency E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, node := range nodes.Items {
+			if example.NodeSchedulable(node) && len(node.Spec.Taints) == 0 && node.Labels[v1.LabelHostname] != "" {
+				hostname = node.Labels[v1.LabelHostname]
+				break
+			}
+		}
+		gomega.Expect(hostname).NotTo(gomega.BeEmpty(), "No ready, schedulable node without taints")
+
+		logger.Info().Msgf("=== Prepulling the image on %s ===", hostname)
+		phases := startPod("pod-startup-prepull")
+		deletePod("pod-startup-prepull")
+		logger.Info().Msgf("=== First start, including the pull, took %v ===", phases.ready.Sub(phases.created).Round(time.Millisecond))
+	})
+
+	ginkgo.It("should start pods with a prepulled image within the startup SLO", func() {
+		defer example.E2ePanicHandler()
+
+		samples := defaultSamples
+		if value := os.Getenv("POD_STARTUP_SAMPLES"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid POD_STARTUP_SAMPLES: %s", value)
+			samples = parsed
+		}
+		threshold := float64(defaultP99ThresholdMs)
+		if value := os.Getenv("POD_STARTUP_P99_THRESHOLD_MS"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid POD_STARTUP_P99_THRESHOLD_MS: %s", value)
+			threshold = parsed
+		}
+
+		// Pods are started one at a time, so the samples measure latency and not throughput
+		logger.Info().Msgf("=== Starting %d pods on %s ===", samples, hostname)
+		latencies := map[string][]float64{}
+		milliseconds := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+		for i := 0; i < samples; i++ {
+			name := fmt.Sprintf("pod-startup-%d", i)
+			phases := startPod(name)
+			deletePod(name)
+
+			latencies["scheduling"] = append(latencies["scheduling"], milliseconds(phases.scheduled.Sub(phases.created)))
+			latencies["kubelet_start"] = append(latencies["kubelet_start"], milliseconds(phases.running.Sub(phases.scheduled)))
+			latencies["readiness"] = append(latencies["readiness"], milliseconds(phases.ready.Sub(phases.running)))
+			latencies["total"] = append(latencies["total"], milliseconds(phases.ready.Sub(phases.created)))
+		}
+
+		for _, stage := range []string{"scheduling", "kubelet_start", "readiness", "total"} {
+			p50 := example.Percentile(latencies[stage], 50)
+			p95 := example.Percentile(latencies[stage], 95)
+			p99 := example.Percentile(latencies[stage], 99)
+			logger.Info().Msgf("%-13s p50: %.0fms, p95: %.0fms, p99: %.0fms\n", stage, p50, p95, p99)
+			example.RecordMetric(testTag, "pod_startup_"+stage+"_p50_ms", p50)
+			example.RecordMetric(testTag, "pod_startup_"+stage+"_p95_ms", p95)
+			example.RecordMetric(testTag, "pod_startup_"+stage+"_p99_ms", p99)
+		}
+
+		totalP99 := example.Percentile(latencies["total"], 99)
+		gomega.Expect(totalP99).To(gomega.BeNumerically("<=", threshold),
+			fmt.Sprintf("Pod startup p99 %.0fms exceeds %.0fms", totalP99, threshold))
+	})
+
+})
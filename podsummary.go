@@ -0,0 +1,66 @@
+package example
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodSummary sorts pods by where they are in their lifecycle, the breakdown a rollout or a disruption
+// is watched with. Every pod is in exactly one list, by name.
+type PodSummary struct {
+	Ready []string `json:"ready"`
+	// RunningNotReady pods run but fail their readiness probe or haven't passed it yet
+	RunningNotReady []string `json:"running_not_ready"`
+	// Pending pods are waiting to be scheduled or for their containers to start
+	Pending []string `json:"pending"`
+	// Terminating pods have been deleted and are shutting down, whatever their phase
+	Terminating []string `json:"terminating"`
+	// Finished pods have succeeded or failed
+	Finished []string `json:"finished"`
+}
+
+// SummarizePods classifies the pods. A terminating pod counts as terminating even while it is still
+// ready, since Services and PDBs no longer count it.
+func SummarizePods(pods []corev1.Pod) PodSummary {
+	var summary PodSummary
+	for _, pod := range pods {
+		switch {
+		case pod.DeletionTimestamp != nil:
+			summary.Terminating = append(summary.Terminating, pod.Name)
+		case pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed:
+			summary.Finished = append(summary.Finished, pod.Name)
+		case podReady(pod):
+			summary.Ready = append(summary.Ready, pod.Name)
+		case pod.Status.Phase == corev1.PodRunning:
+			summary.RunningNotReady = append(summary.RunningNotReady, pod.Name)
+		default:
+			summary.Pending = append(summary.Pending, pod.Name)
+		}
+	}
+	for _, names := range [][]string{summary.Ready, summary.RunningNotReady, summary.Pending, summary.Terminating, summary.Finished} {
+		sort.Strings(names)
+	}
+	return summary
+}
+
+// Total is the number of pods summarized
+func (s PodSummary) Total() int {
+	return len(s.Ready) + len(s.RunningNotReady) + len(s.Pending) + len(s.Terminating) + len(s.Finished)
+}
+
+// String lists the counts, and the names of the pods that aren't ready
+func (s PodSummary) String() string {
+	summary := fmt.Sprintf("Ready: %d | RunningNotReady: %d | Pending: %d | Terminating: %d | Finished: %d",
+		len(s.Ready), len(s.RunningNotReady), len(s.Pending), len(s.Terminating), len(s.Finished))
+	for _, group := range []struct {
+		name  string
+		names []string
+	}{{"running not ready", s.RunningNotReady}, {"pending", s.Pending}, {"terminating", s.Terminating}} {
+		if len(group.names) > 0 {
+			summary += fmt.Sprintf(", %s: %v", group.name, group.names)
+		}
+	}
+	return summary
+}
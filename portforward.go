@@ -0,0 +1,129 @@
+package example
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForwardToPod forwards a free local port to the pod's port through the API server, like
+// kubectl port-forward, and returns the local address as host:port. Unlike exec from a client pod this
+// reaches the workload from the test process itself, in every access mode. The forward is stopped by
+// ginkgo.DeferCleanup when the spec or container that started it ends.
+func PortForwardToPod(config *rest.Config, clientset *kubernetes.Clientset, namespace, pod string, port int) (string, error) {
+	roundTripper, upgrader, err := spdy.RoundTripperFor(config)
+	if err != nil {
+		return "", fmt.Errorf("SPDY round tripper creation error: %w", err)
+	}
+	url := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward").
+		URL()
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: roundTripper}, http.MethodPost, url)
+
+	stop := make(chan struct{})
+	ready := make(chan struct{})
+	var errOut bytes.Buffer
+	forwarder, err := portforward.NewOnAddresses(dialer, []string{"127.0.0.1"}, []string{fmt.Sprintf("0:%d", port)},
+		stop, ready, io.Discard, &errOut)
+	if err != nil {
+		return "", fmt.Errorf("port-forward creation error: %w", err)
+	}
+
+	done := make(chan error, 1)
+	openPortForwards.Add(1)
+	go func() {
+		defer openPortForwards.Add(-1)
+		done <- forwarder.ForwardPorts()
+	}()
+	select {
+	case <-ready:
+	case err := <-done:
+		return "", fmt.Errorf("port-forward to %s/%s:%d failed: %v %s", namespace, pod, port, err, errOut.String())
+	case <-time.After(30 * time.Second):
+		close(stop)
+		return "", fmt.Errorf("port-forward to %s/%s:%d not ready within 30s", namespace, pod, port)
+	}
+	ginkgo.DeferCleanup(func() {
+		close(stop)
+	})
+
+	ports, err := forwarder.GetPorts()
+	if err != nil || len(ports) == 0 {
+		return "", fmt.Errorf("port-forward to %s/%s:%d has no local port: %v", namespace, pod, port, err)
+	}
+	return fmt.Sprintf("127.0.0.1:%d", ports[0].Local), nil
+}
+
+// PortForwardToService forwards a free local port to a ready pod behind the Service, resolving the
+// Service port to the pod's target port the way kubectl port-forward svc/name does. All connections
+// go to that one pod, so this is no replacement for testing the Service's load balancing.
+func PortForwardToService(config *rest.Config, clientset *kubernetes.Clientset, namespace, service string, port int) (string, error) {
+	svc, err := clientset.CoreV1().Services(namespace).Get(context.TODO(), service, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("service %s/%s lookup failed: %w", namespace, service, err)
+	}
+	var servicePort *corev1.ServicePort
+	for i := range svc.Spec.Ports {
+		if int(svc.Spec.Ports[i].Port) == port {
+			servicePort = &svc.Spec.Ports[i]
+		}
+	}
+	if servicePort == nil {
+		return "", fmt.Errorf("service %s/%s has no port %d", namespace, service, port)
+	}
+	if len(svc.Spec.Selector) == 0 {
+		return "", fmt.Errorf("service %s/%s has no selector", namespace, service)
+	}
+
+	pods, err := ListPods(context.TODO(), clientset, namespace, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(svc.Spec.Selector).String(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("pods of service %s/%s listing failed: %w", namespace, service, err)
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || !podReady(pod) {
+			continue
+		}
+		targetPort, err := resolveTargetPort(pod, *servicePort)
+		if err != nil {
+			return "", fmt.Errorf("service %s/%s: %w", namespace, service, err)
+		}
+		return PortForwardToPod(config, clientset, namespace, pod.Name, targetPort)
+	}
+	return "", fmt.Errorf("service %s/%s has no ready pod", namespace, service)
+}
+
+// resolveTargetPort returns the container port a Service port targets on the pod, looking named
+// target ports up in the pod's container ports
+func resolveTargetPort(pod corev1.Pod, servicePort corev1.ServicePort) (int, error) {
+	if servicePort.TargetPort.StrVal == "" {
+		if servicePort.TargetPort.IntVal == 0 {
+			return int(servicePort.Port), nil
+		}
+		return int(servicePort.TargetPort.IntVal), nil
+	}
+	for _, container := range pod.Spec.Containers {
+		for _, containerPort := range container.Ports {
+			if containerPort.Name == servicePort.TargetPort.StrVal {
+				return int(containerPort.ContainerPort), nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("pod %s has no container port named %s", pod.Name, servicePort.TargetPort.StrVal)
+}
@@ -0,0 +1,250 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Pod priority and preemption E2E test", ginkgo.Ordered, ginkgo.Label("disruptive"), example.SuiteConcurrency("PriorityPreemptionTest"), func() {
+	var (
+		clientset        *kubernetes.Clientset
+		targetNode       string
+		targetHostname   string
+		freeMilliCPU     int64
+		lowReplicas      int32
+		priorityYAML     []byte
+		lowPriorityYAML  []byte
+		highPriorityYAML []byte
+		logger           zerolog.Logger
+		testTag          = "PriorityPreemptionTest"
+	)
+
+	const (
+		pollInterval = 3 * time.Second
+		// Below this the victims' requests get too small to be meaningful
+		minFreeMilliCPU = 400
+	)
+
+	// freeCPUOnNode returns the node's allocatable CPU minus the requests of every pod bound to it
+	freeCPUOnNode := func(node v1.Node) int64 {
+		pods, err := example.ListPodsOnNode(context.TODO(), clientset, "", node.Name)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		allocatable := node.Status.Allocatable[v1.ResourceCPU]
+		free := allocatable.MilliValue()
+		for _, pod := range pods {
+			if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+				continue
+			}
+			for _, container := range pod.Spec.Containers {
+				request := container.Resources.Requests[v1.ResourceCPU]
+				free -= request.MilliValue()
+			}
+		}
+		return free
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		priorityYAML, lowPriorityYAML, highPriorityYAML, err = example.GetPriorityPreemptionTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Preflight: saturating a node is only acceptable when the rest of the cluster can absorb the load
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		schedulable := 0
+		for _, node := range nodes.Items {
+			if node.Spec.Unschedulable || len(node.Spec.Taints) > 0 || node.Labels["kubernetes.io/hostname"] == "" {
+				continue
+			}
+			schedulable++
+			free := freeCPUOnNode(node)
+			logger.Info().Msgf("Node %s free CPU: %dm\n", node.Name, free)
+			if free > freeMilliCPU {
+				targetNode = node.Name
+				targetHostname = node.Labels["kubernetes.io/hostname"]
+				freeMilliCPU = free
+			}
+		}
+		if schedulable < 2 {
+			ginkgo.Skip(fmt.Sprintf("Preemption test needs at least 2 untainted schedulable nodes (found %d)", schedulable))
+		}
+		if freeMilliCPU < minFreeMilliCPU {
+			ginkgo.Skip(fmt.Sprintf("No node has at least %dm of unrequested CPU (best: %dm)", minFreeMilliCPU, freeMilliCPU))
+		}
+		logger.Info().Msgf("=== Target node: %s with %dm free CPU ===", targetNode, freeMilliCPU)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+
+		// PriorityClasses are cluster scoped and outlive the namespace
+		for _, name := range []string{example.FixtureName("e2e-low-priority"), example.FixtureName("e2e-high-priority")} {
+			err := clientset.SchedulingV1().PriorityClasses().Delete(context.TODO(), name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				logger.Error().Msgf("Failed to delete PriorityClass %s: %v", name, err)
+			}
+		}
+	})
+
+	ginkgo.It("should saturate the target node with low priority pods", func() {
+		logger.Info().Msgf("=== Starting Pod priority and preemption E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying PriorityClass manifest ===")
+		err := example.ApplyRawManifest(clientset, priorityYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deployment := &appsv1.Deployment{}
+		err = utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(lowPriorityYAML), 4096).Decode(deployment)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		lowReplicas = *deployment.Spec.Replicas
+
+		// Split the free CPU between the replicas, so the node is full once they all run
+		perPod := resource.NewMilliQuantity(freeMilliCPU/int64(lowReplicas), resource.DecimalSI)
+		deployment.Spec.Template.Spec.NodeSelector = map[string]string{"kubernetes.io/hostname": targetHostname}
+		deployment.Spec.Template.Spec.Containers[0].Resources.Requests[v1.ResourceCPU] = *perPod
+
+		logger.Info().Msgf("=== Creating %d low priority pods requesting %s CPU each on %s ===", lowReplicas, perPod.String(), targetNode)
+		_, err = clientset.AppsV1().Deployments(example.TestNamespace()).Create(context.TODO(), deployment, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		readyTimeout := example.Timeout(example.TimeoutRollout, 3*time.Minute)
+		deadline := time.Now().Add(readyTimeout)
+		for {
+			current, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "low-priority-app", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			logger.Info().Msgf("Low priority ready replicas: %d/%d\n", current.Status.ReadyReplicas, lowReplicas)
+			if current.Status.ReadyReplicas == lowReplicas {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("low-priority-app did not become ready within %v, the node may have filled up meanwhile", readyTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=low-priority-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, pod := range pods {
+			gomega.Expect(pod.Spec.Priority).NotTo(gomega.BeNil())
+			gomega.Expect(*pod.Spec.Priority).To(gomega.BeNumerically("<", 0), "Pod %s did not get the low priority", pod.Name)
+		}
+	})
+
+	ginkgo.It("should preempt low priority pods to schedule a high priority pod", func() {
+		defer example.E2ePanicHandler()
+
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(highPriorityYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Half of the node's free CPU can only be found by removing about half of the victims
+		request := resource.NewMilliQuantity(freeMilliCPU/2, resource.DecimalSI)
+		pod.Spec.NodeSelector = map[string]string{"kubernetes.io/hostname": targetHostname}
+		pod.Spec.Containers[0].Resources.Requests[v1.ResourceCPU] = *request
+
+		logger.Info().Msgf("=== Creating high priority pod requesting %s CPU on %s ===", request.String(), targetNode)
+		createdAt := time.Now()
+		_, err = clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			current, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "high-priority-pod", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			logger.Info().Msgf("High priority pod phase: %s, nominated node: %q\n", current.Status.Phase, current.Status.NominatedNodeName)
+			if current.Status.Phase == v1.PodRunning {
+				gomega.Expect(current.Spec.NodeName).To(gomega.Equal(targetNode))
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("High priority pod was not running within %v", runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== High priority pod running %v after creation ===", time.Since(createdAt))
+		example.RecordMetric(testTag, "preemption_to_running_seconds", time.Since(createdAt).Seconds())
+
+		// The replacements of the victims have nowhere to go on the full node
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=low-priority-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		running, pending := 0, 0
+		for _, p := range pods {
+			if p.DeletionTimestamp != nil {
+				continue
+			}
+			switch p.Status.Phase {
+			case v1.PodRunning:
+				running++
+			case v1.PodPending:
+				pending++
+			}
+		}
+		logger.Info().Msgf("=== Low priority pods running: %d, pending: %d ===", running, pending)
+		gomega.Expect(running).To(gomega.BeNumerically("<", lowReplicas), "No low priority pod was preempted")
+		gomega.Expect(pending).To(gomega.BeNumerically(">", 0), "Preempted pods were not left pending")
+	})
+
+	ginkgo.It("should record the preemption in events", func() {
+		defer example.E2ePanicHandler()
+
+		deadline := time.Now().Add(example.Timeout(example.TimeoutPods, time.Minute))
+		for {
+			events, err := clientset.CoreV1().Events(example.TestNamespace()).List(context.TODO(), metav1.ListOptions{
+				FieldSelector: fields.OneTermEqualSelector("reason", "Preempted").String(),
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			preempted := 0
+			for _, event := range events.Items {
+				logger.Info().Msgf("Event %s/%s: %s\n", event.InvolvedObject.Kind, event.InvolvedObject.Name, event.Message)
+				if event.InvolvedObject.Kind == "Pod" {
+					preempted++
+				}
+			}
+			if preempted > 0 {
+				logger.Info().Msgf("=== Found %d Preempted events ===", preempted)
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail("No Preempted event was recorded for the low priority pods")
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	})
+
+})
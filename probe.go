@@ -0,0 +1,255 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// probePodName and probeContainer are the pod HTTPProbeFromPod launches when the options name none
+	probePodName   = "http-probe"
+	probeContainer = "probe"
+	// probeMarker starts the line curl writes after each response, with its status code and latency
+	probeMarker = "--- http-probe"
+)
+
+// ProbeImage returns the image of the pod HTTPProbeFromPod launches: curlimages/curl:8.5.0, overridable
+// with PROBE_IMAGE in .env. It must provide sh, seq, sleep and curl.
+func ProbeImage() string {
+	if image := os.Getenv("PROBE_IMAGE"); image != "" {
+		return image
+	}
+	return "curlimages/curl:8.5.0"
+}
+
+// HTTPProbeOptions configures HTTPProbeFromPod. The zero value sends one request with a 2 second
+// timeout from the http-probe pod in the TestNamespace.
+type HTTPProbeOptions struct {
+	// Namespace of the probe pod, the TestNamespace by default. It is the namespace NetworkPolicies see the
+	// traffic come from.
+	Namespace string
+	// Pod and Container to send the requests from, http-probe and probe by default. A pod that doesn't
+	// exist is launched with ProbeImage, an existing one, e.g. a suite's client pod, must provide curl.
+	Pod       string
+	Container string
+	// Requests is the number of requests, one by default
+	Requests int
+	// Interval is the pause between two requests, none by default
+	Interval time.Duration
+	// Timeout limits each request, 2 seconds by default
+	Timeout time.Duration
+}
+
+func (o HTTPProbeOptions) withDefaults() HTTPProbeOptions {
+	if o.Namespace == "" {
+		o.Namespace = TestNamespace()
+	}
+	if o.Pod == "" {
+		o.Pod = probePodName
+	}
+	if o.Container == "" {
+		o.Container = probeContainer
+	}
+	if o.Requests <= 0 {
+		o.Requests = 1
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = 2 * time.Second
+	}
+	return o
+}
+
+// HTTPProbeSample is the outcome of one request of HTTPProbeFromPod
+type HTTPProbeSample struct {
+	// StatusCode is 0 when no response came back, e.g. the connection was refused or timed out
+	StatusCode int
+	// Latency is curl's total time for the request, measured inside the pod
+	Latency time.Duration
+	// Body is the response body without surrounding whitespace
+	Body string
+}
+
+// HTTPProbeSamples are the samples of one HTTPProbeFromPod call, in the order of the requests
+type HTTPProbeSamples []HTTPProbeSample
+
+// StatusCodes counts the samples per status code, failed requests under 0
+func (s HTTPProbeSamples) StatusCodes() map[int]int {
+	codes := map[int]int{}
+	for _, sample := range s {
+		codes[sample.StatusCode]++
+	}
+	return codes
+}
+
+// Bodies counts the samples per response body, e.g. per track name the pods answer with
+func (s HTTPProbeSamples) Bodies() map[string]int {
+	bodies := map[string]int{}
+	for _, sample := range s {
+		if sample.StatusCode != 0 {
+			bodies[sample.Body]++
+		}
+	}
+	return bodies
+}
+
+// LatenciesMs returns the latencies of the requests that got a response, in milliseconds, for Percentile
+func (s HTTPProbeSamples) LatenciesMs() []float64 {
+	var latencies []float64
+	for _, sample := range s {
+		if sample.StatusCode != 0 {
+			latencies = append(latencies, float64(sample.Latency.Microseconds())/1000)
+		}
+	}
+	return latencies
+}
+
+// HTTPProbeFromPod sends requests to targetURL from inside the cluster and returns a sample per
+// request. The test runner doesn't need to reach the cluster network, so Service, Ingress and
+// NetworkPolicy assertions work from anywhere the API server is reachable. The requests run in
+// one exec, back to back or opts.Interval apart:
+//
+//	samples, err := example.HTTPProbeFromPod(ctx, config, clientset, "http://web.test-ns.svc", example.HTTPProbeOptions{Requests: 50})
+//	gomega.Expect(samples.StatusCodes()).To(gomega.Equal(map[int]int{200: 50}))
+//
+// Unless opts names an existing pod, the http-probe pod is launched on the first call and reused by
+// the following ones; ClearNamespace removes it with the rest of the TestNamespace. Failed requests are
+// samples, not errors: the error reports a probe pod that didn't start or an exec that failed.
+// Certificates of https URLs are not verified.
+func HTTPProbeFromPod(ctx context.Context, config *rest.Config, clientset *kubernetes.Clientset, targetURL string,
+	opts HTTPProbeOptions) (HTTPProbeSamples, error) {
+	opts = opts.withDefaults()
+	if err := ensureProbePod(ctx, clientset, opts); err != nil {
+		return nil, err
+	}
+
+	// The URL is passed as $1 so that it is never parsed by the shell
+	script := fmt.Sprintf(
+		"for i in $(seq 1 %d); do curl -k -s -m %g -w '\\n%s %%{http_code} %%{time_total}\\n' \"$1\"; [ $i -lt %d ] && sleep %g; done; true",
+		opts.Requests, opts.Timeout.Seconds(), probeMarker, opts.Requests, opts.Interval.Seconds())
+	stdout, stderr, err := ExecInPod(ctx, config, clientset, opts.Namespace, opts.Pod, opts.Container,
+		[]string{"sh", "-c", script, "http-probe", targetURL})
+	if err != nil {
+		return nil, fmt.Errorf("probe of %s from pod %s/%s failed: %w, stderr: %s", targetURL, opts.Namespace, opts.Pod,
+			err, stderr)
+	}
+
+	samples, err := parseProbeOutput(stdout)
+	if err != nil {
+		return nil, fmt.Errorf("probe of %s from pod %s/%s: %w", targetURL, opts.Namespace, opts.Pod, err)
+	}
+	if len(samples) != opts.Requests {
+		return samples, fmt.Errorf("probe of %s from pod %s/%s returned %d/%d samples, stderr: %s", targetURL,
+			opts.Namespace, opts.Pod, len(samples), opts.Requests, stderr)
+	}
+	return samples, nil
+}
+
+// parseProbeOutput splits the exec output into the responses, each followed by its marker line
+func parseProbeOutput(stdout string) (HTTPProbeSamples, error) {
+	var samples HTTPProbeSamples
+	var body []string
+	for _, line := range strings.Split(stdout, "\n") {
+		if !strings.HasPrefix(line, probeMarker+" ") {
+			body = append(body, line)
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, probeMarker))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected curl output %q", line)
+		}
+		statusCode, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected status code in %q: %w", line, err)
+		}
+		seconds, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected latency in %q: %w", line, err)
+		}
+		samples = append(samples, HTTPProbeSample{
+			StatusCode: statusCode,
+			Latency:    time.Duration(seconds * float64(time.Second)),
+			Body:       strings.TrimSpace(strings.Join(body, "\n")),
+		})
+		body = nil
+	}
+	return samples, nil
+}
+
+// ensureProbePod launches the probe pod unless it exists, and waits until it runs
+func ensureProbePod(ctx context.Context, clientset *kubernetes.Clientset, opts HTTPProbeOptions) error {
+	_, err := clientset.CoreV1().Pods(opts.Namespace).Get(ctx, opts.Pod, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = clientset.CoreV1().Pods(opts.Namespace).Create(ctx, probePod(opts), metav1.CreateOptions{FieldManager: "e2e-test"})
+		if apierrors.IsAlreadyExists(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("probe pod %s/%s setup failed: %w", opts.Namespace, opts.Pod, err)
+	}
+
+	var reason string
+	err = PollUntil(ctx, time.Second, Timeout(TimeoutPods, 2*time.Minute), func(ctx context.Context) (bool, error) {
+		pod, err := clientset.CoreV1().Pods(opts.Namespace).Get(ctx, opts.Pod, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		reason = podNotReadyReason(*pod)
+		return podReady(*pod), nil
+	})
+	if err != nil {
+		return fmt.Errorf("probe pod %s/%s not ready (%s): %w", opts.Namespace, opts.Pod, reason, err)
+	}
+	return nil
+}
+
+// probePod is a pod that idles until curl is exec'ed in it. It meets the restricted Pod Security
+// Standard, so it starts in namespaces that enforce it.
+func probePod(opts HTTPProbeOptions) *corev1.Pod {
+	gracePeriod := int64(1)
+	runAsNonRoot := true
+	// The image's user may be a name, which the kubelet can't check against runAsNonRoot
+	nobody := int64(65534)
+	allowPrivilegeEscalation := false
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      opts.Pod,
+			Namespace: opts.Namespace,
+			Labels:    map[string]string{"app": opts.Pod},
+		},
+		Spec: corev1.PodSpec{
+			TerminationGracePeriodSeconds: &gracePeriod,
+			SecurityContext: &corev1.PodSecurityContext{
+				RunAsNonRoot:   &runAsNonRoot,
+				RunAsUser:      &nobody,
+				SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			Containers: []corev1.Container{{
+				Name:    opts.Container,
+				Image:   ProbeImage(),
+				Command: []string{"sh", "-c", "trap 'exit 0' TERM; while true; do sleep 1; done"},
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{
+						corev1.ResourceCPU:    resource.MustParse("10m"),
+						corev1.ResourceMemory: resource.MustParse("16Mi"),
+					},
+				},
+				SecurityContext: &corev1.SecurityContext{
+					AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+					Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{"ALL"}},
+				},
+			}},
+		},
+	}
+}
@@ -0,0 +1,237 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Probe behavior E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("ProbeBehaviorTest"), func() {
+	var (
+		clientset     *kubernetes.Clientset
+		config        *rest.Config
+		readinessYAML []byte
+		livenessYAML  []byte
+		startupYAML   []byte
+		logger        zerolog.Logger
+		testTag       = "ProbeBehaviorTest"
+	)
+
+	const pollInterval = time.Second
+
+	execInPod := func(podName, command string) {
+		_, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), podName, "main",
+			[]string{"sh", "-c", command})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Command failed in %s: %s", podName, stderr)
+	}
+
+	waitForPodRunning := func(name string) *v1.Pod {
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if pod.Status.Phase == v1.PodRunning {
+				return pod
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s did not reach Running within %v", name, runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	// serviceEndpointReady reports whether the Service's EndpointSlices list the pod IP as ready
+	serviceEndpointReady := func(service, podIP string) bool {
+		endpoints, err := example.GetServiceEndpoints(context.TODO(), clientset, example.TestNamespace(), service)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		endpoint, _ := endpoints.Find(podIP)
+		return endpoint.Ready
+	}
+
+	// waitForEndpointReady waits until the pod's endpoint reaches the wanted readiness and returns how long it took
+	waitForEndpointReady := func(podIP string, ready bool, timeout time.Duration) time.Duration {
+		timeout = example.Timeout(example.TimeoutEndpoints, timeout)
+		start := time.Now()
+		for serviceEndpointReady("readiness-svc", podIP) != ready {
+			if time.Since(start) > timeout {
+				ginkgo.Fail(fmt.Sprintf("Endpoint %s did not become ready=%t within %v", podIP, ready, timeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		return time.Since(start)
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		readinessYAML, livenessYAML, startupYAML, err = example.GetProbesTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should remove a pod failing its readiness probe from the Service endpoints", func() {
+		logger.Info().Msgf("=== Starting Probe behavior E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying readiness Service and pod manifest ===")
+		err := example.ApplyRawManifest(clientset, readinessYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pod := waitForPodRunning("readiness-pod")
+		waitForEndpointReady(pod.Status.PodIP, true, 2*time.Minute)
+		logger.Info().Msgf("=== readiness-pod (%s) is a ready endpoint ===", pod.Status.PodIP)
+
+		logger.Info().Msgf("=== Failing the readiness probe ===")
+		execInPod("readiness-pod", "rm -f /tmp/ready")
+		removal := waitForEndpointReady(pod.Status.PodIP, false, time.Minute)
+		logger.Info().Msgf("=== Endpoint withdrawn after %v ===", removal.Round(time.Millisecond))
+		example.RecordMetric(testTag, "readiness_endpoint_removal_seconds", removal.Seconds())
+
+		logger.Info().Msgf("=== Restoring the readiness probe ===")
+		execInPod("readiness-pod", "touch /tmp/ready")
+		restore := waitForEndpointReady(pod.Status.PodIP, true, time.Minute)
+		logger.Info().Msgf("=== Endpoint ready again after %v ===", restore.Round(time.Millisecond))
+
+		// A failing readiness probe must never restart the container
+		pod, err = clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "readiness-pod", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pod.Status.ContainerStatuses[0].RestartCount).To(gomega.BeZero())
+	})
+
+	ginkgo.It("should restart a container failing its liveness probe", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying liveness pod manifest ===")
+		err := example.ApplyRawManifest(clientset, livenessYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pod := waitForPodRunning("liveness-pod")
+		initialRestarts := pod.Status.ContainerStatuses[0].RestartCount
+
+		logger.Info().Msgf("=== Failing the liveness probe (restartCount: %d) ===", initialRestarts)
+		execInPod("liveness-pod", "rm -f /tmp/healthy")
+		failedAt := time.Now()
+
+		restartTimeout := example.Timeout(example.TimeoutPods, 2*time.Minute)
+		deadline := failedAt.Add(restartTimeout)
+		for {
+			pod, err = clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "liveness-pod", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			status := pod.Status.ContainerStatuses[0]
+			if status.RestartCount > initialRestarts {
+				logger.Info().Msgf("=== Container restarted after %v (restartCount: %d) ===",
+					time.Since(failedAt).Round(time.Millisecond), status.RestartCount)
+				example.RecordMetric(testTag, "liveness_restart_seconds", time.Since(failedAt).Seconds())
+				gomega.Expect(status.LastTerminationState.Terminated).NotTo(gomega.BeNil())
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Container was not restarted within %v of failing its liveness probe", restartTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		// The restarted container recreates the file and must stay up
+		waitForPodRunning("liveness-pod")
+		time.Sleep(10 * time.Second)
+		pod, err = clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "liveness-pod", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pod.Status.ContainerStatuses[0].RestartCount).To(gomega.Equal(initialRestarts + 1))
+	})
+
+	ginkgo.It("should hold off liveness probes until the startup probe succeeds", func() {
+		defer example.E2ePanicHandler()
+
+		type podSpec struct {
+			Spec struct {
+				Containers []struct {
+					Env []struct {
+						Name  string `yaml:"name"`
+						Value string `yaml:"value"`
+					} `yaml:"env"`
+				} `yaml:"containers"`
+			} `yaml:"spec"`
+		}
+
+		var podConfig podSpec
+		err := yaml.Unmarshal(startupYAML, &podConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		var startupDelay time.Duration
+		for _, env := range podConfig.Spec.Containers[0].Env {
+			if env.Name == "STARTUP_DELAY_SECONDS" {
+				seconds, err := strconv.Atoi(env.Value)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				startupDelay = time.Duration(seconds) * time.Second
+			}
+		}
+		gomega.Expect(startupDelay).To(gomega.BeNumerically(">", 0), "Fixture has no STARTUP_DELAY_SECONDS")
+
+		logger.Info().Msgf("=== Applying startup pod manifest (startup delay: %v) ===", startupDelay)
+		err = example.ApplyRawManifest(clientset, startupYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		startTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(startTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "startup-pod", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			if len(pod.Status.ContainerStatuses) > 0 {
+				status := pod.Status.ContainerStatuses[0]
+				gomega.Expect(status.RestartCount).To(gomega.BeZero(), "Liveness probe restarted the container during startup")
+
+				if status.Started != nil && *status.Started && status.State.Running != nil {
+					startedAfter := time.Since(status.State.Running.StartedAt.Time)
+					logger.Info().Msgf("=== Startup probe succeeded %v after the container started ===", startedAfter.Round(time.Second))
+					gomega.Expect(startedAfter).To(gomega.BeNumerically(">=", startupDelay),
+						"Container was reported started before its startup delay")
+					break
+				}
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("startup-pod was not reported started within %v", startTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		// From now on the liveness probe runs and keeps succeeding
+		time.Sleep(10 * time.Second)
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "startup-pod", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pod.Status.ContainerStatuses[0].RestartCount).To(gomega.BeZero())
+	})
+
+})
@@ -0,0 +1,206 @@
+package example_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+// tokenClaims holds the JWT claims of a projected ServiceAccount token this suite checks
+type tokenClaims struct {
+	Audience   []string `json:"aud"`
+	Expiry     int64    `json:"exp"`
+	IssuedAt   int64    `json:"iat"`
+	Kubernetes struct {
+		Namespace string `json:"namespace"`
+		Pod       struct {
+			Name string `json:"name"`
+		} `json:"pod"`
+		ServiceAccount struct {
+			Name string `json:"name"`
+		} `json:"serviceaccount"`
+	} `json:"kubernetes.io"`
+}
+
+// decodeTokenClaims decodes the payload of a JWT without verifying its signature
+func decodeTokenClaims(token string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("token has %d parts, expected 3", len(parts))
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("token payload decoding failed: %w", err)
+	}
+	claims := &tokenClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, fmt.Errorf("token claims parsing failed: %w", err)
+	}
+	return claims, nil
+}
+
+var _ = ginkgo.Describe("ServiceAccount projected token E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("ProjectedTokenTest"), func() {
+	var (
+		clientset         *kubernetes.Clientset
+		config            *rest.Config
+		audience          string
+		expirationSeconds int64
+		firstToken        string
+		firstClaims       *tokenClaims
+		logger            zerolog.Logger
+		testTag           = "ProjectedTokenTest"
+	)
+
+	const pollInterval = 15 * time.Second
+
+	readToken := func() string {
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "token-reader", "main",
+			[]string{"cat", "/var/run/secrets/tokens/e2e-token"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Reading the token failed: %s", stderr)
+		return strings.TrimSpace(stdout)
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should mount a projected token with the requested audience and expiry", func() {
+		logger.Info().Msgf("=== Starting ServiceAccount projected token E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		podYAML, err := example.GetProjectedTokenTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		type podSpec struct {
+			Spec struct {
+				Volumes []struct {
+					Projected struct {
+						Sources []struct {
+							ServiceAccountToken struct {
+								Audience          string `yaml:"audience"`
+								ExpirationSeconds int64  `yaml:"expirationSeconds"`
+							} `yaml:"serviceAccountToken"`
+						} `yaml:"sources"`
+					} `yaml:"projected"`
+				} `yaml:"volumes"`
+			} `yaml:"spec"`
+		}
+
+		var podConfig podSpec
+		err = yaml.Unmarshal(podYAML, &podConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		tokenSource := podConfig.Spec.Volumes[0].Projected.Sources[0].ServiceAccountToken
+		audience = tokenSource.Audience
+		expirationSeconds = tokenSource.ExpirationSeconds
+
+		logger.Info().Msgf("=== Applying token reader pod (audience: %s, expirationSeconds: %d) ===", audience, expirationSeconds)
+		err = example.ApplyRawManifest(clientset, podYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "token-reader", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if pod.Status.Phase == v1.PodRunning {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("token-reader did not reach Running within %v", runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(3 * time.Second))
+		}
+
+		firstToken = readToken()
+		firstClaims, err = decodeTokenClaims(firstToken)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		issued := time.Unix(firstClaims.IssuedAt, 0)
+		expiry := time.Unix(firstClaims.Expiry, 0)
+		logger.Info().Msgf("=== Token aud: %v, issued: %s, expires: %s ===", firstClaims.Audience, issued.UTC(), expiry.UTC())
+
+		gomega.Expect(firstClaims.Audience).To(gomega.ConsistOf(audience))
+		gomega.Expect(firstClaims.Kubernetes.Namespace).To(gomega.Equal(example.TestNamespace()))
+		gomega.Expect(firstClaims.Kubernetes.Pod.Name).To(gomega.Equal("token-reader"))
+		gomega.Expect(firstClaims.Kubernetes.ServiceAccount.Name).To(gomega.Equal("default"))
+
+		// The API server may extend short lifetimes (--service-account-extend-token-expiration), but
+		// never shortens them below the requested expirationSeconds
+		lifetime := firstClaims.Expiry - firstClaims.IssuedAt
+		gomega.Expect(lifetime).To(gomega.BeNumerically(">=", expirationSeconds),
+			"Token lifetime %ds is shorter than the requested %ds", lifetime, expirationSeconds)
+		example.RecordMetric(testTag, "token_lifetime_seconds", lifetime)
+	})
+
+	ginkgo.It("should rotate the token before it expires", func() {
+		defer example.E2ePanicHandler()
+
+		// The kubelet refreshes the token once it is older than 80% of expirationSeconds, which is
+		// measured against the requested value even when the API server extended the lifetime
+		issued := time.Unix(firstClaims.IssuedAt, 0)
+		refreshDue := issued.Add(time.Duration(expirationSeconds*8/10) * time.Second)
+		expiry := time.Unix(firstClaims.Expiry, 0)
+		logger.Info().Msgf("=== Waiting for rotation, due around %s, token expires %s ===", refreshDue.UTC(), expiry.UTC())
+
+		for {
+			token := readToken()
+			if token != firstToken {
+				rotatedAt := time.Now()
+				claims, err := decodeTokenClaims(token)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+				logger.Info().Msgf("=== Token rotated %v after issue, %v before expiry ===",
+					rotatedAt.Sub(issued).Round(time.Second), expiry.Sub(rotatedAt).Round(time.Second))
+				example.RecordMetric(testTag, "rotation_after_issue_seconds", rotatedAt.Sub(issued).Seconds())
+
+				gomega.Expect(rotatedAt.Before(expiry)).To(gomega.BeTrue(), "Token was rotated only after it expired")
+				gomega.Expect(claims.IssuedAt).To(gomega.BeNumerically(">", firstClaims.IssuedAt))
+				gomega.Expect(claims.Expiry).To(gomega.BeNumerically(">", firstClaims.Expiry))
+				gomega.Expect(claims.Audience).To(gomega.ConsistOf(audience))
+				return
+			}
+
+			if time.Now().After(expiry) {
+				ginkgo.Fail(fmt.Sprintf("Token was not rotated before it expired at %s", expiry.UTC()))
+			}
+			logger.Info().Msgf("Token not rotated yet, %v until refresh is due\n", time.Until(refreshDue).Round(time.Second))
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	})
+
+})
@@ -0,0 +1,176 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("ConfigMap and Secret propagation E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("ConfigPropagationTest"), func() {
+	var (
+		clientset  *kubernetes.Clientset
+		config     *rest.Config
+		threshold  time.Duration
+		initialEnv map[string]string
+		logger     zerolog.Logger
+		testTag    = "ConfigPropagationTest"
+	)
+
+	const (
+		// The kubelet refreshes mounted ConfigMaps and Secrets on its periodic pod sync (1 minute by
+		// default) plus the propagation delay of its cache. Overridable with PROPAGATION_THRESHOLD_SECONDS in .env
+		defaultThresholdSeconds = 120
+		pollInterval            = time.Second
+	)
+
+	readInPod := func(command string) string {
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "propagation-reader", "main",
+			[]string{"sh", "-c", command})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Command failed: %s", stderr)
+		return strings.TrimSpace(stdout)
+	}
+
+	// waitForFileContent polls the mounted file until it holds the expected value and returns how long it took
+	waitForFileContent := func(path, expected string, since time.Time) time.Duration {
+		deadline := since.Add(threshold)
+		for {
+			content := readInPod("cat " + path)
+			if content == expected {
+				return time.Since(since)
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("%s still holds %q after %v, expected %q", path, content, threshold, expected))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		threshold = defaultThresholdSeconds * time.Second
+		if value := os.Getenv("PROPAGATION_THRESHOLD_SECONDS"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid PROPAGATION_THRESHOLD_SECONDS: %s", value)
+			threshold = time.Duration(seconds) * time.Second
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should expose the ConfigMap and Secret as volumes and env", func() {
+		logger.Info().Msgf("=== Starting ConfigMap and Secret propagation E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		configYAML, podYAML, err := example.GetPropagationTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying ConfigMap and Secret manifest ===")
+		err = example.ApplyRawManifest(clientset, configYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying reader pod manifest ===")
+		err = example.ApplyRawManifest(clientset, podYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "propagation-reader", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if pod.Status.Phase == v1.PodRunning {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("propagation-reader did not reach Running within %v", runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(3 * time.Second))
+		}
+
+		initialEnv = map[string]string{
+			"CONFIG_MESSAGE":  readInPod("printenv CONFIG_MESSAGE"),
+			"SECRET_PASSWORD": readInPod("printenv SECRET_PASSWORD"),
+		}
+		gomega.Expect(initialEnv["CONFIG_MESSAGE"]).To(gomega.Equal("config-v1"))
+		gomega.Expect(initialEnv["SECRET_PASSWORD"]).To(gomega.Equal("secret-v1"))
+		gomega.Expect(readInPod("cat /etc/config/message")).To(gomega.Equal("config-v1"))
+		gomega.Expect(readInPod("cat /etc/secret/password")).To(gomega.Equal("secret-v1"))
+	})
+
+	ginkgo.It("should refresh the mounted ConfigMap within the kubelet sync period", func() {
+		defer example.E2ePanicHandler()
+
+		configMap, err := clientset.CoreV1().ConfigMaps(example.TestNamespace()).Get(context.TODO(), "propagation-config", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		configMap.Data["message"] = "config-v2"
+
+		logger.Info().Msgf("=== Updating ConfigMap ===")
+		_, err = clientset.CoreV1().ConfigMaps(example.TestNamespace()).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		updatedAt := time.Now()
+
+		latency := waitForFileContent("/etc/config/message", "config-v2", updatedAt)
+		logger.Info().Msgf("=== ConfigMap volume refreshed after %v (threshold %v) ===", latency.Round(time.Millisecond), threshold)
+		example.RecordMetric(testTag, "configmap_propagation_seconds", latency.Seconds())
+	})
+
+	ginkgo.It("should refresh the mounted Secret within the kubelet sync period", func() {
+		defer example.E2ePanicHandler()
+
+		secret, err := clientset.CoreV1().Secrets(example.TestNamespace()).Get(context.TODO(), "propagation-secret", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		secret.Data["password"] = []byte("secret-v2")
+
+		logger.Info().Msgf("=== Updating Secret ===")
+		_, err = clientset.CoreV1().Secrets(example.TestNamespace()).Update(context.TODO(), secret, metav1.UpdateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		updatedAt := time.Now()
+
+		latency := waitForFileContent("/etc/secret/password", "secret-v2", updatedAt)
+		logger.Info().Msgf("=== Secret volume refreshed after %v (threshold %v) ===", latency.Round(time.Millisecond), threshold)
+		example.RecordMetric(testTag, "secret_propagation_seconds", latency.Seconds())
+	})
+
+	ginkgo.It("should keep environment variables at their startup values", func() {
+		defer example.E2ePanicHandler()
+
+		for name, value := range initialEnv {
+			current := readInPod("printenv " + name)
+			logger.Info().Msgf("%s: %q (at startup: %q)\n", name, current, value)
+			gomega.Expect(current).To(gomega.Equal(value), "Environment variable %s changed in a running container", name)
+		}
+	})
+
+})
@@ -0,0 +1,125 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Pod Security Admission E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("PodSecurityAdmissionTest"), func() {
+	var (
+		clientset      *kubernetes.Clientset
+		privilegedYAML []byte
+		hostPathYAML   []byte
+		compliantYAML  []byte
+		logger         zerolog.Logger
+		testTag        = "PodSecurityAdmissionTest"
+	)
+
+	psaNamespace := example.TestNamespaced("test-ns-psa")
+
+	psaLabels := map[string]string{
+		"pod-security.kubernetes.io/enforce":         "restricted",
+		"pod-security.kubernetes.io/enforce-version": "latest",
+	}
+
+	// createPod submits the fixture pod and returns the admission error, if any
+	createPod := func(podYAML []byte) (string, error) {
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(podYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		_, err = clientset.CoreV1().Pods(psaNamespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+		return pod.Name, err
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		// Namespace setup, enforcing the restricted Pod Security Standard
+		err = example.NewNamespaceManager(logger, clientset, psaNamespace, psaLabels).Ensure(context.TODO(), time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		privilegedYAML, hostPathYAML, compliantYAML, err = example.GetPodSecurityTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespaceByName(logger, clientset, psaNamespace)
+	})
+
+	ginkgo.It("should reject a privileged pod", func() {
+		logger.Info().Msgf("=== Starting Pod Security Admission E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		name, err := createPod(privilegedYAML)
+		gomega.Expect(err).To(gomega.HaveOccurred(), "Privileged pod %s was admitted", name)
+		logger.Info().Msgf("=== Privileged pod rejected: %v ===", err)
+
+		gomega.Expect(apierrors.IsForbidden(err)).To(gomega.BeTrue(), "Unexpected error type: %v", err)
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring(`violates PodSecurity "restricted:latest"`))
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("privileged"))
+	})
+
+	ginkgo.It("should reject a pod with a hostPath volume", func() {
+		defer example.E2ePanicHandler()
+
+		name, err := createPod(hostPathYAML)
+		gomega.Expect(err).To(gomega.HaveOccurred(), "hostPath pod %s was admitted", name)
+		logger.Info().Msgf("=== hostPath pod rejected: %v ===", err)
+
+		gomega.Expect(apierrors.IsForbidden(err)).To(gomega.BeTrue(), "Unexpected error type: %v", err)
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring(`violates PodSecurity "restricted:latest"`))
+		gomega.Expect(err.Error()).To(gomega.ContainSubstring("hostPath"))
+	})
+
+	ginkgo.It("should admit and run a pod that meets the restricted standard", func() {
+		defer example.E2ePanicHandler()
+
+		name, err := createPod(compliantYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Compliant pod was rejected")
+
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(psaNamespace).Get(context.TODO(), name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if pod.Status.Phase == v1.PodRunning {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Compliant pod did not reach Running within %v", runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(3 * time.Second))
+		}
+		logger.Info().Msgf("=== Compliant pod %s is running ===", name)
+	})
+
+})
@@ -0,0 +1,278 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("PVC and StorageClass E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("PVCStorageClassTest"), func() {
+	var (
+		clientset           *kubernetes.Clientset
+		config              *rest.Config
+		defaultStorageClass string
+		pvName              string
+		logger              zerolog.Logger
+		testTag             = "PVCStorageClassTest"
+	)
+
+	const (
+		defaultClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+		probeContent           = "written-by-pvc-writer"
+		pollInterval           = 3 * time.Second
+	)
+
+	// waitForPodRunning covers binding and attaching the volume as well, so it follows the volume timeout
+	waitForPodRunning := func(name string, timeout time.Duration) {
+		timeout = example.Timeout(example.TimeoutVolume, timeout)
+		deadline := time.Now().Add(timeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			if pod.Status.Phase == v1.PodRunning {
+				logger.Info().Msgf("Pod %s is running on node %s\n", name, pod.Spec.NodeName)
+				return
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s did not reach Running within %v (phase: %s)", name, timeout, pod.Status.Phase))
+			}
+
+			logger.Info().Msgf("Waiting for pod %s, phase: %s\n", name, pod.Status.Phase)
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	waitForPodDeleted := func(name string, timeout time.Duration) {
+		timeout = example.Timeout(example.TimeoutPods, timeout)
+		deadline := time.Now().Add(timeout)
+		for {
+			_, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				return
+			}
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s was not deleted within %v", name, timeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+
+		// PVs with a Retain policy outlive the namespace, don't leave them behind after a failed run
+		if pvName != "" {
+			err := clientset.CoreV1().PersistentVolumes().Delete(context.TODO(), pvName, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				logger.Error().Msgf("Failed to delete PersistentVolume %s: %v", pvName, err)
+			}
+		}
+	})
+
+	ginkgo.It("should bind a PVC against the default StorageClass", func() {
+		logger.Info().Msgf("=== Starting PVC and StorageClass E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		storageClasses, err := clientset.StorageV1().StorageClasses().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, sc := range storageClasses.Items {
+			if sc.Annotations[defaultClassAnnotation] == "true" {
+				defaultStorageClass = sc.Name
+				logger.Info().Msgf("=== Default StorageClass: %s (provisioner: %s) ===", sc.Name, sc.Provisioner)
+			}
+		}
+		if defaultStorageClass == "" {
+			ginkgo.Skip("Cluster has no default StorageClass")
+		}
+
+		pvcYAML, writerYAML, _, _, err := example.GetPVCTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying PVC manifest ===")
+		err = example.ApplyRawManifest(clientset, pvcYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Classes with WaitForFirstConsumer only bind once a pod using the claim is scheduled
+		logger.Info().Msgf("=== Applying writer pod manifest ===")
+		err = example.ApplyRawManifest(clientset, writerYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		waitForPodRunning("pvc-writer", 5*time.Minute)
+
+		pvc, err := clientset.CoreV1().PersistentVolumeClaims(example.TestNamespace()).Get(context.TODO(), "data-pvc", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== PVC phase: %s, volume: %s ===", pvc.Status.Phase, pvc.Spec.VolumeName)
+
+		gomega.Expect(pvc.Status.Phase).To(gomega.Equal(v1.ClaimBound))
+		gomega.Expect(pvc.Spec.StorageClassName).NotTo(gomega.BeNil())
+		gomega.Expect(*pvc.Spec.StorageClassName).To(gomega.Equal(defaultStorageClass),
+			"PVC was not assigned the default StorageClass")
+		pvName = pvc.Spec.VolumeName
+
+		pv, err := clientset.CoreV1().PersistentVolumes().Get(context.TODO(), pvName, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pv.Spec.ClaimRef).NotTo(gomega.BeNil())
+		gomega.Expect(pv.Spec.ClaimRef.Name).To(gomega.Equal("data-pvc"))
+	})
+
+	ginkgo.It("should persist data written through the mount across pods", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Writing probe file through the mount ===")
+		_, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "pvc-writer", "main",
+			[]string{"sh", "-c", fmt.Sprintf("echo %s > /data/probe && sync", probeContent)})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Write failed: %s", stderr)
+
+		logger.Info().Msgf("=== Replacing writer pod with reader pod ===")
+		err = clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), "pvc-writer", metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		waitForPodDeleted("pvc-writer", 2*time.Minute)
+
+		_, _, readerYAML, _, err := example.GetPVCTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.ApplyRawManifest(clientset, readerYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		waitForPodRunning("pvc-reader", 5*time.Minute)
+
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "pvc-reader", "main",
+			[]string{"cat", "/data/probe"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Read failed: %s", stderr)
+		logger.Info().Msgf("=== Reader pod read: %s ===", strings.TrimSpace(stdout))
+		gomega.Expect(strings.TrimSpace(stdout)).To(gomega.Equal(probeContent))
+	})
+
+	ginkgo.It("should not run a second pod on another node with a ReadWriteOnce claim", func() {
+		defer example.E2ePanicHandler()
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		schedulable := 0
+		for _, node := range nodes.Items {
+			if !node.Spec.Unschedulable {
+				schedulable++
+			}
+		}
+		if schedulable < 2 {
+			ginkgo.Skip("ReadWriteOnce enforcement across nodes needs at least 2 schedulable nodes")
+		}
+
+		_, _, _, conflictYAML, err := example.GetPVCTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying conflicting pod on a different node ===")
+		err = example.ApplyRawManifest(clientset, conflictYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The pod either can't be scheduled (node-bound volume) or can't attach (Multi-Attach), it must never run
+		observeFor := 60 * time.Second
+		deadline := time.Now().Add(observeFor)
+		for time.Now().Before(deadline) {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "pvc-conflict", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			logger.Info().Msgf("Conflicting pod phase: %s, node: %q\n", pod.Status.Phase, pod.Spec.NodeName)
+			gomega.Expect(pod.Status.Phase).NotTo(gomega.Equal(v1.PodRunning),
+				"A second pod on another node is running with the ReadWriteOnce volume")
+
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		events, err := clientset.CoreV1().Events(example.TestNamespace()).List(context.TODO(), metav1.ListOptions{
+			FieldSelector: "involvedObject.name=pvc-conflict",
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, event := range events.Items {
+			logger.Info().Msgf("Event %s: %s\n", event.Reason, event.Message)
+		}
+
+		err = clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), "pvc-conflict", metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should reclaim the volume according to its reclaim policy", func() {
+		defer example.E2ePanicHandler()
+
+		gomega.Expect(pvName).NotTo(gomega.BeEmpty(), "No bound PersistentVolume recorded")
+		pv, err := clientset.CoreV1().PersistentVolumes().Get(context.TODO(), pvName, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		reclaimPolicy := pv.Spec.PersistentVolumeReclaimPolicy
+		logger.Info().Msgf("=== PersistentVolume %s reclaim policy: %s ===", pvName, reclaimPolicy)
+
+		// The claim stays in use (and protected by its finalizer) until every pod mounting it is gone
+		for _, name := range []string{"pvc-reader", "pvc-conflict"} {
+			err := clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			waitForPodDeleted(name, 2*time.Minute)
+		}
+
+		logger.Info().Msgf("=== Deleting PVC ===")
+		err = clientset.CoreV1().PersistentVolumeClaims(example.TestNamespace()).Delete(context.TODO(), "data-pvc", metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		reclaimTimeout := example.Timeout(example.TimeoutVolume, 3*time.Minute)
+		deadline := time.Now().Add(reclaimTimeout)
+		for {
+			pv, err := clientset.CoreV1().PersistentVolumes().Get(context.TODO(), pvName, metav1.GetOptions{})
+
+			switch reclaimPolicy {
+			case v1.PersistentVolumeReclaimDelete:
+				if apierrors.IsNotFound(err) {
+					logger.Info().Msgf("=== PersistentVolume %s was deleted ===", pvName)
+					pvName = ""
+					return
+				}
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			default:
+				gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Retained PersistentVolume disappeared")
+				if pv.Status.Phase == v1.VolumeReleased {
+					logger.Info().Msgf("=== PersistentVolume %s was released and retained ===", pvName)
+					return
+				}
+			}
+
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("PersistentVolume %s was not reclaimed per policy %s within %v", pvName, reclaimPolicy, reclaimTimeout))
+			}
+
+			logger.Info().Msgf("Waiting for PersistentVolume %s to be reclaimed, phase: %s\n", pvName, pv.Status.Phase)
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	})
+
+})
@@ -0,0 +1,176 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+// rbacPermission is one row of the expected policy matrix in rbac_test_yamls
+type rbacPermission struct {
+	Verb        string `yaml:"verb"`
+	Group       string `yaml:"group"`
+	Resource    string `yaml:"resource"`
+	Subresource string `yaml:"subresource"`
+	Namespace   string `yaml:"namespace"`
+	Name        string `yaml:"name"`
+	Allowed     bool   `yaml:"allowed"`
+}
+
+func (p rbacPermission) String() string {
+	resource := p.Resource
+	if p.Subresource != "" {
+		resource += "/" + p.Subresource
+	}
+	if p.Group != "" {
+		resource += "." + p.Group
+	}
+	if p.Name != "" {
+		resource += " " + p.Name
+	}
+	if p.Namespace == "" {
+		return fmt.Sprintf("%s %s (cluster-wide)", p.Verb, resource)
+	}
+	return fmt.Sprintf("%s %s in %s", p.Verb, resource, p.Namespace)
+}
+
+func (p rbacPermission) resourceAttributes() *authorizationv1.ResourceAttributes {
+	return &authorizationv1.ResourceAttributes{
+		Verb:        p.Verb,
+		Group:       p.Group,
+		Resource:    p.Resource,
+		Subresource: p.Subresource,
+		Namespace:   p.Namespace,
+		Name:        p.Name,
+	}
+}
+
+var _ = ginkgo.Describe("RBAC verification E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("RBACVerificationTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		matrix    struct {
+			ServiceAccount string           `yaml:"serviceAccount"`
+			Permissions    []rbacPermission `yaml:"permissions"`
+		}
+		logger  zerolog.Logger
+		testTag = "RBACVerificationTest"
+	)
+
+	// reportDiff logs every mismatch between the matrix and the observed decisions, records them in
+	// the final report and fails the spec if there are any
+	reportDiff := func(metric string, mismatches []string) {
+		example.RecordMetric(testTag, metric, mismatches)
+		if len(mismatches) == 0 {
+			logger.Info().Msgf("=== All permissions match the expected matrix ===")
+			return
+		}
+		for _, line := range mismatches {
+			logger.Error().Msgf("%s", line)
+		}
+		ginkgo.Fail(fmt.Sprintf("%d permissions differ from the expected matrix:\n%s", len(mismatches), strings.Join(mismatches, "\n")))
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		permissionsYAML, err := example.GetRBACTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = yaml.Unmarshal(permissionsYAML, &matrix)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(matrix.Permissions).NotTo(gomega.BeEmpty())
+
+		// The ServiceAccount can be overridden for clusters that run the tests under another identity
+		if serviceAccount := os.Getenv("RBAC_SERVICE_ACCOUNT"); serviceAccount != "" {
+			matrix.ServiceAccount = serviceAccount
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.It("should allow the current identity everything the suites need", func() {
+		logger.Info().Msgf("=== Starting RBAC verification E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		// The current identity may be a cluster admin, so only the expected allows are enforced here
+		var mismatches []string
+		for _, permission := range matrix.Permissions {
+			review := &authorizationv1.SelfSubjectAccessReview{
+				Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+					ResourceAttributes: permission.resourceAttributes(),
+				},
+			}
+			result, err := clientset.AuthorizationV1().SelfSubjectAccessReviews().Create(context.TODO(), review, metav1.CreateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			logger.Info().Msgf("self: %-60s allowed: %t\n", permission.String(), result.Status.Allowed)
+			if permission.Allowed && !result.Status.Allowed {
+				mismatches = append(mismatches, fmt.Sprintf("- unexpected deny: %s", permission))
+			}
+		}
+		reportDiff("self_unexpected_denies", mismatches)
+	})
+
+	ginkgo.It("should grant the test ServiceAccount exactly the expected permissions", func() {
+		defer example.E2ePanicHandler()
+
+		parts := strings.SplitN(matrix.ServiceAccount, "/", 2)
+		gomega.Expect(parts).To(gomega.HaveLen(2), "serviceAccount must be <namespace>/<name>, got %q", matrix.ServiceAccount)
+		_, err := clientset.CoreV1().ServiceAccounts(parts[0]).Get(context.TODO(), parts[1], metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			ginkgo.Skip(fmt.Sprintf("ServiceAccount %s does not exist in this cluster", matrix.ServiceAccount))
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		user := fmt.Sprintf("system:serviceaccount:%s:%s", parts[0], parts[1])
+		groups := []string{"system:serviceaccounts", "system:serviceaccounts:" + parts[0], "system:authenticated"}
+		logger.Info().Msgf("=== Reviewing permissions of %s ===", user)
+
+		var mismatches []string
+		for _, permission := range matrix.Permissions {
+			review := &authorizationv1.SubjectAccessReview{
+				Spec: authorizationv1.SubjectAccessReviewSpec{
+					ResourceAttributes: permission.resourceAttributes(),
+					User:               user,
+					Groups:             groups,
+				},
+			}
+			result, err := clientset.AuthorizationV1().SubjectAccessReviews().Create(context.TODO(), review, metav1.CreateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			logger.Info().Msgf("%s: %-60s allowed: %t\n", parts[1], permission.String(), result.Status.Allowed)
+			switch {
+			case permission.Allowed && !result.Status.Allowed:
+				mismatches = append(mismatches, fmt.Sprintf("- unexpected deny: %s", permission))
+			case !permission.Allowed && result.Status.Allowed:
+				mismatches = append(mismatches, fmt.Sprintf("+ unexpected allow: %s (%s)", permission, result.Status.Reason))
+			}
+		}
+		reportDiff("service_account_permission_diff", mismatches)
+	})
+
+})
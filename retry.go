@@ -0,0 +1,115 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilnet "k8s.io/apimachinery/pkg/util/net"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// RetryPolicy configures Retry. The backoff starts at InitialBackoff and is multiplied by Multiplier
+// after every failed attempt, up to MaxBackoff, each wait varied by up to Jitter times itself.
+type RetryPolicy struct {
+	// Attempts in total, including the first one
+	Attempts       int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	Jitter         float64
+	// Decides whether an error is worth another attempt, IsRetryableError when nil
+	Retryable func(err error) bool
+}
+
+// DefaultRetryPolicy rides out an API server restart or a short overload: 5 attempts within about 8
+// seconds
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:       5,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     4 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// terminalError marks an error Retry must not retry, whatever the policy thinks of it
+type terminalError struct {
+	err error
+}
+
+func (e terminalError) Error() string { return e.err.Error() }
+func (e terminalError) Unwrap() error { return e.err }
+
+// Terminal wraps an error so Retry returns it at once
+func Terminal(err error) error {
+	if err == nil {
+		return nil
+	}
+	return terminalError{err: err}
+}
+
+// IsRetryableError reports whether err is a transient API or connection error: a server or client
+// timeout, throttling, an internal error or unavailable server, or a reset, refused or cut off
+// connection. Errors about the request itself, like NotFound, Conflict or Invalid, are terminal.
+func IsRetryableError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var terminal terminalError
+	if errors.As(err, &terminal) {
+		return false
+	}
+	if apierrors.IsServerTimeout(err) || apierrors.IsTimeout(err) || apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) || apierrors.IsServiceUnavailable(err) || apierrors.IsUnexpectedServerError(err) {
+		return true
+	}
+	if utilnet.IsConnectionReset(err) || utilnet.IsConnectionRefused(err) || utilnet.IsProbableEOF(err) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Retry calls fn until it succeeds, returns an error the policy doesn't consider retryable, the
+// attempts are used up or ctx ends, backing off between attempts. The last error is returned, wrapped
+// with the attempt count when the attempts ran out.
+func Retry(ctx context.Context, policy RetryPolicy, fn func(ctx context.Context) error) error {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryableError
+	}
+	backoff := wait.Backoff{
+		Duration: policy.InitialBackoff,
+		Factor:   policy.Multiplier,
+		Jitter:   policy.Jitter,
+		Steps:    policy.Attempts,
+		Cap:      policy.MaxBackoff,
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			return nil
+		}
+		var terminal terminalError
+		if errors.As(err, &terminal) {
+			return terminal.err
+		}
+		if !retryable(err) {
+			return err
+		}
+		if attempt >= policy.Attempts {
+			return fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last error: %v", ctx.Err(), err)
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// StatefulSetRevisions are the revisions a StatefulSet's controller reports and the revision each of
+// its pods runs. Suites assert on these rather than on images, which two revisions may share.
+type StatefulSetRevisions struct {
+	// CurrentRevision is the revision of the pods below the partition, UpdateRevision the one the
+	// controller rolls out. They are equal once a rollout is complete.
+	CurrentRevision string
+	UpdateRevision  string
+	// Observed is false while the controller has not caught up with the current spec, the
+	// revisions are then those of the previous one
+	Observed bool
+	// Pods maps the name of every pod to the revision in its controller-revision-hash label
+	Pods map[string]string
+}
+
+// PodsAt returns the names of the pods running the revision, by ordinal
+func (r *StatefulSetRevisions) PodsAt(revision string) []string {
+	var pods []string
+	for pod, podRevision := range r.Pods {
+		if podRevision == revision {
+			pods = append(pods, pod)
+		}
+	}
+	sort.Slice(pods, func(i, j int) bool { return podOrdinal(pods[i]) < podOrdinal(pods[j]) })
+	return pods
+}
+
+func (r *StatefulSetRevisions) String() string {
+	updated := r.PodsAt(r.UpdateRevision)
+	status := fmt.Sprintf("current revision %s, update revision %s, %d/%d pods updated %v", r.CurrentRevision,
+		r.UpdateRevision, len(updated), len(r.Pods), updated)
+	if !r.Observed {
+		status += " (spec not observed yet)"
+	}
+	return status
+}
+
+// podOrdinal returns the ordinal a StatefulSet pod's name ends with, -1 for other names
+func podOrdinal(pod string) int {
+	ordinal, err := strconv.Atoi(pod[strings.LastIndex(pod, "-")+1:])
+	if err != nil {
+		return -1
+	}
+	return ordinal
+}
+
+// GetStatefulSetRevisions reads the StatefulSet's revisions and those of its pods. Pods that are being
+// deleted are left out, their replacements may run another revision.
+func GetStatefulSetRevisions(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) (*StatefulSetRevisions, error) {
+	statefulSet, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("statefulset %s/%s lookup failed: %w", namespace, name, err)
+	}
+	selector, err := metav1.LabelSelectorAsSelector(statefulSet.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("statefulset %s/%s selector: %w", namespace, name, err)
+	}
+	pods, err := ListPods(ctx, clientset, namespace, metav1.ListOptions{LabelSelector: selector.String()})
+	if err != nil {
+		return nil, fmt.Errorf("pods of statefulset %s/%s listing failed: %w", namespace, name, err)
+	}
+
+	revisions := &StatefulSetRevisions{
+		CurrentRevision: statefulSet.Status.CurrentRevision,
+		UpdateRevision:  statefulSet.Status.UpdateRevision,
+		Observed:        statefulSet.Status.ObservedGeneration >= statefulSet.Generation,
+		Pods:            map[string]string{},
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || !metav1.IsControlledBy(&pod, statefulSet) {
+			continue
+		}
+		revisions.Pods[pod.Name] = pod.Labels[appsv1.ControllerRevisionHashLabelKey]
+	}
+	return revisions, nil
+}
+
+// WaitForStatefulSetRevisions polls the StatefulSet until the controller has observed its current spec
+// and the condition holds for its revisions, and returns them. On timeout the error carries the last
+// revisions seen.
+//
+//	// Wait until only the pod at the partition ordinal 2 runs the update revision
+//	example.WaitForStatefulSetRevisions(ctx, clientset, "test-ns", "web", 3*time.Minute, func(r *example.StatefulSetRevisions) bool {
+//		return r.CurrentRevision != r.UpdateRevision && reflect.DeepEqual(r.PodsAt(r.UpdateRevision), []string{"web-2"})
+//	})
+func WaitForStatefulSetRevisions(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string,
+	timeout time.Duration, condition func(revisions *StatefulSetRevisions) bool) (*StatefulSetRevisions, error) {
+	timeout = Timeout(TimeoutRollout, timeout)
+	var last *StatefulSetRevisions
+	err := PollUntil(ctx, 2*time.Second, timeout, func(ctx context.Context) (bool, error) {
+		revisions, err := GetStatefulSetRevisions(ctx, clientset, namespace, name)
+		if err != nil {
+			return false, err
+		}
+		last = revisions
+		return revisions.Observed && condition(revisions), nil
+	})
+	if err != nil {
+		if last == nil {
+			return nil, fmt.Errorf("statefulset %s/%s: %w", namespace, name, err)
+		}
+		return last, fmt.Errorf("statefulset %s/%s: %s: %w", namespace, name, last, err)
+	}
+	return last, nil
+}
+
+// SetStatefulSetPartition sets the partition of the StatefulSet's RollingUpdate strategy: only pods
+// with an ordinal at or above it are updated, the others keep running the current revision. A
+// partition of 0 rolls out to every pod.
+func SetStatefulSetPartition(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, partition int32) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"updateStrategy":{"type":"RollingUpdate","rollingUpdate":{"partition":%d}}}}`, partition))
+	_, err := clientset.AppsV1().StatefulSets(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("statefulset %s/%s setting partition to %d failed: %w", namespace, name, partition, err)
+	}
+	return nil
+}
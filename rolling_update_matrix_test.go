@@ -0,0 +1,170 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Rolling update strategy matrix E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("RollingUpdateMatrixTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		logger    zerolog.Logger
+		testTag   = "RollingUpdateMatrixTest"
+	)
+
+	const pollInterval = 500 * time.Millisecond
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		logger.Info().Msgf("=== Starting Rolling update strategy matrix E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	// countPods returns the deployment's pods that are not terminating and how many of them are ready
+	countPods := func(name string) (total, ready int32) {
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{
+			LabelSelector: "app=" + name,
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, pod := range pods {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			total++
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+					ready++
+				}
+			}
+		}
+		return total, ready
+	}
+
+	ginkgo.DescribeTable("should keep pod counts within the strategy bounds during a rolling update",
+		func(maxSurge, maxUnavailable string) {
+			defer example.E2ePanicHandler()
+
+			combination := strings.ReplaceAll(fmt.Sprintf("rollout-s%s-u%s", maxSurge, maxUnavailable), "%", "pct")
+			// The object name carries the run ID, the metric names stay comparable across runs
+			name := example.UniqueName(combination)
+
+			logger.Info().Msgf("=== Creating deployment %s (maxSurge: %s, maxUnavailable: %s) ===", name, maxSurge, maxUnavailable)
+			err := example.NewDeployment(name).
+				WithReplicas(4).
+				WithRollingUpdate(maxSurge, maxUnavailable).
+				// A short readiness delay keeps new pods unavailable long enough for the bounds to matter
+				WithReadinessDelay(3*time.Second).
+				Create(context.TODO(), clientset)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			defer func() {
+				err := clientset.AppsV1().Deployments(example.TestNamespace()).Delete(context.TODO(), name, metav1.DeleteOptions{})
+				if err != nil && !apierrors.IsNotFound(err) {
+					logger.Error().Msgf("Failed to delete deployment %s: %v", name, err)
+				}
+			}()
+			err = example.WaitForRollout(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), name, 3*time.Minute)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			// Same rounding as the deployment controller: surge rounds up, unavailable rounds down
+			deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			replicas := int(*deployment.Spec.Replicas)
+			surgeValue := intstr.Parse(maxSurge)
+			surge, err := intstr.GetScaledValueFromIntOrPercent(&surgeValue, replicas, true)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			unavailableValue := intstr.Parse(maxUnavailable)
+			unavailable, err := intstr.GetScaledValueFromIntOrPercent(&unavailableValue, replicas, false)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			maxPods := int32(replicas + surge)
+			minReady := int32(replicas - unavailable)
+			logger.Info().Msgf("=== Bounds for %d replicas: at most %d pods, at least %d ready ===", replicas, maxPods, minReady)
+
+			logger.Info().Msgf("=== Triggering rolling update ===")
+			err = example.TriggerRollingUpdate(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), name,
+				func(template *v1.PodTemplateSpec) {
+					if template.Annotations == nil {
+						template.Annotations = map[string]string{}
+					}
+					template.Annotations["e2e.test/revision"] = "2"
+				})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			startedAt := time.Now()
+
+			observedMaxPods, observedMinReady := int32(0), int32(replicas)
+			checks := 0
+			rolloutTimeout := example.Timeout(example.TimeoutRollout, 5*time.Minute)
+			deadline := startedAt.Add(rolloutTimeout)
+			for {
+				total, ready := countPods(name)
+				checks++
+				if total > observedMaxPods {
+					observedMaxPods = total
+				}
+				if ready < observedMinReady {
+					observedMinReady = ready
+				}
+				gomega.Expect(total).To(gomega.BeNumerically("<=", maxPods),
+					"Check %d: %d pods exceed replicas+maxSurge (%d)", checks, total, maxPods)
+				gomega.Expect(ready).To(gomega.BeNumerically(">=", minReady),
+					"Check %d: %d ready pods are below replicas-maxUnavailable (%d)", checks, ready, minReady)
+
+				// Stalls fail here instead of at the deadline
+				message, done, err := example.RolloutStatus(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), name)
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				if done {
+					break
+				}
+				if time.Now().After(deadline) {
+					ginkgo.Fail(fmt.Sprintf("Deployment %s did not finish rolling out within %v: %s", name, rolloutTimeout, message))
+				}
+				time.Sleep(example.CheckInterval(pollInterval))
+			}
+
+			duration := time.Since(startedAt)
+			logger.Info().Msgf("=== Rollout took %v over %d checks: max %d pods (bound %d), min %d ready (bound %d) ===",
+				duration.Round(time.Millisecond), checks, observedMaxPods, maxPods, observedMinReady, minReady)
+			example.RecordMetric(testTag, combination+"_rollout_seconds", duration.Seconds())
+			example.RecordMetric(testTag, combination+"_max_pods", observedMaxPods)
+			example.RecordMetric(testTag, combination+"_min_ready", observedMinReady)
+		},
+		ginkgo.Entry("surge only", "1", "0"),
+		ginkgo.Entry("unavailable only", "0", "1"),
+		ginkgo.Entry("default percentages", "25%", "25%"),
+		ginkgo.Entry("half and half", "50%", "50%"),
+		ginkgo.Entry("full surge", "100%", "0"),
+		ginkgo.Entry("large absolute values", "2", "2"),
+	)
+
+})
@@ -0,0 +1,235 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apiequality "k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// WorkloadKind names a workload kind for RolloutStatus, TriggerRollingUpdate and Scale
+type WorkloadKind string
+
+const (
+	WorkloadDeployment  WorkloadKind = "Deployment"
+	WorkloadStatefulSet WorkloadKind = "StatefulSet"
+	WorkloadDaemonSet   WorkloadKind = "DaemonSet"
+)
+
+// ErrRolloutStalled is wrapped by the RolloutStatus error of a Deployment whose Progressing condition
+// reports ProgressDeadlineExceeded. Waiting longer won't help, the rollout has to be fixed or undone.
+var ErrRolloutStalled = errors.New("rollout exceeded its progress deadline")
+
+// RolloutStatus reports a workload's rollout the way kubectl rollout status does: the message kubectl
+// prints and whether the rollout is done. An error means waiting is pointless, because the Deployment
+// stalled or the StatefulSet or DaemonSet doesn't use the RollingUpdate strategy.
+func RolloutStatus(ctx context.Context, clientset *kubernetes.Clientset, kind WorkloadKind, namespace, name string) (string, bool, error) {
+	switch kind {
+	case WorkloadDeployment:
+		deployment, err := clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", false, fmt.Errorf("deployment %s/%s lookup failed: %w", namespace, name, err)
+		}
+		return deploymentRolloutStatus(deployment)
+	case WorkloadStatefulSet:
+		statefulSet, err := clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", false, fmt.Errorf("statefulset %s/%s lookup failed: %w", namespace, name, err)
+		}
+		return statefulSetRolloutStatus(statefulSet)
+	case WorkloadDaemonSet:
+		daemonSet, err := clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return "", false, fmt.Errorf("daemonset %s/%s lookup failed: %w", namespace, name, err)
+		}
+		return daemonSetRolloutStatus(daemonSet)
+	}
+	return "", false, fmt.Errorf("rollout status of kind %q is not supported", kind)
+}
+
+// WaitForRollout polls RolloutStatus until the rollout is done. A stalled rollout fails at once, with
+// an error wrapping ErrRolloutStalled, and a timeout returns the last status message.
+func WaitForRollout(ctx context.Context, clientset *kubernetes.Clientset, kind WorkloadKind, namespace, name string, timeout time.Duration) error {
+	timeout = Timeout(TimeoutRollout, timeout)
+	var message string
+	err := PollUntil(ctx, CheckInterval(2*time.Second), timeout, func(ctx context.Context) (bool, error) {
+		var done bool
+		var err error
+		message, done, err = RolloutStatus(ctx, clientset, kind, namespace, name)
+		return done, err
+	})
+	if err != nil {
+		return fmt.Errorf("%s %s/%s rollout not done (%s): %w", kind, namespace, name, message, err)
+	}
+	return nil
+}
+
+// DeploymentRevisionAnnotation holds the revision the deployment controller gave a Deployment's
+// current ReplicaSet. Every rollout increments it.
+const DeploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+
+// PauseRollout pauses a Deployment like kubectl rollout pause. Pod template changes made while it is
+// paused don't start a rollout, ResumeRollout rolls them out together in a single new ReplicaSet.
+func PauseRollout(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) error {
+	return setDeploymentPaused(ctx, clientset, namespace, name, true)
+}
+
+// ResumeRollout resumes a paused Deployment like kubectl rollout resume. It doesn't wait for the
+// rollout, WaitForRollout does.
+func ResumeRollout(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string) error {
+	return setDeploymentPaused(ctx, clientset, namespace, name, false)
+}
+
+// setDeploymentPaused patches only spec.paused, so it can't undo changes staged in the meantime
+func setDeploymentPaused(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, paused bool) error {
+	patch := []byte(fmt.Sprintf(`{"spec":{"paused":%t}}`, paused))
+	_, err := clientset.AppsV1().Deployments(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("deployment %s/%s setting paused to %t failed: %w", namespace, name, paused, err)
+	}
+	return nil
+}
+
+// TriggerRollingUpdate gets the Deployment or StatefulSet, applies mutate to its pod template,
+// e.g. to change an image, an environment variable or resources, and updates it, retrying the whole
+// read-modify-write when the update conflicts with another writer. A mutation that leaves the template
+// unchanged is an error, because it would not start a rollout. It doesn't wait for the rollout,
+// WaitForRollout does.
+//
+//	err := example.TriggerRollingUpdate(ctx, clientset, example.WorkloadDeployment, "test-ns", "app", func(template *corev1.PodTemplateSpec) {
+//		template.Spec.Containers[0].Image = "nginx:1.27"
+//	})
+func TriggerRollingUpdate(ctx context.Context, clientset *kubernetes.Clientset, kind WorkloadKind, namespace, name string,
+	mutate func(template *corev1.PodTemplateSpec)) error {
+	var update func() error
+	// mutateTemplate applies mutate and fails when it changed nothing
+	mutateTemplate := func(template *corev1.PodTemplateSpec) error {
+		original := template.DeepCopy()
+		mutate(template)
+		if apiequality.Semantic.DeepEqual(original, template) {
+			return fmt.Errorf("the mutation left the pod template unchanged")
+		}
+		return nil
+	}
+	options := metav1.UpdateOptions{FieldManager: "e2e-test"}
+	switch kind {
+	case WorkloadDeployment:
+		deployments := clientset.AppsV1().Deployments(namespace)
+		update = func() error {
+			deployment, err := deployments.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if err := mutateTemplate(&deployment.Spec.Template); err != nil {
+				return err
+			}
+			_, err = deployments.Update(ctx, deployment, options)
+			return err
+		}
+	case WorkloadStatefulSet:
+		statefulSets := clientset.AppsV1().StatefulSets(namespace)
+		update = func() error {
+			statefulSet, err := statefulSets.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			if err := mutateTemplate(&statefulSet.Spec.Template); err != nil {
+				return err
+			}
+			_, err = statefulSets.Update(ctx, statefulSet, options)
+			return err
+		}
+	default:
+		return fmt.Errorf("rolling update of kind %q is not supported", kind)
+	}
+
+	if err := retry.RetryOnConflict(retry.DefaultRetry, update); err != nil {
+		return fmt.Errorf("%s %s/%s rolling update failed: %w", kind, namespace, name, err)
+	}
+	return nil
+}
+
+// The three status functions follow kubectl's DeploymentStatusViewer, StatefulSetStatusViewer and
+// DaemonSetStatusViewer, messages included
+
+func deploymentRolloutStatus(deployment *appsv1.Deployment) (string, bool, error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return "Waiting for deployment spec update to be observed...", false, nil
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return "", false, fmt.Errorf("deployment %q: %w", deployment.Name, ErrRolloutStalled)
+		}
+	}
+	status := deployment.Status
+	if deployment.Spec.Replicas != nil && status.UpdatedReplicas < *deployment.Spec.Replicas {
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d out of %d new replicas have been updated...",
+			deployment.Name, status.UpdatedReplicas, *deployment.Spec.Replicas), false, nil
+	}
+	if status.Replicas > status.UpdatedReplicas {
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d old replicas are pending termination...",
+			deployment.Name, status.Replicas-status.UpdatedReplicas), false, nil
+	}
+	if status.AvailableReplicas < status.UpdatedReplicas {
+		return fmt.Sprintf("Waiting for deployment %q rollout to finish: %d of %d updated replicas are available...",
+			deployment.Name, status.AvailableReplicas, status.UpdatedReplicas), false, nil
+	}
+	return fmt.Sprintf("deployment %q successfully rolled out", deployment.Name), true, nil
+}
+
+func statefulSetRolloutStatus(statefulSet *appsv1.StatefulSet) (string, bool, error) {
+	if statefulSet.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return "", false, fmt.Errorf("statefulset %q: rollout status is only available for %s strategy type",
+			statefulSet.Name, appsv1.RollingUpdateStatefulSetStrategyType)
+	}
+	status := statefulSet.Status
+	if status.ObservedGeneration == 0 || statefulSet.Generation > status.ObservedGeneration {
+		return "Waiting for statefulset spec update to be observed...", false, nil
+	}
+	if statefulSet.Spec.Replicas != nil && status.ReadyReplicas < *statefulSet.Spec.Replicas {
+		return fmt.Sprintf("Waiting for %d pods to be ready...", *statefulSet.Spec.Replicas-status.ReadyReplicas), false, nil
+	}
+	rollingUpdate := statefulSet.Spec.UpdateStrategy.RollingUpdate
+	if rollingUpdate != nil && rollingUpdate.Partition != nil && statefulSet.Spec.Replicas != nil {
+		// Only the pods at or above the partition ordinal are updated
+		toUpdate := *statefulSet.Spec.Replicas - *rollingUpdate.Partition
+		if status.UpdatedReplicas < toUpdate {
+			return fmt.Sprintf("Waiting for partitioned roll out to finish: %d out of %d new pods have been updated...",
+				status.UpdatedReplicas, toUpdate), false, nil
+		}
+		return fmt.Sprintf("partitioned roll out complete: %d new pods have been updated...", status.UpdatedReplicas), true, nil
+	}
+	if status.UpdateRevision != status.CurrentRevision {
+		return fmt.Sprintf("waiting for statefulset rolling update to complete %d pods at revision %s...",
+			status.UpdatedReplicas, status.UpdateRevision), false, nil
+	}
+	return fmt.Sprintf("statefulset rolling update complete %d pods at revision %s...", status.CurrentReplicas, status.CurrentRevision), true, nil
+}
+
+func daemonSetRolloutStatus(daemonSet *appsv1.DaemonSet) (string, bool, error) {
+	if daemonSet.Spec.UpdateStrategy.Type != appsv1.RollingUpdateDaemonSetStrategyType {
+		return "", false, fmt.Errorf("daemonset %q: rollout status is only available for %s strategy type",
+			daemonSet.Name, appsv1.RollingUpdateDaemonSetStrategyType)
+	}
+	status := daemonSet.Status
+	if daemonSet.Generation > status.ObservedGeneration {
+		return "Waiting for daemon set spec update to be observed...", false, nil
+	}
+	if status.UpdatedNumberScheduled < status.DesiredNumberScheduled {
+		return fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d out of %d new pods have been updated...",
+			daemonSet.Name, status.UpdatedNumberScheduled, status.DesiredNumberScheduled), false, nil
+	}
+	if status.NumberAvailable < status.DesiredNumberScheduled {
+		return fmt.Sprintf("Waiting for daemon set %q rollout to finish: %d of %d updated pods are available...",
+			daemonSet.Name, status.NumberAvailable, status.DesiredNumberScheduled), false, nil
+	}
+	return fmt.Sprintf("daemon set %q successfully rolled out", daemonSet.Name), true, nil
+}
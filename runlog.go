@@ -0,0 +1,259 @@
+package example
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runLogDir is where the run logs and the final report are written
+const runLogDir = "./temp"
+
+// runLog appends every log entry to the process's run log, an NDJSON file in ./temp named after the
+// time the process started, e.g. temp/run_20240102-150405_12345.ndjson. Entries are written as they
+// are logged, without buffering, so the log survives a process that is killed and a soak run doesn't
+// hold its whole log in memory. The file is created with the first entry. When it can't be, the
+// entries are kept in memory instead.
+type runLog struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	fallback *bytes.Buffer
+}
+
+var processLog = &runLog{
+	path: filepath.Join(runLogDir, fmt.Sprintf("run_%s_%d.ndjson", time.Now().Format("20060102-150405"), os.Getpid())),
+}
+
+func (l *runLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil && l.fallback == nil {
+		file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: run log %s not created, keeping the log in memory: %v\n", l.path, err)
+			l.fallback = new(bytes.Buffer)
+		} else {
+			l.file = file
+		}
+	}
+	if l.fallback != nil {
+		return l.fallback.Write(p)
+	}
+	return l.file.Write(p)
+}
+
+// open returns a reader of what was logged so far, along with a function that closes it
+func (l *runLog) open() (io.Reader, func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.fallback != nil:
+		return bytes.NewReader(append([]byte(nil), l.fallback.Bytes()...)), func() {}, nil
+	case l.file == nil:
+		return strings.NewReader(""), func() {}, nil
+	}
+	file, err := os.Open(l.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("run log %s: %w", l.path, err)
+	}
+	return file, func() { file.Close() }, nil
+}
+
+// logFile returns the path of the process's run log, empty while nothing was logged or when the log
+// is kept in memory
+func (l *runLog) logFile() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return ""
+	}
+	return l.path
+}
+
+// inMemory returns a copy of the entries kept in memory because the run log couldn't be created
+func (l *runLog) inMemory() []byte {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fallback == nil {
+		return nil
+	}
+	return append([]byte(nil), l.fallback.Bytes()...)
+}
+
+// RunLogFile returns the path of the run log this process appends its log entries to, empty while
+// nothing was logged
+func RunLogFile() string {
+	return processLog.logFile()
+}
+
+// logsByTag is the outcome of reading the run logs: every tagged entry, moved to a file per tag, and
+// the tags that logged TEST_FAILED
+type logsByTag struct {
+	dir    string
+	files  map[string]*os.File
+	tags   []string
+	failed map[string]bool
+}
+
+// splitRunLogs streams the run logs into a temporary file per tag in dir, holding one entry at a
+// time in memory. Entries of the Setup tag and entries without a tag are left out of the report. The
+// tag and level fields are dropped, the tag names the entry's section of the report.
+func splitRunLogs(dir string, logs []io.Reader) (*logsByTag, error) {
+	split, err := os.MkdirTemp(dir, "report_")
+	if err != nil {
+		return nil, fmt.Errorf("report directory creation failed: %w", err)
+	}
+	result := &logsByTag{dir: split, files: map[string]*os.File{}, failed: map[string]bool{}}
+	for _, log := range logs {
+		reader := bufio.NewReader(log)
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			if err := result.add(line); err != nil {
+				result.remove()
+				return nil, err
+			}
+			if readErr == io.EOF {
+				break
+			}
+			if readErr != nil {
+				result.remove()
+				return nil, fmt.Errorf("run log reading failed: %w", readErr)
+			}
+		}
+	}
+	sort.Strings(result.tags)
+	return result, nil
+}
+
+func (r *logsByTag) add(line []byte) error {
+	var entry map[string]interface{}
+	if len(bytes.TrimSpace(line)) == 0 || json.Unmarshal(line, &entry) != nil {
+		return nil
+	}
+	tag, ok := entry["tag"].(string)
+	if !ok || tag == "Setup" {
+		return nil
+	}
+	if msg, ok := entry["message"].(string); ok && strings.Contains(msg, "TEST_FAILED") {
+		r.failed[tag] = true
+	}
+	delete(entry, "tag")
+	delete(entry, "level")
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("log entry serialization failed: %w", err)
+	}
+
+	file, found := r.files[tag]
+	if !found {
+		file, err = os.Create(filepath.Join(r.dir, fmt.Sprintf("%d.ndjson", len(r.files))))
+		if err != nil {
+			return fmt.Errorf("report file of %s creation failed: %w", tag, err)
+		}
+		r.files[tag] = file
+		r.tags = append(r.tags, tag)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("report file of %s write failed: %w", tag, err)
+	}
+	return nil
+}
+
+// writeTo writes the entries as the logs_by_tags object of the report, a JSON array per tag, indented
+// like the rest of the report
+func (r *logsByTag) writeTo(w io.Writer) error {
+	if len(r.tags) == 0 {
+		_, err := io.WriteString(w, "{}")
+		return err
+	}
+	io.WriteString(w, "{\n")
+	for i, tag := range r.tags {
+		name, _ := json.Marshal(tag)
+		fmt.Fprintf(w, "  %s: [\n", name)
+		file := r.files[tag]
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("report file of %s: %w", tag, err)
+		}
+		reader := bufio.NewReader(file)
+		first := true
+		for {
+			line, readErr := reader.ReadBytes('\n')
+			if line = bytes.TrimSpace(line); len(line) > 0 {
+				if !first {
+					io.WriteString(w, ",\n")
+				}
+				first = false
+				var indented bytes.Buffer
+				if err := json.Indent(&indented, line, "   ", " "); err != nil {
+					return fmt.Errorf("report entry of %s: %w", tag, err)
+				}
+				io.WriteString(w, "   ")
+				if _, err := indented.WriteTo(w); err != nil {
+					return err
+				}
+			}
+			if readErr == io.EOF {
+				break
+			}
+			if readErr != nil {
+				return fmt.Errorf("report file of %s reading failed: %w", tag, readErr)
+			}
+		}
+		io.WriteString(w, "\n  ]")
+		if i < len(r.tags)-1 {
+			io.WriteString(w, ",")
+		}
+		io.WriteString(w, "\n")
+	}
+	_, err := io.WriteString(w, " }")
+	return err
+}
+
+// remove deletes the per-tag files
+func (r *logsByTag) remove() {
+	for _, file := range r.files {
+		file.Close()
+	}
+	os.RemoveAll(r.dir)
+}
+
+// writeReport writes the report to filename, streaming the logs into its logs_by_tags field, which the
+// report itself leaves empty
+func writeReport(filename string, report FinalReport, logs *logsByTag) error {
+	report.LogsByTags = nil
+	header, err := json.MarshalIndent(report, "", " ")
+	if err != nil {
+		return fmt.Errorf("report serialization failed: %w", err)
+	}
+	before, after, found := bytes.Cut(header, []byte(`"logs_by_tags": null`))
+	if !found {
+		return fmt.Errorf("report serialization failed: no logs_by_tags field")
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("report file creation failed: %w", err)
+	}
+	writer := bufio.NewWriter(file)
+	writer.Write(before)
+	writer.WriteString(`"logs_by_tags": `)
+	if err := logs.writeTo(writer); err != nil {
+		file.Close()
+		return err
+	}
+	writer.Write(after)
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("report write failed: %w", err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,288 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	nodev1 "k8s.io/api/node/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("RuntimeClass scheduling E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("RuntimeClassSchedulingTest"), func() {
+	var (
+		clientset    *kubernetes.Clientset
+		podYAML      []byte
+		runtimeClass *nodev1.RuntimeClass
+		// Node the RuntimeClass pod ran on
+		nodeName string
+		logger   zerolog.Logger
+		testTag  = "RuntimeClassSchedulingTest"
+	)
+
+	const pollInterval = 2 * time.Second
+
+	// Sandboxed runtimes are preferred, they are why a cluster has more than one RuntimeClass
+	preferredRuntimes := []string{"gvisor", "runsc", "kata"}
+
+	newPod := func(name string) *v1.Pod {
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(podYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		pod.Name = name
+		return pod
+	}
+
+	// podRequest returns what the scheduler reserves for the pod in milli-units: the larger of the
+	// containers' and any init container's requests, plus the pod overhead
+	podRequest := func(pod *v1.Pod, name v1.ResourceName) int64 {
+		var containers, initContainers int64
+		for _, container := range pod.Spec.Containers {
+			containers += container.Resources.Requests.Name(name, resource.DecimalSI).MilliValue()
+		}
+		for _, container := range pod.Spec.InitContainers {
+			if request := container.Resources.Requests.Name(name, resource.DecimalSI).MilliValue(); request > initContainers {
+				initContainers = request
+			}
+		}
+		request := max(containers, initContainers)
+		if quantity, ok := pod.Spec.Overhead[name]; ok {
+			request += quantity.MilliValue()
+		}
+		return request
+	}
+
+	waitForPod := func(name string, done func(*v1.Pod) bool, description string) *v1.Pod {
+		podTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(podTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if done(pod) {
+				return pod
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s did not become %s within %v (phase %s)", name, description, podTimeout, pod.Status.Phase))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	running := func(pod *v1.Pod) bool { return pod.Status.Phase == v1.PodRunning }
+
+	// runProbe runs the pod with the RuntimeClass and remembers its node
+	runProbe := func() {
+		pod := newPod("runtime-class")
+		pod.Spec.RuntimeClassName = &runtimeClass.Name
+		_, err := clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pod = waitForPod("runtime-class", running, "Running")
+		nodeName = pod.Spec.NodeName
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		runtimeClasses, err := clientset.NodeV1().RuntimeClasses().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if len(runtimeClasses.Items) == 0 {
+			ginkgo.Skip("No RuntimeClass exists, the cluster only has the default runtime")
+		}
+		for _, rc := range runtimeClasses.Items {
+			logger.Info().Msgf("RuntimeClass %s: handler %s, overhead %v\n", rc.Name, rc.Handler, rc.Overhead)
+		}
+
+		// RUNTIME_CLASS_NAME in .env picks the RuntimeClass, otherwise a sandboxed one or the first
+		wanted := os.Getenv("RUNTIME_CLASS_NAME")
+		for i := range runtimeClasses.Items {
+			rc := &runtimeClasses.Items[i]
+			if wanted != "" {
+				if rc.Name == wanted {
+					runtimeClass = rc
+				}
+				continue
+			}
+			for _, preferred := range preferredRuntimes {
+				if runtimeClass == nil && (strings.Contains(rc.Name, preferred) || strings.Contains(rc.Handler, preferred)) {
+					runtimeClass = rc
+				}
+			}
+		}
+		if wanted != "" {
+			gomega.Expect(runtimeClass).NotTo(gomega.BeNil(), "RuntimeClass %s from RUNTIME_CLASS_NAME does not exist", wanted)
+		}
+		if runtimeClass == nil {
+			runtimeClass = &runtimeClasses.Items[0]
+		}
+		logger.Info().Msgf("=== Using RuntimeClass %s (handler %s) ===", runtimeClass.Name, runtimeClass.Handler)
+
+		podYAML, err = example.GetRuntimeClassTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should run a pod with the RuntimeClass on a node that supports it", func() {
+		logger.Info().Msgf("=== Starting RuntimeClass scheduling E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		start := time.Now()
+		runProbe()
+		logger.Info().Msgf("=== Pod running on %s after %v ===", nodeName, time.Since(start).Round(time.Second))
+		example.RecordMetric(testTag, "runtime_class_pod_start_seconds", time.Since(start).Seconds())
+
+		// The RuntimeClass admission controller merges the scheduling constraints into the pod
+		if runtimeClass.Scheduling != nil && len(runtimeClass.Scheduling.NodeSelector) > 0 {
+			node, err := clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for key, value := range runtimeClass.Scheduling.NodeSelector {
+				gomega.Expect(node.Labels).To(gomega.HaveKeyWithValue(key, value),
+					"Node %s doesn't match the RuntimeClass nodeSelector", nodeName)
+			}
+		}
+	})
+
+	ginkgo.It("should add the RuntimeClass overhead to the pod", func() {
+		defer example.E2ePanicHandler()
+
+		if runtimeClass.Overhead == nil || len(runtimeClass.Overhead.PodFixed) == 0 {
+			ginkgo.Skip(fmt.Sprintf("RuntimeClass %s declares no pod overhead", runtimeClass.Name))
+		}
+
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "runtime-class", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Pod overhead: %v ===", pod.Spec.Overhead)
+		for name, quantity := range runtimeClass.Overhead.PodFixed {
+			actual, ok := pod.Spec.Overhead[name]
+			gomega.Expect(ok).To(gomega.BeTrue(), "Pod overhead is missing %s", name)
+			gomega.Expect(actual.Cmp(quantity)).To(gomega.BeZero(),
+				"Pod overhead %s is %s, the RuntimeClass declares %s", name, actual.String(), quantity.String())
+		}
+	})
+
+	// Filling the node's free capacity blocks other workloads from scheduling there, so this spec also
+	// needs RUNTIME_CLASS_CAPACITY_CHECK=true
+	ginkgo.It("should count the overhead against the node allocatable when scheduling", ginkgo.Label("disruptive"), func() {
+		defer example.E2ePanicHandler()
+
+		if os.Getenv("RUNTIME_CLASS_CAPACITY_CHECK") != "true" {
+			ginkgo.Skip("Filling a node's capacity is opt-in, set RUNTIME_CLASS_CAPACITY_CHECK=true")
+		}
+		if runtimeClass.Overhead == nil || len(runtimeClass.Overhead.PodFixed) == 0 {
+			ginkgo.Skip(fmt.Sprintf("RuntimeClass %s declares no pod overhead", runtimeClass.Name))
+		}
+		// The first spec doesn't run when only disruptive specs are selected
+		if nodeName == "" {
+			runProbe()
+		}
+
+		// CPU is checked, unless the RuntimeClass only declares memory overhead
+		probe, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "runtime-class", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		resourceName := v1.ResourceCPU
+		if runtimeClass.Overhead.PodFixed.Cpu().IsZero() {
+			resourceName = v1.ResourceMemory
+		}
+		overhead := probe.Spec.Overhead.Name(resourceName, resource.DecimalSI).MilliValue()
+		withOverhead := podRequest(probe, resourceName)
+
+		node, err := clientset.CoreV1().Nodes().Get(context.TODO(), nodeName, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		pods, err := example.ListPodsOnNode(context.TODO(), clientset, "", nodeName)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		var allocated int64
+		for i := range pods {
+			pod := &pods[i]
+			if pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+				allocated += podRequest(pod, resourceName)
+			}
+		}
+		allocatable := node.Status.Allocatable.Name(resourceName, resource.DecimalSI).MilliValue()
+
+		// Once the probe pod is gone, the filler leaves room for the pod's requests but only half its
+		// overhead. The pod then only fits if the scheduler ignores the overhead.
+		free := allocatable - allocated + withOverhead
+		filler := free - (withOverhead - overhead/2)
+		logger.Info().Msgf("=== %s on %s: allocatable %dm, allocated %dm, pod needs %dm incl. %dm overhead, filler %dm ===",
+			resourceName, nodeName, allocatable, allocated, withOverhead, overhead, filler)
+		if filler <= 0 {
+			ginkgo.Skip(fmt.Sprintf("Node %s has too little free %s for the check", nodeName, resourceName))
+		}
+
+		gracePeriod := int64(0)
+		err = clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), "runtime-class", metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		fillerPod := newPod("runtime-class-filler")
+		fillerPod.Spec.NodeSelector = map[string]string{v1.LabelHostname: node.Labels[v1.LabelHostname]}
+		fillerPod.Spec.Containers[0].Resources.Requests = v1.ResourceList{
+			resourceName: *resource.NewMilliQuantity(filler, resource.DecimalSI),
+		}
+		if resourceName == v1.ResourceCPU {
+			fillerPod.Spec.Containers[0].Resources.Requests[v1.ResourceMemory] = resource.MustParse("16Mi")
+		} else {
+			fillerPod.Spec.Containers[0].Resources.Requests[v1.ResourceCPU] = resource.MustParse("10m")
+		}
+		_, err = clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), fillerPod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		waitForPod("runtime-class-filler", running, "Running")
+
+		pod := newPod("runtime-class-capacity")
+		pod.Spec.RuntimeClassName = &runtimeClass.Name
+		pod.Spec.NodeSelector = map[string]string{v1.LabelHostname: node.Labels[v1.LabelHostname]}
+		_, err = clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pod = waitForPod("runtime-class-capacity", func(pod *v1.Pod) bool {
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == v1.PodScheduled {
+					return condition.Status == v1.ConditionTrue || condition.Reason == v1.PodReasonUnschedulable
+				}
+			}
+			return false
+		}, "scheduled or unschedulable")
+		gomega.Expect(pod.Spec.NodeName).To(gomega.BeEmpty(), "The pod fit next to the filler, its overhead was not counted")
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == v1.PodScheduled {
+				logger.Info().Msgf("=== Pod unschedulable as expected: %s ===", condition.Message)
+				gomega.Expect(condition.Message).To(gomega.ContainSubstring("Insufficient " + string(resourceName)))
+			}
+		}
+
+		// Without the filler the same pod must fit, so only the overhead kept it out
+		err = clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), "runtime-class-filler", metav1.DeleteOptions{GracePeriodSeconds: &gracePeriod})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		waitForPod("runtime-class-capacity", running, "Running")
+	})
+
+})
@@ -0,0 +1,117 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+	"k8s.io/client-go/util/retry"
+)
+
+// Scale sets the replicas of a Deployment or StatefulSet through the scale subresource, like kubectl
+// scale. Only spec.replicas is written, so the update can't undo concurrent changes to the rest of the
+// spec, and a conflicting write, e.g. by an HPA, is retried.
+func Scale(ctx context.Context, clientset *kubernetes.Clientset, kind WorkloadKind, namespace, name string, replicas int32) error {
+	var get func() (*autoscalingv1.Scale, error)
+	var update func(scale *autoscalingv1.Scale) error
+	switch kind {
+	case WorkloadDeployment:
+		deployments := clientset.AppsV1().Deployments(namespace)
+		get = func() (*autoscalingv1.Scale, error) {
+			return deployments.GetScale(ctx, name, metav1.GetOptions{})
+		}
+		update = func(scale *autoscalingv1.Scale) error {
+			_, err := deployments.UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+			return err
+		}
+	case WorkloadStatefulSet:
+		statefulSets := clientset.AppsV1().StatefulSets(namespace)
+		get = func() (*autoscalingv1.Scale, error) {
+			return statefulSets.GetScale(ctx, name, metav1.GetOptions{})
+		}
+		update = func(scale *autoscalingv1.Scale) error {
+			_, err := statefulSets.UpdateScale(ctx, name, scale, metav1.UpdateOptions{})
+			return err
+		}
+	default:
+		return fmt.Errorf("scaling of kind %q is not supported", kind)
+	}
+
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		scale, err := get()
+		if err != nil {
+			return err
+		}
+		scale.Spec.Replicas = replicas
+		return update(scale)
+	})
+	if err != nil {
+		return fmt.Errorf("%s %s/%s scaling to %d failed: %w", kind, namespace, name, replicas, err)
+	}
+	return nil
+}
+
+// WaitForScale watches the Deployment or StatefulSet until the controller has observed the current
+// spec and it reports exactly replicas pods, all of them ready. Being a watch, it returns as soon as
+// that happens, which keeps scaling benchmarks precise. Terminating pods aren't reported, so callers
+// that must wait for them to go check the pods themselves. On timeout the error carries the last
+// counts seen.
+func WaitForScale(ctx context.Context, clientset *kubernetes.Clientset, kind WorkloadKind, namespace, name string, replicas int32,
+	timeout time.Duration) error {
+	timeout = Timeout(TimeoutRollout, timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var listWatch *cache.ListWatch
+	var objectType runtime.Object
+	switch kind {
+	case WorkloadDeployment:
+		listWatch = cache.NewListWatchFromClient(clientset.AppsV1().RESTClient(), "deployments", namespace,
+			fields.OneTermEqualSelector("metadata.name", name))
+		objectType = &appsv1.Deployment{}
+	case WorkloadStatefulSet:
+		listWatch = cache.NewListWatchFromClient(clientset.AppsV1().RESTClient(), "statefulsets", namespace,
+			fields.OneTermEqualSelector("metadata.name", name))
+		objectType = &appsv1.StatefulSet{}
+	default:
+		return fmt.Errorf("scaling of kind %q is not supported", kind)
+	}
+
+	summary := "not found"
+	_, err := watchtools.UntilWithSync(ctx, listWatch, objectType, nil, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("%s %s/%s was deleted", kind, namespace, name)
+		}
+		var observed bool
+		var current, ready int32
+		switch object := event.Object.(type) {
+		case *appsv1.Deployment:
+			observed = object.Status.ObservedGeneration >= object.Generation
+			current, ready = object.Status.Replicas, object.Status.ReadyReplicas
+		case *appsv1.StatefulSet:
+			observed = object.Status.ObservedGeneration >= object.Generation
+			current, ready = object.Status.Replicas, object.Status.ReadyReplicas
+		default:
+			return false, nil
+		}
+		summary = fmt.Sprintf("observed: %t, replicas: %d, ready: %d", observed, current, ready)
+		return observed && current == replicas && ready == replicas, nil
+	})
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("waiting for %s %s/%s failed: %w", kind, namespace, name, err)
+	}
+	return fmt.Errorf("%s %s/%s not at %d ready replicas within %v (%s)", kind, namespace, name, replicas, timeout, summary)
+}
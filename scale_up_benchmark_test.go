@@ -0,0 +1,192 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Scale-up benchmark E2E test", ginkgo.Ordered, ginkgo.Label("benchmark"), example.SuiteConcurrency("ScaleUpBenchmarkTest"), func() {
+	var (
+		clientset     *kubernetes.Clientset
+		replicaCounts []int32
+		timeout       time.Duration
+		zoneMap       *example.ZoneMap
+		logger        zerolog.Logger
+		testTag       = "ScaleUpBenchmarkTest"
+	)
+
+	const (
+		// Comma-separated replica counts, each measured from zero. Overridable with SCALE_UP_REPLICAS in .env
+		defaultReplicaCounts = "50"
+		// Overridable with SCALE_UP_TIMEOUT_SECONDS in .env
+		defaultTimeoutSeconds = 600
+	)
+
+	setReplicas := func(replicas int32) {
+		err := example.Scale(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), "scale-up-bench", replicas)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	listPods := func() []v1.Pod {
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=scale-up-bench"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return pods
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		counts := os.Getenv("SCALE_UP_REPLICAS")
+		if counts == "" {
+			counts = defaultReplicaCounts
+		}
+		for _, value := range strings.Split(counts, ",") {
+			count, err := strconv.ParseInt(strings.TrimSpace(value), 10, 32)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid SCALE_UP_REPLICAS: %s", counts)
+			gomega.Expect(count).To(gomega.BeNumerically(">", 0), "Invalid SCALE_UP_REPLICAS: %s", counts)
+			replicaCounts = append(replicaCounts, int32(count))
+		}
+
+		timeout = defaultTimeoutSeconds * time.Second
+		if value := os.Getenv("SCALE_UP_TIMEOUT_SECONDS"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid SCALE_UP_TIMEOUT_SECONDS: %s", value)
+			timeout = time.Duration(seconds) * time.Second
+		}
+
+		// A node that is still joining or has failed would skew the results towards less capacity
+		nodes, err := example.WaitForNodesReady(context.TODO(), clientset, 0, 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== All %d nodes are ready ===", len(nodes))
+
+		// A replica count the nodes can't hold would only measure the timeout
+		capacity, err := example.ClusterCapacity(context.TODO(), clientset)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Cluster capacity: %v ===", capacity)
+		for _, replicas := range replicaCounts {
+			if int64(replicas) > capacity.Total.FreePods() {
+				ginkgo.Skip(fmt.Sprintf("%d replicas don't fit on the cluster, it has %d free pod slots (SCALE_UP_REPLICAS: %v)",
+					replicas, capacity.Total.FreePods(), replicaCounts))
+			}
+		}
+
+		zoneMap, err = example.NewZoneMap(context.TODO(), clientset)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should create the benchmark deployment with zero replicas", func() {
+		logger.Info().Msgf("=== Starting Scale-up benchmark E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Creating Deployment, replica counts %v, timeout %v ===", replicaCounts, timeout)
+		// Scaled up by the test, every run starts from zero pods. Spread like a typical production workload,
+		// so the zone distribution reflects the scheduler.
+		err := example.NewDeployment("scale-up-bench").
+			WithReplicas(0).
+			WithImage("registry.k8s.io/pause:3.9").
+			WithResources("1m", "4Mi").
+			WithMemoryLimit("16Mi").
+			WithTerminationGracePeriod(0).
+			WithSoftZoneSpread(1).
+			Create(context.TODO(), clientset)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should scale up to every replica count within the timeout", func() {
+		defer example.E2ePanicHandler()
+
+		for _, replicas := range replicaCounts {
+			prefix := fmt.Sprintf("scale_up_%d", replicas)
+
+			logger.Info().Msgf("=== Scaling from 0 to %d replicas ===", replicas)
+			start := time.Now()
+			setReplicas(replicas)
+
+			err := example.WaitForScale(context.TODO(), clientset, example.WorkloadDeployment, example.TestNamespace(), "scale-up-bench", replicas, timeout)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			total := time.Since(start)
+
+			var scheduleLatencies, readyLatencies []float64
+			perZone := map[string]int{}
+			// Pod condition timestamps have second resolution, so the start is truncated to match
+			truncatedStart := start.Truncate(time.Second)
+			for _, pod := range listPods() {
+				zone := zoneMap.ZoneOf(pod)
+				if zone == "" {
+					zone = "none"
+				}
+				perZone[zone]++
+				for _, condition := range pod.Status.Conditions {
+					switch condition.Type {
+					case v1.PodScheduled:
+						scheduleLatencies = append(scheduleLatencies, condition.LastTransitionTime.Sub(pod.CreationTimestamp.Time).Seconds())
+					case v1.PodReady:
+						readyLatencies = append(readyLatencies, condition.LastTransitionTime.Sub(truncatedStart).Seconds())
+					}
+				}
+			}
+
+			logger.Info().Msgf("=== %d replicas ready after %v ===", replicas, total.Round(time.Millisecond))
+			logger.Info().Msgf("Pod ready p50: %.0fs, p90: %.0fs, p99: %.0fs | scheduling p50: %.0fs, p99: %.0fs\n",
+				example.Percentile(readyLatencies, 50), example.Percentile(readyLatencies, 90), example.Percentile(readyLatencies, 99),
+				example.Percentile(scheduleLatencies, 50), example.Percentile(scheduleLatencies, 99))
+			logger.Info().Msgf("Pods per zone: %v\n", perZone)
+
+			example.RecordMetric(testTag, prefix+"_seconds", total.Seconds())
+			example.RecordMetric(testTag, prefix+"_pod_ready_p50_seconds", example.Percentile(readyLatencies, 50))
+			example.RecordMetric(testTag, prefix+"_pod_ready_p90_seconds", example.Percentile(readyLatencies, 90))
+			example.RecordMetric(testTag, prefix+"_pod_ready_p99_seconds", example.Percentile(readyLatencies, 99))
+			example.RecordMetric(testTag, prefix+"_schedule_p99_seconds", example.Percentile(scheduleLatencies, 99))
+			example.RecordMetric(testTag, prefix+"_pods_per_zone", perZone)
+
+			// Every measurement starts from zero pods, so the next one doesn't reuse warm pods
+			logger.Info().Msgf("=== Scaling back to 0 ===")
+			setReplicas(0)
+			drainTimeout := example.Timeout(example.TimeoutPods, 5*time.Minute)
+			deadline := time.Now().Add(drainTimeout)
+			for {
+				remaining := len(listPods())
+				if remaining == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					ginkgo.Fail(fmt.Sprintf("%d pods were left %v after scaling to 0", remaining, drainTimeout))
+				}
+				time.Sleep(example.CheckInterval(2 * time.Second))
+			}
+		}
+	})
+
+})
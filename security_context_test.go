@@ -0,0 +1,242 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Seccomp and securityContext enforcement E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("SecurityContextEnforcementTest"), func() {
+	var (
+		config    *rest.Config
+		clientset *kubernetes.Clientset
+		podYAML   []byte
+		logger    zerolog.Logger
+		testTag   = "SecurityContextEnforcementTest"
+
+		securityNamespace = example.TestNamespaced("test-ns-seccomp")
+	)
+
+	const (
+		// The user and group the fixture runs as (nobody)
+		unprivilegedID = "65534"
+		pollInterval   = 2 * time.Second
+	)
+
+	psaLabels := map[string]string{
+		"pod-security.kubernetes.io/enforce":         "restricted",
+		"pod-security.kubernetes.io/enforce-version": "latest",
+	}
+
+	decodePod := func() *v1.Pod {
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(podYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return pod
+	}
+
+	// procStatus returns the fields of /proc/1/status of the pod's main container, which shows what the
+	// runtime actually applied to the container process
+	procStatus := func(name string) map[string]string {
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, securityNamespace, name, "main",
+			[]string{"cat", "/proc/1/status"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "stderr: %s", stderr)
+
+		fields := map[string]string{}
+		for _, line := range strings.Split(stdout, "\n") {
+			key, value, found := strings.Cut(line, ":")
+			if found {
+				fields[key] = strings.Join(strings.Fields(value), " ")
+			}
+		}
+		return fields
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		// Namespace setup, enforcing the restricted Pod Security Standard like our application namespaces
+		logger.Info().Msgf("=== Ensuring %s exists with restricted enforcement ===", securityNamespace)
+		ns, err := clientset.CoreV1().Namespaces().Get(
+			context.TODO(),
+			securityNamespace,
+			metav1.GetOptions{},
+		)
+
+		if apierrors.IsNotFound(err) {
+			logger.Info().Msgf("Creating %s namespace\n", securityNamespace)
+			ns := &v1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   securityNamespace,
+					Labels: psaLabels,
+				},
+			}
+			_, err = clientset.CoreV1().Namespaces().Create(
+				context.TODO(),
+				ns,
+				metav1.CreateOptions{},
+			)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		} else {
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if ns.Labels == nil {
+				ns.Labels = map[string]string{}
+			}
+			for key, value := range psaLabels {
+				ns.Labels[key] = value
+			}
+			_, err = clientset.CoreV1().Namespaces().Update(context.TODO(), ns, metav1.UpdateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		podYAML, err = example.GetSecurityContextTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespaceByName(logger, clientset, securityNamespace)
+	})
+
+	ginkgo.It("should run the container with the requested user, seccomp profile and capabilities", func() {
+		logger.Info().Msgf("=== Starting Seccomp and securityContext enforcement E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		pod := decodePod()
+		_, err := clientset.CoreV1().Pods(securityNamespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Compliant pod was rejected")
+
+		runningTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			current, err := clientset.CoreV1().Pods(securityNamespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if current.Status.Phase == v1.PodRunning {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s did not reach Running within %v", pod.Name, runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		status := procStatus(pod.Name)
+		logger.Info().Msgf("=== Uid: %s, Gid: %s, Seccomp: %s, NoNewPrivs: %s, CapEff: %s, CapBnd: %s ===",
+			status["Uid"], status["Gid"], status["Seccomp"], status["NoNewPrivs"], status["CapEff"], status["CapBnd"])
+
+		// Real, effective, saved and filesystem IDs
+		id := strings.Repeat(unprivilegedID+" ", 3) + unprivilegedID
+		gomega.Expect(status["Uid"]).To(gomega.Equal(id), "Container does not run as user %s", unprivilegedID)
+		gomega.Expect(status["Gid"]).To(gomega.Equal(id), "Container does not run as group %s", unprivilegedID)
+		// 2 is SECCOMP_MODE_FILTER, 0 would mean the container runs unconfined
+		gomega.Expect(status["Seccomp"]).To(gomega.Equal("2"), "RuntimeDefault seccomp profile is not applied")
+		gomega.Expect(status["NoNewPrivs"]).To(gomega.Equal("1"), "allowPrivilegeEscalation=false is not applied")
+		// Dropping ALL clears the bounding set as well, so nothing can be regained
+		for _, set := range []string{"CapInh", "CapPrm", "CapEff", "CapBnd", "CapAmb"} {
+			gomega.Expect(status[set]).To(gomega.Equal("0000000000000000"), "Capability set %s is not empty", set)
+		}
+	})
+
+	ginkgo.It("should reject pods that weaken the securityContext", func() {
+		defer example.E2ePanicHandler()
+
+		violations := []struct {
+			name string
+			// The control named in the rejection
+			control string
+			mutate  func(pod *v1.Pod)
+		}{
+			{"unconfined-seccomp", "seccompProfile", func(pod *v1.Pod) {
+				pod.Spec.SecurityContext.SeccompProfile.Type = v1.SeccompProfileTypeUnconfined
+			}},
+			{"root-user", "runAsUser=0", func(pod *v1.Pod) {
+				root := int64(0)
+				pod.Spec.SecurityContext.RunAsNonRoot = nil
+				pod.Spec.SecurityContext.RunAsUser = &root
+			}},
+			{"added-capability", "unrestricted capabilities", func(pod *v1.Pod) {
+				pod.Spec.Containers[0].SecurityContext.Capabilities.Add = []v1.Capability{"SYS_ADMIN"}
+			}},
+			{"privilege-escalation", "allowPrivilegeEscalation != false", func(pod *v1.Pod) {
+				allow := true
+				pod.Spec.Containers[0].SecurityContext.AllowPrivilegeEscalation = &allow
+			}},
+		}
+
+		for _, violation := range violations {
+			pod := decodePod()
+			pod.Name = "security-context-" + violation.name
+			violation.mutate(pod)
+
+			_, err := clientset.CoreV1().Pods(securityNamespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+			gomega.Expect(err).To(gomega.HaveOccurred(), "Pod %s was admitted", pod.Name)
+			logger.Info().Msgf("=== Pod %s rejected: %v ===", pod.Name, err)
+
+			gomega.Expect(apierrors.IsForbidden(err)).To(gomega.BeTrue(), "Unexpected error type: %v", err)
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring(`violates PodSecurity "restricted:latest"`))
+			gomega.Expect(err.Error()).To(gomega.ContainSubstring(violation.control))
+		}
+	})
+
+	ginkgo.It("should refuse to start a root image under runAsNonRoot", func() {
+		defer example.E2ePanicHandler()
+
+		// Admission can't know the image's user, so the kubelet has to enforce runAsNonRoot
+		pod := decodePod()
+		pod.Name = "security-context-image-root"
+		pod.Spec.SecurityContext.RunAsUser = nil
+		pod.Spec.SecurityContext.RunAsGroup = nil
+		_, err := clientset.CoreV1().Pods(securityNamespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Pod without runAsUser was rejected at admission")
+
+		refusalTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(refusalTimeout)
+		for {
+			current, err := clientset.CoreV1().Pods(securityNamespace).Get(context.TODO(), pod.Name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, status := range current.Status.ContainerStatuses {
+				gomega.Expect(status.State.Running).To(gomega.BeNil(), "Container of %s runs as root despite runAsNonRoot", pod.Name)
+				if waiting := status.State.Waiting; waiting != nil && waiting.Reason == "CreateContainerConfigError" {
+					logger.Info().Msgf("=== Container refused: %s ===", waiting.Message)
+					gomega.Expect(waiting.Message).To(gomega.ContainSubstring("runAsNonRoot"))
+					return
+				}
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Container of %s was not refused within %v", pod.Name, refusalTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	})
+
+})
@@ -0,0 +1,250 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var ipv4Pattern = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+
+var _ = ginkgo.Describe("Service connectivity E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("ServiceConnectivityTest"), func() {
+	var (
+		clientset       *kubernetes.Clientset
+		config          *rest.Config
+		backendReplicas int
+		backendPods     map[string]string // pod name -> pod IP
+		logger          zerolog.Logger
+		testTag         = "ServiceConnectivityTest"
+	)
+
+	const requestCount = 30
+
+	// execInClient runs a shell snippet inside the client pod, so all traffic originates in-cluster
+	execInClient := func(script string) (string, error) {
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "service-client", "client",
+			[]string{"sh", "-c", script})
+		if err != nil {
+			return stdout, fmt.Errorf("%w (stderr: %s)", err, stderr)
+		}
+		return stdout, nil
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should apply backend, Service and client manifests", func() {
+		logger.Info().Msgf("=== Starting Service connectivity E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		backendYAML, clientYAML, err := example.GetServiceTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying backend Deployment and Services manifest ===")
+		err = example.ApplyRawManifest(clientset, backendYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying client pod manifest ===")
+		err = example.ApplyRawManifest(clientset, clientYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "echo-backend", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		backendReplicas = int(*deployment.Spec.Replicas)
+
+		logger.Info().Msgf("=== Waiting for %d ready backends and the client pod ===", backendReplicas)
+		readyTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(readyTimeout)
+		pollInterval := example.CheckInterval(3 * time.Second)
+		for {
+			pods, err := example.ListPods(
+				context.TODO(),
+				clientset,
+				example.TestNamespace(),
+				metav1.ListOptions{LabelSelector: "app=echo-backend"},
+			)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			backendPods = map[string]string{}
+			for _, pod := range pods {
+				if pod.DeletionTimestamp != nil {
+					continue
+				}
+				for _, cond := range pod.Status.Conditions {
+					if cond.Type == v1.PodReady && cond.Status == v1.ConditionTrue {
+						backendPods[pod.Name] = pod.Status.PodIP
+					}
+				}
+			}
+
+			client, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "service-client", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			logger.Info().Msgf("Ready backends: %d/%d, client phase: %s\n", len(backendPods), backendReplicas, client.Status.Phase)
+			if len(backendPods) == backendReplicas && client.Status.Phase == v1.PodRunning {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Backends and client did not become ready within %v", readyTimeout))
+			}
+
+			time.Sleep(pollInterval)
+		}
+
+		// Ready pods reach the ClusterIP Service only once the EndpointSlice controller lists them
+		_, err = example.WaitForEndpoints(context.TODO(), clientset, example.TestNamespace(), "echo-clusterip", backendReplicas, time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should load-balance ClusterIP traffic across endpoints", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Sending %d requests to the ClusterIP Service ===", requestCount)
+		output, err := execInClient(fmt.Sprintf(
+			"for i in $(seq 1 %d); do wget -q -T 2 -O - http://echo-clusterip.%s.svc.cluster.local; done",
+			requestCount, example.TestNamespace()))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		distribution := map[string]int{}
+		for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+			responder := strings.TrimSpace(line)
+			if responder == "" {
+				continue
+			}
+			gomega.Expect(backendPods).To(gomega.HaveKey(responder),
+				"Response from %s which is not a ready backend", responder)
+			distribution[responder]++
+		}
+
+		logger.Info().Msgf("Responses per backend: %v\n", distribution)
+		total := 0
+		for _, count := range distribution {
+			total += count
+		}
+		gomega.Expect(total).To(gomega.Equal(requestCount), "Some requests to the ClusterIP Service failed")
+
+		// With several backends and uniform balancing, a single responder is practically impossible
+		gomega.Expect(len(distribution)).To(gomega.BeNumerically(">=", 2),
+			fmt.Sprintf("All %d requests were served by a single backend: %v", requestCount, distribution))
+	})
+
+	ginkgo.It("should return per-pod records from the headless Service", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Resolving the headless Service ===")
+		output, err := execInClient(example.TestNamespaced("nslookup echo-headless.test-ns.svc.cluster.local"))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Only addresses after the "Name:" line are answers, the ones above it belong to the DNS server
+		answers := output
+		if idx := strings.Index(output, "Name:"); idx >= 0 {
+			answers = output[idx:]
+		}
+		resolved := map[string]bool{}
+		for _, ip := range ipv4Pattern.FindAllString(answers, -1) {
+			resolved[ip] = true
+		}
+		logger.Info().Msgf("Headless Service resolved to: %v\n", resolved)
+
+		gomega.Expect(resolved).To(gomega.HaveLen(len(backendPods)),
+			"Headless Service should return one record per ready pod")
+		for name, ip := range backendPods {
+			gomega.Expect(resolved).To(gomega.HaveKey(ip),
+				"Headless Service has no record for pod %s (%s)", name, ip)
+		}
+	})
+
+	ginkgo.It("should reach the NodePort from within the cluster", func() {
+		defer example.E2ePanicHandler()
+
+		service, err := clientset.CoreV1().Services(example.TestNamespace()).Get(context.TODO(), "echo-nodeport", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(service.Spec.Ports).NotTo(gomega.BeEmpty())
+		nodePort := service.Spec.Ports[0].NodePort
+		gomega.Expect(nodePort).NotTo(gomega.BeZero(), "NodePort was not allocated")
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// kube-proxy opens the NodePort on every node, so each node's internal IP must answer
+		for _, node := range nodes.Items {
+			var nodeIP string
+			for _, addr := range node.Status.Addresses {
+				if addr.Type == v1.NodeInternalIP {
+					nodeIP = addr.Address
+					break
+				}
+			}
+			if nodeIP == "" {
+				logger.Info().Msgf("Node %s has no InternalIP, skipping\n", node.Name)
+				continue
+			}
+
+			output, err := execInClient(fmt.Sprintf("wget -q -T 3 -O - http://%s:%d", nodeIP, nodePort))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(),
+				"NodePort %d not reachable on node %s (%s)", nodePort, node.Name, nodeIP)
+
+			responder := strings.TrimSpace(output)
+			logger.Info().Msgf("Node %-30s %s:%d answered by %s\n", node.Name, nodeIP, nodePort, responder)
+			gomega.Expect(backendPods).To(gomega.HaveKey(responder))
+		}
+	})
+
+	ginkgo.It("should serve HTTP through a port-forward to the ClusterIP Service", func() {
+		defer example.E2ePanicHandler()
+
+		// The request leaves the test process, so this also works when the tests run outside the cluster
+		address, err := example.PortForwardToService(config, clientset, example.TestNamespace(), "echo-clusterip", 80)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Port-forward to echo-clusterip listening on %s ===", address)
+
+		httpClient := &http.Client{Timeout: 5 * time.Second}
+		response, err := httpClient.Get(fmt.Sprintf("http://%s/", address))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer response.Body.Close()
+		body, err := io.ReadAll(response.Body)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		responder := strings.TrimSpace(string(body))
+		logger.Info().Msgf("Port-forwarded request answered by %s with %d\n", responder, response.StatusCode)
+		gomega.Expect(response.StatusCode).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(backendPods).To(gomega.HaveKey(responder))
+	})
+
+})
@@ -2,18 +2,21 @@ package example
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/onsi/ginkgo/v2"
 	"github.com/rs/zerolog"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -21,7 +24,7 @@ import (
 )
 
 var Logger zerolog.Logger
-var LogBuffer *bytes.Buffer
+
 var KubeconfigPath string
 var AllowedToFailTags []string
 
@@ -43,7 +46,6 @@ func parseAllowedToFailTags() error {
 }
 
 func init() {
-	LogBuffer = new(bytes.Buffer)
 	consoleWriter := zerolog.ConsoleWriter{
 		Out:        os.Stdout,
 		NoColor:    true,
@@ -58,8 +60,8 @@ func init() {
 	consoleWriter.FormatFieldName = func(i interface{}) string { return "" }
 	consoleWriter.FormatFieldValue = func(i interface{}) string { return "" }
 
-	// Create a multi-writer to write to both stdout and LogBuffer
-	multiWriter := zerolog.MultiLevelWriter(consoleWriter, LogBuffer)
+	// Create a multi-writer to write to both stdout and the run log the report is built from
+	multiWriter := zerolog.MultiLevelWriter(consoleWriter, processLog)
 
 	Logger = zerolog.New(multiWriter).
 		With().
@@ -177,7 +179,34 @@ func getExternalClusterAPICreds() (*rest.Config, error) {
 	}, nil
 }
 
-func GetClient() (*kubernetes.Clientset, error) {
+// GetRestConfig returns a copy of the process's config for the ACCESS_MODE in .env, which the first
+// call builds, so callers may change their copy. Its clients count their calls, see APICalls in
+// apicalls.go, and use protobuf where the API serves it, see APIContentType.
+func GetRestConfig() (*rest.Config, error) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	config, err := processConfig()
+	if err != nil {
+		return nil, err
+	}
+	return rest.CopyConfig(config), nil
+}
+
+// processConfig returns the process's config, building it on the first call. The caller holds clientMu.
+func processConfig() (*rest.Config, error) {
+	if restConfig != nil {
+		return restConfig, nil
+	}
+	config, err := newRestConfig()
+	if err != nil {
+		return nil, err
+	}
+	restConfig = config
+	return restConfig, nil
+}
+
+// newRestConfig builds the config for the ACCESS_MODE in .env
+func newRestConfig() (*rest.Config, error) {
 	// Load .env to get ACCESS_MODE
 	logger := GetLogger("Setup")
 	err := godotenv.Load(".env")
@@ -197,7 +226,7 @@ func GetClient() (*kubernetes.Clientset, error) {
 			return nil, fmt.Errorf("config creation error: %w", err)
 		}
 		logger.Info().Msgf("Running test with access mode KUBECONFIG")
-		return kubernetes.NewForConfig(config)
+		return clientConfig(config), nil
 
 	case "EXTERNAL_K8S_API":
 		config, err := getExternalClusterAPICreds()
@@ -205,7 +234,7 @@ func GetClient() (*kubernetes.Clientset, error) {
 			return nil, fmt.Errorf("API credentials error: %w", err)
 		}
 		logger.Info().Msgf("Running test with access mode EXTERNAL_K8S_API")
-		return kubernetes.NewForConfig(config)
+		return clientConfig(config), nil
 
 	case "LOCAL_K8S_API":
 		config, err := getLocalClusterAPICreds()
@@ -213,7 +242,7 @@ func GetClient() (*kubernetes.Clientset, error) {
 			return nil, fmt.Errorf("API credentials error: %w", err)
 		}
 		logger.Info().Msgf("Running test with access mode LOCAL_K8S_API")
-		return kubernetes.NewForConfig(config)
+		return clientConfig(config), nil
 
 	default:
 		logger.Info().Msgf("Invalid .env ACCESS_MODE: %s. Must be KUBECONFIG, LOCAL_K8S_API or EXTERNAL_K8S_API\n", accessMode)
@@ -222,15 +251,85 @@ func GetClient() (*kubernetes.Clientset, error) {
 	}
 }
 
+// clientConfig sets up the config of every access mode the same way
+func clientConfig(config *rest.Config) *rest.Config {
+	config = WithContentType(config, APIContentType())
+	config.Wrap(countAPICalls)
+	if LeakCheckMode() != LeakCheckOff {
+		config.Dial = countConnections(config.Dial)
+		config.Wrap(trackTransport)
+	}
+	return config
+}
+
+var (
+	restConfig    *rest.Config
+	client        *kubernetes.Clientset
+	dynamicClient dynamic.Interface
+	clientMu      sync.Mutex
+)
+
+// GetClient returns the process's clientset, which the first call builds from GetRestConfig. The
+// SynchronizedBeforeSuite in main_test.go makes that call, the suites share the clientset, which is
+// safe for concurrent use.
+func GetClient() (*kubernetes.Clientset, error) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+	config, err := processConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err = kubernetes.NewForConfig(config)
+	if err != nil {
+		client = nil
+		return nil, err
+	}
+	return client, nil
+}
+
+// DynamicClient returns the process's dynamic client, which the first call builds from GetRestConfig.
+// ClearNamespace and the dynamic manifest helpers share it instead of building a client, and with it
+// a connection, on every call.
+func DynamicClient() (dynamic.Interface, error) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if dynamicClient != nil {
+		return dynamicClient, nil
+	}
+	config, err := processConfig()
+	if err != nil {
+		return nil, err
+	}
+	created, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("dynamic client creation error: %w", err)
+	}
+	dynamicClient = created
+	return dynamicClient, nil
+}
+
+// readFixture reads a manifest of a suite with its namespaces mapped to the process's, see
+// TestNamespaced, and its cluster-scoped objects renamed for the run, see FixtureName
+func readFixture(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fixtureNamed(TestNamespaced(string(content)))), nil
+}
+
 func GetTopologyDeploymentTestFiles() ([]byte, []byte, error) {
 	hpaPath := filepath.Join("topology_test_deployment_yamls", "hpa-trigger.yaml")
-	hpaContent, err := os.ReadFile(hpaPath)
+	hpaContent, err := readFixture(hpaPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("HPA file error: %w (checked: %s)", err, hpaPath)
 	}
 
 	deploymentPath := filepath.Join("topology_test_deployment_yamls", "topology-dep.yaml")
-	deploymentContent, err := os.ReadFile(deploymentPath)
+	deploymentContent, err := readFixture(deploymentPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
 	}
@@ -240,19 +339,19 @@ func GetTopologyDeploymentTestFiles() ([]byte, []byte, error) {
 
 func GetAffinityDeploymentTestFiles() ([]byte, []byte, []byte, error) {
 	hpaPath := filepath.Join("affinity_test_deployment_yamls", "hpa-trigger.yaml")
-	hpaContent, err := os.ReadFile(hpaPath)
+	hpaContent, err := readFixture(hpaPath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("HPA trigger file error: %w (checked: %s)", err, hpaPath)
 	}
 
 	zonePath := filepath.Join("affinity_test_deployment_yamls", "zone-marker.yaml")
-	zoneContent, err := os.ReadFile(zonePath)
+	zoneContent, err := readFixture(zonePath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("zone marker file error: %w (checked: %s)", err, zonePath)
 	}
 
 	deploymentPath := filepath.Join("affinity_test_deployment_yamls", "affinity-dependent-app.yaml")
-	deploymentContent, err := os.ReadFile(deploymentPath)
+	deploymentContent, err := readFixture(deploymentPath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("affinity-dependent deployment file error: %w (checked: %s)", err, deploymentPath)
 	}
@@ -262,19 +361,19 @@ func GetAffinityDeploymentTestFiles() ([]byte, []byte, []byte, error) {
 
 func GetAntiAffinityTestFiles() ([]byte, []byte, []byte, error) {
 	hpaPath := filepath.Join("anti_affinity_test_deployment_yamls", "hpa-trigger.yaml")
-	hpaContent, err := os.ReadFile(hpaPath)
+	hpaContent, err := readFixture(hpaPath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("HPA trigger file error: %w (checked: %s)", err, hpaPath)
 	}
 
 	zonePath := filepath.Join("anti_affinity_test_deployment_yamls", "zone-marker.yaml")
-	zoneContent, err := os.ReadFile(zonePath)
+	zoneContent, err := readFixture(zonePath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("zone marker file error: %w (checked: %s)", err, zonePath)
 	}
 
 	deploymentPath := filepath.Join("anti_affinity_test_deployment_yamls", "anti-affinity-dependent-app.yaml")
-	deploymentContent, err := os.ReadFile(deploymentPath)
+	deploymentContent, err := readFixture(deploymentPath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("anti-affinity-dependent deployment file error: %w (checked: %s)", err, deploymentPath)
 	}
@@ -284,13 +383,13 @@ func GetAntiAffinityTestFiles() ([]byte, []byte, []byte, error) {
 
 func GetPDBDeploymentTestFiles() ([]byte, []byte, error) {
 	deploymentPath := filepath.Join("pdb_deployment_test_yamls", "deployment.yaml")
-	deploymentContent, err := os.ReadFile(deploymentPath)
+	deploymentContent, err := readFixture(deploymentPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
 	}
 
 	pdbPath := filepath.Join("pdb_deployment_test_yamls", "pdb.yaml")
-	pdbContent, err := os.ReadFile(pdbPath)
+	pdbContent, err := readFixture(pdbPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("PDB file error: %w (checked: %s)", err, pdbPath)
 	}
@@ -300,7 +399,7 @@ func GetPDBDeploymentTestFiles() ([]byte, []byte, error) {
 
 func GetRollingUpdateDeploymentTestFiles() ([]byte, error) {
 	startPath := filepath.Join("rolling_update_deployment_test_yamls", "deployment_start.yaml")
-	startContent, err := os.ReadFile(startPath)
+	startContent, err := readFixture(startPath)
 	if err != nil {
 		return nil, fmt.Errorf("deployment start file error: %w (checked: %s)", err, startPath)
 	}
@@ -310,19 +409,19 @@ func GetRollingUpdateDeploymentTestFiles() ([]byte, error) {
 
 func GetAffinityStatefulSetTestFiles() ([]byte, []byte, []byte, error) {
 	hpaPath := filepath.Join("affinity_test_statefulset_yamls", "hpa-trigger.yaml")
-	hpaContent, err := os.ReadFile(hpaPath)
+	hpaContent, err := readFixture(hpaPath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("HPA trigger file error: %w (checked: %s)", err, hpaPath)
 	}
 
 	zonePath := filepath.Join("affinity_test_statefulset_yamls", "zone-marker.yaml")
-	zoneContent, err := os.ReadFile(zonePath)
+	zoneContent, err := readFixture(zonePath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("zone marker file error: %w (checked: %s)", err, zonePath)
 	}
 
 	statefulSetPath := filepath.Join("affinity_test_statefulset_yamls", "affinity-dependent-app.yaml")
-	statefulSetContent, err := os.ReadFile(statefulSetPath)
+	statefulSetContent, err := readFixture(statefulSetPath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("affinity-dependent StatefulSet file error: %w (checked: %s)", err, statefulSetPath)
 	}
@@ -332,19 +431,19 @@ func GetAffinityStatefulSetTestFiles() ([]byte, []byte, []byte, error) {
 
 func GetAntiAffinityStatefulSetTestFiles() ([]byte, []byte, []byte, error) {
 	hpaPath := filepath.Join("anti_affinity_statefulset_test_yamls", "hpa-trigger.yaml")
-	hpaContent, err := os.ReadFile(hpaPath)
+	hpaContent, err := readFixture(hpaPath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("HPA trigger file error: %w (checked: %s)", err, hpaPath)
 	}
 
 	zonePath := filepath.Join("anti_affinity_statefulset_test_yamls", "zone-marker.yaml")
-	zoneContent, err := os.ReadFile(zonePath)
+	zoneContent, err := readFixture(zonePath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("zone marker file error: %w (checked: %s)", err, zonePath)
 	}
 
 	statefulSetPath := filepath.Join("anti_affinity_statefulset_test_yamls", "anti-affinity-dependent-app.yaml")
-	statefulSetContent, err := os.ReadFile(statefulSetPath)
+	statefulSetContent, err := readFixture(statefulSetPath)
 	if err != nil {
 		return nil, nil, nil, fmt.Errorf("anti-affinity-dependent StatefulSet file error: %w (checked: %s)", err, statefulSetPath)
 	}
@@ -354,13 +453,13 @@ func GetAntiAffinityStatefulSetTestFiles() ([]byte, []byte, []byte, error) {
 
 func GetStatefulSetTestFiles() ([]byte, []byte, error) {
 	hpaPath := filepath.Join("topology_test_statefulset_yamls", "hpa-trigger.yaml")
-	hpaContent, err := os.ReadFile(hpaPath)
+	hpaContent, err := readFixture(hpaPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("HPA file error: %w (checked: %s)", err, hpaPath)
 	}
 
 	statefulsetPath := filepath.Join("topology_test_statefulset_yamls", "topology-statefulset.yaml")
-	statefulsetContent, err := os.ReadFile(statefulsetPath)
+	statefulsetContent, err := readFixture(statefulsetPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("StatefulSet file error: %w (checked: %s)", err, statefulsetPath)
 	}
@@ -370,13 +469,13 @@ func GetStatefulSetTestFiles() ([]byte, []byte, error) {
 
 func GetPDBStSTestFiles() ([]byte, []byte, error) {
 	pdbPath := filepath.Join("pdb_statefulset_test_yamls", "pdb.yaml")
-	pdbContent, err := os.ReadFile(pdbPath)
+	pdbContent, err := readFixture(pdbPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("PDB file error: %w (checked: %s)", err, pdbPath)
 	}
 
 	stsPath := filepath.Join("pdb_statefulset_test_yamls", "sts.yaml")
-	stsContent, err := os.ReadFile(stsPath)
+	stsContent, err := readFixture(stsPath)
 	if err != nil {
 		return nil, nil, fmt.Errorf("StatefulSet file error: %w (checked: %s)", err, stsPath)
 	}
@@ -386,7 +485,7 @@ func GetPDBStSTestFiles() ([]byte, []byte, error) {
 
 func GetRollingUpdateStatefulSetTestFiles() ([]byte, error) {
 	startPath := filepath.Join("rolling_update_sts_yamls", "sts_start.yaml")
-	startContent, err := os.ReadFile(startPath)
+	startContent, err := readFixture(startPath)
 	if err != nil {
 		return nil, fmt.Errorf("statefulset start file error: %w (checked: %s)", err, startPath)
 	}
@@ -394,20 +493,847 @@ func GetRollingUpdateStatefulSetTestFiles() ([]byte, error) {
 	return startContent, nil
 }
 
+func GetJobTestFiles() ([]byte, []byte, []byte, error) {
+	parallelPath := filepath.Join("job_test_yamls", "parallel-job.yaml")
+	parallelContent, err := readFixture(parallelPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("parallel Job file error: %w (checked: %s)", err, parallelPath)
+	}
+
+	failingPath := filepath.Join("job_test_yamls", "failing-job.yaml")
+	failingContent, err := readFixture(failingPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failing Job file error: %w (checked: %s)", err, failingPath)
+	}
+
+	deadlinePath := filepath.Join("job_test_yamls", "deadline-job.yaml")
+	deadlineContent, err := readFixture(deadlinePath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("deadline Job file error: %w (checked: %s)", err, deadlinePath)
+	}
+
+	return parallelContent, failingContent, deadlineContent, nil
+}
+
+func GetCronJobTestFiles() ([]byte, []byte, []byte, error) {
+	historyPath := filepath.Join("cronjob_test_yamls", "history-cronjob.yaml")
+	historyContent, err := readFixture(historyPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("history CronJob file error: %w (checked: %s)", err, historyPath)
+	}
+
+	forbidPath := filepath.Join("cronjob_test_yamls", "forbid-cronjob.yaml")
+	forbidContent, err := readFixture(forbidPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("forbid CronJob file error: %w (checked: %s)", err, forbidPath)
+	}
+
+	replacePath := filepath.Join("cronjob_test_yamls", "replace-cronjob.yaml")
+	replaceContent, err := readFixture(replacePath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("replace CronJob file error: %w (checked: %s)", err, replacePath)
+	}
+
+	return historyContent, forbidContent, replaceContent, nil
+}
+
+func GetNetworkPolicyTestFiles() ([]byte, []byte, []byte, []byte, error) {
+	workloadsPath := filepath.Join("networkpolicy_test_yamls", "workloads.yaml")
+	workloadsContent, err := readFixture(workloadsPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("workloads file error: %w (checked: %s)", err, workloadsPath)
+	}
+
+	clientsPath := filepath.Join("networkpolicy_test_yamls", "clients.yaml")
+	clientsContent, err := readFixture(clientsPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("clients file error: %w (checked: %s)", err, clientsPath)
+	}
+
+	denyAllPath := filepath.Join("networkpolicy_test_yamls", "deny-all.yaml")
+	denyAllContent, err := readFixture(denyAllPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("deny-all NetworkPolicy file error: %w (checked: %s)", err, denyAllPath)
+	}
+
+	allowPath := filepath.Join("networkpolicy_test_yamls", "allow-selected-client.yaml")
+	allowContent, err := readFixture(allowPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("allow NetworkPolicy file error: %w (checked: %s)", err, allowPath)
+	}
+
+	return workloadsContent, clientsContent, denyAllContent, allowContent, nil
+}
+
+func GetServiceTestFiles() ([]byte, []byte, error) {
+	backendPath := filepath.Join("service_test_yamls", "backend.yaml")
+	backendContent, err := readFixture(backendPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("backend file error: %w (checked: %s)", err, backendPath)
+	}
+
+	clientPath := filepath.Join("service_test_yamls", "client.yaml")
+	clientContent, err := readFixture(clientPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client pod file error: %w (checked: %s)", err, clientPath)
+	}
+
+	return backendContent, clientContent, nil
+}
+
+func GetDNSTestFiles() ([]byte, []byte, error) {
+	servicesPath := filepath.Join("dns_test_yamls", "services.yaml")
+	servicesContent, err := readFixture(servicesPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("services file error: %w (checked: %s)", err, servicesPath)
+	}
+
+	clientsPath := filepath.Join("dns_test_yamls", "clients.yaml")
+	clientsContent, err := readFixture(clientsPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("DNS clients file error: %w (checked: %s)", err, clientsPath)
+	}
+
+	return servicesContent, clientsContent, nil
+}
+
+func GetPVCTestFiles() ([]byte, []byte, []byte, []byte, error) {
+	pvcPath := filepath.Join("pvc_test_yamls", "pvc.yaml")
+	pvcContent, err := readFixture(pvcPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("PVC file error: %w (checked: %s)", err, pvcPath)
+	}
+
+	writerPath := filepath.Join("pvc_test_yamls", "writer-pod.yaml")
+	writerContent, err := readFixture(writerPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("writer pod file error: %w (checked: %s)", err, writerPath)
+	}
+
+	readerPath := filepath.Join("pvc_test_yamls", "reader-pod.yaml")
+	readerContent, err := readFixture(readerPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("reader pod file error: %w (checked: %s)", err, readerPath)
+	}
+
+	conflictPath := filepath.Join("pvc_test_yamls", "conflict-pod.yaml")
+	conflictContent, err := readFixture(conflictPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("conflict pod file error: %w (checked: %s)", err, conflictPath)
+	}
+
+	return pvcContent, writerContent, readerContent, conflictContent, nil
+}
+
+func GetVolumeExpansionTestFiles() ([]byte, []byte, error) {
+	pvcPath := filepath.Join("volume_expansion_test_yamls", "expandable-pvc.yaml")
+	pvcContent, err := readFixture(pvcPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PVC file error: %w (checked: %s)", err, pvcPath)
+	}
+
+	podPath := filepath.Join("volume_expansion_test_yamls", "writer-pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("writer pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return pvcContent, podContent, nil
+}
+
+func GetStatefulSetOrderedScalingTestFiles() ([]byte, []byte, error) {
+	orderedPath := filepath.Join("sts_ordered_scaling_test_yamls", "ordered-sts.yaml")
+	orderedContent, err := readFixture(orderedPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OrderedReady StatefulSet file error: %w (checked: %s)", err, orderedPath)
+	}
+
+	parallelPath := filepath.Join("sts_ordered_scaling_test_yamls", "parallel-sts.yaml")
+	parallelContent, err := readFixture(parallelPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Parallel StatefulSet file error: %w (checked: %s)", err, parallelPath)
+	}
+
+	return orderedContent, parallelContent, nil
+}
+
+func GetStatefulSetPVCRetentionTestFiles() ([]byte, []byte, error) {
+	retainPath := filepath.Join("sts_pvc_retention_test_yamls", "retain-sts.yaml")
+	retainContent, err := readFixture(retainPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Retain StatefulSet file error: %w (checked: %s)", err, retainPath)
+	}
+
+	deletePath := filepath.Join("sts_pvc_retention_test_yamls", "delete-sts.yaml")
+	deleteContent, err := readFixture(deletePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Delete StatefulSet file error: %w (checked: %s)", err, deletePath)
+	}
+
+	return retainContent, deleteContent, nil
+}
+
+func GetNodeDrainTestFiles() ([]byte, []byte, error) {
+	pdbPath := filepath.Join("node_drain_test_yamls", "pdb.yaml")
+	pdbContent, err := readFixture(pdbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PDB file error: %w (checked: %s)", err, pdbPath)
+	}
+
+	deploymentPath := filepath.Join("node_drain_test_yamls", "deployment.yaml")
+	deploymentContent, err := readFixture(deploymentPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
+	}
+
+	return pdbContent, deploymentContent, nil
+}
+
+func GetTaintsTestFiles() ([]byte, []byte, []byte, []byte, error) {
+	untoleratedPath := filepath.Join("taints_test_yamls", "untolerated-deployment.yaml")
+	untoleratedContent, err := readFixture(untoleratedPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("untolerated deployment file error: %w (checked: %s)", err, untoleratedPath)
+	}
+
+	toleratedPath := filepath.Join("taints_test_yamls", "tolerated-pod.yaml")
+	toleratedContent, err := readFixture(toleratedPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("tolerated pod file error: %w (checked: %s)", err, toleratedPath)
+	}
+
+	timedPath := filepath.Join("taints_test_yamls", "noexecute-timed-pod.yaml")
+	timedContent, err := readFixture(timedPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("NoExecute timed pod file error: %w (checked: %s)", err, timedPath)
+	}
+
+	foreverPath := filepath.Join("taints_test_yamls", "noexecute-forever-pod.yaml")
+	foreverContent, err := readFixture(foreverPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("NoExecute forever pod file error: %w (checked: %s)", err, foreverPath)
+	}
+
+	return untoleratedContent, toleratedContent, timedContent, foreverContent, nil
+}
+
+func GetNodeAffinityTestFiles() ([]byte, []byte, []byte, []byte, error) {
+	requiredNodePath := filepath.Join("node_affinity_test_yamls", "required-node.yaml")
+	requiredNodeContent, err := readFixture(requiredNodePath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("required node affinity deployment file error: %w (checked: %s)", err, requiredNodePath)
+	}
+
+	requiredUnsatisfiablePath := filepath.Join("node_affinity_test_yamls", "required-unsatisfiable.yaml")
+	requiredUnsatisfiableContent, err := readFixture(requiredUnsatisfiablePath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("unsatisfiable required node affinity deployment file error: %w (checked: %s)", err, requiredUnsatisfiablePath)
+	}
+
+	preferredNodePath := filepath.Join("node_affinity_test_yamls", "preferred-node.yaml")
+	preferredNodeContent, err := readFixture(preferredNodePath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("preferred node affinity deployment file error: %w (checked: %s)", err, preferredNodePath)
+	}
+
+	preferredUnsatisfiablePath := filepath.Join("node_affinity_test_yamls", "preferred-unsatisfiable.yaml")
+	preferredUnsatisfiableContent, err := readFixture(preferredUnsatisfiablePath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("unsatisfiable preferred node affinity deployment file error: %w (checked: %s)", err, preferredUnsatisfiablePath)
+	}
+
+	return requiredNodeContent, requiredUnsatisfiableContent, preferredNodeContent, preferredUnsatisfiableContent, nil
+}
+
+func GetPriorityPreemptionTestFiles() ([]byte, []byte, []byte, error) {
+	priorityClassesPath := filepath.Join("priority_preemption_test_yamls", "priority-classes.yaml")
+	priorityClassesContent, err := readFixture(priorityClassesPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("PriorityClass file error: %w (checked: %s)", err, priorityClassesPath)
+	}
+
+	lowPriorityPath := filepath.Join("priority_preemption_test_yamls", "low-priority-deployment.yaml")
+	lowPriorityContent, err := readFixture(lowPriorityPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("low priority deployment file error: %w (checked: %s)", err, lowPriorityPath)
+	}
+
+	highPriorityPath := filepath.Join("priority_preemption_test_yamls", "high-priority-pod.yaml")
+	highPriorityContent, err := readFixture(highPriorityPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("high priority pod file error: %w (checked: %s)", err, highPriorityPath)
+	}
+
+	return priorityClassesContent, lowPriorityContent, highPriorityContent, nil
+}
+
+func GetHPAScaleDownTestFiles() ([]byte, []byte, error) {
+	hpaPath := filepath.Join("hpa_scale_down_test_yamls", "hpa.yaml")
+	hpaContent, err := readFixture(hpaPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("HPA file error: %w (checked: %s)", err, hpaPath)
+	}
+
+	deploymentPath := filepath.Join("hpa_scale_down_test_yamls", "deployment.yaml")
+	deploymentContent, err := readFixture(deploymentPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
+	}
+
+	return hpaContent, deploymentContent, nil
+}
+
+func GetVPATestFiles() ([]byte, []byte, error) {
+	vpaPath := filepath.Join("vpa_test_yamls", "vpa.yaml")
+	vpaContent, err := readFixture(vpaPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("VPA file error: %w (checked: %s)", err, vpaPath)
+	}
+
+	deploymentPath := filepath.Join("vpa_test_yamls", "deployment.yaml")
+	deploymentContent, err := readFixture(deploymentPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
+	}
+
+	return vpaContent, deploymentContent, nil
+}
+
+func GetPodSecurityTestFiles() ([]byte, []byte, []byte, error) {
+	privilegedPath := filepath.Join("psa_test_yamls", "privileged-pod.yaml")
+	privilegedContent, err := readFixture(privilegedPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("privileged pod file error: %w (checked: %s)", err, privilegedPath)
+	}
+
+	hostPathPath := filepath.Join("psa_test_yamls", "hostpath-pod.yaml")
+	hostPathContent, err := readFixture(hostPathPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("hostPath pod file error: %w (checked: %s)", err, hostPathPath)
+	}
+
+	compliantPath := filepath.Join("psa_test_yamls", "compliant-pod.yaml")
+	compliantContent, err := readFixture(compliantPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("compliant pod file error: %w (checked: %s)", err, compliantPath)
+	}
+
+	return privilegedContent, hostPathContent, compliantContent, nil
+}
+
+func GetRBACTestFiles() ([]byte, error) {
+	permissionsPath := filepath.Join("rbac_test_yamls", "expected-permissions.yaml")
+	permissionsContent, err := readFixture(permissionsPath)
+	if err != nil {
+		return nil, fmt.Errorf("expected permissions file error: %w (checked: %s)", err, permissionsPath)
+	}
+
+	return permissionsContent, nil
+}
+
+func GetProjectedTokenTestFiles() ([]byte, error) {
+	podPath := filepath.Join("projected_token_test_yamls", "token-pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, fmt.Errorf("token pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return podContent, nil
+}
+
+func GetPropagationTestFiles() ([]byte, []byte, error) {
+	configPath := filepath.Join("propagation_test_yamls", "config.yaml")
+	configContent, err := readFixture(configPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ConfigMap and Secret file error: %w (checked: %s)", err, configPath)
+	}
+
+	podPath := filepath.Join("propagation_test_yamls", "pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return configContent, podContent, nil
+}
+
+func GetProbesTestFiles() ([]byte, []byte, []byte, error) {
+	readinessPath := filepath.Join("probes_test_yamls", "readiness.yaml")
+	readinessContent, err := readFixture(readinessPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("readiness probe file error: %w (checked: %s)", err, readinessPath)
+	}
+
+	livenessPath := filepath.Join("probes_test_yamls", "liveness.yaml")
+	livenessContent, err := readFixture(livenessPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("liveness probe file error: %w (checked: %s)", err, livenessPath)
+	}
+
+	startupPath := filepath.Join("probes_test_yamls", "startup.yaml")
+	startupContent, err := readFixture(startupPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("startup probe file error: %w (checked: %s)", err, startupPath)
+	}
+
+	return readinessContent, livenessContent, startupContent, nil
+}
+
+func GetGracefulTerminationTestFiles() ([]byte, []byte, error) {
+	servicePath := filepath.Join("graceful_termination_test_yamls", "service.yaml")
+	serviceContent, err := readFixture(servicePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("service file error: %w (checked: %s)", err, servicePath)
+	}
+
+	podPath := filepath.Join("graceful_termination_test_yamls", "pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return serviceContent, podContent, nil
+}
+
+func GetInitContainersTestFiles() ([]byte, []byte, []byte, error) {
+	orderedPath := filepath.Join("init_containers_test_yamls", "ordered.yaml")
+	orderedContent, err := readFixture(orderedPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("ordered init containers file error: %w (checked: %s)", err, orderedPath)
+	}
+
+	failingAlwaysPath := filepath.Join("init_containers_test_yamls", "failing-always.yaml")
+	failingAlwaysContent, err := readFixture(failingAlwaysPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failing init container (restartPolicy Always) file error: %w (checked: %s)", err, failingAlwaysPath)
+	}
+
+	failingNeverPath := filepath.Join("init_containers_test_yamls", "failing-never.yaml")
+	failingNeverContent, err := readFixture(failingNeverPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failing init container (restartPolicy Never) file error: %w (checked: %s)", err, failingNeverPath)
+	}
+
+	return orderedContent, failingAlwaysContent, failingNeverContent, nil
+}
+
+func GetDebugContainerTestFiles() ([]byte, []byte, error) {
+	targetPath := filepath.Join("debug_container_test_yamls", "target.yaml")
+	targetContent, err := readFixture(targetPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("target pod file error: %w (checked: %s)", err, targetPath)
+	}
+
+	debuggerPath := filepath.Join("debug_container_test_yamls", "debugger.yaml")
+	debuggerContent, err := readFixture(debuggerPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("debugger container file error: %w (checked: %s)", err, debuggerPath)
+	}
+
+	return targetContent, debuggerContent, nil
+}
+
+func GetCanaryTestFiles() ([]byte, []byte, []byte, []byte, error) {
+	servicePath := filepath.Join("canary_test_yamls", "service.yaml")
+	serviceContent, err := readFixture(servicePath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("service file error: %w (checked: %s)", err, servicePath)
+	}
+
+	stablePath := filepath.Join("canary_test_yamls", "stable.yaml")
+	stableContent, err := readFixture(stablePath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("stable deployment file error: %w (checked: %s)", err, stablePath)
+	}
+
+	canaryPath := filepath.Join("canary_test_yamls", "canary.yaml")
+	canaryContent, err := readFixture(canaryPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("canary deployment file error: %w (checked: %s)", err, canaryPath)
+	}
+
+	clientPath := filepath.Join("canary_test_yamls", "client.yaml")
+	clientContent, err := readFixture(clientPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("client pod file error: %w (checked: %s)", err, clientPath)
+	}
+
+	return serviceContent, stableContent, canaryContent, clientContent, nil
+}
+
+func GetTopologySpreadPolicyTestFiles() ([]byte, error) {
+	deploymentPath := filepath.Join("topology_spread_policy_test_yamls", "deployment.yaml")
+	deploymentContent, err := readFixture(deploymentPath)
+	if err != nil {
+		return nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
+	}
+
+	return deploymentContent, nil
+}
+
+func GetZoneOutageTestFiles() ([]byte, []byte, error) {
+	pdbPath := filepath.Join("zone_outage_test_yamls", "pdb.yaml")
+	pdbContent, err := readFixture(pdbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PDB file error: %w (checked: %s)", err, pdbPath)
+	}
+
+	deploymentPath := filepath.Join("zone_outage_test_yamls", "deployment.yaml")
+	deploymentContent, err := readFixture(deploymentPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
+	}
+
+	return pdbContent, deploymentContent, nil
+}
+
+func GetAPISLOTestFiles() ([]byte, error) {
+	configMapPath := filepath.Join("api_slo_test_yamls", "configmap.yaml")
+	configMapContent, err := readFixture(configMapPath)
+	if err != nil {
+		return nil, fmt.Errorf("ConfigMap file error: %w (checked: %s)", err, configMapPath)
+	}
+
+	return configMapContent, nil
+}
+
+func GetWebhookLatencyTestFiles() ([]byte, error) {
+	podPath := filepath.Join("webhook_latency_test_yamls", "pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, fmt.Errorf("pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return podContent, nil
+}
+
+func GetCRDLifecycleTestFiles() ([]byte, []byte, error) {
+	crdPath := filepath.Join("crd_lifecycle_test_yamls", "crd.yaml")
+	crdContent, err := readFixture(crdPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CRD file error: %w (checked: %s)", err, crdPath)
+	}
+
+	widgetPath := filepath.Join("crd_lifecycle_test_yamls", "widget.yaml")
+	widgetContent, err := readFixture(widgetPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("widget file error: %w (checked: %s)", err, widgetPath)
+	}
+
+	return crdContent, widgetContent, nil
+}
+
+func GetImagePullTestFiles() ([]byte, error) {
+	podPath := filepath.Join("image_pull_test_yamls", "pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, fmt.Errorf("pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return podContent, nil
+}
+
+func GetPodStartupTestFiles() ([]byte, error) {
+	podPath := filepath.Join("pod_startup_test_yamls", "pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, fmt.Errorf("pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return podContent, nil
+}
+
+func GetNamespaceDeletionTestFiles() ([]byte, []byte, error) {
+	objectsPath := filepath.Join("namespace_deletion_test_yamls", "objects.yaml")
+	objectsContent, err := readFixture(objectsPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("objects file error: %w (checked: %s)", err, objectsPath)
+	}
+
+	heldPath := filepath.Join("namespace_deletion_test_yamls", "held-configmap.yaml")
+	heldContent, err := readFixture(heldPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("held ConfigMap file error: %w (checked: %s)", err, heldPath)
+	}
+
+	return objectsContent, heldContent, nil
+}
+
+func GetEvictionTestFiles() ([]byte, []byte, error) {
+	pdbPath := filepath.Join("eviction_test_yamls", "pdb.yaml")
+	pdbContent, err := readFixture(pdbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PDB file error: %w (checked: %s)", err, pdbPath)
+	}
+
+	deploymentPath := filepath.Join("eviction_test_yamls", "deployment.yaml")
+	deploymentContent, err := readFixture(deploymentPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
+	}
+
+	return pdbContent, deploymentContent, nil
+}
+
+func GetDeschedulerTestFiles() ([]byte, []byte, error) {
+	pdbPath := filepath.Join("descheduler_test_yamls", "pdb.yaml")
+	pdbContent, err := readFixture(pdbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("PDB file error: %w (checked: %s)", err, pdbPath)
+	}
+
+	deploymentPath := filepath.Join("descheduler_test_yamls", "deployment.yaml")
+	deploymentContent, err := readFixture(deploymentPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
+	}
+
+	return pdbContent, deploymentContent, nil
+}
+
+func GetRuntimeClassTestFiles() ([]byte, error) {
+	podPath := filepath.Join("runtime_class_test_yamls", "pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, fmt.Errorf("pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return podContent, nil
+}
+
+func GetExtendedResourceTestFiles() ([]byte, error) {
+	podPath := filepath.Join("extended_resource_test_yamls", "pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, fmt.Errorf("pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return podContent, nil
+}
+
+func GetSecurityContextTestFiles() ([]byte, error) {
+	podPath := filepath.Join("security_context_test_yamls", "pod.yaml")
+	podContent, err := readFixture(podPath)
+	if err != nil {
+		return nil, fmt.Errorf("pod file error: %w (checked: %s)", err, podPath)
+	}
+
+	return podContent, nil
+}
+
+func GetHostPortTestFiles() ([]byte, []byte, []byte, error) {
+	hostPortPath := filepath.Join("hostport_test_yamls", "hostport-pod.yaml")
+	hostPortContent, err := readFixture(hostPortPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("hostPort pod file error: %w (checked: %s)", err, hostPortPath)
+	}
+
+	hostNetworkPath := filepath.Join("hostport_test_yamls", "hostnetwork-pod.yaml")
+	hostNetworkContent, err := readFixture(hostNetworkPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("hostNetwork pod file error: %w (checked: %s)", err, hostNetworkPath)
+	}
+
+	clientPath := filepath.Join("hostport_test_yamls", "client.yaml")
+	clientContent, err := readFixture(clientPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("client file error: %w (checked: %s)", err, clientPath)
+	}
+
+	return hostPortContent, hostNetworkContent, clientContent, nil
+}
+
+func GetColocationTestFiles() ([]byte, []byte, error) {
+	markerPath := filepath.Join("colocation_test_yamls", "marker.yaml")
+	markerContent, err := readFixture(markerPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marker file error: %w (checked: %s)", err, markerPath)
+	}
+
+	dependentPath := filepath.Join("colocation_test_yamls", "dependent.yaml")
+	dependentContent, err := readFixture(dependentPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("dependent file error: %w (checked: %s)", err, dependentPath)
+	}
+
+	return markerContent, dependentContent, nil
+}
+
+func GetOOMTestFiles() ([]byte, []byte, error) {
+	oomPath := filepath.Join("oom_test_yamls", "oom-pod.yaml")
+	oomContent, err := readFixture(oomPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("OOM pod file error: %w (checked: %s)", err, oomPath)
+	}
+
+	throttledPath := filepath.Join("oom_test_yamls", "cpu-throttled-pod.yaml")
+	throttledContent, err := readFixture(throttledPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CPU throttled pod file error: %w (checked: %s)", err, throttledPath)
+	}
+
+	return oomContent, throttledContent, nil
+}
+
+func GetNodePressureTestFiles() ([]byte, []byte, []byte, []byte, error) {
+	writerPath := filepath.Join("node_pressure_test_yamls", "writer.yaml")
+	writerContent, err := readFixture(writerPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("writer file error: %w (checked: %s)", err, writerPath)
+	}
+
+	bestEffortPath := filepath.Join("node_pressure_test_yamls", "besteffort.yaml")
+	bestEffortContent, err := readFixture(bestEffortPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("BestEffort deployment file error: %w (checked: %s)", err, bestEffortPath)
+	}
+
+	guaranteedPath := filepath.Join("node_pressure_test_yamls", "guaranteed.yaml")
+	guaranteedContent, err := readFixture(guaranteedPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("guaranteed deployment file error: %w (checked: %s)", err, guaranteedPath)
+	}
+
+	pdbPath := filepath.Join("node_pressure_test_yamls", "pdb.yaml")
+	pdbContent, err := readFixture(pdbPath)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("PDB file error: %w (checked: %s)", err, pdbPath)
+	}
+
+	return writerContent, bestEffortContent, guaranteedContent, pdbContent, nil
+}
+
+func GetDataplaneTestFiles() ([]byte, []byte, error) {
+	backendPath := filepath.Join("dataplane_test_yamls", "backend.yaml")
+	backendContent, err := readFixture(backendPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("backend file error: %w (checked: %s)", err, backendPath)
+	}
+
+	clientPath := filepath.Join("dataplane_test_yamls", "client.yaml")
+	clientContent, err := readFixture(clientPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client file error: %w (checked: %s)", err, clientPath)
+	}
+
+	return backendContent, clientContent, nil
+}
+
+func GetCSRTestFiles() ([]byte, error) {
+	csrPath := filepath.Join("csr_test_yamls", "csr.yaml")
+	csrContent, err := readFixture(csrPath)
+	if err != nil {
+		return nil, fmt.Errorf("CSR file error: %w (checked: %s)", err, csrPath)
+	}
+
+	return csrContent, nil
+}
+
+func GetTTLAfterFinishedTestFiles() ([]byte, []byte, error) {
+	succeededPath := filepath.Join("ttl_after_finished_test_yamls", "succeeded-job.yaml")
+	succeededContent, err := readFixture(succeededPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("succeeded job file error: %w (checked: %s)", err, succeededPath)
+	}
+
+	failedPath := filepath.Join("ttl_after_finished_test_yamls", "failed-job.yaml")
+	failedContent, err := readFixture(failedPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed job file error: %w (checked: %s)", err, failedPath)
+	}
+
+	return succeededContent, failedContent, nil
+}
+
+func GetStatefulSetDNSTestFiles() ([]byte, []byte, error) {
+	statefulSetPath := filepath.Join("sts_dns_test_yamls", "statefulset.yaml")
+	statefulSetContent, err := readFixture(statefulSetPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("statefulset file error: %w (checked: %s)", err, statefulSetPath)
+	}
+
+	clientPath := filepath.Join("sts_dns_test_yamls", "client.yaml")
+	clientContent, err := readFixture(clientPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("client file error: %w (checked: %s)", err, clientPath)
+	}
+
+	return statefulSetContent, clientContent, nil
+}
+
+func GetCordonScalingTestFiles() ([]byte, []byte, error) {
+	deploymentPath := filepath.Join("cordon_scaling_test_yamls", "deployment.yaml")
+	deploymentContent, err := readFixture(deploymentPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("deployment file error: %w (checked: %s)", err, deploymentPath)
+	}
+
+	hpaPath := filepath.Join("cordon_scaling_test_yamls", "hpa.yaml")
+	hpaContent, err := readFixture(hpaPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("HPA file error: %w (checked: %s)", err, hpaPath)
+	}
+
+	return deploymentContent, hpaContent, nil
+}
+
+func GetKEDATestFiles() ([]byte, []byte, []byte, error) {
+	sourcePath := filepath.Join("keda_test_yamls", "source.yaml")
+	sourceContent, err := readFixture(sourcePath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("event source file error: %w (checked: %s)", err, sourcePath)
+	}
+
+	workloadPath := filepath.Join("keda_test_yamls", "workload.yaml")
+	workloadContent, err := readFixture(workloadPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("workload file error: %w (checked: %s)", err, workloadPath)
+	}
+
+	scaledObjectPath := filepath.Join("keda_test_yamls", "scaledobject.yaml")
+	scaledObjectContent, err := readFixture(scaledObjectPath)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("ScaledObject file error: %w (checked: %s)", err, scaledObjectPath)
+	}
+
+	return sourceContent, workloadContent, scaledObjectContent, nil
+}
+
 type FinalReport struct {
-	TestTimestamp       string                              `json:"test_timestamp"`
-	FailingTests        []string                            `json:"failing_tests"`
-	SucceedingTests     []string                            `json:"succeeding_tests"`
-	AllowedToFailTests  []string                            `json:"allowed_to_fail_tests"`
-	FailedButNotAllowed []string                            `json:"failed_but_not_allowed_to_fail"`
-	SuccessRatio        string                              `json:"success_ratio"`
-	LogsByTags          map[string][]map[string]interface{} `json:"logs_by_tags"`
+	TestTimestamp       string   `json:"test_timestamp"`
+	FailingTests        []string `json:"failing_tests"`
+	SucceedingTests     []string `json:"succeeding_tests"`
+	AllowedToFailTests  []string `json:"allowed_to_fail_tests"`
+	FailedButNotAllowed []string `json:"failed_but_not_allowed_to_fail"`
+	SuccessRatio        string   `json:"success_ratio"`
+	// LogsByTags is streamed into the report file from the run logs, see writeReport in runlog.go
+	LogsByTags      map[string][]map[string]interface{} `json:"logs_by_tags"`
+	MetricsByTags   map[string]map[string]interface{}   `json:"metrics_by_tags,omitempty"`
+	ClusterMetadata *CapacitySummary                    `json:"cluster_metadata,omitempty"`
+	APICalls        APICallCounts                       `json:"api_calls,omitempty"`
+}
+
+var (
+	metricsByTags   = make(map[string]map[string]interface{})
+	metricsByTagsMu sync.Mutex
+)
+
+// RecordMetric attaches a named measurement to the test tag's section of the final report.
+// Recording the same name twice keeps the latest value.
+func RecordMetric(tag, name string, value interface{}) {
+	metricsByTagsMu.Lock()
+	defer metricsByTagsMu.Unlock()
+
+	if metricsByTags[tag] == nil {
+		metricsByTags[tag] = make(map[string]interface{})
+	}
+	metricsByTags[tag][name] = value
 }
 
 var _ = ginkgo.ReportAfterSuite("Test Suite Summary", func(report ginkgo.Report) {
 	logger := GetLogger("FinalReportAfterSuite")
 
-	dir := "./temp"
+	dir := runLogDir
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
 		logger.Error().Msgf("Error: Directory %s does not exist", dir)
 		return
@@ -416,45 +1342,63 @@ var _ = ginkgo.ReportAfterSuite("Test Suite Summary", func(report ginkgo.Report)
 	filename := filepath.Join(dir, fmt.Sprintf("test_suite_log_%s.json",
 		time.Now().Format("20060102-150405")))
 
-	lines := bytes.Split(LogBuffer.Bytes(), []byte("\n"))
-	logsByTags := make(map[string][]map[string]interface{})
-	failingTests := []string{}
-	succeedingTests := []string{}
-	allowedToFailTests := []string{}
-	failedButNotAllowedToFail := []string{}
-	allTags := make(map[string]bool)
-
-	for _, line := range lines {
-		if len(line) == 0 {
-			continue
+	// Under ginkgo -p only process 1 writes the report, the other processes left theirs in dir. The run
+	// logs are streamed from their files, the report never holds them in memory.
+	var logs []io.Reader
+	ownLog, closeOwnLog, err := processLog.open()
+	if err != nil {
+		logger.Error().Err(err).Msg("The report is missing the logs of this process")
+	} else {
+		defer closeOwnLog()
+		logs = append(logs, ownLog)
+	}
+	apiCalls := APICalls()
+	processReports, err := readProcessReports(dir, report.SuiteConfig.ParallelTotal)
+	if err != nil {
+		logger.Error().Err(err).Msg("The report is missing the results of a parallel process")
+	}
+	for _, processReport := range processReports {
+		logs = append(logs, bytes.NewReader(processReport.Logs))
+		if processReport.LogFile != "" {
+			file, err := os.Open(processReport.LogFile)
+			if err != nil {
+				logger.Error().Err(err).Msg("The report is missing the logs of a parallel process")
+			} else {
+				defer file.Close()
+				logs = append(logs, file)
+			}
 		}
-
-		var logEntry map[string]interface{}
-		if err := json.Unmarshal(line, &logEntry); err != nil {
-			continue
+		for call, count := range processReport.APICalls {
+			apiCalls[call] += count
 		}
-
-		if tagValue, ok := logEntry["tag"].(string); ok && tagValue != "Setup" {
-			allTags[tagValue] = true
-
-			if msg, ok := logEntry["message"].(string); ok && strings.Contains(msg, "TEST_FAILED") {
-				failingTests = append(failingTests, tagValue)
-				if contains(AllowedToFailTags, tagValue) {
-					allowedToFailTests = append(allowedToFailTests, tagValue)
-				} else {
-					failedButNotAllowedToFail = append(failedButNotAllowedToFail, tagValue)
-				}
+		for tag, metrics := range processReport.Metrics {
+			for name, value := range metrics {
+				RecordMetric(tag, name, value)
 			}
-
-			delete(logEntry, "tag")
-			delete(logEntry, "level")
-			logsByTags[tagValue] = append(logsByTags[tagValue], logEntry)
 		}
 	}
 
-	for tag := range allTags {
-		if !contains(failingTests, tag) {
+	logsByTags, err := splitRunLogs(dir, logs)
+	if err != nil {
+		logger.Error().Err(err).Msg("Failed to read the run logs")
+		return
+	}
+	defer logsByTags.remove()
+
+	failingTests := []string{}
+	succeedingTests := []string{}
+	allowedToFailTests := []string{}
+	failedButNotAllowedToFail := []string{}
+	for _, tag := range logsByTags.tags {
+		if !logsByTags.failed[tag] {
 			succeedingTests = append(succeedingTests, tag)
+			continue
+		}
+		failingTests = append(failingTests, tag)
+		if contains(AllowedToFailTags, tag) {
+			allowedToFailTests = append(allowedToFailTests, tag)
+		} else {
+			failedButNotAllowedToFail = append(failedButNotAllowedToFail, tag)
 		}
 	}
 
@@ -469,16 +1413,28 @@ var _ = ginkgo.ReportAfterSuite("Test Suite Summary", func(report ginkgo.Report)
 		AllowedToFailTests:  allowedToFailTests,
 		FailedButNotAllowed: failedButNotAllowedToFail,
 		SuccessRatio:        fmt.Sprintf("%.2f%%", successRatio),
-		LogsByTags:          logsByTags,
 	}
 
-	jsonData, err := json.MarshalIndent(finalJSON, "", " ")
-	if err != nil {
-		logger.Error().Err(err).Msg("Failed to serialize logs to JSON")
-		return
+	metricsByTagsMu.Lock()
+	if len(metricsByTags) > 0 {
+		finalJSON.MetricsByTags = metricsByTags
+	}
+	metricsByTagsMu.Unlock()
+
+	// The calls of the whole run, before the capacity lookup below adds its own
+	finalJSON.APICalls = apiCalls
+
+	// The cluster the results came from, so reports from differently sized clusters aren't compared blindly
+	if clientset, err := GetClient(); err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		finalJSON.ClusterMetadata, err = ClusterCapacity(ctx, clientset)
+		cancel()
+		if err != nil {
+			logger.Warn().Err(err).Msg("Failed to read the cluster capacity for the report")
+		}
 	}
 
-	if err := os.WriteFile(filename, jsonData, 0644); err != nil {
+	if err := writeReport(filename, finalJSON, logsByTags); err != nil {
 		logger.Error().Err(err).Msg("Failed to write test suite log file")
 	} else {
 		logger.Info().Str("file", filename).Msg("Test suite log written successfully")
@@ -0,0 +1,190 @@
+package example
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// snapshotKinds are the kinds SnapshotNamespace captures, in the order RestoreNamespace creates them:
+// what pods reference comes before the workloads. DaemonSets and ServiceAccounts are left out, the test
+// runner's RBAC doesn't allow creating them.
+var snapshotKinds = []struct {
+	kind     string
+	resource schema.GroupVersionResource
+}{
+	{"ConfigMap", schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}},
+	{"Secret", schema.GroupVersionResource{Version: "v1", Resource: "secrets"}},
+	{"PersistentVolumeClaim", schema.GroupVersionResource{Version: "v1", Resource: "persistentvolumeclaims"}},
+	{"Service", schema.GroupVersionResource{Version: "v1", Resource: "services"}},
+	{"NetworkPolicy", schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "networkpolicies"}},
+	{"PodDisruptionBudget", schema.GroupVersionResource{Group: "policy", Version: "v1", Resource: "poddisruptionbudgets"}},
+	{"Deployment", schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}},
+	{"StatefulSet", schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "statefulsets"}},
+	{"CronJob", schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "cronjobs"}},
+	{"Job", schema.GroupVersionResource{Group: "batch", Version: "v1", Resource: "jobs"}},
+	{"HorizontalPodAutoscaler", schema.GroupVersionResource{Group: "autoscaling", Version: "v2", Resource: "horizontalpodautoscalers"}},
+	{"Pod", schema.GroupVersionResource{Version: "v1", Resource: "pods"}},
+}
+
+// NamespaceSnapshot holds the workload objects of a namespace as SnapshotNamespace captured them,
+// stripped of the fields the API server and controllers fill in
+type NamespaceSnapshot struct {
+	Namespace string
+	TakenAt   time.Time
+	Objects   []unstructured.Unstructured
+}
+
+// SnapshotNamespace captures the objects of the namespace a suite creates: ConfigMaps, Secrets,
+// PersistentVolumeClaims, Services, NetworkPolicies, PDBs, Deployments, StatefulSets, CronJobs, Jobs,
+// HPAs and pods. Objects a controller owns, e.g. a Deployment's pods, are left to that controller, and
+// so are the objects Kubernetes creates in every namespace, like the kube-root-ca.crt ConfigMap. The
+// snapshot lets a suite disrupt the namespace and bring it back with RestoreNamespace, and its
+// Manifest reproduces the state under test after a failure.
+func SnapshotNamespace(ctx context.Context, config *rest.Config, namespace string) (*NamespaceSnapshot, error) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("dynamic client creation error: %w", err)
+	}
+
+	snapshot := &NamespaceSnapshot{Namespace: namespace, TakenAt: time.Now()}
+	for _, snapshotKind := range snapshotKinds {
+		list, err := dynamicClient.Resource(snapshotKind.resource).Namespace(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("%s listing in %s failed: %w", snapshotKind.resource.GroupResource(), namespace, err)
+		}
+		for _, object := range list.Items {
+			if skipInSnapshot(&object) {
+				continue
+			}
+			stripServerFields(&object)
+			snapshot.Objects = append(snapshot.Objects, object)
+		}
+	}
+	return snapshot, nil
+}
+
+// skipInSnapshot reports objects that would be recreated anyway, or that are being deleted
+func skipInSnapshot(object *unstructured.Unstructured) bool {
+	if object.GetDeletionTimestamp() != nil || metav1.GetControllerOf(object) != nil {
+		return true
+	}
+	switch object.GetKind() {
+	case "ConfigMap":
+		return object.GetName() == "kube-root-ca.crt"
+	case "Secret":
+		secretType, _, _ := unstructured.NestedString(object.Object, "type")
+		return secretType == "kubernetes.io/service-account-token"
+	}
+	return false
+}
+
+// stripServerFields removes what the API server, controllers and the scheduler set, so the object can
+// be created again as it was applied
+func stripServerFields(object *unstructured.Unstructured) {
+	for _, field := range []string{"uid", "resourceVersion", "creationTimestamp", "generation", "managedFields", "selfLink"} {
+		unstructured.RemoveNestedField(object.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(object.Object, "status")
+
+	annotations := object.GetAnnotations()
+	for key := range annotations {
+		if key == DeploymentRevisionAnnotation || strings.HasPrefix(key, "pv.kubernetes.io/") ||
+			strings.HasPrefix(key, "volume.kubernetes.io/") || strings.HasPrefix(key, "volume.beta.kubernetes.io/") {
+			delete(annotations, key)
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	object.SetAnnotations(annotations)
+
+	switch object.GetKind() {
+	case "Pod":
+		unstructured.RemoveNestedField(object.Object, "spec", "nodeName")
+	case "PersistentVolumeClaim":
+		// The claim binds a new volume, the old one goes with the old claim
+		unstructured.RemoveNestedField(object.Object, "spec", "volumeName")
+	case "Service":
+		if clusterIP, _, _ := unstructured.NestedString(object.Object, "spec", "clusterIP"); clusterIP != "None" {
+			unstructured.RemoveNestedField(object.Object, "spec", "clusterIP")
+			unstructured.RemoveNestedField(object.Object, "spec", "clusterIPs")
+		}
+	case "Job":
+		// The generated selector matches the old Job's UID, the API server generates a new one
+		unstructured.RemoveNestedField(object.Object, "spec", "selector")
+		for _, path := range [][]string{{"metadata", "labels"}, {"spec", "template", "metadata", "labels"}} {
+			labels, found, _ := unstructured.NestedStringMap(object.Object, path...)
+			if !found {
+				continue
+			}
+			delete(labels, "controller-uid")
+			delete(labels, "batch.kubernetes.io/controller-uid")
+			unstructured.SetNestedStringMap(object.Object, labels, path...)
+		}
+	}
+}
+
+// Manifest returns the snapshot as a multi-document YAML manifest that ApplyDynamicManifest, or
+// kubectl apply, recreates the objects from
+func (s *NamespaceSnapshot) Manifest() ([]byte, error) {
+	var documents [][]byte
+	for _, object := range s.Objects {
+		document, err := yaml.Marshal(object.Object)
+		if err != nil {
+			return nil, fmt.Errorf("%s %s serialization failed: %w", object.GetKind(), object.GetName(), err)
+		}
+		documents = append(documents, document)
+	}
+	return bytes.Join(documents, []byte("\n---\n")), nil
+}
+
+// RestoreNamespace recreates the snapshot's objects in its namespace, which must exist. Objects that
+// still exist are left as they are, so restoring after a partial disruption only brings back what
+// is missing. Every object is attempted, the error lists all that failed.
+func RestoreNamespace(ctx context.Context, config *rest.Config, snapshot *NamespaceSnapshot) error {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("dynamic client creation error: %w", err)
+	}
+
+	resources := map[schema.GroupVersionKind]schema.GroupVersionResource{}
+	for _, snapshotKind := range snapshotKinds {
+		resources[snapshotKind.resource.GroupVersion().WithKind(snapshotKind.kind)] = snapshotKind.resource
+	}
+
+	var errors []string
+	for _, object := range snapshot.Objects {
+		resource, found := resources[object.GroupVersionKind()]
+		if !found {
+			errors = append(errors, fmt.Sprintf("%s %s: kind not supported", object.GetKind(), object.GetName()))
+			continue
+		}
+		object := object.DeepCopy()
+		object.SetNamespace(snapshot.Namespace)
+		err := Retry(ctx, DefaultRetryPolicy, func(ctx context.Context) error {
+			_, err := dynamicClient.Resource(resource).Namespace(snapshot.Namespace).Create(ctx, object, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return nil
+			}
+			return err
+		})
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s %s: %v", object.GetKind(), object.GetName(), err))
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("namespace %s restore errors:\n%s", snapshot.Namespace, strings.Join(errors, "\n"))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+)
+
+// SpecTimeout returns how long each spec of the suite with the tag may run: its entry in SPEC_TIMEOUTS
+// from .env, a comma-separated list like "CanaryRolloutTest=20m,DNSTest=5m", or the fallback scaled
+// by the timeout profile
+func SpecTimeout(testTag string, fallback time.Duration) time.Duration {
+	for _, entry := range strings.Split(os.Getenv("SPEC_TIMEOUTS"), ",") {
+		tag, value, found := strings.Cut(entry, "=")
+		if !found || strings.TrimSpace(tag) != testTag {
+			continue
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout <= 0 {
+			Logger.Warn().Msgf("Ignoring invalid SPEC_TIMEOUTS entry %q", entry)
+			continue
+		}
+		return timeout
+	}
+	return CurrentTimeoutProfile().Scale(fallback)
+}
+
+// SpecContext derives the context a spec passes to its client calls from the one Ginkgo hands it. The
+// context ends when the spec does, when Ginkgo interrupts it, or after the timeout, which is used as
+// given: it is the one SpecTimeout returned, already scaled by the timeout profile. context.Cause then
+// names the spec and its timeout. Decorating the spec with the same timeout lets Ginkgo report an
+// overrun as a timeout with the spec's stack, rather than as the error of whichever call was cut off:
+//
+//	timeout := example.SpecTimeout(testTag, 10*time.Minute)
+//	ginkgo.It("...", ginkgo.SpecTimeout(timeout), func(sctx ginkgo.SpecContext) {
+//		ctx := example.SpecContext(sctx, testTag, timeout)
+func SpecContext(ctx ginkgo.SpecContext, testTag string, timeout time.Duration) context.Context {
+	cause := fmt.Errorf("%s spec %q exceeded its %v timeout", testTag, ctx.SpecReport().LeafNodeText, timeout)
+	derived, cancel := context.WithTimeoutCause(ctx, timeout, cause)
+	ginkgo.DeferCleanup(cancel)
+	return derived
+}
+
+// SleepContext sleeps for the duration or until ctx ends, returning ctx.Err() in that case, for
+// polling loops that must not outlive their spec
+func SleepContext(ctx context.Context, duration time.Duration) error {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,222 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("StatefulSet headless DNS E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("StatefulSetHeadlessDNSTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		config    *rest.Config
+		timeout   time.Duration
+		logger    zerolog.Logger
+		testTag   = "StatefulSetHeadlessDNSTest"
+	)
+
+	const (
+		replicas      = 3
+		clusterDomain = "cluster.local"
+		// Covers the CoreDNS cache of 30 seconds. Overridable with STS_DNS_TIMEOUT_SECONDS in .env
+		defaultTimeoutSeconds = 90
+		pollInterval          = time.Second
+	)
+
+	// recordName returns the FQDN of a StatefulSet pod's stable record, with the trailing dot so the
+	// search list is not applied
+	recordName := func(ordinal int) string {
+		return fmt.Sprintf("sts-dns-web-%d.sts-dns.%s.svc.%s.", ordinal, example.TestNamespace(), clusterDomain)
+	}
+
+	// lookup resolves the name from the client pod and returns the sorted A records
+	lookup := func(name string) []string {
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "sts-dns-client", "client",
+			[]string{"dig", "+short", name, "A"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "dig failed: %s", stderr)
+		records := strings.Fields(stdout)
+		sort.Strings(records)
+		return records
+	}
+
+	// waitForRecords polls the name until it resolves to exactly the expected addresses and returns how
+	// long that took
+	waitForRecords := func(name string, expected []string) time.Duration {
+		sort.Strings(expected)
+		start := time.Now()
+		deadline := start.Add(timeout)
+		for {
+			records := lookup(name)
+			if strings.Join(records, ",") == strings.Join(expected, ",") {
+				return time.Since(start)
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("%s resolved to %v after %v, expected %v", name, records, timeout, expected))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	// readyPod returns the pod once it is ready
+	readyPod := func(name string, deadline time.Time) *v1.Pod {
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			if err == nil && pod.DeletionTimestamp == nil {
+				for _, condition := range pod.Status.Conditions {
+					if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+						return pod
+					}
+				}
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s was not ready in time", name))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		timeout = example.Timeout(example.TimeoutNetwork, defaultTimeoutSeconds*time.Second)
+		if value := os.Getenv("STS_DNS_TIMEOUT_SECONDS"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid STS_DNS_TIMEOUT_SECONDS: %s", value)
+			timeout = time.Duration(seconds) * time.Second
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should resolve every pod's stable record to its IP", func() {
+		logger.Info().Msgf("=== Starting StatefulSet headless DNS E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		statefulSetYAML, clientYAML, err := example.GetStatefulSetDNSTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying headless Service, StatefulSet (%d replicas) and client pod manifests ===", replicas)
+		err = example.ApplyRawManifest(clientset, statefulSetYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.ApplyRawManifest(clientset, clientYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		deadline := time.Now().Add(example.Timeout(example.TimeoutPods, 3*time.Minute))
+		readyPod("sts-dns-client", deadline)
+		var podIPs []string
+		start := time.Now()
+		for ordinal := 0; ordinal < replicas; ordinal++ {
+			pod := readyPod(fmt.Sprintf("sts-dns-web-%d", ordinal), deadline)
+			waitForRecords(recordName(ordinal), []string{pod.Status.PodIP})
+			logger.Info().Msgf("%s -> %s\n", recordName(ordinal), pod.Status.PodIP)
+			podIPs = append(podIPs, pod.Status.PodIP)
+		}
+		example.RecordMetric(testTag, "initial_records_seconds", time.Since(start).Seconds())
+
+		// The Service name itself returns one record per ready pod
+		waitForRecords(fmt.Sprintf("sts-dns.%s.svc.%s.", example.TestNamespace(), clusterDomain), podIPs)
+	})
+
+	ginkgo.It("should update the record when a pod is recreated", func() {
+		defer example.E2ePanicHandler()
+
+		name := "sts-dns-web-1"
+		old, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Deleting pod %s (IP %s) ===", name, old.Status.PodIP)
+		err = clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), name, metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The replacement has the same name, so wait for a different UID
+		deadline := time.Now().Add(example.Timeout(example.TimeoutPods, 3*time.Minute))
+		var replacement *v1.Pod
+		for replacement == nil {
+			pod := readyPod(name, deadline)
+			if pod.UID != old.UID {
+				replacement = pod
+			} else {
+				time.Sleep(example.CheckInterval(pollInterval))
+			}
+		}
+
+		if replacement.Status.PodIP == old.Status.PodIP {
+			logger.Info().Msgf("=== Replacement reused IP %s, only its resolution is checked ===", old.Status.PodIP)
+		}
+		propagation := waitForRecords(recordName(1), []string{replacement.Status.PodIP})
+		logger.Info().Msgf("=== %s resolves to the new IP %s %v after the pod became ready ===",
+			recordName(1), replacement.Status.PodIP, propagation.Round(time.Millisecond))
+		example.RecordMetric(testTag, "restart_propagation_seconds", propagation.Seconds())
+	})
+
+	ginkgo.It("should remove the record of an ordinal that was scaled down", func() {
+		defer example.E2ePanicHandler()
+
+		scaledDown := int32(replicas - 1)
+		logger.Info().Msgf("=== Scaling the StatefulSet to %d replicas ===", scaledDown)
+		err := example.Scale(context.TODO(), clientset, example.WorkloadStatefulSet, example.TestNamespace(), "sts-dns-web", scaledDown)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		name := fmt.Sprintf("sts-dns-web-%d", scaledDown)
+		removalTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(removalTimeout)
+		for {
+			_, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				break
+			}
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s was not removed within %v", name, removalTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		propagation := waitForRecords(recordName(int(scaledDown)), nil)
+		logger.Info().Msgf("=== %s removed %v after the pod was deleted ===", recordName(int(scaledDown)), propagation.Round(time.Millisecond))
+		example.RecordMetric(testTag, "scale_down_propagation_seconds", propagation.Seconds())
+
+		// The remaining ordinals keep resolving
+		for ordinal := 0; ordinal < int(scaledDown); ordinal++ {
+			gomega.Expect(lookup(recordName(ordinal))).To(gomega.HaveLen(1), "%s no longer resolves", recordName(ordinal))
+		}
+	})
+
+})
@@ -0,0 +1,387 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+// stsPodTimeline holds the times at which the watch observed a pod's lifecycle transitions
+type stsPodTimeline struct {
+	Created  time.Time
+	Ready    time.Time
+	Deleting time.Time
+	Deleted  time.Time
+}
+
+// watchPodTimelines records lifecycle transitions of pods matching selector in test-ns until the
+// returned stop function is called. Pods that already exist are recorded as created at watch start.
+func watchPodTimelines(ctx context.Context, clientset *kubernetes.Clientset, selector string) (func() map[string]*stsPodTimeline, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	watcher, err := clientset.CoreV1().Pods(example.TestNamespace()).Watch(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	timelines := map[string]*stsPodTimeline{}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for event := range watcher.ResultChan() {
+			pod, ok := event.Object.(*v1.Pod)
+			if !ok {
+				continue
+			}
+			now := time.Now()
+
+			mu.Lock()
+			timeline, exists := timelines[pod.Name]
+			if !exists {
+				timeline = &stsPodTimeline{Created: now}
+				timelines[pod.Name] = timeline
+			}
+			if timeline.Ready.IsZero() {
+				for _, cond := range pod.Status.Conditions {
+					if cond.Type == v1.PodReady && cond.Status == v1.ConditionTrue {
+						timeline.Ready = now
+					}
+				}
+			}
+			if timeline.Deleting.IsZero() && pod.DeletionTimestamp != nil {
+				timeline.Deleting = now
+			}
+			if event.Type == watch.Deleted {
+				timeline.Deleted = now
+				// A pod recreated under the same name starts a fresh timeline
+				delete(timelines, pod.Name)
+				timelines[pod.Name+"#deleted"] = timeline
+			}
+			mu.Unlock()
+		}
+	}()
+
+	stop := func() map[string]*stsPodTimeline {
+		watcher.Stop()
+		cancel()
+		<-done
+
+		mu.Lock()
+		defer mu.Unlock()
+		return timelines
+	}
+	return stop, nil
+}
+
+var _ = ginkgo.Describe("StatefulSet ordered scaling E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("StatefulSetOrderedScalingTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		config    *rest.Config
+		logger    zerolog.Logger
+		testTag   = "StatefulSetOrderedScalingTest"
+		// Overridable with SPEC_TIMEOUTS in .env
+		specTimeout = example.SpecTimeout(testTag, 10*time.Minute)
+	)
+
+	const pollInterval = 2 * time.Second
+
+	scaleStatefulSet := func(ctx context.Context, name string, replicas int) {
+		logger.Info().Msgf("=== Scaling StatefulSet %s to %d replicas ===", name, replicas)
+		err := example.Scale(ctx, clientset, example.WorkloadStatefulSet, example.TestNamespace(), name, int32(replicas))
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	}
+
+	// waitForStatefulSetSettled waits until exactly replicas pods exist and all of them are ready
+	waitForStatefulSetSettled := func(ctx context.Context, name string, replicas int) {
+		settleTimeout := example.Timeout(example.TimeoutRollout, 5*time.Minute)
+		deadline := time.Now().Add(settleTimeout)
+		for {
+			sts, err := clientset.AppsV1().StatefulSets(example.TestNamespace()).Get(ctx, name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			pods, err := example.ListPods(ctx, clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=" + name})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			logger.Info().Msgf("StatefulSet %s: pods %d, ready %d, desired %d\n",
+				name, len(pods), sts.Status.ReadyReplicas, replicas)
+			if len(pods) == replicas && int(sts.Status.ReadyReplicas) == replicas {
+				return
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("StatefulSet %s did not settle at %d ready replicas within %v", name, replicas, settleTimeout))
+			}
+			gomega.Expect(example.SleepContext(ctx, example.CheckInterval(pollInterval))).To(gomega.Succeed())
+		}
+	}
+
+	logTimelines := func(timelines map[string]*stsPodTimeline) {
+		for name, t := range timelines {
+			logger.Info().Msgf("Pod %-20s created: %s ready: %s deleting: %s deleted: %s\n", name,
+				t.Created.Format("15:04:05.000"), t.Ready.Format("15:04:05.000"),
+				t.Deleting.Format("15:04:05.000"), t.Deleted.Format("15:04:05.000"))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should apply OrderedReady and Parallel StatefulSet manifests", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		logger.Info().Msgf("=== Starting StatefulSet ordered scaling E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+
+		orderedYAML, parallelYAML, err := example.GetStatefulSetOrderedScalingTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying OrderedReady StatefulSet and Service manifest ===")
+		err = example.ApplyRawManifest(clientset, orderedYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying Parallel StatefulSet and Service manifest ===")
+		err = example.ApplyRawManifest(clientset, parallelYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		waitForStatefulSetSettled(ctx, "ordered-sts", 1)
+		waitForStatefulSetSettled(ctx, "parallel-sts", 1)
+	})
+
+	ginkgo.It("should create pods in ordinal order, each after its predecessor is Ready", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+
+		stop, err := watchPodTimelines(ctx, clientset, "app=ordered-sts")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		scaleStatefulSet(ctx, "ordered-sts", 3)
+		waitForStatefulSetSettled(ctx, "ordered-sts", 3)
+		timelines := stop()
+		logTimelines(timelines)
+
+		for ordinal := 1; ordinal < 3; ordinal++ {
+			previous := timelines[fmt.Sprintf("ordered-sts-%d", ordinal-1)]
+			current := timelines[fmt.Sprintf("ordered-sts-%d", ordinal)]
+			gomega.Expect(previous).NotTo(gomega.BeNil())
+			gomega.Expect(current).NotTo(gomega.BeNil())
+
+			gomega.Expect(current.Created.Before(previous.Ready)).To(gomega.BeFalse(),
+				fmt.Sprintf("ordered-sts-%d was created before ordered-sts-%d was Ready", ordinal, ordinal-1))
+		}
+	})
+
+	ginkgo.It("should keep stable network identities across pod restarts", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(ctx, "ordered-sts-1", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		originalUID := pod.UID
+
+		logger.Info().Msgf("=== Deleting ordered-sts-1 ===")
+		err = clientset.CoreV1().Pods(example.TestNamespace()).Delete(ctx, "ordered-sts-1", metav1.DeleteOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		recreateTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(recreateTimeout)
+		for {
+			pod, err = clientset.CoreV1().Pods(example.TestNamespace()).Get(ctx, "ordered-sts-1", metav1.GetOptions{})
+			if err == nil && pod.UID != originalUID && pod.Status.Phase == v1.PodRunning {
+				break
+			}
+			if err != nil && !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("ordered-sts-1 was not recreated within %v", recreateTimeout))
+			}
+			gomega.Expect(example.SleepContext(ctx, example.CheckInterval(pollInterval))).To(gomega.Succeed())
+		}
+		waitForStatefulSetSettled(ctx, "ordered-sts", 3)
+
+		hostname, _, err := example.ExecInPod(ctx, config, clientset, example.TestNamespace(), "ordered-sts-1", "web",
+			[]string{"hostname"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Recreated pod hostname: %s ===", strings.TrimSpace(hostname))
+		gomega.Expect(strings.TrimSpace(hostname)).To(gomega.Equal("ordered-sts-1"))
+
+		// The per-pod record under the governing Service must point at the recreated pod
+		fqdn := example.TestNamespaced("ordered-sts-1.ordered-sts.test-ns.svc.cluster.local")
+		lookupTimeout := example.Timeout(example.TimeoutNetwork, time.Minute)
+		lookupDeadline := time.Now().Add(lookupTimeout)
+		for {
+			output, _, err := example.ExecInPod(ctx, config, clientset, example.TestNamespace(), "ordered-sts-0", "web",
+				[]string{"nslookup", fqdn})
+			if err == nil && strings.Contains(output, pod.Status.PodIP) {
+				logger.Info().Msgf("=== %s resolves to %s ===", fqdn, pod.Status.PodIP)
+				break
+			}
+			if time.Now().After(lookupDeadline) {
+				ginkgo.Fail(fmt.Sprintf("%s did not resolve to %s within %v: %s", fqdn, pod.Status.PodIP, lookupTimeout, output))
+			}
+			gomega.Expect(example.SleepContext(ctx, example.CheckInterval(pollInterval))).To(gomega.Succeed())
+		}
+	})
+
+	ginkgo.It("should terminate pods in reverse ordinal order, one at a time", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+
+		stop, err := watchPodTimelines(ctx, clientset, "app=ordered-sts")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		scaleStatefulSet(ctx, "ordered-sts", 1)
+		waitForStatefulSetSettled(ctx, "ordered-sts", 1)
+		timelines := stop()
+		logTimelines(timelines)
+
+		higher := timelines["ordered-sts-2#deleted"]
+		lower := timelines["ordered-sts-1#deleted"]
+		gomega.Expect(higher).NotTo(gomega.BeNil(), "Deletion of ordered-sts-2 was not observed")
+		gomega.Expect(lower).NotTo(gomega.BeNil(), "Deletion of ordered-sts-1 was not observed")
+
+		gomega.Expect(lower.Deleting.Before(higher.Deleted)).To(gomega.BeFalse(),
+			"ordered-sts-1 started terminating before ordered-sts-2 was gone")
+	})
+
+	ginkgo.It("should create and terminate pods concurrently with podManagementPolicy Parallel", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+
+		stop, err := watchPodTimelines(ctx, clientset, "app=parallel-sts")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		scaleStatefulSet(ctx, "parallel-sts", 4)
+		waitForStatefulSetSettled(ctx, "parallel-sts", 4)
+		scaleUp := stop()
+		logTimelines(scaleUp)
+
+		// Pods wait at least 10s for readiness, with ordered creation the last pod would lag far behind the first
+		first := scaleUp["parallel-sts-1"]
+		last := scaleUp["parallel-sts-3"]
+		gomega.Expect(first).NotTo(gomega.BeNil())
+		gomega.Expect(last).NotTo(gomega.BeNil())
+		gomega.Expect(last.Created.Before(first.Ready)).To(gomega.BeTrue(),
+			"parallel-sts-3 was only created after parallel-sts-1 became Ready")
+
+		stop, err = watchPodTimelines(ctx, clientset, "app=parallel-sts")
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		scaleStatefulSet(ctx, "parallel-sts", 1)
+		waitForStatefulSetSettled(ctx, "parallel-sts", 1)
+		scaleDown := stop()
+		logTimelines(scaleDown)
+
+		lowest := scaleDown["parallel-sts-1#deleted"]
+		highest := scaleDown["parallel-sts-3#deleted"]
+		gomega.Expect(lowest).NotTo(gomega.BeNil(), "Deletion of parallel-sts-1 was not observed")
+		gomega.Expect(highest).NotTo(gomega.BeNil(), "Deletion of parallel-sts-3 was not observed")
+		gomega.Expect(lowest.Deleting.Before(highest.Deleted)).To(gomega.BeTrue(),
+			"parallel-sts-1 only started terminating after parallel-sts-3 was gone")
+	})
+
+	ginkgo.It("should update only pods at or above the partition and roll back to the original revision", ginkgo.SpecTimeout(specTimeout), func(sctx ginkgo.SpecContext) {
+		defer example.E2ePanicHandler()
+		ctx := example.SpecContext(sctx, testTag, specTimeout)
+
+		scaleStatefulSet(ctx, "ordered-sts", 3)
+		waitForStatefulSetSettled(ctx, "ordered-sts", 3)
+
+		initial, err := example.WaitForStatefulSetRevisions(ctx, clientset, example.TestNamespace(), "ordered-sts", time.Minute,
+			func(revisions *example.StatefulSetRevisions) bool {
+				return revisions.CurrentRevision == revisions.UpdateRevision && len(revisions.PodsAt(revisions.CurrentRevision)) == 3
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		original := initial.CurrentRevision
+		logger.Info().Msgf("=== Initial revisions: %s ===", initial)
+
+		logger.Info().Msgf("=== Updating the pod template of ordered-sts with partition 2 ===")
+		err = example.SetStatefulSetPartition(ctx, clientset, example.TestNamespace(), "ordered-sts", 2)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.TriggerRollingUpdate(ctx, clientset, example.WorkloadStatefulSet, example.TestNamespace(), "ordered-sts",
+			func(template *v1.PodTemplateSpec) {
+				if template.Annotations == nil {
+					template.Annotations = map[string]string{}
+				}
+				template.Annotations["e2e-test/release"] = "2"
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		partitioned, err := example.WaitForStatefulSetRevisions(ctx, clientset, example.TestNamespace(), "ordered-sts", 3*time.Minute,
+			func(revisions *example.StatefulSetRevisions) bool {
+				return revisions.UpdateRevision != original && len(revisions.Pods) == 3 &&
+					len(revisions.PodsAt(revisions.UpdateRevision)) == 1
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Partitioned revisions: %s ===", partitioned)
+		updated := partitioned.UpdateRevision
+		gomega.Expect(partitioned.CurrentRevision).To(gomega.Equal(original))
+		gomega.Expect(partitioned.PodsAt(updated)).To(gomega.Equal([]string{"ordered-sts-2"}))
+		gomega.Expect(partitioned.PodsAt(original)).To(gomega.Equal([]string{"ordered-sts-0", "ordered-sts-1"}),
+			"Pods below the partition must keep the original revision")
+
+		logger.Info().Msgf("=== Removing the partition ===")
+		err = example.SetStatefulSetPartition(ctx, clientset, example.TestNamespace(), "ordered-sts", 0)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		rolledOut, err := example.WaitForStatefulSetRevisions(ctx, clientset, example.TestNamespace(), "ordered-sts", 3*time.Minute,
+			func(revisions *example.StatefulSetRevisions) bool {
+				return revisions.CurrentRevision == updated && len(revisions.PodsAt(updated)) == 3
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Rolled out revisions: %s ===", rolledOut)
+
+		// Restoring the previous template is a rollback, the controller reuses the original revision
+		logger.Info().Msgf("=== Rolling back the pod template of ordered-sts ===")
+		err = example.TriggerRollingUpdate(ctx, clientset, example.WorkloadStatefulSet, example.TestNamespace(), "ordered-sts",
+			func(template *v1.PodTemplateSpec) {
+				delete(template.Annotations, "e2e-test/release")
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		rolledBack, err := example.WaitForStatefulSetRevisions(ctx, clientset, example.TestNamespace(), "ordered-sts", 3*time.Minute,
+			func(revisions *example.StatefulSetRevisions) bool {
+				return revisions.UpdateRevision != updated && revisions.CurrentRevision == revisions.UpdateRevision &&
+					len(revisions.PodsAt(revisions.UpdateRevision)) == 3
+			})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("=== Rolled back revisions: %s ===", rolledBack)
+		gomega.Expect(rolledBack.UpdateRevision).To(gomega.Equal(original),
+			"The rollback created a new revision instead of reusing the original one")
+	})
+
+})
@@ -0,0 +1,176 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("StatefulSet PVC retention E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("StatefulSetPVCRetentionTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		logger    zerolog.Logger
+		testTag   = "StatefulSetPVCRetentionTest"
+	)
+
+	const (
+		pollInterval = 3 * time.Second
+		// Deleting claims goes through the garbage collector, allow it a generous margin
+		pvcRemovalTimeout = 3 * time.Minute
+		// A retained claim must still be there after this long
+		pvcRetentionWindow = 30 * time.Second
+	)
+
+	pvcExists := func(name string) bool {
+		_, err := clientset.CoreV1().PersistentVolumeClaims(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return false
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return true
+	}
+
+	expectPVCRemoved := func(name string) {
+		removalTimeout := example.Timeout(example.TimeoutVolume, pvcRemovalTimeout)
+		deadline := time.Now().Add(removalTimeout)
+		for pvcExists(name) {
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("PVC %s was not removed within %v", name, removalTimeout))
+			}
+			logger.Info().Msgf("Waiting for PVC %s to be removed\n", name)
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== PVC %s was removed ===", name)
+	}
+
+	expectPVCRetained := func(name string) {
+		deadline := time.Now().Add(pvcRetentionWindow)
+		for time.Now().Before(deadline) {
+			gomega.Expect(pvcExists(name)).To(gomega.BeTrue(), "PVC %s was removed despite the Retain policy", name)
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== PVC %s was retained ===", name)
+	}
+
+	waitForPodCount := func(selector string, count int) {
+		settleTimeout := example.Timeout(example.TimeoutPods, 5*time.Minute)
+		deadline := time.Now().Add(settleTimeout)
+		for {
+			pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: selector})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			running := 0
+			for _, pod := range pods {
+				if pod.Status.Phase == v1.PodRunning && pod.DeletionTimestamp == nil {
+					running++
+				}
+			}
+			if len(pods) == count && running == count {
+				return
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pods %s did not settle at %d within %v (found %d, running %d)",
+					selector, count, settleTimeout, len(pods), running))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should apply StatefulSets with Retain and Delete retention policies", func() {
+		logger.Info().Msgf("=== Starting StatefulSet PVC retention E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		retainYAML, deleteYAML, err := example.GetStatefulSetPVCRetentionTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying Retain StatefulSet and Service manifest ===")
+		err = example.ApplyRawManifest(clientset, retainYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// API servers with the StatefulSetAutoDeletePVC feature gate disabled silently drop the field
+		sts, err := clientset.AppsV1().StatefulSets(example.TestNamespace()).Get(context.TODO(), "retain-sts", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if sts.Spec.PersistentVolumeClaimRetentionPolicy == nil {
+			ginkgo.Skip("persistentVolumeClaimRetentionPolicy is not supported (StatefulSetAutoDeletePVC feature gate disabled)")
+		}
+
+		logger.Info().Msgf("=== Applying Delete StatefulSet and Service manifest ===")
+		err = example.ApplyRawManifest(clientset, deleteYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		waitForPodCount("app=retain-sts", 2)
+		waitForPodCount("app=delete-sts", 2)
+
+		for _, name := range []string{"data-retain-sts-0", "data-retain-sts-1", "data-delete-sts-0", "data-delete-sts-1"} {
+			gomega.Expect(pvcExists(name)).To(gomega.BeTrue(), "PVC %s was not created", name)
+		}
+	})
+
+	ginkgo.It("should apply whenScaled on scale-down", func() {
+		defer example.E2ePanicHandler()
+
+		for _, name := range []string{"retain-sts", "delete-sts"} {
+			logger.Info().Msgf("=== Scaling %s down to 1 replica ===", name)
+			_, err := clientset.AppsV1().StatefulSets(example.TestNamespace()).Patch(
+				context.TODO(), name, types.MergePatchType, []byte(`{"spec":{"replicas":1}}`), metav1.PatchOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+		waitForPodCount("app=retain-sts", 1)
+		waitForPodCount("app=delete-sts", 1)
+
+		expectPVCRemoved("data-delete-sts-1")
+		expectPVCRetained("data-retain-sts-1")
+		gomega.Expect(pvcExists("data-delete-sts-0")).To(gomega.BeTrue(), "PVC of a remaining replica was removed")
+	})
+
+	ginkgo.It("should apply whenDeleted when the StatefulSet is deleted", func() {
+		defer example.E2ePanicHandler()
+
+		for _, name := range []string{"retain-sts", "delete-sts"} {
+			logger.Info().Msgf("=== Deleting StatefulSet %s ===", name)
+			propagation := metav1.DeletePropagationForeground
+			err := clientset.AppsV1().StatefulSets(example.TestNamespace()).Delete(
+				context.TODO(), name, metav1.DeleteOptions{PropagationPolicy: &propagation})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		expectPVCRemoved("data-delete-sts-0")
+		expectPVCRetained("data-retain-sts-0")
+		gomega.Expect(pvcExists("data-retain-sts-1")).To(gomega.BeTrue(), "PVC retained on scale-down was removed")
+	})
+
+})
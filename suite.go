@@ -0,0 +1,43 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// Preflight checks once per run, before any suite, that the API server answers and at least one node is
+// Ready, so a cluster that isn't reachable fails the run right away instead of every suite's setup
+func Preflight(ctx context.Context, clientset *kubernetes.Clientset) error {
+	logger := GetLogger("Setup")
+	info, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return fmt.Errorf("API server not reachable: %w", err)
+	}
+	ready, err := WaitForNodesReady(ctx, clientset, 1, time.Minute)
+	if err != nil {
+		return fmt.Errorf("preflight: %w", err)
+	}
+	logger.Info().Msgf("Preflight passed: API server %s, %d nodes ready", info.GitVersion, len(ready))
+	return nil
+}
+
+// SetUpTestNamespace creates the process's TestNamespace and starts its shared informers, once per
+// process before any suite. The suites no longer create the namespace in BeforeAll, ClearNamespace
+// empties it after each of them.
+func SetUpTestNamespace(ctx context.Context, clientset *kubernetes.Clientset) error {
+	err := NewNamespaceManager(GetLogger("Setup"), clientset, TestNamespace(), nil).Ensure(ctx, time.Minute)
+	if err != nil {
+		return err
+	}
+	return StartTestNamespaceInformers(clientset)
+}
+
+// TearDownTestNamespace stops the shared informers and deletes the process's TestNamespace, once per
+// process after the last suite. Failures are only logged.
+func TearDownTestNamespace(ctx context.Context, clientset *kubernetes.Clientset) {
+	StopTestNamespaceInformers()
+	NewNamespaceManager(GetLogger("Setup"), clientset, TestNamespace(), nil).Cleanup(ctx)
+}
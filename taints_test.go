@@ -0,0 +1,229 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Taints and tolerations E2E test", ginkgo.Ordered, ginkgo.Label("disruptive"), example.SuiteConcurrency("TaintsTolerationsTest"), func() {
+	var (
+		clientset       *kubernetes.Clientset
+		taintedNode     string
+		nodeHostname    string
+		untoleratedYAML []byte
+		toleratedYAML   []byte
+		timedYAML       []byte
+		foreverYAML     []byte
+		logger          zerolog.Logger
+		testTag         = "TaintsTolerationsTest"
+	)
+
+	const (
+		taintKey     = "ginkgo-e2e/taints-test"
+		taintValue   = "true"
+		pollInterval = 3 * time.Second
+	)
+
+	// createPinnedPod creates the fixture pod with a nodeSelector for the tainted node, so the
+	// scheduler has no other choice and only its tolerations decide whether it can run there
+	createPinnedPod := func(podYAML []byte) *v1.Pod {
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(podYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		pod.Spec.NodeSelector = map[string]string{"kubernetes.io/hostname": nodeHostname}
+
+		logger.Info().Msgf("=== Creating pod %s pinned to node %s ===", pod.Name, taintedNode)
+		created, err := clientset.CoreV1().Pods(example.TestNamespace()).Create(context.TODO(), pod, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return created
+	}
+
+	waitForPodRunning := func(name string, timeout time.Duration) *v1.Pod {
+		timeout = example.Timeout(example.TimeoutPods, timeout)
+		deadline := time.Now().Add(timeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if pod.Status.Phase == v1.PodRunning {
+				return pod
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Pod %s did not reach Running within %v (phase %s)", name, timeout, pod.Status.Phase))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	// isPodEvicted reports whether the taint manager has deleted the pod
+	isPodEvicted := func(name string) bool {
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return true
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return pod.DeletionTimestamp != nil
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		untoleratedYAML, toleratedYAML, timedYAML, foreverYAML, err = example.GetTaintsTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Untolerated pods need somewhere else to go, so only untainted schedulable nodes count
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		var candidates []v1.Node
+		for _, node := range nodes.Items {
+			if node.Spec.Unschedulable || len(node.Spec.Taints) > 0 {
+				continue
+			}
+			candidates = append(candidates, node)
+		}
+		if len(candidates) < 2 {
+			ginkgo.Skip(fmt.Sprintf("Tainting a node needs at least 2 untainted schedulable nodes (found %d)", len(candidates)))
+		}
+
+		taintedNode = candidates[0].Name
+		nodeHostname = candidates[0].Labels["kubernetes.io/hostname"]
+		gomega.Expect(nodeHostname).NotTo(gomega.BeEmpty(), "Node %s has no kubernetes.io/hostname label", taintedNode)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		// Never leave the node tainted, even when a spec failed halfway through
+		if taintedNode != "" {
+			logger.Info().Msgf("=== Restoring node %s ===", taintedNode)
+			for _, effect := range []v1.TaintEffect{v1.TaintEffectNoExecute, v1.TaintEffectNoSchedule} {
+				if err := example.RemoveNodeTaint(context.TODO(), clientset, taintedNode, taintKey, effect); err != nil {
+					logger.Error().Msgf("Failed to remove %s taint from node %s: %v", effect, taintedNode, err)
+				}
+			}
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should keep untolerated pods off a node with a NoSchedule taint", func() {
+		logger.Info().Msgf("=== Starting Taints and tolerations E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Adding %s=%s:NoSchedule taint to node %s ===", taintKey, taintValue, taintedNode)
+		err := example.AddNodeTaint(context.TODO(), clientset, taintedNode, v1.Taint{
+			Key:    taintKey,
+			Value:  taintValue,
+			Effect: v1.TaintEffectNoSchedule,
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying untolerated Deployment manifest ===")
+		err = example.ApplyRawManifest(clientset, untoleratedYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		err = example.WaitForDeploymentReady(context.TODO(), clientset, example.TestNamespace(), "untolerated-app", 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=untolerated-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		for _, pod := range pods {
+			logger.Info().Msgf("Pod %s runs on node %s\n", pod.Name, pod.Spec.NodeName)
+			gomega.Expect(pod.Spec.NodeName).NotTo(gomega.Equal(taintedNode),
+				"Pod %s without a toleration was scheduled onto the tainted node", pod.Name)
+		}
+	})
+
+	ginkgo.It("should schedule a pod with a matching toleration onto the tainted node", func() {
+		defer example.E2ePanicHandler()
+
+		createPinnedPod(toleratedYAML)
+		pod := waitForPodRunning("tolerated-pod", 3*time.Minute)
+		gomega.Expect(pod.Spec.NodeName).To(gomega.Equal(taintedNode))
+		logger.Info().Msgf("=== tolerated-pod runs on tainted node %s ===", taintedNode)
+	})
+
+	ginkgo.It("should evict pods after their tolerationSeconds once a NoExecute taint is added", func() {
+		defer example.E2ePanicHandler()
+
+		timedPod := createPinnedPod(timedYAML)
+		createPinnedPod(foreverYAML)
+		waitForPodRunning("noexecute-timed-pod", 3*time.Minute)
+		waitForPodRunning("noexecute-forever-pod", 3*time.Minute)
+
+		var tolerationSeconds int64
+		for _, toleration := range timedPod.Spec.Tolerations {
+			if toleration.Effect == v1.TaintEffectNoExecute && toleration.TolerationSeconds != nil {
+				tolerationSeconds = *toleration.TolerationSeconds
+			}
+		}
+		gomega.Expect(tolerationSeconds).To(gomega.BeNumerically(">", 0), "Fixture has no NoExecute tolerationSeconds")
+		tolerationPeriod := time.Duration(tolerationSeconds) * time.Second
+
+		logger.Info().Msgf("=== Adding %s=%s:NoExecute taint to node %s ===", taintKey, taintValue, taintedNode)
+		taintedAt := time.Now()
+		err := example.AddNodeTaint(context.TODO(), clientset, taintedNode, v1.Taint{
+			Key:    taintKey,
+			Value:  taintValue,
+			Effect: v1.TaintEffectNoExecute,
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The timed pod must survive its toleration period and go shortly after it
+		deadline := taintedAt.Add(tolerationPeriod + time.Minute)
+		var evictedAfter time.Duration
+		for {
+			if isPodEvicted("noexecute-timed-pod") {
+				evictedAfter = time.Since(taintedAt)
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("noexecute-timed-pod was not evicted within %v of the NoExecute taint", tolerationPeriod+time.Minute))
+			}
+			time.Sleep(time.Second)
+		}
+		logger.Info().Msgf("=== noexecute-timed-pod evicted %v after the taint (tolerationSeconds: %d) ===", evictedAfter, tolerationSeconds)
+		example.RecordMetric(testTag, "noexecute_eviction_seconds", evictedAfter.Seconds())
+
+		// Allow a little slack for the clock skew between the test runner and the controller manager
+		gomega.Expect(evictedAfter).To(gomega.BeNumerically(">=", tolerationPeriod-5*time.Second),
+			"Pod was evicted before its tolerationSeconds expired")
+
+		// A NoSchedule toleration alone doesn't protect a pod from NoExecute
+		gomega.Expect(isPodEvicted("tolerated-pod")).To(gomega.BeTrue(), "tolerated-pod was not evicted by the NoExecute taint")
+
+		pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "noexecute-forever-pod", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pod.DeletionTimestamp).To(gomega.BeNil(), "Pod tolerating NoExecute indefinitely was evicted")
+		gomega.Expect(pod.Status.Phase).To(gomega.Equal(v1.PodRunning))
+
+		logger.Info().Msgf("=== Removing NoExecute taint from node %s ===", taintedNode)
+		err = example.RemoveNodeTaint(context.TODO(), clientset, taintedNode, taintKey, v1.TaintEffectNoExecute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+})
@@ -0,0 +1,208 @@
+package example
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeout keys, one per kind of wait. The wait helpers resolve the timeout they are given through the
+// key of what they wait for, and suites do the same for their own waits with Timeout.
+const (
+	TimeoutNamespace = "namespace"
+	TimeoutNodes     = "nodes"
+	TimeoutPods      = "pods"
+	TimeoutRollout   = "rollout"
+	TimeoutHPA       = "hpa"
+	TimeoutMetrics   = "metrics"
+	TimeoutPDB       = "pdb"
+	TimeoutEndpoints = "endpoints"
+	TimeoutJob       = "job"
+	// TimeoutVolume is for volumes to be bound, expanded or released
+	TimeoutVolume = "volume"
+	// TimeoutNetwork is for DNS names to resolve and Services or network policies to take effect
+	TimeoutNetwork = "network"
+	// TimeoutAPI is for the API server and the controllers to act on objects other than workloads, e.g.
+	// a CRD to be established, a CSR signed or objects garbage-collected
+	TimeoutAPI = "api"
+)
+
+// timeoutFactors are the profiles TIMEOUT_PROFILE selects from
+var timeoutFactors = map[string]float64{
+	"fast":    0.5,
+	"default": 1,
+	"slow":    3,
+}
+
+// TimeoutProfile adapts the waits of the suites to the cluster: a kind cluster on a laptop, where
+// everything is local, or a large production cluster, where nodes are provisioned and images pulled
+// from afar. The defaults the suites pass are scaled by the profile's factor, and overrides replace
+// them per key.
+type TimeoutProfile struct {
+	Name   string
+	Factor float64
+	// Overrides replace the scaled default of their key
+	Overrides map[string]time.Duration
+	// Interval replaces the pause between two checks of the polling waits that use CheckInterval, zero
+	// keeps their defaults
+	Interval time.Duration
+}
+
+// Timeout returns the override of the key, or the fallback scaled by the profile's factor
+func (p *TimeoutProfile) Timeout(key string, fallback time.Duration) time.Duration {
+	if override, found := p.Overrides[key]; found {
+		return override
+	}
+	return p.Scale(fallback)
+}
+
+// Scale scales a duration by the profile's factor, for waits that no key covers
+func (p *TimeoutProfile) Scale(duration time.Duration) time.Duration {
+	return time.Duration(float64(duration) * p.Factor)
+}
+
+func (p *TimeoutProfile) String() string {
+	overrides := make([]string, 0, len(p.Overrides))
+	for key, timeout := range p.Overrides {
+		overrides = append(overrides, fmt.Sprintf("%s=%v", key, timeout))
+	}
+	sort.Strings(overrides)
+	description := fmt.Sprintf("%s (x%g) overrides: [%s]", p.Name, p.Factor, strings.Join(overrides, ","))
+	if p.Interval > 0 {
+		description += fmt.Sprintf(" check interval: %v", p.Interval)
+	}
+	return description
+}
+
+// CheckInterval returns the Interval of the profile, or the fallback when it has none
+func (p *TimeoutProfile) CheckInterval(fallback time.Duration) time.Duration {
+	if p.Interval > 0 {
+		return p.Interval
+	}
+	return fallback
+}
+
+// namedTimeouts are the .env settings that set the timeout of a single key. An entry of the key in
+// TIMEOUT_OVERRIDES takes precedence.
+var namedTimeouts = []struct {
+	setting string
+	key     string
+}{
+	{"ROLLOUT_TIMEOUT", TimeoutRollout},
+	{"HPA_SCALE_DEADLINE", TimeoutHPA},
+}
+
+// applySettings sets the profile's overrides from ROLLOUT_TIMEOUT and HPA_SCALE_DEADLINE and its
+// interval from CHECK_INTERVAL, read through getenv. The values are durations like "90s" or "10m", or
+// a number of seconds.
+func (p *TimeoutProfile) applySettings(getenv func(string) string) error {
+	for _, named := range namedTimeouts {
+		value := getenv(named.setting)
+		if value == "" {
+			continue
+		}
+		timeout, err := parseSetting(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", named.setting, err)
+		}
+		if _, found := p.Overrides[named.key]; !found {
+			p.Overrides[named.key] = timeout
+		}
+	}
+	if value := getenv("CHECK_INTERVAL"); value != "" {
+		interval, err := parseSetting(value)
+		if err != nil {
+			return fmt.Errorf("CHECK_INTERVAL: %w", err)
+		}
+		p.Interval = interval
+	}
+	return nil
+}
+
+// parseSetting parses a duration setting, a Go duration or a number of seconds
+func parseSetting(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	var duration time.Duration
+	seconds, err := strconv.Atoi(value)
+	if err == nil {
+		duration = time.Duration(seconds) * time.Second
+	} else {
+		duration, err = time.ParseDuration(value)
+	}
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("%q is not a positive duration", value)
+	}
+	return duration, nil
+}
+
+// ParseTimeoutProfile builds a profile from its name, fast, default or slow, and a comma-separated
+// list of overrides like "hpa=10m,namespace=5m". An empty name selects default.
+func ParseTimeoutProfile(name, overrides string) (*TimeoutProfile, error) {
+	if name == "" {
+		name = "default"
+	}
+	factor, found := timeoutFactors[name]
+	if !found {
+		return nil, fmt.Errorf("unknown timeout profile %q, expected fast, default or slow", name)
+	}
+	profile := &TimeoutProfile{Name: name, Factor: factor, Overrides: map[string]time.Duration{}}
+	for _, entry := range strings.Split(overrides, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("timeout override %q is not key=duration", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout <= 0 {
+			return nil, fmt.Errorf("timeout override %q has no valid duration", entry)
+		}
+		profile.Overrides[strings.TrimSpace(key)] = timeout
+	}
+	return profile, nil
+}
+
+var (
+	timeoutProfile     *TimeoutProfile
+	timeoutProfileOnce sync.Once
+)
+
+// CurrentTimeoutProfile returns the profile TIMEOUT_PROFILE and TIMEOUT_OVERRIDES in .env select, with
+// ROLLOUT_TIMEOUT, HPA_SCALE_DEADLINE and CHECK_INTERVAL applied. An invalid setting is logged and the
+// default profile used instead.
+func CurrentTimeoutProfile() *TimeoutProfile {
+	timeoutProfileOnce.Do(func() {
+		var err error
+		timeoutProfile, err = ParseTimeoutProfile(os.Getenv("TIMEOUT_PROFILE"), os.Getenv("TIMEOUT_OVERRIDES"))
+		if err == nil {
+			err = timeoutProfile.applySettings(os.Getenv)
+		}
+		if err != nil {
+			Logger.Warn().Msgf("Ignoring the timeout profile settings: %v", err)
+			timeoutProfile, _ = ParseTimeoutProfile("", "")
+		}
+	})
+	return timeoutProfile
+}
+
+// Timeout returns the timeout of a wait under the current profile: the override of the key, or the
+// fallback scaled by the profile's factor. Suites wrap the timeouts of their own waits in it:
+//
+//	deadline := time.Now().Add(example.Timeout(example.TimeoutPods, 3*time.Minute))
+func Timeout(key string, fallback time.Duration) time.Duration {
+	return CurrentTimeoutProfile().Timeout(key, fallback)
+}
+
+// CheckInterval returns the pause between two checks of a polling wait under the current profile:
+// CHECK_INTERVAL from .env, or the fallback when it isn't set. A slow cluster is checked less often, a
+// fast one can be checked more often than the suites' defaults.
+//
+//	err := example.PollUntil(ctx, example.CheckInterval(2*time.Second), timeout, condition)
+func CheckInterval(fallback time.Duration) time.Duration {
+	return CurrentTimeoutProfile().CheckInterval(fallback)
+}
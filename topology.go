@@ -0,0 +1,107 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TopologyDistribution breaks down how pods spread over the domains of a topology key, e.g. zones or
+// hostnames. It is meant to be recorded with RecordMetric as is.
+type TopologyDistribution struct {
+	TopologyKey string `json:"topology_key"`
+	// Pods per domain, including the domains without pods
+	Domains    map[string]int `json:"domains"`
+	Max        int            `json:"max"`
+	Min        int            `json:"min"`
+	Skew       int            `json:"skew"`
+	MaxDomains []string       `json:"max_domains"`
+	MinDomains []string       `json:"min_domains"`
+	// Pods on nodes without the topology key, which spread constraints ignore
+	Unlabeled int `json:"unlabeled,omitempty"`
+}
+
+// NewTopologyDistribution computes the breakdown of pod counts per domain. Domains that should count
+// as empty must be present with 0. Without domains, every figure is 0.
+func NewTopologyDistribution(topologyKey string, perDomain map[string]int) TopologyDistribution {
+	distribution := TopologyDistribution{TopologyKey: topologyKey, Domains: map[string]int{}}
+	first := true
+	for domain, count := range perDomain {
+		distribution.Domains[domain] = count
+		if first || count < distribution.Min {
+			distribution.Min = count
+		}
+		if first || count > distribution.Max {
+			distribution.Max = count
+		}
+		first = false
+	}
+	for domain, count := range perDomain {
+		if count == distribution.Max {
+			distribution.MaxDomains = append(distribution.MaxDomains, domain)
+		}
+		if count == distribution.Min {
+			distribution.MinDomains = append(distribution.MinDomains, domain)
+		}
+	}
+	sort.Strings(distribution.MaxDomains)
+	sort.Strings(distribution.MinDomains)
+	distribution.Skew = distribution.Max - distribution.Min
+	return distribution
+}
+
+func (d TopologyDistribution) String() string {
+	return fmt.Sprintf("%s skew %d (max %d in %v, min %d in %v): %v", d.TopologyKey, d.Skew, d.Max, d.MaxDomains,
+		d.Min, d.MinDomains, d.Domains)
+}
+
+// PodDistribution counts the scheduled, non-terminating pods matching the label selector per domain of
+// the topology key, e.g. corev1.LabelHostname or corev1.LabelTopologyZone. Every domain of a node that
+// has the key is present, with 0 when it has no pods, including the domains of cordoned, tainted and
+// control-plane nodes the pods can't run on. This is not how topology spread constraints count: the
+// scheduler leaves out the nodes the pods' node affinity excludes (nodeAffinityPolicy) and, with
+// nodeTaintsPolicy Honor, the nodes whose taints they don't tolerate. The Skew here can therefore be
+// higher than the one the scheduler enforces, at hostname level in particular. Unlike ZoneMap it lists
+// the nodes on every call.
+func PodDistribution(ctx context.Context, clientset *kubernetes.Clientset, namespace, selector, topologyKey string) (TopologyDistribution, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return TopologyDistribution{}, fmt.Errorf("nodes listing failed: %w", err)
+	}
+	pods, err := ListPods(ctx, clientset, namespace, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return TopologyDistribution{}, err
+	}
+	return distributionOf(topologyKey, nodes.Items, pods), nil
+}
+
+// distributionOf counts the pods per domain of the nodes, as PodDistribution describes
+func distributionOf(topologyKey string, nodes []corev1.Node, pods []corev1.Pod) TopologyDistribution {
+	nodeDomains := map[string]string{}
+	perDomain := map[string]int{}
+	for _, node := range nodes {
+		if domain, found := node.Labels[topologyKey]; found {
+			nodeDomains[node.Name] = domain
+			perDomain[domain] = 0
+		}
+	}
+	unlabeled := 0
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Spec.NodeName == "" {
+			continue
+		}
+		domain, found := nodeDomains[pod.Spec.NodeName]
+		if !found {
+			unlabeled++
+			continue
+		}
+		perDomain[domain]++
+	}
+	distribution := NewTopologyDistribution(topologyKey, perDomain)
+	distribution.Unlabeled = unlabeled
+	return distribution
+}
@@ -0,0 +1,281 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Topology spread policy E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("TopologySpreadPolicyTest"), func() {
+	var (
+		clientset      *kubernetes.Clientset
+		deploymentYAML []byte
+		// Hostnames of up to two nodes test pods can schedule on, the spread domains of every case
+		schedulable []string
+		// Hostname of a node with a NoSchedule or NoExecute taint, empty if the cluster has none
+		tainted    string
+		totalNodes int
+		logger     zerolog.Logger
+		testTag    = "TopologySpreadPolicyTest"
+	)
+
+	const (
+		// minDomains is beta and enabled by default from 1.27, the node inclusion policies from 1.26
+		minimumVersion = "1.27"
+		pollInterval   = 2 * time.Second
+		pendingHold    = 15 * time.Second
+	)
+
+	type spreadCase struct {
+		name               string
+		hostnames          []string
+		replicas           int32
+		minDomains         *int32
+		nodeAffinityPolicy *v1.NodeInclusionPolicy
+		nodeTaintsPolicy   *v1.NodeInclusionPolicy
+	}
+
+	// runCase creates the deployment of a case and checks that exactly expectPending of its pods stay
+	// Pending because of the spread constraint, while the others run
+	runCase := func(c spreadCase, expectPending int) {
+		deployment := &appsv1.Deployment{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(deploymentYAML), 4096).Decode(deployment)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		labels := map[string]string{"app": c.name}
+		deployment.Name = c.name
+		deployment.Labels = labels
+		deployment.Spec.Replicas = &c.replicas
+		deployment.Spec.Selector.MatchLabels = labels
+		deployment.Spec.Template.Labels = labels
+		deployment.Spec.Template.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.
+			NodeSelectorTerms[0].MatchExpressions[0].Values = c.hostnames
+		constraint := &deployment.Spec.Template.Spec.TopologySpreadConstraints[0]
+		constraint.LabelSelector.MatchLabels = labels
+		constraint.MinDomains = c.minDomains
+		constraint.NodeAffinityPolicy = c.nodeAffinityPolicy
+		constraint.NodeTaintsPolicy = c.nodeTaintsPolicy
+
+		logger.Info().Msgf("=== Creating %s: %d replicas on %v, expecting %d Pending ===",
+			c.name, c.replicas, c.hostnames, expectPending)
+		_, err = clientset.AppsV1().Deployments(example.TestNamespace()).Create(context.TODO(), deployment, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		defer func() {
+			err := clientset.AppsV1().Deployments(example.TestNamespace()).Delete(context.TODO(), c.name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				logger.Error().Msgf("Failed to delete deployment %s: %v", c.name, err)
+			}
+		}()
+
+		expectRunning := int(c.replicas) - expectPending
+		var running, unschedulable int
+		var messages []string
+		check := func() bool {
+			pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{
+				LabelSelector: "app=" + c.name,
+			})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			running, unschedulable, messages = 0, 0, nil
+			for _, pod := range pods {
+				if pod.DeletionTimestamp != nil {
+					continue
+				}
+				if pod.Status.Phase == v1.PodRunning {
+					running++
+					continue
+				}
+				for _, condition := range pod.Status.Conditions {
+					if condition.Type == v1.PodScheduled && condition.Status == v1.ConditionFalse &&
+						condition.Reason == v1.PodReasonUnschedulable {
+						unschedulable++
+						messages = append(messages, condition.Message)
+					}
+				}
+			}
+			return running == expectRunning && unschedulable == expectPending
+		}
+
+		settleTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(settleTimeout)
+		for !check() {
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("%s: %d running and %d unschedulable pods after %v, expected %d and %d",
+					c.name, running, unschedulable, settleTimeout, expectRunning, expectPending))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("%s: %d running, %d unschedulable\n", c.name, running, unschedulable)
+		distribution, err := example.PodDistribution(context.TODO(), clientset, example.TestNamespace(), "app="+c.name, v1.LabelHostname)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		logger.Info().Msgf("%s: %v\n", c.name, distribution)
+		example.RecordMetric(testTag, c.name+"_distribution", distribution)
+
+		if expectPending == 0 {
+			return
+		}
+		for _, message := range messages {
+			logger.Info().Msgf("Scheduler: %s\n", message)
+			gomega.Expect(message).To(gomega.ContainSubstring("topology spread constraints"),
+				"Pod is unschedulable for a reason other than the spread constraint")
+		}
+
+		// The pod must stay Pending, not just be waiting for a retry of the scheduler
+		time.Sleep(pendingHold)
+		gomega.Expect(check()).To(gomega.BeTrue(),
+			"%s: %d running and %d unschedulable pods after %v, expected %d and %d",
+			c.name, running, unschedulable, pendingHold, expectRunning, expectPending)
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		supported, serverVersion, err := example.ServerVersionAtLeast(clientset, minimumVersion)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if !supported {
+			ginkgo.Skip(fmt.Sprintf("Server version %s is older than %s", serverVersion, minimumVersion))
+		}
+		logger.Info().Msgf("=== Server version %s ===", serverVersion)
+
+		deploymentYAML, err = example.GetTopologySpreadPolicyTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		totalNodes = len(nodes.Items)
+		for _, node := range nodes.Items {
+			hostname := node.Labels[v1.LabelHostname]
+			if hostname == "" {
+				continue
+			}
+			ready := false
+			for _, condition := range node.Status.Conditions {
+				if condition.Type == v1.NodeReady && condition.Status == v1.ConditionTrue {
+					ready = true
+				}
+			}
+			hasTaint := false
+			for _, taint := range node.Spec.Taints {
+				if taint.Effect == v1.TaintEffectNoSchedule || taint.Effect == v1.TaintEffectNoExecute {
+					hasTaint = true
+				}
+			}
+			switch {
+			case hasTaint && tainted == "":
+				tainted = hostname
+			case ready && !hasTaint && !node.Spec.Unschedulable && len(schedulable) < 2:
+				schedulable = append(schedulable, hostname)
+			}
+		}
+		gomega.Expect(schedulable).NotTo(gomega.BeEmpty(), "No schedulable node without taints")
+		logger.Info().Msgf("=== Spread domains: %v, tainted node: %q, %d nodes in total ===", schedulable, tainted, totalNodes)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	// In every case one replica more than there are domains is created. When a constraint counts an
+	// extra domain that can't receive pods, the global minimum is 0 and maxSkew 1 allows only one pod
+	// per schedulable domain, so exactly one replica stays Pending.
+
+	ginkgo.It("should keep a pod Pending while fewer domains than minDomains exist", func() {
+		logger.Info().Msgf("=== Starting Topology spread policy E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		domains := int32(len(schedulable))
+		unsatisfiable := domains + 1
+		runCase(spreadCase{
+			name:       "spread-min-domains",
+			hostnames:  schedulable,
+			replicas:   domains + 1,
+			minDomains: &unsatisfiable,
+		}, 1)
+
+		// With minDomains met the same deployment schedules completely
+		runCase(spreadCase{
+			name:       "spread-min-domains-met",
+			hostnames:  schedulable,
+			replicas:   domains + 1,
+			minDomains: &domains,
+		}, 0)
+	})
+
+	ginkgo.It("should count nodes outside the node affinity as domains with nodeAffinityPolicy Ignore", func() {
+		defer example.E2ePanicHandler()
+
+		if totalNodes <= len(schedulable) {
+			ginkgo.Skip(fmt.Sprintf("All %d nodes are spread domains, no node is left outside the node affinity", totalNodes))
+		}
+
+		domains := int32(len(schedulable))
+		ignore, honor := v1.NodeInclusionPolicyIgnore, v1.NodeInclusionPolicyHonor
+		runCase(spreadCase{
+			name:               "spread-affinity-ignore",
+			hostnames:          schedulable,
+			replicas:           domains + 1,
+			nodeAffinityPolicy: &ignore,
+		}, 1)
+
+		runCase(spreadCase{
+			name:               "spread-affinity-honor",
+			hostnames:          schedulable,
+			replicas:           domains + 1,
+			nodeAffinityPolicy: &honor,
+		}, 0)
+	})
+
+	ginkgo.It("should only exclude tainted nodes from the domains with nodeTaintsPolicy Honor", func() {
+		defer example.E2ePanicHandler()
+
+		if tainted == "" {
+			ginkgo.Skip("No node with a NoSchedule or NoExecute taint")
+		}
+
+		// The tainted node matches the node affinity, so only its taint can exclude it
+		hostnames := append(append([]string{}, schedulable...), tainted)
+		domains := int32(len(schedulable))
+		ignore, honor := v1.NodeInclusionPolicyIgnore, v1.NodeInclusionPolicyHonor
+		runCase(spreadCase{
+			name:             "spread-taints-ignore",
+			hostnames:        hostnames,
+			replicas:         domains + 1,
+			nodeTaintsPolicy: &ignore,
+		}, 1)
+
+		runCase(spreadCase{
+			name:             "spread-taints-honor",
+			hostnames:        hostnames,
+			replicas:         domains + 1,
+			nodeTaintsPolicy: &honor,
+		}, 0)
+	})
+
+})
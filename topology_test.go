@@ -0,0 +1,119 @@
+package example
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNewTopologyDistribution(t *testing.T) {
+	tests := []struct {
+		name      string
+		perDomain map[string]int
+		want      TopologyDistribution
+	}{
+		{
+			name:      "no domains",
+			perDomain: map[string]int{},
+			want:      TopologyDistribution{TopologyKey: corev1.LabelTopologyZone, Domains: map[string]int{}},
+		},
+		{
+			name:      "single domain",
+			perDomain: map[string]int{"a": 3},
+			want: TopologyDistribution{TopologyKey: corev1.LabelTopologyZone, Domains: map[string]int{"a": 3},
+				Max: 3, Min: 3, MaxDomains: []string{"a"}, MinDomains: []string{"a"}},
+		},
+		{
+			name:      "ties for max and min",
+			perDomain: map[string]int{"c": 2, "a": 2, "d": 1, "b": 1},
+			want: TopologyDistribution{TopologyKey: corev1.LabelTopologyZone,
+				Domains: map[string]int{"a": 2, "b": 1, "c": 2, "d": 1},
+				Max:     2, Min: 1, Skew: 1, MaxDomains: []string{"a", "c"}, MinDomains: []string{"b", "d"}},
+		},
+		{
+			name:      "all domains tied",
+			perDomain: map[string]int{"b": 1, "a": 1},
+			want: TopologyDistribution{TopologyKey: corev1.LabelTopologyZone, Domains: map[string]int{"a": 1, "b": 1},
+				Max: 1, Min: 1, MaxDomains: []string{"a", "b"}, MinDomains: []string{"a", "b"}},
+		},
+		{
+			name:      "zero-count domains",
+			perDomain: map[string]int{"a": 3, "b": 0, "c": 0},
+			want: TopologyDistribution{TopologyKey: corev1.LabelTopologyZone, Domains: map[string]int{"a": 3, "b": 0, "c": 0},
+				Max: 3, Min: 0, Skew: 3, MaxDomains: []string{"a"}, MinDomains: []string{"b", "c"}},
+		},
+		{
+			name:      "only zero-count domains",
+			perDomain: map[string]int{"a": 0, "b": 0},
+			want: TopologyDistribution{TopologyKey: corev1.LabelTopologyZone, Domains: map[string]int{"a": 0, "b": 0},
+				MaxDomains: []string{"a", "b"}, MinDomains: []string{"a", "b"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := NewTopologyDistribution(corev1.LabelTopologyZone, test.perDomain)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("NewTopologyDistribution(%v) = %+v, want %+v", test.perDomain, got, test.want)
+			}
+		})
+	}
+}
+
+func TestDistributionOf(t *testing.T) {
+	node := func(name string, labels map[string]string) corev1.Node {
+		return corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	pod := func(name, nodeName string, terminating bool) corev1.Pod {
+		p := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: corev1.PodSpec{NodeName: nodeName}}
+		if terminating {
+			p.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+		}
+		return p
+	}
+	zoneA := map[string]string{corev1.LabelTopologyZone: "a"}
+	zoneB := map[string]string{corev1.LabelTopologyZone: "b"}
+
+	tests := []struct {
+		name  string
+		nodes []corev1.Node
+		pods  []corev1.Pod
+		want  TopologyDistribution
+	}{
+		{
+			name: "no nodes and no pods",
+			want: TopologyDistribution{TopologyKey: corev1.LabelTopologyZone, Domains: map[string]int{}},
+		},
+		{
+			name:  "domains of nodes without pods count as 0",
+			nodes: []corev1.Node{node("n1", zoneA), node("n2", zoneB)},
+			pods:  []corev1.Pod{pod("p1", "n1", false), pod("p2", "n1", false)},
+			want: TopologyDistribution{TopologyKey: corev1.LabelTopologyZone, Domains: map[string]int{"a": 2, "b": 0},
+				Max: 2, Skew: 2, MaxDomains: []string{"a"}, MinDomains: []string{"b"}},
+		},
+		{
+			name:  "pods on nodes without the key are unlabeled",
+			nodes: []corev1.Node{node("n1", zoneA), node("n2", nil)},
+			pods:  []corev1.Pod{pod("p1", "n1", false), pod("p2", "n2", false), pod("p3", "n2", false), pod("p4", "gone", false)},
+			want: TopologyDistribution{TopologyKey: corev1.LabelTopologyZone, Domains: map[string]int{"a": 1},
+				Max: 1, Min: 1, MaxDomains: []string{"a"}, MinDomains: []string{"a"}, Unlabeled: 3},
+		},
+		{
+			name:  "unscheduled and terminating pods are left out",
+			nodes: []corev1.Node{node("n1", zoneA), node("n2", nil)},
+			pods:  []corev1.Pod{pod("p1", "", false), pod("p2", "n1", true), pod("p3", "n2", true)},
+			want: TopologyDistribution{TopologyKey: corev1.LabelTopologyZone, Domains: map[string]int{"a": 0},
+				MaxDomains: []string{"a"}, MinDomains: []string{"a"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := distributionOf(corev1.LabelTopologyZone, test.nodes, test.pods)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("distributionOf() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	batchv1 "k8s.io/api/batch/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("TTL-after-finished Job cleanup E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("TTLAfterFinishedTest"), func() {
+	var (
+		clientset    *kubernetes.Clientset
+		succeededJob []byte
+		failedJob    []byte
+		margin       time.Duration
+		logger       zerolog.Logger
+		testTag      = "TTLAfterFinishedTest"
+	)
+
+	const (
+		// How long the TTL controller may take beyond the TTL. Overridable with TTL_MARGIN_SECONDS in .env
+		defaultMarginSeconds = 60
+		pollInterval         = time.Second
+	)
+
+	// Only the fields the assertions depend on are parsed from the fixtures
+	type jobSpec struct {
+		Metadata struct {
+			Name string `yaml:"name"`
+		} `yaml:"metadata"`
+		Spec struct {
+			TTLSecondsAfterFinished int `yaml:"ttlSecondsAfterFinished"`
+		} `yaml:"spec"`
+	}
+
+	// expectCollected runs the fixture Job until it reaches the given condition and checks that the Job
+	// and its pods are deleted no earlier than the TTL and no later than the TTL plus the margin
+	expectCollected := func(jobYAML []byte, condition batchv1.JobConditionType) {
+		var jobConfig jobSpec
+		err := yaml.Unmarshal(jobYAML, &jobConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		name := jobConfig.Metadata.Name
+		ttl := time.Duration(jobConfig.Spec.TTLSecondsAfterFinished) * time.Second
+
+		logger.Info().Msgf("=== Applying Job %s with ttlSecondsAfterFinished %v ===", name, ttl)
+		err = example.ApplyRawManifest(clientset, jobYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		result, err := example.WaitForJobComplete(context.TODO(), clientset, example.TestNamespace(), name, 3*time.Minute)
+		if condition == batchv1.JobFailed {
+			gomega.Expect(err).To(gomega.MatchError(example.ErrJobFailed))
+		} else {
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+		finished := result.FinishTime
+		gomega.Expect(result.Pods).NotTo(gomega.BeEmpty(), "Job %s has no pods to collect", name)
+
+		deadline := finished.Add(ttl + margin)
+		for {
+			_, err := clientset.BatchV1().Jobs(example.TestNamespace()).Get(context.TODO(), name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				break
+			}
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Job %s still exists %v after it finished, is the TTL controller enabled?",
+					name, time.Since(finished).Round(time.Second)))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		// Condition timestamps have second resolution
+		collected := time.Since(finished)
+		logger.Info().Msgf("=== Job %s deleted %v after it finished ===", name, collected.Round(time.Second))
+		gomega.Expect(collected).To(gomega.BeNumerically(">=", ttl-time.Second), "Job %s was deleted before its TTL", name)
+		example.RecordMetric(testTag, fmt.Sprintf("%s_collected_seconds", condition), collected.Seconds())
+
+		// The TTL controller deletes in the foreground, but a garbage collector lagging behind would leave the pods
+		for {
+			pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "job-name=" + name})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if len(pods) == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("%d pods of Job %s still exist %v after it finished",
+					len(pods), name, time.Since(finished).Round(time.Second)))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		margin = defaultMarginSeconds * time.Second
+		if value := os.Getenv("TTL_MARGIN_SECONDS"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid TTL_MARGIN_SECONDS: %s", value)
+			margin = time.Duration(seconds) * time.Second
+		}
+
+		succeededJob, failedJob, err = example.GetTTLAfterFinishedTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should delete a succeeded Job and its pods after the TTL", func() {
+		logger.Info().Msgf("=== Starting TTL-after-finished Job cleanup E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		expectCollected(succeededJob, batchv1.JobComplete)
+	})
+
+	ginkgo.It("should delete a failed Job and its pods after the TTL", func() {
+		defer example.E2ePanicHandler()
+
+		expectCollected(failedJob, batchv1.JobFailed)
+	})
+
+})
@@ -0,0 +1,157 @@
+package example
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ResourceUsage is the CPU and memory a pod or node used in the metrics-server's last scrape window.
+// A pod's usage is the sum over its containers.
+type ResourceUsage struct {
+	Name          string `json:"name"`
+	CPUMillicores int64  `json:"cpu_millicores"`
+	MemoryBytes   int64  `json:"memory_bytes"`
+}
+
+// UsageSnapshot holds the usage of a namespace's pods and of all nodes, in the form RecordMetric puts
+// into the report
+type UsageSnapshot struct {
+	Time  time.Time       `json:"time"`
+	Pods  []ResourceUsage `json:"pods"`
+	Nodes []ResourceUsage `json:"nodes"`
+}
+
+// PodCPUMillicores returns the summed CPU usage of the snapshot's pods
+func (s *UsageSnapshot) PodCPUMillicores() int64 {
+	var total int64
+	for _, pod := range s.Pods {
+		total += pod.CPUMillicores
+	}
+	return total
+}
+
+// The parts of the metrics.k8s.io/v1beta1 PodMetricsList and NodeMetricsList the snapshot uses. The
+// metrics API types live in k8s.io/metrics, which isn't worth a dependency for two lists.
+type metricsUsage struct {
+	CPU    resource.Quantity `json:"cpu"`
+	Memory resource.Quantity `json:"memory"`
+}
+
+type metricsList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Usage      metricsUsage `json:"usage"`
+		Containers []struct {
+			Usage metricsUsage `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// SnapshotUsage reads the current pod usage in the namespace and the node usage from the metrics API,
+// which is served by metrics-server. Pods only appear once they have been scraped, typically within a
+// minute of starting.
+func SnapshotUsage(ctx context.Context, clientset *kubernetes.Clientset, namespace string) (*UsageSnapshot, error) {
+	snapshot := &UsageSnapshot{Time: time.Now()}
+
+	var pods metricsList
+	if err := getMetricsList(ctx, clientset, "/apis/metrics.k8s.io/v1beta1/namespaces/"+namespace+"/pods", "", &pods); err != nil {
+		return nil, err
+	}
+	for _, item := range pods.Items {
+		usage := ResourceUsage{Name: item.Metadata.Name}
+		for _, container := range item.Containers {
+			usage.CPUMillicores += container.Usage.CPU.MilliValue()
+			usage.MemoryBytes += container.Usage.Memory.Value()
+		}
+		snapshot.Pods = append(snapshot.Pods, usage)
+	}
+
+	var nodes metricsList
+	if err := getMetricsList(ctx, clientset, "/apis/metrics.k8s.io/v1beta1/nodes", "", &nodes); err != nil {
+		return nil, err
+	}
+	for _, item := range nodes.Items {
+		snapshot.Nodes = append(snapshot.Nodes, ResourceUsage{
+			Name:          item.Metadata.Name,
+			CPUMillicores: item.Usage.CPU.MilliValue(),
+			MemoryBytes:   item.Usage.Memory.Value(),
+		})
+	}
+	return snapshot, nil
+}
+
+// WaitForPodMetrics polls the metrics API until metrics-server has a sample for every running pod
+// matching the label selector, with at least one such pod, and returns their usage. Until then an HPA
+// can't compute a utilization and reports FailedGetResourceMetric, so HPA suites call it before they
+// wait for the HPA to scale. A metrics API that isn't served fails at once, and on timeout the error
+// names the pods without metrics.
+func WaitForPodMetrics(ctx context.Context, clientset *kubernetes.Clientset, namespace, selector string,
+	timeout time.Duration) ([]ResourceUsage, error) {
+	timeout = Timeout(TimeoutMetrics, timeout)
+	var usages []ResourceUsage
+	var missing []string
+	err := PollUntil(ctx, 5*time.Second, timeout, func(ctx context.Context) (bool, error) {
+		pods, err := ListPods(ctx, clientset, namespace, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, err
+		}
+		var metrics metricsList
+		if err := getMetricsList(ctx, clientset, "/apis/metrics.k8s.io/v1beta1/namespaces/"+namespace+"/pods", selector, &metrics); err != nil {
+			return false, err
+		}
+		sampled := map[string]ResourceUsage{}
+		for _, item := range metrics.Items {
+			usage := ResourceUsage{Name: item.Metadata.Name}
+			for _, container := range item.Containers {
+				usage.CPUMillicores += container.Usage.CPU.MilliValue()
+				usage.MemoryBytes += container.Usage.Memory.Value()
+			}
+			sampled[usage.Name] = usage
+		}
+
+		usages, missing = nil, nil
+		for _, pod := range pods {
+			if pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning {
+				continue
+			}
+			if usage, found := sampled[pod.Name]; found {
+				usages = append(usages, usage)
+			} else {
+				missing = append(missing, pod.Name)
+			}
+		}
+		return len(usages) > 0 && len(missing) == 0, nil
+	})
+	if err != nil {
+		if len(usages) == 0 && len(missing) == 0 {
+			return nil, fmt.Errorf("no running pods %q in %s with metrics: %w", selector, namespace, err)
+		}
+		return usages, fmt.Errorf("pods %q in %s without metrics %v: %w", selector, namespace, missing, err)
+	}
+	return usages, nil
+}
+
+// getMetricsList reads a metrics API list as JSON, filtered by the label selector unless it is empty
+func getMetricsList(ctx context.Context, clientset *kubernetes.Clientset, path, selector string, list *metricsList) error {
+	request := clientset.RESTClient().Get().AbsPath(path).SetHeader("Accept", "application/json")
+	if selector != "" {
+		request = request.Param("labelSelector", selector)
+	}
+	body, err := request.DoRaw(ctx)
+	if err != nil {
+		return fmt.Errorf("metrics request %s failed: %w", path, err)
+	}
+	if err := json.Unmarshal(body, list); err != nil {
+		return fmt.Errorf("metrics response %s decoding error: %w", path, err)
+	}
+	return nil
+}
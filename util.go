@@ -4,22 +4,36 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"strings"
+	"math"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/onsi/ginkgo/v2"
 	"github.com/rs/zerolog"
 	appsv1 "k8s.io/api/apps/v1"
 	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer/json"
 	"k8s.io/apimachinery/pkg/runtime/serializer/yaml"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/remotecommand"
 )
 
 var (
@@ -28,7 +42,8 @@ var (
 		json.DefaultMetaFactory, scheme, scheme,
 		json.SerializerOptions{Yaml: false, Strict: true},
 	)
-	yamlSerializer = yaml.NewDecodingSerializer(jsonSerializer)
+	yamlSerializer         = yaml.NewDecodingSerializer(jsonSerializer)
+	unstructuredSerializer = yaml.NewDecodingSerializer(unstructured.UnstructuredJSONScheme)
 )
 
 func init() {
@@ -36,13 +51,23 @@ func init() {
 	corev1.AddToScheme(scheme)
 	appsv1.AddToScheme(scheme)
 	autoscalingv2.AddToScheme(scheme)
+	batchv1.AddToScheme(scheme)
 	policyv1.AddToScheme(scheme)
+	schedulingv1.AddToScheme(scheme)
 }
 
 func ApplyRawManifest(clientset *kubernetes.Clientset, yamlContent []byte) error {
+	return ApplyRawManifestConcurrently(clientset, yamlContent, 1)
+}
+
+// ApplyRawManifestConcurrently is ApplyRawManifest creating up to concurrency documents at a time, for
+// manifests of many documents. Namespaces are created before the other documents. Every document is
+// attempted, the error lists each one that failed.
+func ApplyRawManifestConcurrently(clientset *kubernetes.Clientset, yamlContent []byte, concurrency int) error {
 	// Split YAML into individual documents
 	documents := bytes.Split(yamlContent, []byte("\n---\n"))
-	var errors []string
+	var decoded []manifestDocument
+	var errors []manifestError
 
 	for i, doc := range documents {
 		if len(bytes.TrimSpace(doc)) == 0 {
@@ -51,108 +76,368 @@ func ApplyRawManifest(clientset *kubernetes.Clientset, yamlContent []byte) error
 
 		obj, _, err := yamlSerializer.Decode(doc, nil, nil)
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("Document %d decode failed: %v", i+1, err))
+			errors = append(errors, manifestError{i + 1, fmt.Sprintf("Document %d decode failed: %v", i+1, err)})
 			continue
 		}
 
-		var createErr error
+		var create func(ctx context.Context) error
+		first := false
 		switch o := obj.(type) {
+		case *corev1.Namespace:
+			first = true
+			create = func(ctx context.Context) error {
+				_, err := clientset.CoreV1().Namespaces().Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
 		case *autoscalingv2.HorizontalPodAutoscaler:
-			_, createErr = clientset.AutoscalingV2().HorizontalPodAutoscalers(o.Namespace).Create(
-				context.TODO(), o, metav1.CreateOptions{})
+			create = func(ctx context.Context) error {
+				_, err := clientset.AutoscalingV2().HorizontalPodAutoscalers(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
 		case *appsv1.Deployment:
-			_, createErr = clientset.AppsV1().Deployments(o.Namespace).Create(
-				context.TODO(), o, metav1.CreateOptions{})
+			create = func(ctx context.Context) error {
+				_, err := clientset.AppsV1().Deployments(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
 		case *appsv1.StatefulSet:
-			_, createErr = clientset.AppsV1().StatefulSets(o.Namespace).Create(
-				context.TODO(), o, metav1.CreateOptions{})
+			create = func(ctx context.Context) error {
+				_, err := clientset.AppsV1().StatefulSets(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
 		case *corev1.Service:
-			_, createErr = clientset.CoreV1().Services(o.Namespace).Create(
-				context.TODO(), o, metav1.CreateOptions{})
+			create = func(ctx context.Context) error {
+				_, err := clientset.CoreV1().Services(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
+		case *corev1.Pod:
+			create = func(ctx context.Context) error {
+				_, err := clientset.CoreV1().Pods(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
+		case *corev1.ConfigMap:
+			create = func(ctx context.Context) error {
+				_, err := clientset.CoreV1().ConfigMaps(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
+		case *corev1.Secret:
+			create = func(ctx context.Context) error {
+				_, err := clientset.CoreV1().Secrets(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
+		case *corev1.PersistentVolumeClaim:
+			create = func(ctx context.Context) error {
+				_, err := clientset.CoreV1().PersistentVolumeClaims(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
+		case *corev1.PersistentVolume:
+			create = func(ctx context.Context) error {
+				_, err := clientset.CoreV1().PersistentVolumes().Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
 		case *policyv1.PodDisruptionBudget:
-			_, createErr = clientset.PolicyV1().PodDisruptionBudgets(o.Namespace).Create(
-				context.TODO(), o, metav1.CreateOptions{})
+			create = func(ctx context.Context) error {
+				_, err := clientset.PolicyV1().PodDisruptionBudgets(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
+		case *batchv1.Job:
+			create = func(ctx context.Context) error {
+				_, err := clientset.BatchV1().Jobs(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
+		case *batchv1.CronJob:
+			create = func(ctx context.Context) error {
+				_, err := clientset.BatchV1().CronJobs(o.Namespace).Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
+		case *schedulingv1.PriorityClass:
+			create = func(ctx context.Context) error {
+				_, err := clientset.SchedulingV1().PriorityClasses().Create(ctx, o, metav1.CreateOptions{})
+				return err
+			}
 		default:
-			errors = append(errors, fmt.Sprintf("Document %d: unsupported type %T", i+1, obj))
+			errors = append(errors, manifestError{i + 1, fmt.Sprintf("Document %d: unsupported type %T", i+1, obj)})
 			continue
 		}
 
-		if createErr != nil {
-			errors = append(errors, fmt.Sprintf("Document %d apply failed: %v", i+1, createErr))
-		}
+		decoded = append(decoded, manifestDocument{number: i + 1, first: first, create: func(ctx context.Context) error {
+			// A create that timed out may still have gone through, so AlreadyExists on a retry is success
+			attempts := 0
+			return Retry(ctx, DefaultRetryPolicy, func(ctx context.Context) error {
+				attempts++
+				err := create(ctx)
+				if attempts > 1 && apierrors.IsAlreadyExists(err) {
+					return nil
+				}
+				return err
+			})
+		}})
 	}
 
-	if len(errors) > 0 {
-		return fmt.Errorf("manifest application errors:\n%s", strings.Join(errors, "\n"))
-	}
-	return nil
+	errors = append(errors, applyDocuments(decoded, concurrency)...)
+	return manifestErrorsOf(errors)
 }
 
-func E2ePanicHandler() {
-	defer func() {
-		if r := recover(); r != nil {
-			ginkgo.Fail(fmt.Sprintf("Test panicked with error: %v", r))
-		}
-	}()
+// ApplyDynamicManifest creates every document in yamlContent through the dynamic client, resolving
+// resources via API discovery. Unlike ApplyRawManifest it accepts any kind the cluster serves,
+// including cluster-scoped objects and custom resources.
+func ApplyDynamicManifest(yamlContent []byte) error {
+	_, err := ApplyDynamicManifestTracked(yamlContent)
+	return err
 }
 
-func ClearNamespace(logger zerolog.Logger, clientset *kubernetes.Clientset) {
-	logger.Info().Msgf("=== Final namespace cleanup ===")
-	err := clientset.CoreV1().Namespaces().Delete(
-		context.TODO(),
-		"test-ns",
-		metav1.DeleteOptions{},
+// ApplyDynamicManifestConcurrently is ApplyDynamicManifest creating up to concurrency documents at a
+// time, for manifests of many documents. Namespaces and CustomResourceDefinitions are created before
+// the other documents, and custom resources of a CRD in the same manifest wait up to a minute for it
+// to be served. Every document is attempted, the error lists each one that failed.
+func ApplyDynamicManifestConcurrently(yamlContent []byte, concurrency int) error {
+	_, err := applyDynamicManifest(yamlContent, concurrency)
+	return err
+}
+
+// ClusterScopedObject identifies a cluster-scoped object created by a suite. ClearNamespace doesn't
+// remove these, so suites pass them to DeleteClusterScopedObjects in AfterAll.
+type ClusterScopedObject struct {
+	Resource schema.GroupVersionResource
+	Name     string
+}
+
+func (o ClusterScopedObject) String() string {
+	return fmt.Sprintf("%s/%s", o.Resource.GroupResource(), o.Name)
+}
+
+// ApplyDynamicManifestTracked is ApplyDynamicManifest that also returns the cluster-scoped objects it
+// created, including those created before a later document failed.
+func ApplyDynamicManifestTracked(yamlContent []byte) ([]ClusterScopedObject, error) {
+	return applyDynamicManifest(yamlContent, 1)
+}
+
+// applyDynamicManifest creates the documents through the process's dynamic client, resolving their
+// resources through the discovery of the process's clientset
+func applyDynamicManifest(yamlContent []byte, concurrency int) ([]ClusterScopedObject, error) {
+	dynamicClient, err := DynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	clientset, err := GetClient()
+	if err != nil {
+		return nil, err
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery()))
+
+	documents := bytes.Split(yamlContent, []byte("\n---\n"))
+	var (
+		created   []ClusterScopedObject
+		createdMu sync.Mutex
+		decoded   []manifestDocument
+		errors    []manifestError
 	)
-	if err != nil && !apierrors.IsNotFound(err) {
-		logger.Error().Msgf("Initial cleanup failed: %v", err)
+	hasCRDs := false
+	for i, doc := range documents {
+		if len(bytes.TrimSpace(doc)) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		_, gvk, err := unstructuredSerializer.Decode(doc, nil, obj)
+		if err != nil {
+			errors = append(errors, manifestError{i + 1, fmt.Sprintf("Document %d decode failed: %v", i+1, err)})
+			continue
+		}
+		crd := gvk.GroupKind() == schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+		hasCRDs = hasCRDs || crd
+		first := crd || gvk.GroupKind() == schema.GroupKind{Kind: "Namespace"}
+
+		kind := *gvk
+		decoded = append(decoded, manifestDocument{number: i + 1, first: first, create: func(ctx context.Context) error {
+			mapping, err := mapper.RESTMapping(kind.GroupKind(), kind.Version)
+			if meta.IsNoMatchError(err) && hasCRDs && !first {
+				// The manifest's CRDs were created, but the API server may not serve them yet
+				err = PollUntil(ctx, 2*time.Second, time.Minute, func(ctx context.Context) (bool, error) {
+					mapper.Reset()
+					mapping, err = mapper.RESTMapping(kind.GroupKind(), kind.Version)
+					return err == nil, nil
+				})
+			}
+			if err != nil {
+				return fmt.Errorf("no resource for %s: %w", kind.String(), err)
+			}
+
+			var resource dynamic.ResourceInterface
+			namespaced := mapping.Scope.Name() == meta.RESTScopeNameNamespace
+			if namespaced {
+				namespace := obj.GetNamespace()
+				if namespace == "" {
+					namespace = metav1.NamespaceDefault
+				}
+				resource = dynamicClient.Resource(mapping.Resource).Namespace(namespace)
+			} else {
+				resource = dynamicClient.Resource(mapping.Resource)
+			}
+
+			if _, err := resource.Create(ctx, obj, metav1.CreateOptions{}); err != nil {
+				return err
+			}
+			if !namespaced {
+				createdMu.Lock()
+				created = append(created, ClusterScopedObject{Resource: mapping.Resource, Name: obj.GetName()})
+				createdMu.Unlock()
+			}
+			return nil
+		}})
+	}
+
+	errors = append(errors, applyDocuments(decoded, concurrency)...)
+	return created, manifestErrorsOf(errors)
+}
+
+// DeleteClusterScopedObjects deletes the objects in reverse creation order and waits up to
+// Timeout(TimeoutNamespace, 3*time.Minute) for each to be gone. Objects that no longer exist are
+// skipped, failures are only logged.
+func DeleteClusterScopedObjects(logger zerolog.Logger, config *rest.Config, objects []ClusterScopedObject) {
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		logger.Error().Msgf("Cluster-scoped cleanup failed: dynamic client creation error: %v", err)
+		return
 	}
 
-	// Wait for initial deletion (3 minutes)
-	initialDeleteTimeout := time.Now().Add(3 * time.Minute)
-	for {
-		_, err := clientset.CoreV1().Namespaces().Get(context.TODO(), "test-ns", metav1.GetOptions{})
+	for i := len(objects) - 1; i >= 0; i-- {
+		object := objects[i]
+		resource := dynamicClient.Resource(object.Resource)
+		err := resource.Delete(context.TODO(), object.Name, metav1.DeleteOptions{})
 		if apierrors.IsNotFound(err) {
-			logger.Info().Msgf("Namespace 'test-ns' successfully deleted")
-			return
+			continue
+		}
+		if err != nil {
+			logger.Error().Msgf("Failed to delete %s: %v", object, err)
+			continue
 		}
-		if time.Now().After(initialDeleteTimeout) {
-			logger.Info().Msgf("Initial deletion timed out after 3 minutes. Attempting force deletion...")
-			break
+
+		logger.Info().Msgf("=== Deleting %s ===", object)
+		timeout := Timeout(TimeoutNamespace, 3*time.Minute)
+		deadline := time.Now().Add(timeout)
+		for {
+			_, err := resource.Get(context.TODO(), object.Name, metav1.GetOptions{})
+			if apierrors.IsNotFound(err) {
+				break
+			}
+			if time.Now().After(deadline) {
+				logger.Error().Msgf("%s still exists after %v", object, timeout)
+				break
+			}
+			time.Sleep(2 * time.Second)
 		}
-		logger.Info().Msgf("Waiting for initial deletion to complete...")
-		time.Sleep(5 * time.Second)
 	}
+}
 
-	// Force deletion
-	deletePolicy := metav1.DeletePropagationBackground
-	deleteOptions := metav1.DeleteOptions{
-		GracePeriodSeconds: new(int64),
-		PropagationPolicy:  &deletePolicy,
+// ExecInPod runs command in the given container and returns its stdout and stderr.
+// A non-zero exit code of the command is returned as an error.
+func ExecInPod(ctx context.Context, config *rest.Config, clientset *kubernetes.Clientset,
+	namespace, podName, container string, command []string) (string, string, error) {
+
+	req := clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, clientgoscheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return "", "", fmt.Errorf("exec executor creation error: %w", err)
 	}
-	*deleteOptions.GracePeriodSeconds = 0 // This the forcing part
 
-	err = clientset.CoreV1().Namespaces().Delete(
-		context.TODO(),
-		"test-ns",
-		deleteOptions,
-	)
+	var stdout, stderr bytes.Buffer
+	err = executor.StreamWithContext(ctx, remotecommand.StreamOptions{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	return stdout.String(), stderr.String(), err
+}
+
+// Percentile returns the p-th percentile (0-100) of values using the nearest-rank method.
+// values does not need to be sorted and is not modified.
+func Percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// ServerVersionAtLeast reports whether the API server runs at least the minimum version (e.g. "1.27").
+// The server's git version is returned as well, for logging and skip messages.
+func ServerVersionAtLeast(clientset *kubernetes.Clientset, minimum string) (bool, string, error) {
+	info, err := clientset.Discovery().ServerVersion()
+	if err != nil {
+		return false, "", fmt.Errorf("server version lookup failed: %w", err)
+	}
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
 	if err != nil {
-		logger.Error().Msgf("Force deletion failed: %v", err)
+		return false, info.GitVersion, fmt.Errorf("server version %q parsing failed: %w", info.GitVersion, err)
 	}
+	minimumVersion, err := version.ParseGeneric(minimum)
+	if err != nil {
+		return false, info.GitVersion, fmt.Errorf("minimum version %q parsing failed: %w", minimum, err)
+	}
+	return serverVersion.AtLeast(minimumVersion), info.GitVersion, nil
+}
 
-	// Wait for force deletion (3 minutes)
-	forceDeleteTimeout := time.Now().Add(3 * time.Minute)
-	for {
-		_, err := clientset.CoreV1().Namespaces().Get(context.TODO(), "test-ns", metav1.GetOptions{})
-		if apierrors.IsNotFound(err) {
-			logger.Info().Msgf("Namespace 'test-ns' successfully force deleted")
-			return
+func E2ePanicHandler() {
+	defer func() {
+		if r := recover(); r != nil {
+			ginkgo.Fail(fmt.Sprintf("Test panicked with error: %v", r))
 		}
-		if time.Now().After(forceDeleteTimeout) {
-			logger.Error().Msgf("Force deletion timed out after 3 minutes")
-			return
+	}()
+}
+
+// NamespaceDeletionBlockers returns what keeps a terminating namespace from being deleted, as
+// "Reason: message" from its deletion conditions (remaining content and finalizers, discovery failures).
+func NamespaceDeletionBlockers(ctx context.Context, clientset *kubernetes.Clientset, namespace string) ([]string, error) {
+	ns, err := clientset.CoreV1().Namespaces().Get(ctx, namespace, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var blockers []string
+	for _, condition := range ns.Status.Conditions {
+		if condition.Status == corev1.ConditionTrue {
+			blockers = append(blockers, fmt.Sprintf("%s: %s", condition.Type, condition.Message))
 		}
-		logger.Info().Msgf("Waiting for force deletion to complete...")
-		time.Sleep(5 * time.Second)
 	}
+	return blockers, nil
+}
+
+// ClearNamespace empties the TestNamespace after a suite, for the next suite of the process to reuse it.
+// The namespace itself is created and deleted once per process, see SetUpTestNamespace. When it can't
+// be emptied, it is deleted and created again.
+func ClearNamespace(logger zerolog.Logger, clientset *kubernetes.Clientset) {
+	manager := NewNamespaceManager(logger, clientset, TestNamespace(), nil)
+	err := manager.Empty(context.TODO(), 3*time.Minute)
+	if err == nil {
+		return
+	}
+	logger.Error().Msgf("Emptying the namespace failed, recreating it: %v", err)
+	manager.Cleanup(context.TODO())
+	if err := manager.Ensure(context.TODO(), time.Minute); err != nil {
+		logger.Error().Msgf("Namespace recreation failed: %v", err)
+	}
+}
+
+// ClearNamespaceByName deletes a namespace a suite created in addition to the TestNamespace
+func ClearNamespaceByName(logger zerolog.Logger, clientset *kubernetes.Clientset, namespace string) {
+	NewNamespaceManager(logger, clientset, namespace, nil).Cleanup(context.TODO())
 }
@@ -0,0 +1,238 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Volume expansion E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("VolumeExpansionTest"), func() {
+	var (
+		clientset        *kubernetes.Clientset
+		config           *rest.Config
+		storageClassName string
+		originalSizeKB   int64
+		dataChecksum     string
+		logger           zerolog.Logger
+		testTag          = "VolumeExpansionTest"
+	)
+
+	const (
+		defaultClassAnnotation = "storageclass.kubernetes.io/is-default-class"
+		expandedSize           = "2Gi"
+		pollInterval           = 5 * time.Second
+	)
+
+	execInWriter := func(script string) string {
+		stdout, stderr, err := example.ExecInPod(context.TODO(), config, clientset, example.TestNamespace(), "expansion-writer", "main",
+			[]string{"sh", "-c", script})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Command failed: %s", stderr)
+		return strings.TrimSpace(stdout)
+	}
+
+	// filesystemSizeKB reports the size of the mounted filesystem as seen from inside the pod
+	filesystemSizeKB := func() int64 {
+		output := execInWriter("df -Pk /data | tail -n 1 | awk '{print $2}'")
+		size, err := strconv.ParseInt(output, 10, 64)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Unexpected df output: %q", output)
+		return size
+	}
+
+	waitForWriterRunning := func() {
+		runningTimeout := example.Timeout(example.TimeoutVolume, 5*time.Minute)
+		deadline := time.Now().Add(runningTimeout)
+		for {
+			pod, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "expansion-writer", metav1.GetOptions{})
+			if err == nil && pod.Status.Phase == v1.PodRunning && pod.DeletionTimestamp == nil {
+				return
+			}
+			if err != nil && !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Writer pod did not reach Running within %v", runningTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		config, err = example.GetRestConfig()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should provision a PVC from an expandable StorageClass and write data", func() {
+		logger.Info().Msgf("=== Starting Volume expansion E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		storageClassName = os.Getenv("VOLUME_EXPANSION_STORAGE_CLASS")
+		if storageClassName == "" {
+			storageClasses, err := clientset.StorageV1().StorageClasses().List(context.TODO(), metav1.ListOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			for _, sc := range storageClasses.Items {
+				if sc.Annotations[defaultClassAnnotation] == "true" {
+					storageClassName = sc.Name
+				}
+			}
+		}
+		if storageClassName == "" {
+			ginkgo.Skip("No VOLUME_EXPANSION_STORAGE_CLASS set and the cluster has no default StorageClass")
+		}
+
+		storageClass, err := clientset.StorageV1().StorageClasses().Get(context.TODO(), storageClassName, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if storageClass.AllowVolumeExpansion == nil || !*storageClass.AllowVolumeExpansion {
+			ginkgo.Skip(fmt.Sprintf("StorageClass %s does not allow volume expansion", storageClassName))
+		}
+		logger.Info().Msgf("=== Using StorageClass %s (provisioner: %s) ===", storageClassName, storageClass.Provisioner)
+
+		pvcYAML, podYAML, err := example.GetVolumeExpansionTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// The class is only known at runtime, so the claim is decoded and created directly
+		pvc := &v1.PersistentVolumeClaim{}
+		err = utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(pvcYAML), 4096).Decode(pvc)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		pvc.Spec.StorageClassName = &storageClassName
+
+		logger.Info().Msgf("=== Creating PVC and writer pod ===")
+		_, err = clientset.CoreV1().PersistentVolumeClaims(example.TestNamespace()).Create(context.TODO(), pvc, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		err = example.ApplyRawManifest(clientset, podYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		waitForWriterRunning()
+
+		originalSizeKB = filesystemSizeKB()
+		logger.Info().Msgf("=== Filesystem size before expansion: %d KiB ===", originalSizeKB)
+
+		logger.Info().Msgf("=== Writing 50MiB of random data ===")
+		dataChecksum = execInWriter("dd if=/dev/urandom of=/data/payload bs=1M count=50 2>/dev/null && sync && md5sum /data/payload")
+		logger.Info().Msgf("=== Payload checksum: %s ===", dataChecksum)
+	})
+
+	ginkgo.It("should grow the filesystem after the PVC is patched", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Patching PVC storage request to %s ===", expandedSize)
+		patch := fmt.Sprintf(`{"spec":{"resources":{"requests":{"storage":"%s"}}}}`, expandedSize)
+		_, err := clientset.CoreV1().PersistentVolumeClaims(example.TestNamespace()).Patch(
+			context.TODO(),
+			"expandable-pvc",
+			types.StrategicMergePatchType,
+			[]byte(patch),
+			metav1.PatchOptions{},
+		)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		expected := resource.MustParse(expandedSize)
+		// Allow some filesystem overhead, the grown filesystem only needs to be clearly larger than before
+		minimumSizeKB := originalSizeKB + (expected.Value()/1024-originalSizeKB)/2
+
+		expansionTimeout := example.Timeout(example.TimeoutVolume, 5*time.Minute)
+		deadline := time.Now().Add(expansionTimeout)
+		pendingSince := time.Time{}
+		restarted := false
+		for {
+			pvc, err := clientset.CoreV1().PersistentVolumeClaims(example.TestNamespace()).Get(context.TODO(), "expandable-pvc", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			capacity := pvc.Status.Capacity[v1.ResourceStorage]
+			var conditions []string
+			fsResizePending := false
+			for _, cond := range pvc.Status.Conditions {
+				conditions = append(conditions, string(cond.Type))
+				if cond.Type == v1.PersistentVolumeClaimFileSystemResizePending {
+					fsResizePending = true
+				}
+			}
+
+			sizeKB := filesystemSizeKB()
+			logger.Info().Msgf("PVC capacity: %s, conditions: %v, filesystem size: %d KiB\n", capacity.String(), conditions, sizeKB)
+
+			if capacity.Cmp(expected) >= 0 && sizeKB >= minimumSizeKB {
+				logger.Info().Msgf("=== Filesystem grew from %d KiB to %d KiB ===", originalSizeKB, sizeKB)
+				break
+			}
+
+			// Drivers without online expansion resize the filesystem on the next mount
+			if fsResizePending && !restarted {
+				if pendingSince.IsZero() {
+					pendingSince = time.Now()
+				} else if time.Since(pendingSince) > 90*time.Second {
+					logger.Info().Msgf("=== Filesystem resize still pending, recreating writer pod for offline expansion ===")
+					err := clientset.CoreV1().Pods(example.TestNamespace()).Delete(context.TODO(), "expansion-writer", metav1.DeleteOptions{})
+					gomega.Expect(err).NotTo(gomega.HaveOccurred())
+					for {
+						_, err := clientset.CoreV1().Pods(example.TestNamespace()).Get(context.TODO(), "expansion-writer", metav1.GetOptions{})
+						if apierrors.IsNotFound(err) {
+							break
+						}
+						time.Sleep(example.CheckInterval(pollInterval))
+					}
+
+					_, podYAML, err := example.GetVolumeExpansionTestFiles()
+					gomega.Expect(err).NotTo(gomega.HaveOccurred())
+					err = example.ApplyRawManifest(clientset, podYAML)
+					gomega.Expect(err).NotTo(gomega.HaveOccurred())
+					waitForWriterRunning()
+					restarted = true
+				}
+			}
+
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Filesystem did not grow within %v (capacity %s, filesystem %d KiB)",
+					expansionTimeout, capacity.String(), sizeKB))
+			}
+
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+	})
+
+	ginkgo.It("should keep the data written before expansion", func() {
+		defer example.E2ePanicHandler()
+
+		checksum := execInWriter("md5sum /data/payload")
+		logger.Info().Msgf("=== Payload checksum after expansion: %s ===", checksum)
+		gomega.Expect(checksum).To(gomega.Equal(dataChecksum), "Data changed during volume expansion")
+	})
+
+})
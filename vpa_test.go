@@ -0,0 +1,203 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("VPA recommendation E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("VPARecommendationTest"), func() {
+	var (
+		clientset     *kubernetes.Clientset
+		dynamicClient dynamic.Interface
+		vpaYAML       []byte
+		depYAML       []byte
+		logger        zerolog.Logger
+		testTag       = "VPARecommendationTest"
+	)
+
+	const (
+		pollInterval           = 10 * time.Second
+		recommendationDeadline = 5 * time.Minute
+	)
+
+	vpaResource := schema.GroupVersionResource{Group: "autoscaling.k8s.io", Version: "v1", Resource: "verticalpodautoscalers"}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		dynamicClient, err = example.DynamicClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		// The VPA is an add-on, clusters without its CRDs are skipped rather than failed
+		_, err = clientset.Discovery().ServerResourcesForGroupVersion(vpaResource.GroupVersion().String())
+		if apierrors.IsNotFound(err) {
+			ginkgo.Skip("VerticalPodAutoscaler CRDs (autoscaling.k8s.io/v1) are not installed")
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		vpaYAML, depYAML, err = example.GetVPATestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should apply the workload and a VPA in Off mode", func() {
+		logger.Info().Msgf("=== Starting VPA recommendation E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Applying Deployment manifest ===")
+		err := example.ApplyRawManifest(clientset, depYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying VPA manifest ===")
+		err = example.ApplyDynamicManifest(vpaYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		err = example.WaitForDeploymentReady(context.TODO(), clientset, example.TestNamespace(), "vpa-app", 3*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should provide recommendations within sane bounds", func() {
+		defer example.E2ePanicHandler()
+
+		type containerPolicy struct {
+			ContainerName string            `yaml:"containerName"`
+			MinAllowed    map[string]string `yaml:"minAllowed"`
+			MaxAllowed    map[string]string `yaml:"maxAllowed"`
+		}
+		type vpaSpec struct {
+			Spec struct {
+				ResourcePolicy struct {
+					ContainerPolicies []containerPolicy `yaml:"containerPolicies"`
+				} `yaml:"resourcePolicy"`
+			} `yaml:"spec"`
+		}
+
+		var vpaConfig vpaSpec
+		err := yaml.Unmarshal(vpaYAML, &vpaConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Waiting up to %v for recommendations ===", recommendationDeadline)
+		startedAt := time.Now()
+		deadline := startedAt.Add(recommendationDeadline)
+		var recommendations []interface{}
+		for {
+			vpa, err := dynamicClient.Resource(vpaResource).Namespace(example.TestNamespace()).Get(context.TODO(), "vpa-app-vpa", metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			recommendations, _, err = unstructured.NestedSlice(vpa.Object, "status", "recommendation", "containerRecommendations")
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			if len(recommendations) > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("VPA provided no recommendation within %v, is the recommender running?", recommendationDeadline))
+			}
+			logger.Info().Msgf("Waiting for VPA recommendation\n")
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== Recommendation available after %v ===", time.Since(startedAt).Round(time.Second))
+		example.RecordMetric(testTag, "recommendation_seconds", time.Since(startedAt).Seconds())
+
+		quantity := func(rec map[string]interface{}, field string, name v1.ResourceName) resource.Quantity {
+			value, found, err := unstructured.NestedString(rec, field, string(name))
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(found).To(gomega.BeTrue(), "Recommendation has no %s %s", field, name)
+			q, err := resource.ParseQuantity(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			return q
+		}
+
+		for _, item := range recommendations {
+			rec, ok := item.(map[string]interface{})
+			gomega.Expect(ok).To(gomega.BeTrue())
+			containerName, _, _ := unstructured.NestedString(rec, "containerName")
+
+			var policy *containerPolicy
+			for i := range vpaConfig.Spec.ResourcePolicy.ContainerPolicies {
+				if vpaConfig.Spec.ResourcePolicy.ContainerPolicies[i].ContainerName == containerName {
+					policy = &vpaConfig.Spec.ResourcePolicy.ContainerPolicies[i]
+				}
+			}
+
+			for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+				lower := quantity(rec, "lowerBound", name)
+				target := quantity(rec, "target", name)
+				upper := quantity(rec, "upperBound", name)
+				logger.Info().Msgf("Container %s %s: lowerBound %s, target %s, upperBound %s\n",
+					containerName, name, lower.String(), target.String(), upper.String())
+
+				gomega.Expect(target.Sign()).To(gomega.Equal(1), "Non-positive %s target for %s", name, containerName)
+				gomega.Expect(lower.Cmp(target)).To(gomega.BeNumerically("<=", 0), "%s lowerBound above target", name)
+				gomega.Expect(target.Cmp(upper)).To(gomega.BeNumerically("<=", 0), "%s target above upperBound", name)
+
+				if policy == nil {
+					continue
+				}
+				if minAllowed, ok := policy.MinAllowed[string(name)]; ok {
+					gomega.Expect(target.Cmp(resource.MustParse(minAllowed))).To(gomega.BeNumerically(">=", 0),
+						"%s target %s below minAllowed %s", name, target.String(), minAllowed)
+				}
+				if maxAllowed, ok := policy.MaxAllowed[string(name)]; ok {
+					gomega.Expect(target.Cmp(resource.MustParse(maxAllowed))).To(gomega.BeNumerically("<=", 0),
+						"%s target %s above maxAllowed %s", name, target.String(), maxAllowed)
+				}
+			}
+		}
+	})
+
+	ginkgo.It("should not touch the pods in Off mode", func() {
+		defer example.E2ePanicHandler()
+
+		deployment, err := clientset.AppsV1().Deployments(example.TestNamespace()).Get(context.TODO(), "vpa-app", metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		expected := deployment.Spec.Template.Spec.Containers[0].Resources.Requests
+
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=vpa-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(pods).To(gomega.HaveLen(int(*deployment.Spec.Replicas)))
+		for _, pod := range pods {
+			gomega.Expect(pod.DeletionTimestamp).To(gomega.BeNil(), "Pod %s is being evicted", pod.Name)
+			requests := pod.Spec.Containers[0].Resources.Requests
+			for _, name := range []v1.ResourceName{v1.ResourceCPU, v1.ResourceMemory} {
+				actual := requests[name]
+				gomega.Expect(actual.Cmp(expected[name])).To(gomega.Equal(0),
+					"Pod %s %s request was changed", pod.Name, name)
+			}
+		}
+	})
+
+})
@@ -0,0 +1,244 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
+)
+
+// PollUntil calls condition immediately and then every interval until it returns true, returns an
+// error or the timeout expires. An error from condition stops the polling and is returned as is,
+// unless IsRetryableError considers it transient; those are polled through and only reported with a
+// timeout. A timeout is returned wrapping context.DeadlineExceeded.
+func PollUntil(ctx context.Context, interval, timeout time.Duration, condition func(ctx context.Context) (bool, error)) error {
+	var transient error
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		done, err := condition(ctx)
+		if IsRetryableError(err) {
+			transient = err
+			return false, nil
+		}
+		transient = nil
+		return done, err
+	})
+	if errors.Is(err, context.DeadlineExceeded) {
+		if transient != nil {
+			return fmt.Errorf("condition not met within %v, last error %v: %w", timeout, transient, err)
+		}
+		return fmt.Errorf("condition not met within %v: %w", timeout, err)
+	}
+	return err
+}
+
+// ExpectPollUntil is PollUntil that fails the current spec when the condition isn't met, with the
+// optional description the way gomega assertions take one
+func ExpectPollUntil(ctx context.Context, interval, timeout time.Duration, condition func(ctx context.Context) (bool, error),
+	description ...interface{}) {
+	gomega.ExpectWithOffset(1, PollUntil(ctx, interval, timeout, condition)).To(gomega.Succeed(), description...)
+}
+
+// Eventually is gomega.Eventually with the interval and timeout set, for conditions that read better as
+// matchers than as a condition function, e.g. a func(g gomega.Gomega) with assertions that must all pass
+func Eventually(ctx context.Context, interval, timeout time.Duration, actual interface{}) gomega.AsyncAssertion {
+	return gomega.EventuallyWithOffset(1, ctx, actual).WithPolling(interval).WithTimeout(timeout)
+}
+
+// WaitForDeploymentReady watches the Deployment until the controller has observed its current
+// generation and every desired replica is updated and ready, with no old replicas left. On timeout
+// the error describes the last status seen, including the Progressing condition.
+func WaitForDeploymentReady(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, timeout time.Duration) error {
+	timeout = Timeout(TimeoutRollout, timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	listWatch := cache.NewListWatchFromClient(clientset.AppsV1().RESTClient(), "deployments", namespace,
+		fields.OneTermEqualSelector("metadata.name", name))
+	var last *appsv1.Deployment
+	_, err := watchtools.UntilWithSync(ctx, listWatch, &appsv1.Deployment{}, nil, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("deployment %s/%s was deleted", namespace, name)
+		}
+		deployment, ok := event.Object.(*appsv1.Deployment)
+		if !ok {
+			return false, nil
+		}
+		last = deployment
+		return deploymentReady(deployment), nil
+	})
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("waiting for deployment %s/%s failed: %w", namespace, name, err)
+	}
+	if last == nil {
+		return fmt.Errorf("deployment %s/%s not found within %v", namespace, name, timeout)
+	}
+	return fmt.Errorf("deployment %s/%s not ready within %v: %s", namespace, name, timeout, deploymentStatusSummary(last))
+}
+
+func deploymentReady(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.ReadyReplicas == replicas &&
+		deployment.Status.Replicas == replicas
+}
+
+func deploymentStatusSummary(deployment *appsv1.Deployment) string {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	summary := fmt.Sprintf("generation %d (observed %d), %d desired, %d total, %d updated, %d ready, %d available",
+		deployment.Generation, deployment.Status.ObservedGeneration, replicas, deployment.Status.Replicas,
+		deployment.Status.UpdatedReplicas, deployment.Status.ReadyReplicas, deployment.Status.AvailableReplicas)
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing || condition.Type == appsv1.DeploymentReplicaFailure {
+			summary += fmt.Sprintf("; %s=%s %s: %s", condition.Type, condition.Status, condition.Reason, condition.Message)
+		}
+	}
+	return summary
+}
+
+// WaitForHPAScaled watches the HorizontalPodAutoscaler until it both wants and has the target number of
+// replicas, and returns it. Pods that can't be scheduled count as replicas here, so callers that need
+// running pods wait for those separately. On timeout the error carries the last replica counts and the
+// AbleToScale, ScalingActive and ScalingLimited conditions, which tell a missing metrics source apart
+// from a replica limit.
+func WaitForHPAScaled(ctx context.Context, clientset *kubernetes.Clientset, namespace, name string, targetReplicas int32,
+	timeout time.Duration) (*autoscalingv2.HorizontalPodAutoscaler, error) {
+	timeout = Timeout(TimeoutHPA, timeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	listWatch := cache.NewListWatchFromClient(clientset.AutoscalingV2().RESTClient(), "horizontalpodautoscalers", namespace,
+		fields.OneTermEqualSelector("metadata.name", name))
+	var last *autoscalingv2.HorizontalPodAutoscaler
+	_, err := watchtools.UntilWithSync(ctx, listWatch, &autoscalingv2.HorizontalPodAutoscaler{}, nil, func(event watch.Event) (bool, error) {
+		if event.Type == watch.Deleted {
+			return false, fmt.Errorf("HPA %s/%s was deleted", namespace, name)
+		}
+		hpa, ok := event.Object.(*autoscalingv2.HorizontalPodAutoscaler)
+		if !ok {
+			return false, nil
+		}
+		last = hpa
+		return hpa.Status.DesiredReplicas == targetReplicas && hpa.Status.CurrentReplicas == targetReplicas, nil
+	})
+	if err == nil {
+		return last, nil
+	}
+	if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return last, fmt.Errorf("waiting for HPA %s/%s failed: %w", namespace, name, err)
+	}
+	if last == nil {
+		return nil, fmt.Errorf("HPA %s/%s not found within %v", namespace, name, timeout)
+	}
+	summary := fmt.Sprintf("%d current, %d desired", last.Status.CurrentReplicas, last.Status.DesiredReplicas)
+	for _, condition := range last.Status.Conditions {
+		summary += fmt.Sprintf("; %s=%s %s: %s", condition.Type, condition.Status, condition.Reason, condition.Message)
+	}
+	return last, fmt.Errorf("HPA %s/%s not scaled to %d replicas within %v: %s", namespace, name, targetReplicas, timeout, summary)
+}
+
+// PodCount selects how WaitForPodsReady compares the number of ready pods with the expected count
+type PodCount int
+
+const (
+	// PodCountExactly waits for exactly the expected number of pods, all of them ready
+	PodCountExactly PodCount = iota
+	// PodCountAtLeast waits for at least the expected number of ready pods, other pods are ignored
+	PodCountAtLeast
+)
+
+// WaitForPodsReady polls the pods matching the label selector until count of them are Running and
+// Ready, compared as selected by mode, and returns the ready pods. Terminating pods are never counted,
+// so pods of a previous ReplicaSet that are shutting down don't satisfy or break the wait. On timeout
+// the error lists the pods that weren't ready and why.
+func WaitForPodsReady(ctx context.Context, clientset *kubernetes.Clientset, namespace, selector string,
+	count int, mode PodCount, timeout time.Duration) ([]corev1.Pod, error) {
+	timeout = Timeout(TimeoutPods, timeout)
+	var ready []corev1.Pod
+	var notReady []string
+	var total int
+	err := PollUntil(ctx, CheckInterval(2*time.Second), timeout, func(ctx context.Context) (bool, error) {
+		pods, err := ListPods(ctx, clientset, namespace, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return false, err
+		}
+		ready, notReady, total = nil, nil, 0
+		for _, pod := range pods {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			total++
+			if podReady(pod) {
+				ready = append(ready, pod)
+			} else {
+				notReady = append(notReady, fmt.Sprintf("%s (%s)", pod.Name, podNotReadyReason(pod)))
+			}
+		}
+		if mode == PodCountAtLeast {
+			return len(ready) >= count, nil
+		}
+		return total == count && len(ready) == count, nil
+	})
+	if err == nil {
+		return ready, nil
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("waiting for pods %q in %s failed: %w", selector, namespace, err)
+	}
+	expected := fmt.Sprintf("%d", count)
+	if mode == PodCountAtLeast {
+		expected = fmt.Sprintf("at least %d", count)
+	}
+	return nil, fmt.Errorf("%d/%d pods %q in %s ready within %v, expected %s; not ready: %s",
+		len(ready), total, selector, namespace, timeout, expected, strings.Join(notReady, ", "))
+}
+
+func podReady(pod corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podNotReadyReason returns the most specific reason the pod isn't ready: a waiting container's
+// reason, the scheduler's message or the pod phase
+func podNotReadyReason(pod corev1.Pod) string {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Waiting != nil && status.State.Waiting.Reason != "" {
+			return status.State.Waiting.Reason
+		}
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodScheduled && condition.Status == corev1.ConditionFalse {
+			return fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		}
+	}
+	return string(pod.Status.Phase)
+}
@@ -0,0 +1,433 @@
+package example_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+// admissionWebhook is a mutating or validating webhook that intercepts pod creation
+type admissionWebhook struct {
+	Kind           string
+	Configuration  string
+	Name           string
+	FailurePolicy  admissionregistrationv1.FailurePolicyType
+	TimeoutSeconds int32
+	Service        *admissionregistrationv1.ServiceReference
+}
+
+func (w admissionWebhook) String() string {
+	return fmt.Sprintf("%s %s/%s (failurePolicy %s, timeout %ds)", w.Kind, w.Configuration, w.Name, w.FailurePolicy, w.TimeoutSeconds)
+}
+
+func newAdmissionWebhook(kind, configuration, name string, failurePolicy *admissionregistrationv1.FailurePolicyType,
+	timeoutSeconds *int32, clientConfig admissionregistrationv1.WebhookClientConfig) admissionWebhook {
+	// Same defaults the API server applies to admissionregistration.k8s.io/v1 objects
+	webhook := admissionWebhook{
+		Kind:           kind,
+		Configuration:  configuration,
+		Name:           name,
+		FailurePolicy:  admissionregistrationv1.Fail,
+		TimeoutSeconds: 10,
+		Service:        clientConfig.Service,
+	}
+	if failurePolicy != nil {
+		webhook.FailurePolicy = *failurePolicy
+	}
+	if timeoutSeconds != nil {
+		webhook.TimeoutSeconds = *timeoutSeconds
+	}
+	return webhook
+}
+
+// interceptsPodCreate reports whether the rules match CREATE of core/v1 pods
+func interceptsPodCreate(rules []admissionregistrationv1.RuleWithOperations) bool {
+	matches := func(values []string, wanted ...string) bool {
+		for _, value := range values {
+			for _, w := range wanted {
+				if value == w {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, rule := range rules {
+		if matches(rule.APIGroups, "", "*") && matches(rule.APIVersions, "v1", "*") &&
+			matches(rule.Resources, "pods", "*", "*/*") &&
+			matches(operationStrings(rule.Operations), string(admissionregistrationv1.Create), string(admissionregistrationv1.OperationAll)) &&
+			(rule.Scope == nil || *rule.Scope != admissionregistrationv1.ClusterScope) {
+			return true
+		}
+	}
+	return false
+}
+
+func operationStrings(operations []admissionregistrationv1.OperationType) []string {
+	values := make([]string, 0, len(operations))
+	for _, operation := range operations {
+		values = append(values, string(operation))
+	}
+	return values
+}
+
+// podCreateWebhooks lists the webhooks that intercept pod creation in the namespace, judged by their
+// rules and namespaceSelector. objectSelectors are not evaluated.
+func podCreateWebhooks(ctx context.Context, clientset *kubernetes.Clientset, namespace *v1.Namespace) ([]admissionWebhook, error) {
+	selects := func(selector *metav1.LabelSelector) (bool, error) {
+		if selector == nil {
+			return true, nil
+		}
+		parsed, err := metav1.LabelSelectorAsSelector(selector)
+		if err != nil {
+			return false, err
+		}
+		return parsed.Matches(labels.Set(namespace.Labels)), nil
+	}
+
+	var webhooks []admissionWebhook
+	mutating, err := clientset.AdmissionregistrationV1().MutatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mutating webhook configurations: %w", err)
+	}
+	for _, configuration := range mutating.Items {
+		for _, webhook := range configuration.Webhooks {
+			selected, err := selects(webhook.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s has an invalid namespaceSelector: %w", webhook.Name, err)
+			}
+			if selected && interceptsPodCreate(webhook.Rules) {
+				webhooks = append(webhooks, newAdmissionWebhook("mutating", configuration.Name, webhook.Name,
+					webhook.FailurePolicy, webhook.TimeoutSeconds, webhook.ClientConfig))
+			}
+		}
+	}
+
+	validating, err := clientset.AdmissionregistrationV1().ValidatingWebhookConfigurations().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list validating webhook configurations: %w", err)
+	}
+	for _, configuration := range validating.Items {
+		for _, webhook := range configuration.Webhooks {
+			selected, err := selects(webhook.NamespaceSelector)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s has an invalid namespaceSelector: %w", webhook.Name, err)
+			}
+			if selected && interceptsPodCreate(webhook.Rules) {
+				webhooks = append(webhooks, newAdmissionWebhook("validating", configuration.Name, webhook.Name,
+					webhook.FailurePolicy, webhook.TimeoutSeconds, webhook.ClientConfig))
+			}
+		}
+	}
+	return webhooks, nil
+}
+
+var _ = ginkgo.Describe("Admission webhook latency E2E test", ginkgo.Ordered, ginkgo.Label("safe-in-production"), example.SuiteConcurrency("AdmissionWebhookLatencyTest"), func() {
+	var (
+		clientset       *kubernetes.Clientset
+		podYAML         []byte
+		subjectWebhooks []admissionWebhook
+		controlWebhooks []admissionWebhook
+		logger          zerolog.Logger
+		testTag         = "AdmissionWebhookLatencyTest"
+
+		// test-ns gets the labels that opt a namespace into the platform webhooks (WEBHOOK_NAMESPACE_LABELS),
+		// the control namespace the ones that opt it out (WEBHOOK_CONTROL_NAMESPACE_LABELS)
+		controlNamespace = example.TestNamespaced("test-ns-webhook-control")
+	)
+
+	const (
+		// Extra p95 pod create latency the webhooks may add. Overridable with WEBHOOK_OVERHEAD_BUDGET_MS in .env
+		defaultOverheadBudgetMs = 250
+		warmupCreates           = 3
+		measuredCreates         = 30
+		pollInterval            = 500 * time.Millisecond
+	)
+
+	parseLabels := func(name string) map[string]string {
+		value := os.Getenv(name)
+		if value == "" {
+			return nil
+		}
+		parsed, err := labels.ConvertSelectorToLabelsMap(value)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid %s: %s", name, value)
+		return parsed
+	}
+
+	// createPod creates a pod from the fixture in the namespace, deletes it right away and returns how
+	// long the create request took
+	createPod := func(namespace string) (time.Duration, error) {
+		pod := &v1.Pod{}
+		err := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(podYAML), 4096).Decode(pod)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		start := time.Now()
+		created, err := clientset.CoreV1().Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+		elapsed := time.Since(start)
+		if err != nil {
+			return elapsed, err
+		}
+
+		gracePeriod := int64(0)
+		err = clientset.CoreV1().Pods(namespace).Delete(context.TODO(), created.Name, metav1.DeleteOptions{
+			GracePeriodSeconds: &gracePeriod,
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			logger.Error().Msgf("Failed to delete pod %s/%s: %v", namespace, created.Name, err)
+		}
+		return elapsed, nil
+	}
+
+	readyEndpoints := func(service *admissionregistrationv1.ServiceReference) int {
+		endpoints, err := example.GetServiceEndpoints(context.TODO(), clientset, service.Namespace, service.Name)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		return len(endpoints.Ready())
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		podYAML, err = example.GetWebhookLatencyTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		// Webhooks are discovered here so the disruptive spec also works when it is selected on its own
+		subject, err := clientset.CoreV1().Namespaces().Get(context.TODO(), example.TestNamespace(), metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if subjectLabels := parseLabels("WEBHOOK_NAMESPACE_LABELS"); len(subjectLabels) > 0 {
+			if subject.Labels == nil {
+				subject.Labels = map[string]string{}
+			}
+			for key, value := range subjectLabels {
+				subject.Labels[key] = value
+			}
+			subject, err = clientset.CoreV1().Namespaces().Update(context.TODO(), subject, metav1.UpdateOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		logger.Info().Msgf("=== Creating control namespace %s ===", controlNamespace)
+		control, err := clientset.CoreV1().Namespaces().Create(context.TODO(), &v1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   controlNamespace,
+				Labels: parseLabels("WEBHOOK_CONTROL_NAMESPACE_LABELS"),
+			},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			control, err = clientset.CoreV1().Namespaces().Get(context.TODO(), controlNamespace, metav1.GetOptions{})
+		}
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		subjectWebhooks, err = podCreateWebhooks(context.TODO(), clientset, subject)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		controlWebhooks, err = podCreateWebhooks(context.TODO(), clientset, control)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespaceByName(logger, clientset, controlNamespace)
+		// The test namespace outlives the suite, the next suites must not be opted into the webhooks
+		if subjectLabels := parseLabels("WEBHOOK_NAMESPACE_LABELS"); len(subjectLabels) > 0 {
+			subject, err := clientset.CoreV1().Namespaces().Get(context.TODO(), example.TestNamespace(), metav1.GetOptions{})
+			if err == nil {
+				for key := range subjectLabels {
+					delete(subject.Labels, key)
+				}
+				_, err = clientset.CoreV1().Namespaces().Update(context.TODO(), subject, metav1.UpdateOptions{})
+			}
+			if err != nil {
+				logger.Error().Msgf("Failed to remove the webhook labels from the test namespace: %v", err)
+			}
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should find the webhooks intercepting pod creation in both namespaces", func() {
+		logger.Info().Msgf("=== Starting Admission webhook latency E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		for _, webhook := range subjectWebhooks {
+			logger.Info().Msgf("test-ns: %s\n", webhook)
+		}
+		for _, webhook := range controlWebhooks {
+			logger.Info().Msgf("%s: %s\n", controlNamespace, webhook)
+		}
+		logger.Info().Msgf("=== Webhooks on pod create: %d in test-ns, %d in %s ===",
+			len(subjectWebhooks), len(controlWebhooks), controlNamespace)
+		example.RecordMetric(testTag, "subject_namespace_webhooks", len(subjectWebhooks))
+		example.RecordMetric(testTag, "control_namespace_webhooks", len(controlWebhooks))
+		if len(subjectWebhooks) == 0 {
+			logger.Info().Msgf("No webhook intercepts pod creation in test-ns, set WEBHOOK_NAMESPACE_LABELS to opt it in\n")
+		}
+
+		// A webhook that fails open can silently stop enforcing, so the expected policy is checked up front
+		if expected := os.Getenv("WEBHOOK_EXPECTED_FAILURE_POLICY"); expected != "" {
+			var mismatches []string
+			for _, webhook := range subjectWebhooks {
+				if string(webhook.FailurePolicy) != expected {
+					mismatches = append(mismatches, webhook.String())
+				}
+			}
+			gomega.Expect(mismatches).To(gomega.BeEmpty(),
+				"Webhooks without the expected failurePolicy %s:\n%s", expected, strings.Join(mismatches, "\n"))
+		}
+	})
+
+	ginkgo.It("should keep the webhook overhead on pod creation within budget", func() {
+		defer example.E2ePanicHandler()
+
+		budget := float64(defaultOverheadBudgetMs)
+		if value := os.Getenv("WEBHOOK_OVERHEAD_BUDGET_MS"); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid WEBHOOK_OVERHEAD_BUDGET_MS: %s", value)
+			budget = parsed
+		}
+
+		// Warm-up creates absorb connection setup and cold webhook backends
+		for i := 0; i < warmupCreates; i++ {
+			_, err := createPod(example.TestNamespace())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			_, err = createPod(controlNamespace)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		}
+
+		// Alternating between the namespaces keeps both samples under the same control plane conditions
+		logger.Info().Msgf("=== Creating %d pods in each namespace ===", measuredCreates)
+		var subjectLatencies, controlLatencies []float64
+		for i := 0; i < measuredCreates; i++ {
+			elapsed, err := createPod(example.TestNamespace())
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			subjectLatencies = append(subjectLatencies, float64(elapsed.Microseconds())/1000)
+
+			elapsed, err = createPod(controlNamespace)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			controlLatencies = append(controlLatencies, float64(elapsed.Microseconds())/1000)
+		}
+
+		subjectP50, subjectP95 := example.Percentile(subjectLatencies, 50), example.Percentile(subjectLatencies, 95)
+		controlP50, controlP95 := example.Percentile(controlLatencies, 50), example.Percentile(controlLatencies, 95)
+		overhead := subjectP95 - controlP95
+		logger.Info().Msgf("=== test-ns p50: %.1fms, p95: %.1fms | %s p50: %.1fms, p95: %.1fms | p95 overhead: %.1fms (budget %.0fms) ===",
+			subjectP50, subjectP95, controlNamespace, controlP50, controlP95, overhead, budget)
+
+		example.RecordMetric(testTag, "subject_create_p50_ms", subjectP50)
+		example.RecordMetric(testTag, "subject_create_p95_ms", subjectP95)
+		example.RecordMetric(testTag, "control_create_p50_ms", controlP50)
+		example.RecordMetric(testTag, "control_create_p95_ms", controlP95)
+		example.RecordMetric(testTag, "webhook_p95_overhead_ms", overhead)
+
+		gomega.Expect(overhead).To(gomega.BeNumerically("<=", budget),
+			fmt.Sprintf("Webhooks add %.1fms to the p95 pod create latency, over the budget of %.0fms", overhead, budget))
+	})
+
+	// Deleting a platform webhook's backend is disruptive, so this spec also needs WEBHOOK_BACKEND_DISRUPTION=true
+	ginkgo.It("should enforce the declared failurePolicy while a webhook backend is down", ginkgo.Label("disruptive"), func() {
+		defer example.E2ePanicHandler()
+
+		if os.Getenv("WEBHOOK_BACKEND_DISRUPTION") != "true" {
+			ginkgo.Skip("Deleting webhook backends is opt-in, set WEBHOOK_BACKEND_DISRUPTION=true")
+		}
+
+		var target *admissionWebhook
+		for i := range subjectWebhooks {
+			if subjectWebhooks[i].Service != nil {
+				target = &subjectWebhooks[i]
+				break
+			}
+		}
+		if target == nil {
+			ginkgo.Skip("No webhook intercepting pod creation in test-ns is backed by an in-cluster Service")
+		}
+
+		service, err := clientset.CoreV1().Services(target.Service.Namespace).Get(context.TODO(), target.Service.Name, metav1.GetOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(service.Spec.Selector).NotTo(gomega.BeEmpty(), "Service %s/%s has no selector", service.Namespace, service.Name)
+		backends, err := example.ListPods(context.TODO(), clientset, service.Namespace, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(service.Spec.Selector).String(),
+		})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Deleting %d backend pods of %s ===", len(backends), target)
+		gracePeriod := int64(0)
+		for _, pod := range backends {
+			err := clientset.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{
+				GracePeriodSeconds: &gracePeriod,
+			})
+			if err != nil && !apierrors.IsNotFound(err) {
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			}
+		}
+
+		// Only a create sent while the Service has no ready endpoint shows the failurePolicy at work
+		var createErr error
+		var createLatency time.Duration
+		attempted := false
+		deadline := time.Now().Add(example.Timeout(example.TimeoutEndpoints, time.Minute))
+		for time.Now().Before(deadline) {
+			if readyEndpoints(target.Service) == 0 {
+				createLatency, createErr = createPod(example.TestNamespace())
+				attempted = true
+				break
+			}
+			time.Sleep(pollInterval)
+		}
+		if !attempted {
+			ginkgo.Skip("The webhook backend recovered before a create could be sent without it")
+		}
+		logger.Info().Msgf("=== Create without backend took %v, error: %v ===", createLatency.Round(time.Millisecond), createErr)
+		example.RecordMetric(testTag, "create_without_backend_ms", float64(createLatency.Microseconds())/1000)
+
+		// The platform must heal itself before the verdict, so the cluster is never left degraded
+		recoveryTimeout := example.Timeout(example.TimeoutEndpoints, 3*time.Minute)
+		deadline = time.Now().Add(recoveryTimeout)
+		for readyEndpoints(target.Service) == 0 {
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("Backend of %s did not recover within %v", target, recoveryTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+		logger.Info().Msgf("=== Webhook backend recovered ===")
+
+		switch target.FailurePolicy {
+		case admissionregistrationv1.Fail:
+			gomega.Expect(createErr).To(gomega.HaveOccurred(),
+				"%s declares failurePolicy Fail but a pod was admitted without its backend", target)
+		case admissionregistrationv1.Ignore:
+			gomega.Expect(createErr).NotTo(gomega.HaveOccurred(),
+				"%s declares failurePolicy Ignore but blocked pod creation without its backend", target)
+			gomega.Expect(createLatency).To(gomega.BeNumerically("<=", time.Duration(target.TimeoutSeconds+5)*time.Second),
+				"Create without the backend took longer than the webhook timeout")
+		}
+	})
+
+})
@@ -0,0 +1,266 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+)
+
+// GeneratedLabel is set on every object GenerateWorkload creates, with the seed as its value, so the
+// objects of a generated workload can be listed or deleted together
+const GeneratedLabel = "e2e.example.com/generated"
+
+// WorkloadSeed returns the seed for GenerateWorkload: WORKLOAD_SEED from .env, to reproduce the
+// objects of an earlier run, or a new one. Suites log the seed they use.
+func WorkloadSeed() (int64, error) {
+	if value := os.Getenv("WORKLOAD_SEED"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid WORKLOAD_SEED %q: %w", value, err)
+		}
+		return seed, nil
+	}
+	return time.Now().UnixNano(), nil
+}
+
+// WorkloadMix is how many objects of each kind GenerateWorkload creates, and the bounds of their sizes
+type WorkloadMix struct {
+	Deployments int
+	Services    int
+	ConfigMaps  int
+	// MaxReplicas bounds the replicas of each Deployment, which are drawn from 0 to MaxReplicas. With
+	// the default of 0 the Deployments run no pods.
+	MaxReplicas int32
+	// MaxConfigMapBytes bounds the data of each ConfigMap, 4096 bytes by default
+	MaxConfigMapBytes int
+	// Labels are added to every object, e.g. to make them match a suite's selector
+	Labels map[string]string
+}
+
+// GeneratedWorkload holds the objects GenerateWorkload generated, in the order Create creates them
+type GeneratedWorkload struct {
+	Seed        int64
+	Namespace   string
+	ConfigMaps  []*corev1.ConfigMap
+	Deployments []*appsv1.Deployment
+	Services    []*corev1.Service
+}
+
+// GenerateWorkload generates randomized but valid objects for the namespace: ConfigMaps with a few
+// keys of random sizes, Deployments of FixtureImage pods with random labels, environment and requests,
+// some of them reading a ConfigMap, and ClusterIP Services selecting random Deployments. The same seed
+// and mix always generate the same objects, so a run that hit a problem can be reproduced with its
+// seed:
+//
+//	workload := example.GenerateWorkload("test-ns", seed, example.WorkloadMix{Deployments: 20, Services: 20, ConfigMaps: 100})
+//	err := workload.Create(ctx, clientset)
+func GenerateWorkload(namespace string, seed int64, mix WorkloadMix) *GeneratedWorkload {
+	random := rand.New(rand.NewSource(seed))
+	if mix.MaxConfigMapBytes <= 0 {
+		mix.MaxConfigMapBytes = 4096
+	}
+	workload := &GeneratedWorkload{Seed: seed, Namespace: namespace}
+	metadata := func(name string, labels map[string]string) metav1.ObjectMeta {
+		labels[GeneratedLabel] = seedLabel(seed)
+		for key, value := range mix.Labels {
+			labels[key] = value
+		}
+		return metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}
+	}
+
+	for i := 0; i < mix.ConfigMaps; i++ {
+		data := map[string]string{}
+		remaining := 1 + random.Intn(mix.MaxConfigMapBytes)
+		for key := 0; remaining > 0 && key < 8; key++ {
+			size := 1 + random.Intn(remaining)
+			data[fmt.Sprintf("key-%d", key)] = randomString(random, size)
+			remaining -= size
+		}
+		workload.ConfigMaps = append(workload.ConfigMaps, &corev1.ConfigMap{
+			ObjectMeta: metadata(fmt.Sprintf("gen-config-%d", i), map[string]string{}),
+			Data:       data,
+		})
+	}
+
+	for i := 0; i < mix.Deployments; i++ {
+		name := fmt.Sprintf("gen-app-%d", i)
+		podLabels := map[string]string{"app": name, GeneratedLabel: seedLabel(seed)}
+		for label := random.Intn(4); label > 0; label-- {
+			podLabels[fmt.Sprintf("gen-label-%d", label)] = randomString(random, 1+random.Intn(10))
+		}
+		replicas := int32(random.Intn(int(mix.MaxReplicas) + 1))
+		gracePeriod := int64(1)
+
+		container := corev1.Container{
+			Name:    "main",
+			Image:   FixtureImage(),
+			Command: []string{"sh", "-c", "exec sleep 3600"},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewMilliQuantity(int64(5+random.Intn(16)), resource.DecimalSI),
+					corev1.ResourceMemory: *resource.NewQuantity(int64(8+random.Intn(25))<<20, resource.BinarySI),
+				},
+			},
+		}
+		for env := random.Intn(6); env > 0; env-- {
+			container.Env = append(container.Env, corev1.EnvVar{
+				Name:  fmt.Sprintf("GEN_ENV_%d", env),
+				Value: randomString(random, 1+random.Intn(64)),
+			})
+		}
+		if len(workload.ConfigMaps) > 0 && random.Intn(2) == 0 {
+			configMap := workload.ConfigMaps[random.Intn(len(workload.ConfigMaps))]
+			container.EnvFrom = []corev1.EnvFromSource{{
+				Prefix:       "GEN_CONFIG_",
+				ConfigMapRef: &corev1.ConfigMapEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name}},
+			}}
+		}
+
+		workload.Deployments = append(workload.Deployments, &appsv1.Deployment{
+			ObjectMeta: metadata(name, map[string]string{"app": name}),
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: podLabels},
+					Spec: corev1.PodSpec{
+						TerminationGracePeriodSeconds: &gracePeriod,
+						Containers:                    []corev1.Container{container},
+					},
+				},
+			},
+		})
+	}
+
+	for i := 0; i < mix.Services; i++ {
+		service := &corev1.Service{
+			ObjectMeta: metadata(fmt.Sprintf("gen-svc-%d", i), map[string]string{}),
+			Spec: corev1.ServiceSpec{
+				Type:     corev1.ServiceTypeClusterIP,
+				Selector: map[string]string{"app": fmt.Sprintf("gen-app-%d", i)},
+			},
+		}
+		if len(workload.Deployments) > 0 {
+			service.Spec.Selector = map[string]string{"app": workload.Deployments[random.Intn(len(workload.Deployments))].Name}
+		}
+		for port := 1 + random.Intn(3); port > 0; port-- {
+			service.Spec.Ports = append(service.Spec.Ports, corev1.ServicePort{
+				Name:       fmt.Sprintf("port-%d", port),
+				Port:       int32(8000 + port),
+				TargetPort: intstr.FromInt(8000 + random.Intn(1000)),
+			})
+		}
+		workload.Services = append(workload.Services, service)
+	}
+	return workload
+}
+
+// randomString returns length random lowercase alphanumerics
+func randomString(random *rand.Rand, length int) string {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz0123456789"
+	var builder strings.Builder
+	builder.Grow(length)
+	for i := 0; i < length; i++ {
+		builder.WriteByte(alphabet[random.Intn(len(alphabet))])
+	}
+	return builder.String()
+}
+
+// Selector is the label selector matching every object of the workload
+func (w *GeneratedWorkload) Selector() string {
+	return GeneratedLabel + "=" + seedLabel(w.Seed)
+}
+
+// seedLabel is the seed as a label value, which can't start with a minus sign
+func seedLabel(seed int64) string {
+	return strconv.FormatUint(uint64(seed), 10)
+}
+
+// Objects is the number of objects the workload creates directly, not counting ReplicaSets and pods
+func (w *GeneratedWorkload) Objects() int {
+	return len(w.ConfigMaps) + len(w.Deployments) + len(w.Services)
+}
+
+// Replicas is the number of pods the workload's Deployments run together
+func (w *GeneratedWorkload) Replicas() int {
+	replicas := 0
+	for _, deployment := range w.Deployments {
+		replicas += int(*deployment.Spec.Replicas)
+	}
+	return replicas
+}
+
+// Create creates the ConfigMaps, the Deployments reading them, and then the Services. Every create
+// is retried on transient errors. Objects that already exist are left as they are, the same seed
+// generated them the same way.
+func (w *GeneratedWorkload) Create(ctx context.Context, clientset *kubernetes.Clientset) error {
+	return w.CreateConcurrently(ctx, clientset, 1)
+}
+
+// CreateConcurrently is Create with up to concurrency creates in flight, for large workloads. The
+// Deployments are still created once all ConfigMaps are, and the Services last. The error lists every
+// object that couldn't be created.
+func (w *GeneratedWorkload) CreateConcurrently(ctx context.Context, clientset *kubernetes.Clientset, concurrency int) error {
+	create := func(kind, name string, call func(ctx context.Context) error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			err := Retry(ctx, DefaultRetryPolicy, func(ctx context.Context) error {
+				if err := call(ctx); !apierrors.IsAlreadyExists(err) {
+					return err
+				}
+				return nil
+			})
+			if err != nil {
+				return fmt.Errorf("generated %s %s/%s creation failed (seed %d): %w", kind, w.Namespace, name, w.Seed, err)
+			}
+			return nil
+		}
+	}
+	var configMaps, deployments, services []func(ctx context.Context) error
+	for _, configMap := range w.ConfigMaps {
+		configMaps = append(configMaps, create("ConfigMap", configMap.Name, func(ctx context.Context) error {
+			_, err := clientset.CoreV1().ConfigMaps(w.Namespace).Create(ctx, configMap, metav1.CreateOptions{})
+			return err
+		}))
+	}
+	for _, deployment := range w.Deployments {
+		deployments = append(deployments, create("Deployment", deployment.Name, func(ctx context.Context) error {
+			_, err := clientset.AppsV1().Deployments(w.Namespace).Create(ctx, deployment, metav1.CreateOptions{})
+			return err
+		}))
+	}
+	for _, service := range w.Services {
+		services = append(services, create("Service", service.Name, func(ctx context.Context) error {
+			_, err := clientset.CoreV1().Services(w.Namespace).Create(ctx, service, metav1.CreateOptions{})
+			return err
+		}))
+	}
+
+	// The next stage isn't started after a failure, its objects would reference ones that don't exist
+	for _, stage := range [][]func(ctx context.Context) error{configMaps, deployments, services} {
+		if concurrency <= 1 {
+			for _, create := range stage {
+				if err := create(ctx); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if err := errors.Join(runConcurrently(ctx, stage, concurrency)...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
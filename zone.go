@@ -0,0 +1,123 @@
+package example
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ZoneMap maps nodes to their topology.kubernetes.io/zone label, read with a single node LIST instead of
+// a GET per pod. It is a snapshot: nodes added later have no zone, so suites that add nodes take a new
+// one.
+type ZoneMap struct {
+	clientset *kubernetes.Clientset
+	zones     map[string]string
+}
+
+// NewZoneMap lists the nodes once and records their zones. Nodes without the label are kept with an
+// empty zone.
+func NewZoneMap(ctx context.Context, clientset *kubernetes.Clientset) (*ZoneMap, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("nodes listing failed: %w", err)
+	}
+	zoneMap := &ZoneMap{clientset: clientset, zones: map[string]string{}}
+	for _, node := range nodes.Items {
+		zoneMap.zones[node.Name] = node.Labels[corev1.LabelTopologyZone]
+	}
+	return zoneMap, nil
+}
+
+// NodeZone returns the node's zone, empty when the node has no zone label or isn't in the snapshot
+func (z *ZoneMap) NodeZone(node string) string {
+	return z.zones[node]
+}
+
+// ZoneOf returns the zone of the node the pod is scheduled on, empty while it is unscheduled
+func (z *ZoneMap) ZoneOf(pod corev1.Pod) string {
+	return z.zones[pod.Spec.NodeName]
+}
+
+// Zones returns the distinct zones of the nodes, sorted
+func (z *ZoneMap) Zones() []string {
+	seen := map[string]bool{}
+	var zones []string
+	for _, zone := range z.zones {
+		if zone != "" && !seen[zone] {
+			seen[zone] = true
+			zones = append(zones, zone)
+		}
+	}
+	sort.Strings(zones)
+	return zones
+}
+
+// NodesIn returns the names of the zone's nodes, sorted
+func (z *ZoneMap) NodesIn(zone string) []string {
+	var nodes []string
+	for node, nodeZone := range z.zones {
+		if nodeZone == zone {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// Distribution counts the scheduled, non-terminating pods matching the label selector per zone. Every
+// zone of the map is present, with 0 when it has no pods, so a skew over the map counts empty zones.
+// Pods on nodes without a zone are counted under the empty zone.
+func (z *ZoneMap) Distribution(ctx context.Context, namespace, selector string) (map[string]int, error) {
+	pods, err := ListPods(ctx, z.clientset, namespace, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	perZone := map[string]int{}
+	for _, zone := range z.Zones() {
+		perZone[zone] = 0
+	}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil || pod.Spec.NodeName == "" {
+			continue
+		}
+		perZone[z.ZoneOf(pod)]++
+	}
+	return perZone, nil
+}
+
+// PodZones returns the zone of every scheduled, non-terminating pod matching the label selector, by pod
+// name
+func (z *ZoneMap) PodZones(ctx context.Context, namespace, selector string) (map[string]string, error) {
+	pods, err := ListPods(ctx, z.clientset, namespace, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	podZones := map[string]string{}
+	for _, pod := range pods {
+		if pod.DeletionTimestamp == nil && pod.Spec.NodeName != "" {
+			podZones[pod.Name] = z.ZoneOf(pod)
+		}
+	}
+	return podZones, nil
+}
+
+// Skew returns the difference between the most and the least populated zone for the pods matching the
+// label selector, as topology spread constraints define it, along with the distribution it was
+// computed from
+func (z *ZoneMap) Skew(ctx context.Context, namespace, selector string) (int, map[string]int, error) {
+	perZone, err := z.Distribution(ctx, namespace, selector)
+	if err != nil {
+		return 0, nil, err
+	}
+	return ZoneSkew(perZone), perZone, nil
+}
+
+// ZoneSkew returns the difference between the highest and the lowest count, 0 for no zones. The full
+// breakdown is NewTopologyDistribution's.
+func ZoneSkew(perZone map[string]int) int {
+	return NewTopologyDistribution(corev1.LabelTopologyZone, perZone).Skew
+}
@@ -0,0 +1,281 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Zone outage E2E test", ginkgo.Ordered, ginkgo.Label("disruptive"), example.SuiteConcurrency("ZoneOutageTest"), func() {
+	var (
+		clientset    *kubernetes.Clientset
+		sla          time.Duration
+		replicas     int32
+		minAvailable int32
+		nodeZones    map[string]string
+		outageZone   string
+		// Nodes this suite cordoned and must uncordon, even when a spec fails
+		cordonedNodes []string
+		logger        zerolog.Logger
+		testTag       = "ZoneOutageTest"
+	)
+
+	const (
+		// Time the workload gets to be fully available again outside the failed zone. Overridable with
+		// ZONE_OUTAGE_SLA_SECONDS in .env
+		defaultSLASeconds = 300
+		// nodeTaintsPolicy in the fixture is beta and enabled by default from 1.26
+		minimumVersion = "1.26"
+		pollInterval   = 2 * time.Second
+	)
+
+	// podsPerZone returns the non-terminating zone-app pods per zone and how many of them are ready
+	podsPerZone := func() (map[string]int, int32) {
+		pods, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: "app=zone-app"})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		perZone := map[string]int{}
+		var ready int32
+		for _, pod := range pods {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+			if pod.Spec.NodeName != "" {
+				perZone[nodeZones[pod.Spec.NodeName]]++
+			}
+			for _, condition := range pod.Status.Conditions {
+				if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+					ready++
+				}
+			}
+		}
+		return perZone, ready
+	}
+
+	// expectSpread checks that every zone has pods and that the counts differ by at most maxSkew 1, and
+	// returns the breakdown over the zones
+	expectSpread := func(perZone map[string]int, zones []string) example.TopologyDistribution {
+		counts := map[string]int{}
+		for _, zone := range zones {
+			counts[zone] = perZone[zone]
+		}
+		distribution := example.NewTopologyDistribution(v1.LabelTopologyZone, counts)
+		gomega.Expect(distribution.Min).To(gomega.BeNumerically(">", 0), "A zone has no pods: %v", distribution)
+		gomega.Expect(distribution.Skew).To(gomega.BeNumerically("<=", 1), "Pods are not spread evenly: %v", distribution)
+		return distribution
+	}
+
+	zonesExcept := func(excluded string) []string {
+		seen := map[string]bool{}
+		var zones []string
+		for _, zone := range nodeZones {
+			if zone != excluded && !seen[zone] {
+				seen[zone] = true
+				zones = append(zones, zone)
+			}
+		}
+		sort.Strings(zones)
+		return zones
+	}
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+
+		supported, serverVersion, err := example.ServerVersionAtLeast(clientset, minimumVersion)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		if !supported {
+			ginkgo.Skip(fmt.Sprintf("Server version %s is older than %s", serverVersion, minimumVersion))
+		}
+
+		sla = defaultSLASeconds * time.Second
+		if value := os.Getenv("ZONE_OUTAGE_SLA_SECONDS"); value != "" {
+			seconds, err := strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid ZONE_OUTAGE_SLA_SECONDS: %s", value)
+			sla = time.Duration(seconds) * time.Second
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		// Never leave a zone cordoned, even when a spec failed halfway through the outage
+		for _, node := range cordonedNodes {
+			logger.Info().Msgf("=== Restoring node %s ===", node)
+			if err := example.UncordonNode(context.TODO(), clientset, node); err != nil {
+				logger.Error().Msgf("Failed to uncordon node %s: %v", node, err)
+			}
+		}
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should spread the PDB-protected workload across all zones", func() {
+		logger.Info().Msgf("=== Starting Zone outage E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		nodes, err := clientset.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		nodeZones = map[string]string{}
+		for _, node := range nodes.Items {
+			if zone := node.Labels[v1.LabelTopologyZone]; zone != "" && !node.Spec.Unschedulable {
+				nodeZones[node.Name] = zone
+			}
+		}
+		zones := zonesExcept("")
+		if len(zones) < 2 {
+			ginkgo.Skip(fmt.Sprintf("A zone outage needs schedulable nodes in at least 2 zones, found %v", zones))
+		}
+		logger.Info().Msgf("=== Zones: %v, SLA: %v ===", zones, sla)
+
+		pdbYAML, depYAML, err := example.GetZoneOutageTestFiles()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		type deploymentSpec struct {
+			Spec struct {
+				Replicas int32 `yaml:"replicas"`
+			} `yaml:"spec"`
+		}
+
+		var deploymentConfig deploymentSpec
+		err = yaml.Unmarshal(depYAML, &deploymentConfig)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		replicas = deploymentConfig.Spec.Replicas
+		pdb, err := example.ParsePDB(pdbYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		minAvailable, err = example.PDBMinAvailable(pdb, replicas)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger.Info().Msgf("=== Applying Deployment (%d replicas) and PDB (minAvailable %d) manifests ===", replicas, minAvailable)
+		err = example.ApplyRawManifest(clientset, depYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		err = example.ApplyRawManifest(clientset, pdbYAML)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		readyTimeout := example.Timeout(example.TimeoutPods, 3*time.Minute)
+		deadline := time.Now().Add(readyTimeout)
+		for {
+			_, ready := podsPerZone()
+			if ready == replicas {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("zone-app has %d/%d ready pods after %v", ready, replicas, readyTimeout))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		perZone, _ := podsPerZone()
+		logger.Info().Msgf("=== Pods per zone: %v ===", perZone)
+		expectSpread(perZone, zones)
+
+		// Failing a zone that hosts pods is what makes the outage meaningful
+		outageZone = os.Getenv("ZONE_OUTAGE_ZONE")
+		if outageZone == "" {
+			outageZone = zones[0]
+		}
+		gomega.Expect(perZone[outageZone]).To(gomega.BeNumerically(">", 0), "Zone %s hosts no zone-app pods", outageZone)
+	})
+
+	ginkgo.It("should re-establish availability in the remaining zones within the SLA", func() {
+		defer example.E2ePanicHandler()
+
+		var zoneNodes []string
+		for node, zone := range nodeZones {
+			if zone == outageZone {
+				zoneNodes = append(zoneNodes, node)
+			}
+		}
+		sort.Strings(zoneNodes)
+
+		logger.Info().Msgf("=== Taking down zone %s: cordoning %v ===", outageZone, zoneNodes)
+		outageStart := time.Now()
+		for _, node := range zoneNodes {
+			err := example.CordonNode(context.TODO(), clientset, node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			cordonedNodes = append(cordonedNodes, node)
+		}
+
+		// Evictions refused by the PDB are retried every poll, like kubectl drain does
+		minObservedReady := replicas
+		deadline := outageStart.Add(sla)
+		for {
+			for _, node := range zoneNodes {
+				result, err := example.DrainNode(context.TODO(), clientset, node, example.TestNamespace())
+				gomega.Expect(err).NotTo(gomega.HaveOccurred())
+				if len(result.Evicted) > 0 || len(result.Blocked) > 0 {
+					logger.Info().Msgf("%s: evicted %v, blocked by PDB %v\n", node, result.Evicted, result.Blocked)
+				}
+			}
+
+			perZone, ready := podsPerZone()
+			if ready < minObservedReady {
+				minObservedReady = ready
+			}
+			gomega.Expect(ready).To(gomega.BeNumerically(">=", minAvailable),
+				"Ready pods dropped to %d, below the PDB minimum %d", ready, minAvailable)
+
+			if ready == replicas && perZone[outageZone] == 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				ginkgo.Fail(fmt.Sprintf("zone-app did not recover outside zone %s within %v: %d/%d ready, pods per zone %v",
+					outageZone, sla, ready, replicas, perZone))
+			}
+			time.Sleep(example.CheckInterval(pollInterval))
+		}
+
+		recovery := time.Since(outageStart)
+		perZone, _ := podsPerZone()
+		logger.Info().Msgf("=== Recovered after %v (SLA %v), minimum %d ready, pods per zone: %v ===",
+			recovery.Round(time.Second), sla, minObservedReady, perZone)
+		example.RecordMetric(testTag, "zone_recovery_seconds", recovery.Seconds())
+		example.RecordMetric(testTag, "min_ready_during_outage", minObservedReady)
+
+		distribution := expectSpread(perZone, zonesExcept(outageZone))
+		example.RecordMetric(testTag, "distribution_after_recovery", distribution)
+	})
+
+	ginkgo.It("should make the zone schedulable again when it is restored", func() {
+		defer example.E2ePanicHandler()
+
+		logger.Info().Msgf("=== Restoring zone %s ===", outageZone)
+		for _, node := range cordonedNodes {
+			err := example.UncordonNode(context.TODO(), clientset, node)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+			restored, err := clientset.CoreV1().Nodes().Get(context.TODO(), node, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			gomega.Expect(restored.Spec.Unschedulable).To(gomega.BeFalse(), "Node %s is still cordoned", node)
+		}
+		cordonedNodes = nil
+
+		// Running pods are not rebalanced into the restored zone, the workload must just stay available
+		_, ready := podsPerZone()
+		gomega.Expect(ready).To(gomega.Equal(replicas))
+	})
+
+})
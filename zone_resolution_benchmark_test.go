@@ -0,0 +1,120 @@
+package example_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	"example"
+)
+
+var _ = ginkgo.Describe("Zone resolution benchmark E2E test", ginkgo.Ordered, ginkgo.Label("benchmark"), example.SuiteConcurrency("ZoneResolutionBenchmarkTest"), func() {
+	var (
+		clientset *kubernetes.Clientset
+		pods      int
+		logger    zerolog.Logger
+		testTag   = "ZoneResolutionBenchmarkTest"
+	)
+
+	const (
+		// Overridable with ZONE_BENCH_PODS in .env
+		defaultPods = 30
+		selector    = "app=zone-bench"
+	)
+
+	ginkgo.BeforeAll(func() {
+
+		var err error
+		clientset, err = example.GetClient()
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		logger = example.GetLogger(testTag)
+		pods = defaultPods
+		if value := os.Getenv("ZONE_BENCH_PODS"); value != "" {
+			pods, err = strconv.Atoi(value)
+			gomega.Expect(err).NotTo(gomega.HaveOccurred(), "Invalid ZONE_BENCH_PODS: %s", value)
+			gomega.Expect(pods).To(gomega.BeNumerically(">", 0), "Invalid ZONE_BENCH_PODS: %s", value)
+		}
+	})
+
+	ginkgo.AfterEach(func() {
+		clientset.CoreV1().RESTClient().(*rest.RESTClient).Client.CloseIdleConnections()
+		if ginkgo.CurrentSpecReport().Failed() {
+			logger.Error().Msgf("%s:TEST_FAILED", testTag)
+		}
+
+	})
+
+	ginkgo.AfterAll(func() {
+		example.ClearNamespace(logger, clientset)
+	})
+
+	ginkgo.It("should create the pods to resolve", func() {
+		logger.Info().Msgf("=== Starting Zone resolution benchmark E2E test ===")
+		logger.Info().Msgf("=== tag: %s, allowed to fail: %t", testTag, example.IsTestAllowedToFail(testTag))
+		defer example.E2ePanicHandler()
+
+		deployment, _ := example.NewDeployment("zone-bench").WithReplicas(int32(pods)).Build()
+		logger.Info().Msgf("=== Creating %d pods ===", pods)
+		_, err := clientset.AppsV1().Deployments(example.TestNamespace()).Create(context.TODO(), deployment, metav1.CreateOptions{})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+
+		err = example.WaitForDeploymentReady(context.TODO(), clientset, example.TestNamespace(), "zone-bench", 5*time.Minute)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+	})
+
+	ginkgo.It("should resolve the pods' zones with one node list instead of a node get per pod", func() {
+		defer example.E2ePanicHandler()
+
+		scheduled, err := example.ListPods(context.TODO(), clientset, example.TestNamespace(), metav1.ListOptions{LabelSelector: selector})
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		gomega.Expect(scheduled).To(gomega.HaveLen(pods))
+
+		// The way the zone checks used to resolve zones: a GET of every pod's node
+		tracker := example.TrackAPICalls()
+		start := time.Now()
+		perPod := map[string]string{}
+		for _, pod := range scheduled {
+			node, err := clientset.CoreV1().Nodes().Get(context.TODO(), pod.Spec.NodeName, metav1.GetOptions{})
+			gomega.Expect(err).NotTo(gomega.HaveOccurred())
+			perPod[pod.Name] = node.Labels[v1.LabelTopologyZone]
+		}
+		perPodDuration := time.Since(start)
+		perPodCalls := tracker.Calls()["get nodes"]
+
+		// ZoneMap lists the nodes once
+		tracker = example.TrackAPICalls()
+		start = time.Now()
+		zoneMap, err := example.NewZoneMap(context.TODO(), clientset)
+		gomega.Expect(err).NotTo(gomega.HaveOccurred())
+		fromMap := map[string]string{}
+		for _, pod := range scheduled {
+			fromMap[pod.Name] = zoneMap.ZoneOf(pod)
+		}
+		zoneMapDuration := time.Since(start)
+		zoneMapCalls := tracker.Calls()["list nodes"]
+
+		logger.Info().Msgf("=== %d pods: %d node gets in %v, %d node list in %v ===",
+			pods, perPodCalls, perPodDuration.Round(time.Millisecond), zoneMapCalls, zoneMapDuration.Round(time.Millisecond))
+		example.RecordMetric(testTag, fmt.Sprintf("per_pod_%d_api_calls", pods), perPodCalls)
+		example.RecordMetric(testTag, fmt.Sprintf("per_pod_%d_ms", pods), perPodDuration.Milliseconds())
+		example.RecordMetric(testTag, fmt.Sprintf("zone_map_%d_api_calls", pods), zoneMapCalls)
+		example.RecordMetric(testTag, fmt.Sprintf("zone_map_%d_ms", pods), zoneMapDuration.Milliseconds())
+
+		gomega.Expect(fromMap).To(gomega.Equal(perPod), "The ZoneMap resolved other zones than the nodes have")
+		gomega.Expect(perPodCalls).To(gomega.Equal(pods))
+		gomega.Expect(zoneMapCalls).To(gomega.Equal(1), "The ZoneMap made more than one node list")
+		// Durations depend on the network and the API server's load, they are recorded but not asserted
+	})
+
+})